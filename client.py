@@ -37,10 +37,12 @@ class OllamaClient:
         
         print(f"🚀 Initialized BitTorrent client")
     
-    def get_available_models(self, server_url):
-        """Get list of available models from server"""
+    def get_available_models(self, server_url, group=None):
+        """Get list of available models from server, optionally only those
+        in a group"""
         try:
-            response = requests.get(f"{server_url}/api/models")
+            params = {'group': group} if group else None
+            response = requests.get(f"{server_url}/api/models", params=params)
             response.raise_for_status()
             return response.json()
         except Exception as e:
@@ -161,9 +163,72 @@ class OllamaClient:
             print(f"❌ Error downloading from torrent: {e}")
             return False
     
-    def list_models(self, server_url):
+    def seed_directory(self, directory, save_path=None):
+        """Seed every model whose .torrent was saved in a directory, fetching
+        whatever is still missing into save_path (default: the same directory)"""
+        save_path = save_path or directory
+        torrents = sorted(f for f in os.listdir(directory) if f.endswith('.torrent'))
+        if not torrents:
+            print(f"❌ No .torrent files found in {directory}")
+            return False
+        
+        handles = []
+        for name in torrents:
+            try:
+                info = lt.torrent_info(os.path.join(directory, name))
+            except Exception as e:
+                print(f"⚠️  Skipping {name}: {e}")
+                continue
+            # libtorrent checks the files already on disk and seeds what's complete
+            handles.append(self.session.add_torrent({'ti': info, 'save_path': save_path}))
+            print(f"🌱 Seeding {name}")
+        
+        if not handles:
+            return False
+        
+        # Log a status line now and then rather than a live one, since this
+        # usually runs as a background service
+        try:
+            while True:
+                time.sleep(60)
+                status = [h.status() for h in handles]
+                download_rate = sum(st.download_rate for st in status)
+                upload_rate = sum(st.upload_rate for st in status)
+                peers = sum(st.num_peers for st in status)
+                seeding = sum(1 for h in handles if h.is_seed())
+                print(f"🌱 Seeding {seeding}/{len(handles)} torrents | "
+                      f"Download: {download_rate/1024:.1f} KB/s | "
+                      f"Upload: {upload_rate/1024:.1f} KB/s | Peers: {peers}", flush=True)
+        except KeyboardInterrupt:
+            print("\n🛑 Stopping seeder...")
+        return True
+    
+    def sync(self, server_url, output_dir, model_names=None, group=None):
+        """Download models from the server (all of them, or all of a group,
+        by default) into output_dir and keep seeding them"""
+        models = self.get_available_models(server_url, group)
+        if model_names:
+            found = {m['name'] for m in models}
+            for name in model_names:
+                if name not in found:
+                    print(f"⚠️  Model not found on server: {name}")
+            models = [m for m in models if m['name'] in model_names]
+        models = [m for m in models if not m.get('incomplete')]
+        if not models:
+            print("❌ No models to sync")
+            return False
+        
+        # The torrents keep their own directory, next to the models/ tree
+        # they download into
+        torrent_dir = os.path.join(output_dir, 'torrents')
+        os.makedirs(torrent_dir, exist_ok=True)
+        for model in models:
+            self.download_torrent_file(server_url, model['name'], torrent_dir)
+        return self.seed_directory(torrent_dir, output_dir)
+    
+    def list_models(self, server_url, group=None):
         """List available models on server"""
-        models = self.get_available_models(server_url)
+        models = self.get_available_models(server_url, group)
         
         if not models:
             print("❌ No models found on server")
@@ -196,6 +261,15 @@ Examples:
   
   # Download with custom tracker
   python3 client.py --file model.torrent --output ./downloads --tracker http://192.168.1.100:8081
+  
+  # Keep seeding every model downloaded to a directory
+  python3 client.py --seed ~/.ollama/models
+  
+  # Download every model into ~/.ollama/models and keep them seeded
+  python3 client.py --server http://192.168.1.100:8080 --sync --output ~/.ollama
+  
+  # Only sync the models assigned to a class
+  python3 client.py --server http://192.168.1.100:8080 --sync --group workshop-2025 --output ~/.ollama
         """
     )
     
@@ -212,6 +286,12 @@ Examples:
                        help="Specific model to download from server")
     parser.add_argument("--list", action="store_true", 
                        help="List available models on server")
+    parser.add_argument("--seed", metavar="DIR",
+                       help="Seed the models whose .torrent files are in DIR until stopped")
+    parser.add_argument("--sync", nargs="*", metavar="MODEL",
+                       help="Download the given models (default: all) and keep seeding them")
+    parser.add_argument("--group",
+                       help="Only list or sync the models in this group")
     
     args = parser.parse_args()
     
@@ -223,8 +303,8 @@ Examples:
         args.tracker = "http://localhost:8081"
     
     # Validate arguments
-    if not any([args.file, args.list, args.model]):
-        parser.error("Please specify an action: --file, --list, or --model")
+    if not any([args.file, args.list, args.model, args.seed, args.sync is not None]):
+        parser.error("Please specify an action: --file, --list, --model, --seed, or --sync")
     
     if args.model and not args.server:
         parser.error("--server is required with --model")
@@ -232,6 +312,9 @@ Examples:
     if args.list and not args.server:
         parser.error("--server is required with --list")
     
+    if args.sync is not None and not args.server:
+        parser.error("--server is required with --sync")
+    
     # Create output directory
     os.makedirs(args.output, exist_ok=True)
     
@@ -239,7 +322,13 @@ Examples:
         client = OllamaClient(args.tracker)
         
         if args.list:
-            client.list_models(args.server)
+            client.list_models(args.server, args.group)
+        elif args.seed:
+            if not client.seed_directory(args.seed):
+                sys.exit(1)
+        elif args.sync is not None:
+            if not client.sync(args.server, args.output, args.sync, args.group):
+                sys.exit(1)
         elif args.file:
             client.download_from_torrent(args.file, args.output)
         elif args.model:
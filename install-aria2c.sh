@@ -0,0 +1,280 @@
+#!/bin/bash
+# Ollama BitTorrent Lancache Installer for Linux/macOS (aria2c)
+# Served by {{.ServerURL}} (tracker: {{.TrackerURL}})
+#
+# Downloads models with aria2c instead of the Python libtorrent client, for
+# machines where installing libtorrent is painful. aria2c fetches the
+# .torrent over HTTP and then the model over BitTorrent, using the server's
+# web seeds too when the torrent lists them.
+
+set -e
+
+# Default values
+MODEL=""
+SERVER_URL=""
+TEST_MODE=false
+SHOW_MODELS=false
+SEED_MODE=false
+{{- with .Model}}
+
+# Pre-configured for {{.Name}}: with no --model, this script downloads it
+# straight from its torrent and checks every blob against the manifest.
+MODEL="{{.Name}}"
+PINNED_MODEL="{{.Name}}"
+TORRENT_URL="{{.TorrentURL}}"
+MANIFEST_PATH="{{.ManifestPath}}"
+BLOB_DIR="{{.BlobDir}}"
+EXPECTED_DIGESTS="{{range $i, $digest := .Digests}}{{if $i}} {{end}}{{$digest}}{{end}}"
+{{- else}}
+PINNED_MODEL=""
+{{- end}}
+
+# Colors for output
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+YELLOW='\033[1;33m'
+CYAN='\033[0;36m'
+WHITE='\033[1;37m'
+NC='\033[0m' # No Color
+
+# Function to print colored output
+print_status() {
+    echo -e "${GREEN}🚀 $1${NC}"
+}
+
+print_info() {
+    echo -e "${CYAN}$1${NC}"
+}
+
+print_warning() {
+    echo -e "${YELLOW}$1${NC}"
+}
+
+print_error() {
+    echo -e "${RED}❌ $1${NC}"
+}
+
+print_success() {
+    echo -e "${GREEN}✅ $1${NC}"
+}
+
+# Function to show usage
+show_usage() {
+    echo "Usage: $0 [OPTIONS]"
+    echo
+    echo "Options:"
+    echo "  --model MODEL     Download specific model (e.g., granite3.3:8b)"
+    echo "  --server URL      Server URL (default: {{.ServerURL}})"
+    echo "  --test            Download to current directory instead of ~/.ollama"
+    echo "  --seed            Keep seeding after the download until interrupted"
+    echo "  --list            List available models from server"
+    echo "  -h, --help        Show this help message"
+    echo
+    echo "One-liner examples:"
+    echo "  curl -sSL \"{{.ServerURL}}/install.sh?client=aria2c\" | bash -s -- --model granite3.3:8b"
+    echo "  curl -sSL \"{{.ServerURL}}/install.sh?client=aria2c&model=granite3.3:8b\" | bash"
+}
+
+# Function to parse command line arguments
+parse_args() {
+    while [[ $# -gt 0 ]]; do
+        case $1 in
+            --model)
+                MODEL="$2"
+                shift 2
+                ;;
+            --server)
+                SERVER_URL="$2"
+                shift 2
+                ;;
+            --test)
+                TEST_MODE=true
+                shift
+                ;;
+            --seed)
+                SEED_MODE=true
+                shift
+                ;;
+            --list)
+                SHOW_MODELS=true
+                shift
+                ;;
+            -h|--help)
+                show_usage
+                exit 0
+                ;;
+            *)
+                print_error "Unknown option: $1"
+                show_usage
+                exit 1
+                ;;
+        esac
+    done
+
+    # Set defaults if not provided
+    if [ -z "$SERVER_URL" ]; then
+        SERVER_URL="{{.ServerURL}}"
+    fi
+}
+
+# Function to check if command exists
+command_exists() {
+    command -v "$1" >/dev/null 2>&1
+}
+
+# Function to install aria2c and curl with whatever package manager is around
+install_aria2() {
+    if command_exists aria2c && command_exists curl; then
+        return
+    fi
+
+    print_info "Installing aria2..."
+    if command_exists apt-get; then
+        sudo apt-get update
+        sudo apt-get install -y aria2 curl
+    elif command_exists dnf; then
+        sudo dnf install -y aria2 curl
+    elif command_exists yum; then
+        sudo yum install -y aria2 curl
+    elif command_exists pacman; then
+        sudo pacman -S --noconfirm aria2 curl
+    elif command_exists apk; then
+        sudo apk add aria2 curl
+    elif command_exists brew; then
+        brew install aria2 curl
+    fi
+
+    if ! command_exists aria2c; then
+        print_error "aria2c is not installed and couldn't be installed automatically"
+        print_info "Install aria2 with your package manager and run this script again"
+        exit 1
+    fi
+}
+
+# Function to list available models
+list_models() {
+    print_info "Fetching available models from $SERVER_URL..."
+
+    MODELS_JSON=$(curl -s "$SERVER_URL/api/models" 2>/dev/null)
+    if [ -z "$MODELS_JSON" ]; then
+        print_error "Failed to fetch models from server: $SERVER_URL"
+        print_info "Make sure the server is running and accessible"
+        exit 1
+    fi
+
+    # No Python here, so just pick the names out of the JSON
+    echo
+    print_success "Available Models:"
+    echo "----------------------------------------"
+    echo "$MODELS_JSON" | grep -o '"name":"[^"]*"' | cut -d'"' -f4 | sed 's/^/📁 /'
+    echo "----------------------------------------"
+    echo
+    print_info "To download a model, use:"
+    print_info "  curl -sSL \"$SERVER_URL/install.sh?client=aria2c\" | bash -s -- --model <model-name>"
+}
+
+# Function to print the SHA-256 of a file
+sha256_of() {
+    if command_exists sha256sum; then
+        sha256sum "$1" | cut -d' ' -f1
+    else
+        shasum -a 256 "$1" | cut -d' ' -f1
+    fi
+}
+
+# Function to check a pinned model's files against its manifest
+verify_model() {
+    print_info "Verifying $MODEL..."
+    if [ ! -f "$OUTPUT_DIR/$MANIFEST_PATH" ]; then
+        print_error "Manifest missing: $OUTPUT_DIR/$MANIFEST_PATH"
+        exit 1
+    fi
+    for digest in $EXPECTED_DIGESTS; do
+        blob="$OUTPUT_DIR/$BLOB_DIR/sha256-${digest#sha256:}"
+        if [ ! -f "$blob" ]; then
+            print_error "Blob missing: $blob"
+            exit 1
+        fi
+        if [ "$(sha256_of "$blob")" != "${digest#sha256:}" ]; then
+            print_error "Blob does not match its digest: $blob"
+            exit 1
+        fi
+    done
+    print_success "All blobs match the manifest"
+}
+
+# Function to download model
+download_model() {
+    # Model torrents keep everything under a top-level models/ directory, so
+    # downloading into ~/.ollama puts the files where Ollama expects them
+    if [ "$TEST_MODE" = true ]; then
+        OUTPUT_DIR="$(pwd)/downloads"
+        print_info "Test mode: downloading to $OUTPUT_DIR"
+    else
+        OUTPUT_DIR="$HOME/.ollama"
+        print_info "Downloading to Ollama directory: $OUTPUT_DIR/models"
+    fi
+    mkdir -p "$OUTPUT_DIR"
+
+    if [ -n "$PINNED_MODEL" ] && [ "$MODEL" = "$PINNED_MODEL" ]; then
+        SOURCE_URL="$TORRENT_URL"
+    else
+        SOURCE_URL="$SERVER_URL/api/models/$MODEL/torrent"
+    fi
+
+    # Private lancache torrents: no DHT, but local peer discovery is fine.
+    # aria2c seeds forever with a seed ratio of 0, or not at all with a seed
+    # time of 0.
+    if [ "$SEED_MODE" = true ]; then
+        SEED_OPTS="--seed-ratio=0.0"
+        print_info "Seeding after the download; press Ctrl+C to stop"
+    else
+        SEED_OPTS="--seed-time=0"
+    fi
+
+    print_status "Starting model download..."
+    print_info "Model: $MODEL"
+    print_info "Torrent: $SOURCE_URL"
+
+    if ! aria2c --dir="$OUTPUT_DIR" --follow-torrent=mem --enable-dht=false \
+        --bt-enable-lpd=true --check-integrity=true --summary-interval=10 \
+        $SEED_OPTS "$SOURCE_URL"; then
+        print_error "Model download failed"
+        exit 1
+    fi
+
+    if [ -n "$PINNED_MODEL" ] && [ "$MODEL" = "$PINNED_MODEL" ]; then
+        verify_model
+    fi
+
+    print_success "Model download complete!"
+    if [ "$TEST_MODE" = false ]; then
+        echo
+        print_info "📋 Next steps:"
+        echo -e "${WHITE}1. Install Ollama from https://ollama.ai if not already installed${NC}"
+        echo -e "${WHITE}2. Use 'ollama run $MODEL' to start using your model${NC}"
+    fi
+}
+
+# Main function
+main() {
+    parse_args "$@"
+
+    if [ "$SHOW_MODELS" = true ]; then
+        list_models
+        exit 0
+    fi
+
+    # If no model specified, show available models
+    if [ -z "$MODEL" ]; then
+        print_warning "No model specified. Showing available models..."
+        list_models
+        exit 0
+    fi
+
+    install_aria2
+    download_model
+}
+
+# Run main function
+main "$@"
@@ -0,0 +1,326 @@
+#!/bin/bash
+# Ollama BitTorrent Lancache Installer for NAS and minimal Linux (Transmission)
+# Served by {{.ServerURL}} (tracker: {{.TrackerURL}})
+#
+# Downloads models with the Transmission already on the machine instead of
+# the Python libtorrent client. A running transmission-daemon is used through
+# transmission-remote, so the model keeps seeding from the daemon afterwards;
+# otherwise transmission-cli downloads it in the foreground.
+
+set -e
+
+# Default values
+MODEL=""
+SERVER_URL=""
+TEST_MODE=false
+SHOW_MODELS=false
+SEED_MODE=false
+OUTPUT_DIR=""
+RPC="localhost:9091"
+RPC_AUTH=""
+{{- with .Model}}
+
+# Pre-configured for {{.Name}}: with no --model, this script downloads it
+# straight from its torrent and checks every blob against the manifest.
+MODEL="{{.Name}}"
+PINNED_MODEL="{{.Name}}"
+TORRENT_URL="{{.TorrentURL}}"
+INFO_HASH="{{.InfoHash}}"
+MANIFEST_PATH="{{.ManifestPath}}"
+BLOB_DIR="{{.BlobDir}}"
+EXPECTED_DIGESTS="{{range $i, $digest := .Digests}}{{if $i}} {{end}}{{$digest}}{{end}}"
+{{- else}}
+PINNED_MODEL=""
+{{- end}}
+
+# Colors for output
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+YELLOW='\033[1;33m'
+CYAN='\033[0;36m'
+WHITE='\033[1;37m'
+NC='\033[0m' # No Color
+
+# Function to print colored output
+print_status() {
+    echo -e "${GREEN}🚀 $1${NC}"
+}
+
+print_info() {
+    echo -e "${CYAN}$1${NC}"
+}
+
+print_warning() {
+    echo -e "${YELLOW}$1${NC}"
+}
+
+print_error() {
+    echo -e "${RED}❌ $1${NC}"
+}
+
+print_success() {
+    echo -e "${GREEN}✅ $1${NC}"
+}
+
+# Function to show usage
+show_usage() {
+    echo "Usage: $0 [OPTIONS]"
+    echo
+    echo "Options:"
+    echo "  --model MODEL     Download specific model (e.g., granite3.3:8b)"
+    echo "  --server URL      Server URL (default: {{.ServerURL}})"
+    echo "  --dir DIR         Ollama directory to download into (default: ~/.ollama);"
+    echo "                    with a remote daemon, a path on the daemon's machine"
+    echo "  --rpc HOST:PORT   transmission-daemon RPC address (default: localhost:9091)"
+    echo "  --auth USER:PASS  transmission-daemon RPC credentials"
+    echo "  --seed            With transmission-cli, keep seeding until interrupted"
+    echo "  --list            List available models from server"
+    echo "  -h, --help        Show this help message"
+    echo
+    echo "One-liner examples:"
+    echo "  curl -sSL \"{{.ServerURL}}/install.sh?client=transmission\" | bash -s -- --model granite3.3:8b"
+    echo "  curl -sSL \"{{.ServerURL}}/install.sh?client=transmission\" | bash -s -- --model granite3.3:8b --dir /volume1/ollama"
+}
+
+# Function to parse command line arguments
+parse_args() {
+    while [[ $# -gt 0 ]]; do
+        case $1 in
+            --model)
+                MODEL="$2"
+                shift 2
+                ;;
+            --server)
+                SERVER_URL="$2"
+                shift 2
+                ;;
+            --dir)
+                OUTPUT_DIR="$2"
+                shift 2
+                ;;
+            --rpc)
+                RPC="$2"
+                shift 2
+                ;;
+            --auth)
+                RPC_AUTH="$2"
+                shift 2
+                ;;
+            --seed)
+                SEED_MODE=true
+                shift
+                ;;
+            --list)
+                SHOW_MODELS=true
+                shift
+                ;;
+            -h|--help)
+                show_usage
+                exit 0
+                ;;
+            *)
+                print_error "Unknown option: $1"
+                show_usage
+                exit 1
+                ;;
+        esac
+    done
+
+    # Set defaults if not provided
+    if [ -z "$SERVER_URL" ]; then
+        SERVER_URL="{{.ServerURL}}"
+    fi
+    if [ -z "$OUTPUT_DIR" ]; then
+        OUTPUT_DIR="$HOME/.ollama"
+    fi
+}
+
+# Function to check if command exists
+command_exists() {
+    command -v "$1" >/dev/null 2>&1
+}
+
+# Function to run transmission-remote against the configured daemon
+remote() {
+    if [ -n "$RPC_AUTH" ]; then
+        transmission-remote "$RPC" --auth "$RPC_AUTH" "$@"
+    else
+        transmission-remote "$RPC" "$@"
+    fi
+}
+
+# Function to list available models
+list_models() {
+    print_info "Fetching available models from $SERVER_URL..."
+
+    MODELS_JSON=$(curl -s "$SERVER_URL/api/models" 2>/dev/null)
+    if [ -z "$MODELS_JSON" ]; then
+        print_error "Failed to fetch models from server: $SERVER_URL"
+        print_info "Make sure the server is running and accessible"
+        exit 1
+    fi
+
+    # No Python here, so just pick the names out of the JSON
+    echo
+    print_success "Available Models:"
+    echo "----------------------------------------"
+    echo "$MODELS_JSON" | grep -o '"name":"[^"]*"' | cut -d'"' -f4 | sed 's/^/📁 /'
+    echo "----------------------------------------"
+    echo
+    print_info "To download a model, use:"
+    print_info "  curl -sSL \"$SERVER_URL/install.sh?client=transmission\" | bash -s -- --model <model-name>"
+}
+
+# Function to look up a model's info-hash in the server's catalog
+lookup_info_hash() {
+    curl -s "$SERVER_URL/api/models" | grep -o "{[^{}]*\"name\":\"$MODEL\"[^{}]*}" |
+        grep -o '"info_hash":"[^"]*"' | cut -d'"' -f4
+}
+
+# Function to print the SHA-256 of a file
+sha256_of() {
+    if command_exists sha256sum; then
+        sha256sum "$1" | cut -d' ' -f1
+    else
+        shasum -a 256 "$1" | cut -d' ' -f1
+    fi
+}
+
+# Function to check a pinned model's files against its manifest
+verify_model() {
+    print_info "Verifying $MODEL..."
+    if [ ! -f "$OUTPUT_DIR/$MANIFEST_PATH" ]; then
+        print_error "Manifest missing: $OUTPUT_DIR/$MANIFEST_PATH"
+        exit 1
+    fi
+    for digest in $EXPECTED_DIGESTS; do
+        blob="$OUTPUT_DIR/$BLOB_DIR/sha256-${digest#sha256:}"
+        if [ ! -f "$blob" ]; then
+            print_error "Blob missing: $blob"
+            exit 1
+        fi
+        if [ "$(sha256_of "$blob")" != "${digest#sha256:}" ]; then
+            print_error "Blob does not match its digest: $blob"
+            exit 1
+        fi
+    done
+    print_success "All blobs match the manifest"
+}
+
+# Function to download through a running transmission-daemon, which keeps
+# seeding the model once it's complete
+download_with_daemon() {
+    if [ -z "$INFO_HASH" ]; then
+        INFO_HASH=$(lookup_info_hash)
+    fi
+    if [ -z "$INFO_HASH" ]; then
+        print_error "Model not found on server: $MODEL"
+        exit 1
+    fi
+
+    print_info "Adding torrent to transmission-daemon at $RPC..."
+    if ! remote --add "$SOURCE_URL" --download-dir "$OUTPUT_DIR"; then
+        print_error "transmission-daemon refused the torrent"
+        exit 1
+    fi
+
+    # transmission-remote has no way to wait, so poll until it's done
+    while true; do
+        DONE=$(remote --torrent "$INFO_HASH" --info | grep "Percent Done:" | awk '{print $3}')
+        print_info "Progress: ${DONE:-0%}"
+        if [ "$DONE" = "100%" ]; then
+            break
+        fi
+        sleep 10
+    done
+    print_info "transmission-daemon keeps seeding $MODEL; remove it there to stop"
+
+    # A remote daemon's files can't be checked from here
+    case "$RPC" in
+        localhost*|127.0.0.1*) ;;
+        *) PINNED_MODEL="" ;;
+    esac
+}
+
+# Function to download in the foreground with transmission-cli
+download_with_cli() {
+    # transmission-cli seeds until interrupted once it's done. Unless asked to
+    # seed, a finish script stops it as soon as the download completes.
+    CLI_OPTS=()
+    if [ "$SEED_MODE" = true ]; then
+        print_info "Seeding after the download; press Ctrl+C to stop"
+    else
+        FINISH_SCRIPT=$(mktemp)
+        printf '#!/bin/sh\nkill -INT $PPID\n' > "$FINISH_SCRIPT"
+        chmod +x "$FINISH_SCRIPT"
+        CLI_OPTS=(--finish "$FINISH_SCRIPT")
+    fi
+
+    TORRENT_PATH=$(mktemp)
+    if ! curl -sSL "$SOURCE_URL" -o "$TORRENT_PATH"; then
+        print_error "Failed to download torrent: $SOURCE_URL"
+        exit 1
+    fi
+    transmission-cli --download-dir "$OUTPUT_DIR" "${CLI_OPTS[@]}" "$TORRENT_PATH" || true
+    rm -f "$TORRENT_PATH" "$FINISH_SCRIPT"
+}
+
+# Function to download model
+download_model() {
+    # Model torrents keep everything under a top-level models/ directory, so
+    # downloading into ~/.ollama puts the files where Ollama expects them
+    print_info "Downloading to Ollama directory: $OUTPUT_DIR/models"
+
+    if [ -n "$PINNED_MODEL" ] && [ "$MODEL" = "$PINNED_MODEL" ]; then
+        SOURCE_URL="$TORRENT_URL"
+    else
+        SOURCE_URL="$SERVER_URL/api/models/$MODEL/torrent"
+    fi
+
+    print_status "Starting model download..."
+    print_info "Model: $MODEL"
+    print_info "Torrent: $SOURCE_URL"
+
+    if command_exists transmission-remote && remote --list >/dev/null 2>&1; then
+        download_with_daemon
+    elif command_exists transmission-cli; then
+        mkdir -p "$OUTPUT_DIR"
+        download_with_cli
+    else
+        print_error "Neither a transmission-daemon at $RPC nor transmission-cli was found"
+        print_info "Install Transmission, or use --rpc and --auth to reach your daemon"
+        exit 1
+    fi
+
+    if [ -n "$PINNED_MODEL" ] && [ "$MODEL" = "$PINNED_MODEL" ]; then
+        verify_model
+    fi
+
+    print_success "Model download complete!"
+    echo
+    print_info "📋 Next steps:"
+    echo -e "${WHITE}1. Point Ollama at $OUTPUT_DIR/models (OLLAMA_MODELS) if that's not its default${NC}"
+    echo -e "${WHITE}2. Use 'ollama run $MODEL' to start using your model${NC}"
+}
+
+# Main function
+main() {
+    parse_args "$@"
+
+    if [ "$SHOW_MODELS" = true ]; then
+        list_models
+        exit 0
+    fi
+
+    # If no model specified, show available models
+    if [ -z "$MODEL" ]; then
+        print_warning "No model specified. Showing available models..."
+        list_models
+        exit 0
+    fi
+
+    download_model
+}
+
+# Run main function
+main "$@"
@@ -1,17 +1,31 @@
 # Ollama BitTorrent Lancache Installer for Windows
+# Served by {{.ServerURL}} (tracker: {{.TrackerURL}})
 # Run this script as Administrator
 #
 # IMPORTANT: Before running this script, you must set the execution policy:
 # Set-ExecutionPolicy -ExecutionPolicy RemoteSigned -Scope CurrentUser
 
 param(
-    [string]$Model = "",
-    [string]$Server = "http://localhost:8080",
+    [string]$Model = "{{with .Model}}{{.Name}}{{end}}",
+    [string]$Group = "{{.Group}}",
+    [string]$Server = "{{.ServerURL}}",
     [switch]$Test,
     [switch]$Clean,
-    [switch]$List
+    [switch]$List,
+    [switch]$Seeder,
+    [switch]$Http
 )
-
+{{with .Model}}
+# Pre-configured for {{.Name}}: with no -Model, this script downloads it
+# straight from its torrent and checks every blob against the manifest.
+$PinnedModel = "{{.Name}}"
+$TorrentUrl = "{{.TorrentURL}}"
+$ManifestPath = "{{.ManifestPath}}"
+$BlobDir = "{{.BlobDir}}"
+$ExpectedDigests = @({{range $i, $digest := .Digests}}{{if $i}}, {{end}}"{{$digest}}"{{end}})
+{{else}}
+$PinnedModel = ""
+{{end}}
 # Function to show usage
 function Show-Usage {
     Write-Host "Usage: .\install.ps1 [OPTIONS]" -ForegroundColor White
@@ -29,26 +43,33 @@ function Show-Usage {
     Write-Host ""
     Write-Host "Options:" -ForegroundColor White
     Write-Host "  -Model MODEL     Download specific model (e.g., granite3.3:8b)" -ForegroundColor White
-    Write-Host "  -Server URL      Server URL (default: http://localhost:8080)" -ForegroundColor White
+    Write-Host "  -Group GROUP     List, or with no -Model download, only the models in GROUP" -ForegroundColor White
+    Write-Host "  -Server URL      Server URL (default: {{.ServerURL}})" -ForegroundColor White
     Write-Host "  -Test            Download to current directory instead of ~/.ollama/models" -ForegroundColor White
     Write-Host "  -Clean           Remove virtual environment and exit" -ForegroundColor White
     Write-Host "  -List            List available models from server" -ForegroundColor White
+    Write-Host "  -Seeder          Register a Scheduled Task that keeps seeding downloaded models" -ForegroundColor White
+    Write-Host "  -Http            Download over HTTP instead of BitTorrent (also used automatically" -ForegroundColor White
+    Write-Host "                   without Administrator rights, Python or a working libtorrent)" -ForegroundColor White
     Write-Host "  -Help            Show this help message" -ForegroundColor White
     Write-Host ""
     Write-Host "Examples:" -ForegroundColor White
     Write-Host "  .\install.ps1 -List                                    # List available models" -ForegroundColor Cyan
     Write-Host "  .\install.ps1 -Model granite3.3:8b                    # Download specific model" -ForegroundColor Cyan
+    Write-Host "  .\install.ps1 -Group workshop-2025                    # Download every model in a group" -ForegroundColor Cyan
     Write-Host "  .\install.ps1 -Model phi3:mini -Server http://192.168.1.100:8080  # Download from specific server" -ForegroundColor Cyan
     Write-Host "  .\install.ps1 -Test -Model granite3.3:8b             # Download to current directory" -ForegroundColor Cyan
     Write-Host "  .\install.ps1 -Clean                                  # Remove virtual environment" -ForegroundColor Cyan
+    Write-Host "  .\install.ps1 -Seeder                                 # Keep seeding in the background" -ForegroundColor Cyan
     Write-Host ""
     Write-Host "One-liner examples:" -ForegroundColor White
     Write-Host "  # Download and run (recommended):" -ForegroundColor Yellow
-    Write-Host "  Invoke-WebRequest -Uri 'http://192.168.1.100:8080/install.ps1' -OutFile 'install.ps1'; .\install.ps1 -List" -ForegroundColor Cyan
-    Write-Host "  Invoke-WebRequest -Uri 'http://192.168.1.100:8080/install.ps1' -OutFile 'install.ps1'; .\install.ps1 -Model granite3.3:8b" -ForegroundColor Cyan
+    Write-Host "  Invoke-WebRequest -Uri '{{.ServerURL}}/install.ps1' -OutFile 'install.ps1'; .\install.ps1 -List" -ForegroundColor Cyan
+    Write-Host "  Invoke-WebRequest -Uri '{{.ServerURL}}/install.ps1' -OutFile 'install.ps1'; .\install.ps1 -Model granite3.3:8b" -ForegroundColor Cyan
+    Write-Host "  Invoke-WebRequest -Uri '{{.ServerURL}}/install.ps1?model=granite3.3:8b' -OutFile 'install.ps1'; .\install.ps1" -ForegroundColor Cyan
     Write-Host ""
     Write-Host "  # Direct execution (alternative):" -ForegroundColor Yellow
-    Write-Host "  `$script = Invoke-WebRequest -Uri 'http://192.168.1.100:8080/install.ps1' -UseBasicParsing; Invoke-Expression \"`$(`$script.Content) -List\"" -ForegroundColor Cyan
+    Write-Host "  `$script = Invoke-WebRequest -Uri '{{.ServerURL}}/install.ps1' -UseBasicParsing; Invoke-Expression \"`$(`$script.Content) -List\"" -ForegroundColor Cyan
 }
 
 # Function to list available models
@@ -56,7 +77,7 @@ function Get-AvailableModels {
     Write-Host "Fetching available models from $Server..." -ForegroundColor Cyan
     
     try {
-        $response = Invoke-WebRequest -Uri "$Server/api/models" -UseBasicParsing
+        $response = Invoke-WebRequest -Uri "$Server/api/models?group=$Group" -UseBasicParsing
         $models = $response.Content | ConvertFrom-Json
         
         Write-Host ""
@@ -618,6 +639,12 @@ function Get-ModelFallback {
         exit 1
     }
     
+    # Download the files themselves if the server allows it; otherwise all
+    # that can be done is fetch the torrent for another client
+    if (Get-ModelHttp) {
+        return
+    }
+    
     # Determine output directory
     if ($Test) {
         $outputDir = "$(Get-Location)\downloads"
@@ -700,6 +727,105 @@ function Get-ModelFallback {
     }
 }
 
+# Function to download a model straight over HTTP, for machines where the
+# BitTorrent client can't be installed. Every file is checked against its
+# SHA-256 before it's moved into place. Returns $false if the server doesn't
+# offer HTTP downloads.
+function Get-ModelHttp {
+    try {
+        $capabilities = Invoke-RestMethod -Uri "$Server/api/capabilities" -UseBasicParsing
+    } catch {
+        $capabilities = $null
+    }
+    if (-not $capabilities -or -not $capabilities.http_fallback) {
+        Write-Host "[WARNING] This server doesn't offer HTTP downloads" -ForegroundColor Yellow
+        return $false
+    }
+    
+    if ($Test) {
+        $outputDir = "$(Get-Location)\downloads"
+    } else {
+        $outputDir = "$env:USERPROFILE\.ollama\models"
+    }
+    Write-Host "[START] Downloading $Model over HTTP to $outputDir..." -ForegroundColor Green
+    
+    try {
+        $listing = Invoke-RestMethod -Uri "$Server/api/models/$Model/blobs" -UseBasicParsing
+        foreach ($file in $listing.files) {
+            $dest = Join-Path $outputDir ($file.path -replace '/', '\')
+            if ((Test-Path $dest) -and (Get-FileHash -Path $dest -Algorithm SHA256).Hash -eq $file.sha256) {
+                Write-Host "Already have $($file.path)" -ForegroundColor Cyan
+                continue
+            }
+            Write-Host "Downloading $($file.path) ($($file.size) bytes)..." -ForegroundColor Cyan
+            New-Item -ItemType Directory -Path (Split-Path $dest) -Force | Out-Null
+            Invoke-WebRequest -Uri $file.url -OutFile "$dest.partial" -UseBasicParsing
+            if ((Get-FileHash -Path "$dest.partial" -Algorithm SHA256).Hash -ne $file.sha256) {
+                Remove-Item "$dest.partial" -Force
+                throw "$($file.path) does not match its digest"
+            }
+            Move-Item -Path "$dest.partial" -Destination $dest -Force
+        }
+    } catch {
+        Write-Host "[ERROR] HTTP download failed: $($_.Exception.Message)" -ForegroundColor Red
+        exit 1
+    }
+    
+    Write-Host "[OK] Model download complete! All files match their digests" -ForegroundColor Green
+    if (-not $Test) {
+        Write-Host ""
+        Write-Host "[INFO] Next steps:" -ForegroundColor Cyan
+        Write-Host "1. Install Ollama from https://ollama.ai if not already installed" -ForegroundColor White
+        Write-Host "2. Use 'ollama run $Model' to start using your model" -ForegroundColor White
+    }
+    return $true
+}
+
+# Function to check a pinned model's files against its manifest
+function Test-ModelFiles {
+    param([string]$OutputDir)
+
+    Write-Host "Verifying $Model..." -ForegroundColor Cyan
+    $manifest = Join-Path $OutputDir $ManifestPath
+    if (-not (Test-Path $manifest)) {
+        Write-Host "[ERROR] Manifest missing: $manifest" -ForegroundColor Red
+        exit 1
+    }
+    foreach ($digest in $ExpectedDigests) {
+        $hex = $digest -replace '^sha256:', ''
+        $blob = Join-Path (Join-Path $OutputDir $BlobDir) "sha256-$hex"
+        if (-not (Test-Path $blob)) {
+            Write-Host "[ERROR] Blob missing: $blob" -ForegroundColor Red
+            exit 1
+        }
+        if ((Get-FileHash -Path $blob -Algorithm SHA256).Hash -ne $hex) {
+            Write-Host "[ERROR] Blob does not match its digest: $blob" -ForegroundColor Red
+            exit 1
+        }
+    }
+    Write-Host "[OK] All blobs match the manifest" -ForegroundColor Green
+}
+
+# Function to register the background seeding task
+function Register-Seeder {
+    $clientPath = "$env:USERPROFILE\client.py"
+    if (-not (Test-Path $clientPath) -or -not (Test-Path "$env:USERPROFILE\.ollama-bt-venv")) {
+        Write-Host "[ERROR] Client not installed. Download a model with -Model first." -ForegroundColor Red
+        exit 1
+    }
+    
+    try {
+        $task = Invoke-WebRequest -Uri "$Server/ollama-bt-seed.xml" -UseBasicParsing
+        Register-ScheduledTask -TaskName "Ollama BT Seeder" -Xml $task.Content -Force | Out-Null
+        Start-ScheduledTask -TaskName "Ollama BT Seeder"
+    } catch {
+        Write-Host "[ERROR] Failed to register the seeder task: $($_.Exception.Message)" -ForegroundColor Red
+        exit 1
+    }
+    Write-Host "[OK] Seeder task registered and started" -ForegroundColor Green
+    Write-Host "It starts at every logon. Remove it with: Unregister-ScheduledTask -TaskName `"Ollama BT Seeder`"" -ForegroundColor Cyan
+}
+
 # Function to download model
 function Get-Model {
     if ([string]::IsNullOrEmpty($Model)) {
@@ -738,7 +864,13 @@ function Get-Model {
     
     # Download the model
     try {
-        $output = python $clientPath --server $Server --model $Model --output $outputDir 2>&1
+        if ($PinnedModel -and $Model -eq $PinnedModel) {
+            $torrentPath = Join-Path $outputDir "$($Model -replace ':', '_').torrent"
+            Invoke-WebRequest -Uri $TorrentUrl -OutFile $torrentPath -UseBasicParsing
+            $output = python $clientPath --file $torrentPath --output $outputDir 2>&1
+        } else {
+            $output = python $clientPath --server $Server --model $Model --output $outputDir 2>&1
+        }
         if ($LASTEXITCODE -ne 0) {
             # Check for specific error types
             if ($output -match "DLL load failed while importing libtorrent" -or $output -match "ImportError.*libtorrent") {
@@ -805,6 +937,9 @@ function Get-Model {
     }
     
     if ($LASTEXITCODE -eq 0) {
+        if ($PinnedModel -and $Model -eq $PinnedModel) {
+            Test-ModelFiles -OutputDir $outputDir
+        }
         Write-Host "[OK] Model download complete!" -ForegroundColor Green
         Write-Host "Model downloaded to: $outputDir" -ForegroundColor Green
         
@@ -823,12 +958,12 @@ function Get-Model {
 # Main execution
 try {
     # Check if running as Administrator (only for installation, not for listing/cleaning)
-    if (-not $Clean -and -not $List) {
+    # Without it the BitTorrent client can't be installed, so try HTTP instead
+    if (-not $Clean -and -not $List -and -not $Seeder -and -not $Http) {
         if (-NOT ([Security.Principal.WindowsPrincipal] [Security.Principal.WindowsIdentity]::GetCurrent()).IsInRole([Security.Principal.WindowsBuiltInRole] "Administrator")) {
-            Write-Host "[ERROR] This script requires Administrator privileges for installation" -ForegroundColor Red
-            Write-Host "This is needed to install Visual C++ Redistributable and set up the environment." -ForegroundColor Yellow
-            Write-Host "Please run PowerShell as Administrator and try again" -ForegroundColor Yellow
-            exit 1
+            Write-Host "[WARNING] Not running as Administrator, which installing the BitTorrent client needs" -ForegroundColor Yellow
+            Write-Host "Trying a direct HTTP download instead..." -ForegroundColor Yellow
+            $Http = $true
         }
     }
     
@@ -843,6 +978,23 @@ try {
         exit 0
     }
     
+    if ($Seeder) {
+        Register-Seeder
+        exit 0
+    }
+    
+    # A group with no model installs the whole group
+    $Models = @($Model)
+    if ([string]::IsNullOrEmpty($Model) -and -not [string]::IsNullOrEmpty($Group)) {
+        $response = Invoke-WebRequest -Uri "$Server/api/models?group=$Group" -UseBasicParsing
+        $Models = @($response.Content | ConvertFrom-Json | Where-Object { -not $_.incomplete } | ForEach-Object { $_.name })
+        if ($Models.Count -eq 0) {
+            Write-Host "[ERROR] No models in group $Group" -ForegroundColor Red
+            exit 1
+        }
+        $Model = $Models[0]
+    }
+    
     # If no model specified, show available models
     if ([string]::IsNullOrEmpty($Model)) {
         Write-Host "[WARNING] No model specified. Showing available models..." -ForegroundColor Yellow
@@ -850,17 +1002,37 @@ try {
         exit 0
     }
     
+    if (-not $Http -and -not (Get-Command python -ErrorAction SilentlyContinue)) {
+        Write-Host "[WARNING] Python not found, which the BitTorrent client needs" -ForegroundColor Yellow
+        Write-Host "Trying a direct HTTP download instead..." -ForegroundColor Yellow
+        $Http = $true
+    }
+    
+    if ($Http) {
+        $ok = $true
+        foreach ($Model in $Models) {
+            $ok = (Get-ModelHttp) -and $ok
+        }
+        if ($ok) {
+            exit 0
+        }
+        Write-Host "[ERROR] Run PowerShell as Administrator with Python 3.8+ installed to use BitTorrent" -ForegroundColor Red
+        exit 1
+    }
+    
     # Setup environment and download model
     Write-Host "[START] Installing Ollama BitTorrent Lancache..." -ForegroundColor Green
     Write-Host "Server: $Server" -ForegroundColor Cyan
-    Write-Host "Model: $Model" -ForegroundColor Cyan
+    Write-Host "Model: $($Models -join ', ')" -ForegroundColor Cyan
     
     # Check and install Visual C++ Redistributable (required for libtorrent)
     Install-VisualCppRedistributable
     
     Initialize-VirtualEnvironment
     Get-ClientScript
-    Get-Model
+    foreach ($Model in $Models) {
+        Get-Model
+    }
     
 } catch {
     Write-Host "[ERROR] An error occurred: $($_.Exception.Message)" -ForegroundColor Red
@@ -1,14 +1,31 @@
 #!/bin/bash
 # Ollama BitTorrent Lancache Installer for Linux/macOS
+# Served by {{.ServerURL}} (tracker: {{.TrackerURL}})
 
 set -e
 
 # Default values
 MODEL=""
+GROUP="{{.Group}}"
 SERVER_URL=""
 TEST_MODE=false
 CLEAN_MODE=false
 SHOW_MODELS=false
+SEEDER_MODE=false
+HTTP_MODE=false
+{{- with .Model}}
+
+# Pre-configured for {{.Name}}: with no --model, this script downloads it
+# straight from its torrent and checks every blob against the manifest.
+MODEL="{{.Name}}"
+PINNED_MODEL="{{.Name}}"
+TORRENT_URL="{{.TorrentURL}}"
+MANIFEST_PATH="{{.ManifestPath}}"
+BLOB_DIR="{{.BlobDir}}"
+EXPECTED_DIGESTS="{{range $i, $digest := .Digests}}{{if $i}} {{end}}{{$digest}}{{end}}"
+{{- else}}
+PINNED_MODEL=""
+{{- end}}
 
 # Colors for output
 RED='\033[0;31m'
@@ -45,22 +62,30 @@ show_usage() {
     echo
     echo "Options:"
     echo "  --model MODEL     Download specific model (e.g., granite3.3:8b)"
-    echo "  --server URL      Server URL (default: http://localhost:8080)"
+    echo "  --group GROUP     List, or with no --model download, only the models in GROUP"
+    echo "  --server URL      Server URL (default: {{.ServerURL}})"
     echo "  --test            Download to current directory instead of ~/.ollama/models"
     echo "  --clean           Remove virtual environment and exit"
     echo "  --list            List available models from server"
+    echo "  --seeder          Install a systemd user service that keeps seeding downloaded models"
+    echo "  --http            Download over HTTP instead of BitTorrent (also used automatically"
+    echo "                    when the BitTorrent client can't be installed)"
     echo "  -h, --help        Show this help message"
     echo
     echo "Examples:"
     echo "  $0 --list                                    # List available models"
     echo "  $0 --model granite3.3:8b                    # Download specific model"
+    echo "  $0 --group workshop-2025                     # Download every model in a group"
     echo "  $0 --model phi3:mini --server http://192.168.1.100:8080  # Download from specific server"
     echo "  $0 --test --model granite3.3:8b             # Download to current directory"
     echo "  $0 --clean                                   # Remove virtual environment"
+    echo "  $0 --seeder                                  # Keep seeding in the background"
     echo
     echo "One-liner examples:"
-    echo "  curl -sSL \"http://192.168.1.100:8080/install.sh\" | bash -s -- --model granite3.3:8b"
-    echo "  curl -sSL \"http://192.168.1.100:8080/install.sh\" | bash -s -- --list"
+    echo "  curl -sSL \"{{.ServerURL}}/install.sh?model=granite3.3:8b\" | bash"
+    echo "  curl -sSL \"{{.ServerURL}}/install.sh\" | bash -s -- --model granite3.3:8b"
+    echo "  curl -sSL \"{{.ServerURL}}/install.sh\" | bash -s -- --list"
+    echo "  curl -sSL \"{{.ServerURL}}/install.sh?group=workshop-2025\" | bash"
 }
 
 # Function to parse command line arguments
@@ -71,6 +96,10 @@ parse_args() {
                 MODEL="$2"
                 shift 2
                 ;;
+            --group)
+                GROUP="$2"
+                shift 2
+                ;;
             --server)
                 SERVER_URL="$2"
                 shift 2
@@ -87,6 +116,14 @@ parse_args() {
                 SHOW_MODELS=true
                 shift
                 ;;
+            --seeder)
+                SEEDER_MODE=true
+                shift
+                ;;
+            --http)
+                HTTP_MODE=true
+                shift
+                ;;
             -h|--help)
                 show_usage
                 exit 0
@@ -101,7 +138,7 @@ parse_args() {
     
     # Set defaults if not provided
     if [ -z "$SERVER_URL" ]; then
-        SERVER_URL="http://localhost:8080"
+        SERVER_URL="{{.ServerURL}}"
     fi
 }
 
@@ -164,7 +201,7 @@ list_models() {
     fi
     
     # Fetch models from server
-    MODELS_JSON=$(curl -s "$SERVER_URL/api/models" 2>/dev/null)
+    MODELS_JSON=$(curl -s "$SERVER_URL/api/models?group=$GROUP" 2>/dev/null)
     
     if [ $? -ne 0 ] || [ -z "$MODELS_JSON" ]; then
         print_error "Failed to fetch models from server: $SERVER_URL"
@@ -235,7 +272,7 @@ setup_venv() {
             if [ -n "$SERVER_URL" ]; then
                 print_info "Or check if Python installer is available at: $SERVER_URL/downloads/"
             fi
-            exit 1
+            return 1
         fi
     fi
     
@@ -255,7 +292,7 @@ setup_venv() {
             if [ -n "$SERVER_URL" ]; then
                 print_info "Or check if Python installer is available at: $SERVER_URL/downloads/"
             fi
-            exit 1
+            return 1
         fi
     fi
     
@@ -268,7 +305,10 @@ setup_venv() {
     fi
     
     print_info "Creating virtual environment..."
-    python3 -m venv "$VENV_PATH"
+    if ! python3 -m venv "$VENV_PATH"; then
+        print_error "Failed to create virtual environment"
+        return 1
+    fi
     
     # Activate virtual environment
     print_info "Activating virtual environment..."
@@ -277,7 +317,10 @@ setup_venv() {
     # Install required packages
     print_info "Installing required packages..."
     pip install --upgrade pip
-    pip install libtorrent requests
+    if ! pip install libtorrent requests; then
+        print_error "Failed to install libtorrent"
+        return 1
+    fi
 }
 
 # Function to download client script
@@ -295,6 +338,111 @@ download_client() {
     fi
 }
 
+# Function to print the SHA-256 of a file
+sha256_of() {
+    if command_exists sha256sum; then
+        sha256sum "$1" | cut -d' ' -f1
+    else
+        shasum -a 256 "$1" | cut -d' ' -f1
+    fi
+}
+
+# Function to check a pinned model's files against its manifest
+verify_model() {
+    print_info "Verifying $MODEL..."
+    if [ ! -f "$OUTPUT_DIR/$MANIFEST_PATH" ]; then
+        print_error "Manifest missing: $OUTPUT_DIR/$MANIFEST_PATH"
+        exit 1
+    fi
+    for digest in $EXPECTED_DIGESTS; do
+        blob="$OUTPUT_DIR/$BLOB_DIR/sha256-${digest#sha256:}"
+        if [ ! -f "$blob" ]; then
+            print_error "Blob missing: $blob"
+            exit 1
+        fi
+        if [ "$(sha256_of "$blob")" != "${digest#sha256:}" ]; then
+            print_error "Blob does not match its digest: $blob"
+            exit 1
+        fi
+    done
+    print_success "All blobs match the manifest"
+}
+
+# Function to install the background seeding service
+install_seeder() {
+    if ! command_exists systemctl; then
+        print_error "systemd is required to install the seeder service"
+        print_info "Run 'python3 ~/client.py --seed ~/.ollama/models' to seed instead"
+        exit 1
+    fi
+    if [ ! -f "$HOME/client.py" ] || [ ! -d "$HOME/.ollama-bt-venv" ]; then
+        print_error "Client not installed. Download a model with --model first."
+        exit 1
+    fi
+    
+    UNIT_DIR="$HOME/.config/systemd/user"
+    mkdir -p "$UNIT_DIR"
+    if ! curl -sSL "$SERVER_URL/ollama-bt-seed.service" -o "$UNIT_DIR/ollama-bt-seed.service"; then
+        print_error "Failed to download the seeder service"
+        exit 1
+    fi
+    systemctl --user daemon-reload
+    systemctl --user enable --now ollama-bt-seed.service
+    print_success "Seeder service installed and started"
+    print_info "Check on it with: systemctl --user status ollama-bt-seed.service"
+    print_info "To keep seeding while logged out: loginctl enable-linger $USER"
+}
+
+# Function to download a model straight over HTTP, for machines where the
+# BitTorrent client can't be installed. Every file is checked against its
+# SHA-256 before it's moved into place.
+download_model_http() {
+    if ! curl -s "$SERVER_URL/api/capabilities" | grep -q '"http_fallback":true'; then
+        print_error "This server doesn't offer HTTP downloads; a BitTorrent client is required"
+        exit 1
+    fi
+    
+    if [ "$TEST_MODE" = true ]; then
+        OUTPUT_DIR="$(pwd)/downloads"
+    else
+        OUTPUT_DIR="$HOME/.ollama/models"
+    fi
+    print_status "Downloading $MODEL over HTTP to $OUTPUT_DIR..."
+    
+    if ! LISTING=$(curl -sSf "$SERVER_URL/api/models/$MODEL/blobs?format=text"); then
+        print_error "Failed to list the files of $MODEL"
+        exit 1
+    fi
+    
+    while read -r sha256 size path url; do
+        dest="$OUTPUT_DIR/$path"
+        if [ -f "$dest" ] && [ "$(sha256_of "$dest")" = "$sha256" ]; then
+            print_info "Already have $path"
+            continue
+        fi
+        print_info "Downloading $path ($size bytes)..."
+        mkdir -p "$(dirname "$dest")"
+        if ! curl -sSfL "$url" -o "$dest.partial"; then
+            print_error "Failed to download $url"
+            exit 1
+        fi
+        if [ "$(sha256_of "$dest.partial")" != "$sha256" ]; then
+            rm -f "$dest.partial"
+            print_error "$path does not match its digest"
+            exit 1
+        fi
+        mv "$dest.partial" "$dest"
+    done <<< "$LISTING"
+    
+    print_success "Model download complete! All files match their digests"
+    if [ "$TEST_MODE" = false ]; then
+        echo
+        print_info "📋 Next steps:"
+        echo -e "${WHITE}1. Install Ollama from https://ollama.ai if not already installed${NC}"
+        echo -e "${WHITE}2. Use 'ollama run $MODEL' to start using your model${NC}"
+    fi
+}
+
 # Function to download model
 download_model() {
     if [ -z "$MODEL" ]; then
@@ -330,7 +478,17 @@ download_model() {
     source "$HOME/.ollama-bt-venv/bin/activate"
     
     # Download the model
-    python3 "$CLIENT_PATH" --server "$SERVER_URL" --model "$MODEL" --output "$OUTPUT_DIR"
+    if [ -n "$PINNED_MODEL" ] && [ "$MODEL" = "$PINNED_MODEL" ]; then
+        TORRENT_PATH="$OUTPUT_DIR/${MODEL//:/_}.torrent"
+        if ! curl -sSL "$TORRENT_URL" -o "$TORRENT_PATH"; then
+            print_error "Failed to download torrent: $TORRENT_URL"
+            exit 1
+        fi
+        python3 "$CLIENT_PATH" --file "$TORRENT_PATH" --output "$OUTPUT_DIR"
+        verify_model
+    else
+        python3 "$CLIENT_PATH" --server "$SERVER_URL" --model "$MODEL" --output "$OUTPUT_DIR"
+    fi
     
     if [ $? -eq 0 ]; then
         print_success "Model download complete!"
@@ -348,6 +506,32 @@ download_model() {
     fi
 }
 
+# Function to download every model in $GROUP, one after the other
+download_group() {
+    local names
+    if ! names=$(curl -sSf "$SERVER_URL/api/models?group=$GROUP" | python3 -c "
+import sys, json
+for model in json.load(sys.stdin):
+    if not model.get('incomplete'):
+        print(model['name'])
+"); then
+        print_error "Failed to fetch the models of group $GROUP from $SERVER_URL"
+        exit 1
+    fi
+    if [ -z "$names" ]; then
+        print_error "No models in group $GROUP"
+        exit 1
+    fi
+
+    for MODEL in $names; do
+        if [ "$HTTP_MODE" = true ]; then
+            download_model_http
+        else
+            download_model
+        fi
+    done
+}
+
 # Main function
 main() {
     parse_args "$@"
@@ -363,6 +547,24 @@ main() {
         exit 0
     fi
     
+    if [ "$SEEDER_MODE" = true ]; then
+        install_seeder
+        exit 0
+    fi
+    
+    # A group with no model installs the whole group
+    if [ -z "$MODEL" ] && [ -n "$GROUP" ]; then
+        print_status "Installing the models of group $GROUP..."
+        print_info "Server: $SERVER_URL"
+        if [ "$HTTP_MODE" = false ] && setup_venv; then
+            download_client
+        else
+            HTTP_MODE=true
+        fi
+        download_group
+        exit 0
+    fi
+    
     # If no model specified, show available models
     if [ -z "$MODEL" ]; then
         print_warning "No model specified. Showing available models..."
@@ -375,9 +577,15 @@ main() {
     print_info "Server: $SERVER_URL"
     print_info "Model: $MODEL"
     
-    setup_venv
-    download_client
-    download_model
+    if [ "$HTTP_MODE" = true ]; then
+        download_model_http
+    elif setup_venv; then
+        download_client
+        download_model
+    else
+        print_warning "The BitTorrent client couldn't be installed. Falling back to HTTP..."
+        download_model_http
+    fi
 }
 
 # Run main function
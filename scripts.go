@@ -0,0 +1,42 @@
+// Package lancache embeds the client scripts kept at the repository root,
+// so the server binary serves them no matter where it's started from.
+// install.sh, install.ps1, the seeder service definitions, the compose file
+// and the Ansible playbook are text/template templates rendered by the
+// server, as are the cloud-init and kickstart snippets under bootstrap/;
+// client.py is served as is.
+package lancache
+
+import _ "embed"
+
+//go:embed install.sh
+var InstallSh string
+
+//go:embed install.ps1
+var InstallPs1 string
+
+//go:embed install-aria2c.sh
+var InstallAria2c string
+
+//go:embed install-transmission.sh
+var InstallTransmission string
+
+//go:embed client.py
+var ClientPy []byte
+
+//go:embed ollama-bt-seed.service
+var SeedService string
+
+//go:embed ollama-bt-seed.xml
+var SeedTask string
+
+//go:embed docker-compose.yml
+var DockerCompose string
+
+//go:embed ollama-bt-playbook.yml
+var AnsiblePlaybook string
+
+//go:embed bootstrap/cloud-init.yaml
+var CloudInit string
+
+//go:embed bootstrap/kickstart.ks
+var Kickstart string
@@ -26,8 +26,10 @@ except ImportError:
     sys.exit(1)
 
 class OllamaSeeder:
-    def __init__(self, tracker_url=None):
+    def __init__(self, tracker_url=None, super_seed="auto"):
         self.tracker_url = tracker_url or "http://localhost:8080"
+        self.super_seed = super_seed  # "auto", "on" or "off"
+        self.super_seeding = {}       # info-hash -> current super-seeding state
         self.session = lt.session()
         
         # Configure session settings
@@ -54,6 +56,42 @@ class OllamaSeeder:
         if tracker_url:
             print(f"📡 Tracker URL will be read from torrent file: {tracker_url}")
     
+    def set_super_seeding(self, h, enabled):
+        """Toggle super-seeding (BEP 16) on a torrent handle"""
+        key = str(h.info_hash())
+        if self.super_seeding.get(key) == enabled:
+            return
+        
+        try:
+            # libtorrent 2.x uses torrent flags
+            if enabled:
+                h.set_flags(lt.torrent_flags.super_seeding)
+            else:
+                h.unset_flags(lt.torrent_flags.super_seeding)
+        except AttributeError:
+            h.super_seeding(enabled)
+        
+        self.super_seeding[key] = enabled
+        print(f"\n🚀 Super-seeding {'enabled' if enabled else 'disabled'}")
+    
+    def update_super_seeding(self, h):
+        """Super-seed while we are the only seed, so the first wave of peers
+        each get different pieces and trade them among themselves"""
+        if self.super_seed == "off":
+            enabled = False
+        elif self.super_seed == "on":
+            enabled = True
+        else:
+            s = h.status()
+            # Prefer the tracker's scrape count; fall back to connected seeds
+            if s.num_complete >= 0:
+                enabled = s.num_complete <= 1
+            else:
+                enabled = s.num_seeds == 0
+        
+        self.set_super_seeding(h, enabled)
+        return enabled
+    
     def seed_torrent_file(self, torrent_file):
         """Seed a torrent file directly"""
         if not os.path.exists(torrent_file):
@@ -126,9 +164,13 @@ class OllamaSeeder:
                 progress = h.status().progress * 100
                 is_seed = h.is_seed()
                 
+                # Super-seeding only makes sense once we have every piece
+                super_seeding = self.update_super_seeding(h) if is_seed else False
+                
                 print(f"\r🌱 Seeding: {s.upload_rate/1024:.1f} KB/s | "
                       f"Peers: {peers} | Seeds: {seeds} | Connections: {leeches} | "
                       f"Progress: {progress:.1f}% | State: {state} | IsSeed: {is_seed} | "
+                      f"Super: {'on' if super_seeding else 'off'} | "
                       f"Uptime: {elapsed:.0f}s", end='', flush=True)
                 
                 time.sleep(1)
@@ -308,8 +350,11 @@ class OllamaSeeder:
                 s = h.status()
                 elapsed = time.time() - start_time
                 
+                super_seeding = self.update_super_seeding(h) if h.is_seed() else False
+                
                 print(f"\r🌱 Seeding: {s.upload_rate/1024:.1f} KB/s | "
                       f"Peers: {s.num_peers} | "
+                      f"Super: {'on' if super_seeding else 'off'} | "
                       f"Uptime: {elapsed:.0f}s", end='', flush=True)
                 
                 time.sleep(1)
@@ -380,6 +425,9 @@ Examples:
   
   # Show status
   python3 seeder.py --status
+  
+  # Always super-seed (default: only while we are the sole seed)
+  python3 seeder.py --file model.torrent --super-seed on
         """
     )
     
@@ -402,6 +450,8 @@ Examples:
                        help="List available models on server")
     parser.add_argument("--status", action="store_true", 
                        help="Show current session status")
+    parser.add_argument("--super-seed", choices=["auto", "on", "off"], default="auto",
+                       help="Super-seeding mode; auto enables it while this is the only seed (default: auto)")
     
     args = parser.parse_args()
     
@@ -410,7 +460,7 @@ Examples:
         parser.error("Please specify an action: --file, --download-all, --model, --seed, --list, or --status")
     
     try:
-        seeder = OllamaSeeder(args.tracker)
+        seeder = OllamaSeeder(args.tracker, args.super_seed)
         
         if args.file:
             # Main use case: seed torrent file directly
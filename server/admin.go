@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	rpprof "runtime/pprof"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// AdminSettings configure the admin listener, a separate port for endpoints
+// that shouldn't be reachable by every client on the LAN.
+type AdminSettings struct {
+	Listen string `mapstructure:"listen"` // host:port; empty disables the admin listener
+	Token  string `mapstructure:"token"`  // required as "Authorization: Bearer <token>"
+
+	ProfileInterval time.Duration `mapstructure:"profile_interval"` // 0 disables continuous profiling
+	ProfileDir      string        `mapstructure:"profile_dir"`      // default <state_dir>/profiles
+	ProfileKeep     int           `mapstructure:"profile_keep"`     // sets of profiles kept
+}
+
+// isAdmin reports whether a request carries the admin token.
+func (s *Server) isAdmin(r *http.Request) bool {
+	want := "Bearer " + s.adminToken
+	return s.adminToken != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) == 1
+}
+
+// requireAdmin only lets requests with the admin token through.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAdmin(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ollama-bt-lancache admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startAdminServer serves the admin endpoints: for now net/http/pprof, to
+// find hashing hot spots and seeder goroutine leaks on production boxes.
+func (s *Server) startAdminServer(addr string) {
+	r := mux.NewRouter()
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+
+	s.logger.Infof("Starting admin server on %s (pprof at /debug/pprof/)", addr)
+	server := &http.Server{
+		Addr:    addr,
+		Handler: s.requireAdmin(r),
+		// No write timeout: CPU profiles and traces run as long as asked
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		s.logger.Errorf("Admin server stopped: %v", err)
+	}
+}
+
+// profileLoop writes a CPU, heap and goroutine profile to dir every
+// interval, keeping the newest keep sets, so there's a history to look at
+// after the fact. The CPU profile covers up to 30 seconds of each interval.
+func (s *Server) profileLoop(dir string, interval time.Duration, keep int) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		s.logger.Errorf("Continuous profiling disabled: %v", err)
+		return
+	}
+	for {
+		stamp := time.Now().UTC().Format("20060102T150405Z")
+		if err := writeCPUProfile(filepath.Join(dir, stamp+"-cpu.pprof"), min(interval, 30*time.Second)); err != nil {
+			s.logger.Warnf("Failed to write CPU profile: %v", err)
+		}
+		for _, name := range []string{"heap", "goroutine"} {
+			if err := writeProfile(filepath.Join(dir, stamp+"-"+name+".pprof"), name); err != nil {
+				s.logger.Warnf("Failed to write %s profile: %v", name, err)
+			}
+		}
+		pruneProfiles(dir, keep)
+		time.Sleep(interval - min(interval, 30*time.Second))
+	}
+}
+
+// writeCPUProfile profiles the CPU for d. It fails while a CPU profile is
+// being taken through /debug/pprof/profile, and the next interval tries again.
+func writeCPUProfile(path string, d time.Duration) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := rpprof.StartCPUProfile(f); err != nil {
+		os.Remove(path)
+		return err
+	}
+	time.Sleep(d)
+	rpprof.StopCPUProfile()
+	return nil
+}
+
+func writeProfile(path, name string) error {
+	profile := rpprof.Lookup(name)
+	if profile == nil {
+		return fmt.Errorf("no %s profile", name)
+	}
+	if name == "heap" {
+		runtime.GC() // up-to-date statistics
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := profile.WriteTo(f, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// pruneProfiles removes all but the newest keep sets of profiles. Their
+// names start with a UTC timestamp, so they sort oldest first.
+func pruneProfiles(dir string, keep int) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pprof"))
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	if excess := len(files) - keep*3; excess > 0 {
+		for _, file := range files[:excess] {
+			os.Remove(file)
+		}
+	}
+}
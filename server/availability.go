@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// AvailabilityMap shows, for every model in the federation, which members
+// have it complete, partially downloaded, or not at all.
+type AvailabilityMap struct {
+	Sites  []string            `json:"sites"`
+	Models []ModelAvailability `json:"models"`
+}
+
+type ModelAvailability struct {
+	Name  string             `json:"name"`
+	Sites []SiteAvailability `json:"sites"` // in the same order as AvailabilityMap.Sites
+}
+
+type SiteAvailability struct {
+	Site     string  `json:"site"`
+	State    string  `json:"state"`              // complete, partial, missing, or unknown
+	Progress float64 `json:"progress,omitempty"` // fraction downloaded, for partial models
+}
+
+// availability builds the map from our catalog and the peers' last known
+// catalogs. Peers whose catalog was never fetched are listed as unknown.
+func (s *Server) availability() AvailabilityMap {
+	catalogs := []FederationCatalog{s.localCatalog()}
+	fetched := []bool{true}
+	s.federationMu.Lock()
+	for _, peer := range s.federationPeers {
+		peer = strings.TrimSuffix(peer, "/")
+		catalog, ok := s.peerCatalogs[peer]
+		if !ok {
+			catalog = FederationCatalog{Site: peer, URL: peer}
+			if u, err := url.Parse(peer); err == nil {
+				catalog.Site = u.Hostname()
+			}
+		}
+		catalogs = append(catalogs, catalog)
+		fetched = append(fetched, ok)
+	}
+	s.federationMu.Unlock()
+
+	names := make(map[string]bool)
+	for _, catalog := range catalogs {
+		for _, model := range catalog.Models {
+			names[model.Name] = true
+		}
+		for _, model := range catalog.Partial {
+			names[model.Name] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	result := AvailabilityMap{Models: make([]ModelAvailability, 0, len(sorted))}
+	for _, catalog := range catalogs {
+		result.Sites = append(result.Sites, catalog.Site)
+	}
+	for _, name := range sorted {
+		model := ModelAvailability{Name: name}
+		for i, catalog := range catalogs {
+			model.Sites = append(model.Sites, siteAvailability(catalog, name, fetched[i]))
+		}
+		result.Models = append(result.Models, model)
+	}
+	return result
+}
+
+func siteAvailability(catalog FederationCatalog, name string, fetched bool) SiteAvailability {
+	availability := SiteAvailability{Site: catalog.Site, State: "missing"}
+	if !fetched {
+		availability.State = "unknown"
+		return availability
+	}
+	for _, model := range catalog.Models {
+		if model.Name == name {
+			availability.State = "complete"
+			return availability
+		}
+	}
+	for _, model := range catalog.Partial {
+		if model.Name == name {
+			availability.State = "partial"
+			if model.Size > 0 {
+				availability.Progress = float64(model.Completed) / float64(model.Size)
+			}
+			return availability
+		}
+	}
+	return availability
+}
+
+// serveAvailability shows the federation availability map, as HTML for
+// browsers or JSON for ?format=json / Accept: application/json.
+func (s *Server) serveAvailability(w http.ResponseWriter, r *http.Request) {
+	availability := s.availability()
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(availability)
+		return
+	}
+
+	tmpl := `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta http-equiv="refresh" content="60">
+    <title>Model Availability - Ollama BitTorrent Lancache</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; background-color: #f5f5f5; }
+        .container { max-width: 1200px; margin: 0 auto; background: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
+        h1 { color: #333; text-align: center; }
+        .back-link { margin-bottom: 20px; }
+        .back-link a { color: #007bff; text-decoration: none; }
+        .back-link a:hover { text-decoration: underline; }
+        table { width: 100%; border-collapse: collapse; margin-top: 30px; }
+        th, td { text-align: left; padding: 10px; border-bottom: 1px solid #ddd; }
+        th { background: #fafafa; }
+        .complete { background: #d4edda; color: #155724; }
+        .partial { background: #fff3cd; color: #856404; }
+        .missing { background: #f8d7da; color: #721c24; }
+        .unknown { color: #999; }
+        .empty-state { text-align: center; color: #666; padding: 40px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="back-link">
+            <a href="/">← Back to Main Page</a>
+        </div>
+        <h1>🗺️ Model Availability</h1>
+        <p style="text-align: center; color: #666;">Which federation members hold each model (<a href="?format=json">JSON</a>)</p>
+
+        {{if .Models}}
+        <table>
+            <tr><th>Model</th>{{range .Sites}}<th>{{.}}</th>{{end}}</tr>
+            {{range .Models}}
+            <tr>
+                <td>{{.Name}}</td>
+                {{range .Sites}}
+                <td class="{{.State}}">{{.State}}{{if .Progress}} ({{printf "%.0f" (percent .Progress)}}%){{end}}</td>
+                {{end}}
+            </tr>
+            {{end}}
+        </table>
+        {{else}}
+        <div class="empty-state">
+            <h3>No models yet</h3>
+            <p>Models appear here once this server or a federation peer has them.</p>
+        </div>
+        {{end}}
+    </div>
+</body>
+</html>`
+
+	t, err := template.New("availability").Funcs(template.FuncMap{
+		"percent": func(fraction float64) float64 { return fraction * 100 },
+	}).Parse(tmpl)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	t.Execute(w, availability)
+}
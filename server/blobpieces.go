@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// alignedPieces lays out a model torrent with every blob starting on a piece
+// boundary, followed by a BEP 47 padding file, and the manifests last. A
+// blob's piece hashes are then the same in every torrent that has it, so
+// they're hashed once and saved under <state_dir>/pieces, and a new tag of a
+// model that's already published costs little more than its manifest.
+// progress, if not nil, counts what's hashed.
+func (s *Server) alignedPieces(blobs, manifests []File, pieceLength int64, progress *hashProgress) ([]File, string, error) {
+	var aligned []File
+	var pieces strings.Builder
+	for _, blob := range blobs {
+		hashes, err := s.blobPieces(blob, pieceLength, progress)
+		if err != nil {
+			return nil, "", err
+		}
+		pieces.WriteString(hashes)
+		aligned = append(aligned, blob)
+		if remainder := blob.Length % pieceLength; remainder != 0 {
+			pad, err := s.padFile(pieceLength - remainder)
+			if err != nil {
+				return nil, "", err
+			}
+			aligned = append(aligned, pad)
+		}
+	}
+
+	hashes, err := s.hashFiles(manifests, s.modelsDir, pieceLength, progress)
+	if err != nil {
+		return nil, "", err
+	}
+	pieces.WriteString(hashes)
+	return append(aligned, manifests...), pieces.String(), nil
+}
+
+// blobPieces returns the piece hashes of a blob padded to a whole number of
+// pieces, from an earlier torrent when one had it. Blobs are named by their
+// digest, so saved hashes stay valid for as long as the blob exists.
+func (s *Server) blobPieces(blob File, pieceLength int64, progress *hashProgress) (string, error) {
+	numPieces := (blob.Length + pieceLength - 1) / pieceLength
+	var saved string
+	if s.stateDir != "" {
+		saved = filepath.Join(s.stateDir, "pieces", strconv.FormatInt(pieceLength, 10), blob.Path[len(blob.Path)-1])
+		if data, err := os.ReadFile(saved); err == nil && int64(len(data)) == numPieces*sha1.Size {
+			s.logger.Infof("Reusing piece hashes of %s", strings.Join(blob.Path, "/"))
+			progress.add(numPieces * pieceLength)
+			return string(data), nil
+		}
+	}
+
+	files := []File{blob}
+	if remainder := blob.Length % pieceLength; remainder != 0 {
+		pad, err := s.padFile(pieceLength - remainder)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, pad)
+	}
+	pieces, err := s.hashFiles(files, s.modelsDir, pieceLength, progress)
+	if err != nil {
+		return "", err
+	}
+
+	// Failing to save only means hashing the blob again next time
+	if saved != "" {
+		err := os.MkdirAll(filepath.Dir(saved), 0755)
+		var tmp string
+		if err == nil {
+			tmp, err = writeTemp(saved, []byte(pieces))
+		}
+		if err == nil {
+			if err = os.Rename(tmp, saved); err != nil {
+				os.Remove(tmp)
+			}
+		}
+		if err != nil {
+			s.logger.Warnf("Failed to save piece hashes of %s: %v", strings.Join(blob.Path, "/"), err)
+		}
+	}
+	return pieces, nil
+}
+
+// padFile returns a BEP 47 padding file of length zeros. Clients that know
+// padding files skip them; for the seeder, web seeds and clients that don't,
+// it also exists as a sparse file in the models directory, <models>/.pad/<length>.
+func (s *Server) padFile(length int64) (File, error) {
+	name := strconv.FormatInt(length, 10)
+	path := filepath.Join(s.modelsDir, ".pad", name)
+	if info, err := os.Stat(path); err != nil || info.Size() != length {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return File{}, err
+		}
+		// Never truncated first, so a torrent being hashed at the same time
+		// doesn't see it shrink
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			return File{}, fmt.Errorf("failed to create padding file: %w", err)
+		}
+		err = f.Truncate(length)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return File{}, fmt.Errorf("failed to create padding file: %w", err)
+		}
+	}
+	return File{Length: length, Path: []string{".pad", name}, Attr: "p"}, nil
+}
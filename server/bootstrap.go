@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+
+	lancache "github.com/jjasghar/ollama-bt-lancache"
+)
+
+// Provisioning snippets for labs that re-image machines: each sets up the
+// client as a system service that syncs models from this server.
+var (
+	cloudInitTemplate = template.Must(template.New("cloud-init.yaml").Parse(lancache.CloudInit))
+	kickstartTemplate = template.Must(template.New("kickstart.ks").Parse(lancache.Kickstart))
+)
+
+// defaultBootstrapDir is where Ollama's Linux service keeps its data, so
+// synced models show up without reconfiguring it.
+const defaultBootstrapDir = "/usr/share/ollama/.ollama"
+
+// bootstrapPath matches the absolute directories that can go into the
+// snippets as they are.
+var bootstrapPath = regexp.MustCompile(`^/[A-Za-z0-9._/-]*$`)
+
+// bootstrapData is what the provisioning templates can refer to.
+type bootstrapData struct {
+	scriptData
+	Models []string // empty syncs every model
+	Dir    string   // Ollama directory on the provisioned machine
+}
+
+// bootstrapData reads the models (comma-separated) and dir query parameters.
+// It writes the error response itself when they can't be used.
+func (s *Server) bootstrapData(w http.ResponseWriter, r *http.Request) (bootstrapData, bool) {
+	data := bootstrapData{scriptData: s.scriptData(), Dir: defaultBootstrapDir}
+	for _, name := range strings.Split(r.URL.Query().Get("models"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !scriptSafe.MatchString(name) {
+			http.Error(w, "Invalid model name", http.StatusBadRequest)
+			return data, false
+		}
+		data.Models = append(data.Models, name)
+	}
+	if dir := r.URL.Query().Get("dir"); dir != "" {
+		if !bootstrapPath.MatchString(dir) {
+			http.Error(w, "dir must be an absolute path", http.StatusBadRequest)
+			return data, false
+		}
+		data.Dir = strings.TrimSuffix(dir, "/")
+	}
+	return data, true
+}
+
+func (s *Server) serveCloudInit(w http.ResponseWriter, r *http.Request) {
+	if data, ok := s.bootstrapData(w, r); ok {
+		s.serveScript(w, r, cloudInitTemplate, data)
+	}
+}
+
+func (s *Server) serveKickstart(w http.ResponseWriter, r *http.Request) {
+	if data, ok := s.bootstrapData(w, r); ok {
+		s.serveScript(w, r, kickstartTemplate, data)
+	}
+}
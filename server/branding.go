@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+)
+
+// BrandingSettings customize the web UI for a site.
+type BrandingSettings struct {
+	Title        string `mapstructure:"title"`
+	Logo         string `mapstructure:"logo"`         // image URL, or a local file served at /branding/logo
+	AccentColor  string `mapstructure:"accent_color"` // CSS hex color for buttons and links
+	Announcement string `mapstructure:"announcement"` // banner shown above the catalog
+}
+
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+func (b BrandingSettings) validate() []string {
+	var problems []string
+	if b.Title == "" {
+		problems = append(problems, "branding.title must not be empty")
+	}
+	if !hexColor.MatchString(b.AccentColor) {
+		problems = append(problems, fmt.Sprintf("branding.accent_color must be a hex color such as \"#007bff\", got %q", b.AccentColor))
+	}
+	if b.Logo != "" && !b.remoteLogo() {
+		if stat, err := os.Stat(b.Logo); err != nil || stat.IsDir() {
+			problems = append(problems, fmt.Sprintf("branding.logo must be an http(s) URL or an image file, got %q", b.Logo))
+		}
+	}
+	return problems
+}
+
+func (b BrandingSettings) remoteLogo() bool {
+	u, err := url.Parse(b.Logo)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// LogoURL is where pages load the logo from, or "" without one.
+func (b BrandingSettings) LogoURL() string {
+	if b.Logo == "" || b.remoteLogo() {
+		return b.Logo
+	}
+	return "/branding/logo"
+}
+
+// serveLogo serves a logo configured as a local file.
+func (s *Server) serveLogo(w http.ResponseWriter, r *http.Request) {
+	if s.branding.Logo == "" || s.branding.remoteLogo() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, s.branding.Logo)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Bulk operations apply an admin action to every model matching a name or
+// glob, instead of scripting one call per model. Each request becomes a job
+// that runs in the background, one job at a time in the order they were
+// posted; GET /api/jobs/{id} reports its progress and each model's result.
+
+// Job status values.
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+)
+
+// maxJobs is how many jobs are remembered, finished or not.
+const maxJobs = 100
+
+// bulkActions run an action on one model. A non-nil detail goes into the
+// model's result, such as what a deletion removed.
+var bulkActions = map[string]func(s *Server, model Model) (detail interface{}, err error){
+	"regenerate": (*Server).bulkRegenerate,
+	"verify":     (*Server).bulkVerify,
+	"delete":     (*Server).bulkDelete,
+}
+
+// BulkRequest is the body of POST /api/jobs/{action}.
+type BulkRequest struct {
+	Match string `json:"match"` // model name or glob; empty matches every model, except for delete
+}
+
+// Job is a bulk operation and how far it has got.
+type Job struct {
+	ID         string      `json:"id"`
+	Action     string      `json:"action"` // regenerate, verify or delete
+	Match      string      `json:"match"`
+	Status     string      `json:"status"` // queued, running or done
+	Models     []string    `json:"models"`
+	Done       int         `json:"done"`
+	Failed     int         `json:"failed"`
+	Results    []JobResult `json:"results"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  *time.Time  `json:"started_at,omitempty"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+// JobResult is what a job did to one model.
+type JobResult struct {
+	Model  string      `json:"model"`
+	OK     bool        `json:"ok"`
+	Error  string      `json:"error,omitempty"`
+	Detail interface{} `json:"detail,omitempty"`
+}
+
+// matchingModels lists the catalog models, hidden ones included, whose
+// names match a glob.
+func (s *Server) matchingModels(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q", pattern)
+	}
+	var names []string
+	for _, model := range s.catalog() {
+		if ok, _ := path.Match(pattern, model.Name); ok || pattern == "" {
+			names = append(names, model.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// submitJob queues a job and starts the worker if it isn't running.
+func (s *Server) submitJob(action, match string, models []string) Job {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	s.nextJobID++
+	job := &Job{
+		ID:        strconv.Itoa(s.nextJobID),
+		Action:    action,
+		Match:     match,
+		Status:    jobQueued,
+		Models:    models,
+		Results:   []JobResult{},
+		CreatedAt: time.Now(),
+	}
+	s.jobs = append(s.jobs, job)
+	if len(s.jobs) > maxJobs {
+		// Forget the oldest finished job; queued ones still have to run
+		for i, old := range s.jobs {
+			if old.Status == jobDone {
+				s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+				break
+			}
+		}
+	}
+	if !s.jobRunning {
+		s.jobRunning = true
+		go s.jobWorker()
+	}
+	return job.snapshot()
+}
+
+// snapshot copies a job for encoding while the worker updates it. The
+// caller holds jobsMu.
+func (j *Job) snapshot() Job {
+	copied := *j
+	copied.Results = append([]JobResult{}, j.Results...)
+	return copied
+}
+
+// jobWorker runs the queued jobs in order until there are none left.
+func (s *Server) jobWorker() {
+	for {
+		s.jobsMu.Lock()
+		var job *Job
+		for _, queued := range s.jobs {
+			if queued.Status == jobQueued {
+				job = queued
+				break
+			}
+		}
+		if job == nil {
+			s.jobRunning = false
+			s.jobsMu.Unlock()
+			return
+		}
+		started := time.Now()
+		job.Status, job.StartedAt = jobRunning, &started
+		s.jobsMu.Unlock()
+
+		s.logger.Infof("Job %s: %s %d models matching %q", job.ID, job.Action, len(job.Models), job.Match)
+		s.runJob(job)
+	}
+}
+
+// runJob applies a job's action to each of its models in turn.
+func (s *Server) runJob(job *Job) {
+	action := bulkActions[job.Action]
+	for _, name := range job.Models {
+		result := JobResult{Model: name, OK: true}
+		// Deleted or renamed since the job was posted
+		if model, ok := s.modelByName(name); !ok {
+			result.OK, result.Error = false, "model not found"
+		} else if detail, err := action(s, model); err != nil {
+			result.OK, result.Error, result.Detail = false, err.Error(), detail
+		} else {
+			result.Detail = detail
+		}
+
+		s.jobsMu.Lock()
+		job.Results = append(job.Results, result)
+		job.Done++
+		if !result.OK {
+			job.Failed++
+		}
+		s.jobsMu.Unlock()
+	}
+
+	// Deletions rediscover once at the end rather than after each model
+	if job.Action == "delete" {
+		if err := s.discoverModels(); err != nil {
+			s.logger.Errorf("Failed to rediscover models: %v", err)
+		}
+	}
+
+	s.jobsMu.Lock()
+	finished := time.Now()
+	job.Status, job.FinishedAt = jobDone, &finished
+	s.jobsMu.Unlock()
+	s.logger.Infof("Job %s finished: %d of %d models failed", job.ID, job.Failed, len(job.Models))
+}
+
+func (s *Server) bulkRegenerate(model Model) (interface{}, error) {
+	switch {
+	case model.Incomplete:
+		return nil, fmt.Errorf("model is incomplete")
+	case model.TorrentStatus == torrentPending:
+		return nil, fmt.Errorf("the torrent is already being created")
+	}
+	if err := s.regenerateTorrent(model); err != nil {
+		return nil, err
+	}
+	return RegeneratedTorrent{Model: model.Name, OldInfoHash: model.InfoHash, TorrentStatus: torrentPending}, nil
+}
+
+func (s *Server) bulkVerify(model Model) (interface{}, error) {
+	report := s.checkModel(model)
+	if !report.OK {
+		s.logger.Warnf("Verification of %s failed", model.Name)
+		s.notify(eventVerificationFailed, fmt.Sprintf("Verification of %s failed", model.Name))
+		return report, fmt.Errorf("verification failed")
+	}
+	return nil, nil
+}
+
+func (s *Server) bulkDelete(model Model) (interface{}, error) {
+	s.deleteMu.Lock()
+	defer s.deleteMu.Unlock()
+	deleted, err := s.deleteModel(model.Name)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infof("Deleted model %s: removed %d blobs (%s), kept %d shared", model.Name, len(deleted.RemovedBlobs), deleted.FreedHuman, len(deleted.KeptBlobs))
+	return deleted, nil
+}
+
+// postJob serves POST /api/jobs/{action}, behind the admin token.
+func (s *Server) postJob(w http.ResponseWriter, r *http.Request) {
+	action := mux.Vars(r)["action"]
+	if _, ok := bulkActions[action]; !ok {
+		http.Error(w, fmt.Sprintf("Unknown action %q: use regenerate, verify or delete", action), http.StatusNotFound)
+		return
+	}
+	var req BulkRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if action == "delete" && req.Match == "" {
+		http.Error(w, `Deleting needs a match; use "*" to delete every model`, http.StatusBadRequest)
+		return
+	}
+	// Servers sharing a models directory leave writes to the leader
+	if action != "verify" && !s.lease.isLeader() {
+		http.Error(w, "Not the leader; run this on the other server of the pair", http.StatusServiceUnavailable)
+		return
+	}
+
+	models, err := s.matchingModels(req.Match)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(models) == 0 {
+		http.Error(w, fmt.Sprintf("No models match %q", req.Match), http.StatusNotFound)
+		return
+	}
+
+	job := s.submitJob(action, req.Match, models)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// getJobs serves GET /api/jobs, newest first.
+func (s *Server) getJobs(w http.ResponseWriter, r *http.Request) {
+	s.jobsMu.Lock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, s.jobs[i].snapshot())
+	}
+	s.jobsMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// getJob serves GET /api/jobs/{id}.
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	s.jobsMu.Lock()
+	var job *Job
+	for _, j := range s.jobs {
+		if j.ID == id {
+			copied := j.snapshot()
+			job = &copied
+		}
+	}
+	s.jobsMu.Unlock()
+
+	if job == nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/gorilla/mux"
+)
+
+// A bundle is one torrent with every tag of a model family, such as all the
+// quantizations of llama3.1:8b (llama3.1:8b, llama3.1:8b-instruct-q4_K_M,
+// llama3.1:8b-instruct-q8_0, ...), for power users who want the lot. Layers
+// the tags share are in it once. Blobs start on piece boundaries as in model
+// torrents, so their piece hashes are reused rather than hashed again.
+//
+// Bundles are built when first asked for, and again when a tag of the family
+// changes; <state_dir>/bundles/<family>-<members>.torrent is named after the
+// tags and manifests in it.
+
+// ModelBundle is a family of models offered as one torrent.
+type ModelBundle struct {
+	Family        string   `json:"family"`
+	Models        []string `json:"models"`
+	Size          int64    `json:"size"` // shared layers counted once
+	SizeHuman     string   `json:"size_human"`
+	TorrentStatus string   `json:"torrent_status"`     // ready, pending, or absent until first requested
+	Progress      float64  `json:"progress,omitempty"` // fraction hashed while pending
+	InfoHash      string   `json:"info_hash,omitempty"`
+	TorrentURL    string   `json:"torrent_url"`
+
+	members []Model
+	key     string // names the members and their versions
+}
+
+// modelFamily is the family a tag belongs to: the part of the tag before
+// the first dash, so llama3.1:8b-instruct-q4_K_M is in llama3.1:8b.
+func modelFamily(name string) string {
+	repository, tag, ok := strings.Cut(name, ":")
+	if !ok {
+		return name
+	}
+	size, _, _ := strings.Cut(tag, "-")
+	return repository + ":" + size
+}
+
+// bundlesDir is where bundle torrents are kept.
+func (s *Server) bundlesDir() string {
+	return filepath.Join(s.stateDir, "bundles")
+}
+
+// bundleTorrentPath is where a bundle's torrent is for its current members.
+func (s *Server) bundleTorrentPath(bundle ModelBundle) string {
+	return filepath.Join(s.bundlesDir(), versionDirName(bundle.Family)+"-"+bundle.key+".torrent")
+}
+
+// modelBundles lists the families with more than one listed, complete model.
+func (s *Server) modelBundles() []ModelBundle {
+	families := make(map[string][]Model)
+	for _, model := range s.visibleCatalog() {
+		if !model.Incomplete && model.Digest != "" {
+			family := modelFamily(model.Name)
+			families[family] = append(families[family], model)
+		}
+	}
+
+	bundles := []ModelBundle{}
+	for family, members := range families {
+		if len(members) < 2 {
+			continue
+		}
+		torrentURL := fmt.Sprintf("%s/api/bundles/%s/torrent", s.baseURL(), url.PathEscape(family))
+		bundles = append(bundles, s.newBundle(family, torrentURL, members))
+	}
+	sort.Slice(bundles, func(i, j int) bool { return bundles[i].Family < bundles[j].Family })
+	return bundles
+}
+
+// newBundle describes a bundle of members as it is now: its size, and
+// whether its torrent is built for exactly these members.
+func (s *Server) newBundle(family, torrentURL string, members []Model) ModelBundle {
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	bundle := ModelBundle{
+		Family:     family,
+		Models:     []string{},
+		TorrentURL: torrentURL,
+		members:    members,
+	}
+	key := sha256.New()
+	seen := make(map[string]bool)
+	for _, model := range members {
+		bundle.Models = append(bundle.Models, model.Name)
+		fmt.Fprintf(key, "%s %s\n", model.Name, model.Digest)
+		manifest, err := s.readManifest(model.Name)
+		if err != nil {
+			continue
+		}
+		digests, _ := manifestDigests(manifest)
+		for _, digest := range digests {
+			if info, err := os.Stat(s.blobPath(digest)); err == nil && !seen[digest] {
+				seen[digest] = true
+				bundle.Size += info.Size()
+			}
+		}
+	}
+	bundle.SizeHuman = formatSize(bundle.Size)
+	bundle.key = hex.EncodeToString(key.Sum(nil))[:16]
+
+	s.bundleMu.Lock()
+	progress, building := s.bundlesBuilding[family]
+	s.bundleMu.Unlock()
+	if infoHash, err := torrentInfoHash(s.bundleTorrentPath(bundle)); building {
+		bundle.TorrentStatus, bundle.Progress = torrentPending, progress.fraction()
+	} else if err == nil {
+		bundle.TorrentStatus, bundle.InfoHash = torrentReady, infoHash
+	} else {
+		bundle.TorrentStatus = "absent"
+	}
+	return bundle
+}
+
+// buildBundle queues a bundle's torrent for the hash worker, unless it's
+// already queued, so it's built one at a time with model torrents.
+func (s *Server) buildBundle(bundle ModelBundle) {
+	s.bundleMu.Lock()
+	if s.bundlesBuilding == nil {
+		s.bundlesBuilding = make(map[string]*hashProgress)
+	}
+	if _, ok := s.bundlesBuilding[bundle.Family]; ok {
+		s.bundleMu.Unlock()
+		return
+	}
+	progress := &hashProgress{total: bundle.Size}
+	s.bundlesBuilding[bundle.Family] = progress
+	s.bundleMu.Unlock()
+
+	s.hashMu.Lock()
+	s.bundleQueue = append(s.bundleQueue, bundle)
+	if !s.hashing {
+		s.hashing = true
+		go s.hashWorker()
+	}
+	s.hashMu.Unlock()
+}
+
+// createQueuedBundle creates a queued bundle's torrent.
+func (s *Server) createQueuedBundle(bundle ModelBundle) {
+	s.bundleMu.Lock()
+	progress := s.bundlesBuilding[bundle.Family]
+	s.bundleMu.Unlock()
+
+	if err := s.createBundleTorrent(bundle, progress); err != nil {
+		s.logger.Errorf("Failed to create the bundle torrent of %s: %v", bundle.Family, err)
+	}
+
+	s.bundleMu.Lock()
+	delete(s.bundlesBuilding, bundle.Family)
+	s.bundleMu.Unlock()
+}
+
+// createBundleTorrent lays out a bundle like a model torrent: each distinct
+// blob once, then every member's manifest.
+func (s *Server) createBundleTorrent(bundle ModelBundle, progress *hashProgress) error {
+	var manifests, blobs []File
+	seen := make(map[string]bool)
+	for _, model := range bundle.members {
+		manifestPath, err := s.manifestPath(model.Name)
+		if err != nil {
+			return err
+		}
+		manifest, err := os.ReadFile(manifestPath)
+		if err != nil {
+			return err
+		}
+		if manifestDigest(manifest) != model.Digest {
+			return fmt.Errorf("%s changed while the bundle was being built", model.Name)
+		}
+		rel, err := filepath.Rel(s.modelsDir, manifestPath)
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, File{Length: int64(len(manifest)), Path: strings.Split(rel, string(filepath.Separator))})
+
+		digests, err := manifestDigests(manifest)
+		if err != nil {
+			return err
+		}
+		for _, digest := range digests {
+			if seen[digest] {
+				continue
+			}
+			seen[digest] = true
+			info, err := os.Stat(s.blobPath(digest))
+			if err != nil {
+				return fmt.Errorf("blob %s of model %s is missing", digest, model.Name)
+			}
+			blobs = append(blobs, File{Length: info.Size(), Path: []string{"blobs", strings.Replace(digest, ":", "-", 1)}})
+		}
+	}
+
+	settings := s.modelSettings(bundle.members[0].Name)
+	pieceLength := settings.PieceSize
+	var totalSize int64
+	for _, file := range append(append([]File{}, blobs...), manifests...) {
+		totalSize += file.Length
+	}
+	if totalSize < pieceLength {
+		pieceLength = totalSize
+	}
+
+	s.logger.Infof("Creating the bundle torrent of %s: %d models, %d blobs", bundle.Family, len(bundle.members), len(blobs))
+	var files []File
+	var pieces string
+	var err error
+	if s.alignBlobs && pieceLength == settings.PieceSize {
+		files, pieces, err = s.alignedPieces(blobs, manifests, pieceLength, progress)
+	} else {
+		files = append(blobs, manifests...)
+		pieces, err = s.hashFiles(files, s.modelsDir, pieceLength, progress)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to calculate piece hashes: %w", err)
+	}
+
+	info := TorrentInfo{
+		PieceLength: pieceLength,
+		Pieces:      pieces,
+		Name:        "models",
+		Files:       files,
+		Source:      s.torrentMeta.Source,
+	}
+	if settings.Private {
+		info.Private = 1
+	}
+	data, err := bencode.Marshal(&TorrentFile{
+		Announce:     s.trackerURL,
+		AnnounceList: s.announceList(),
+		Comment:      s.torrentComment(bundle.Family),
+		CreatedBy:    s.torrentMeta.CreatedBy,
+		CreationDate: time.Now().Unix(),
+		Encoding:     "UTF-8",
+		Info:         info,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode torrent: %w", err)
+	}
+
+	if err := os.MkdirAll(s.bundlesDir(), 0755); err != nil {
+		return err
+	}
+	torrentPath := s.bundleTorrentPath(bundle)
+	if err := s.publishTorrent(torrentPath, data); err != nil {
+		return err
+	}
+	s.logger.Infof("Created the bundle torrent of %s: %s", bundle.Family, torrentPath)
+
+	// Torrents of earlier members are of no use any more
+	earlier, _ := filepath.Glob(filepath.Join(s.bundlesDir(), versionDirName(bundle.Family)+"-*.torrent"))
+	for _, path := range earlier {
+		if path == torrentPath {
+			continue
+		}
+		if infoHash, err := torrentInfoHash(path); err == nil && s.seeder != nil {
+			s.seeder.drop(infoHash)
+		}
+		os.Remove(path)
+	}
+
+	if s.seeder != nil {
+		infoHash, err := torrentInfoHash(torrentPath)
+		if err == nil {
+			err = s.seeder.seed(Model{Name: bundle.Family + " bundle", TorrentFile: torrentPath, InfoHash: infoHash, CreatedAt: time.Now()})
+		}
+		if err != nil {
+			s.logger.Warnf("Failed to seed the bundle of %s: %v", bundle.Family, err)
+		}
+	}
+	return nil
+}
+
+// getBundles serves GET /api/bundles.
+func (s *Server) getBundles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.modelBundles())
+}
+
+// getBundleTorrent serves GET /api/bundles/{family}/torrent.
+func (s *Server) getBundleTorrent(w http.ResponseWriter, r *http.Request) {
+	family := mux.Vars(r)["family"]
+	for _, bundle := range s.modelBundles() {
+		if bundle.Family == family {
+			s.serveBundle(w, r, bundle, strings.ReplaceAll(family, ":", "_")+"-bundle")
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("No bundle %q: a family needs at least two listed models", family), http.StatusNotFound)
+}
+
+// serveBundle serves a bundle's torrent. One that isn't built yet is started,
+// and the client is asked to retry, with how far hashing has got.
+func (s *Server) serveBundle(w http.ResponseWriter, r *http.Request, bundle ModelBundle, name string) {
+	if bundle.TorrentStatus != torrentReady {
+		if bundle.TorrentStatus != torrentPending && !s.lease.isLeader() {
+			http.Error(w, "No bundle torrent yet; the leader creates it", http.StatusServiceUnavailable)
+			return
+		}
+		s.buildBundle(bundle)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":          "torrent is not available yet",
+			"torrent_status": torrentPending,
+			"progress":       bundle.Progress,
+		})
+		return
+	}
+
+	// Without federation, which lists every server, this server is the
+	// bundle's web seed
+	webseed := s.baseURL() + "/webseed/"
+	if len(s.federationPeers) > 0 || len(s.registeredPeers()) > 0 {
+		webseed = ""
+	}
+	s.serveTorrent(w, r, s.bundleTorrentPath(bundle), name, webseed)
+}
+
+// everythingBundle is the whole listed catalog as one bundle, for mirroring
+// a new site in one go.
+func (s *Server) everythingBundle() ModelBundle {
+	var members []Model
+	for _, model := range s.visibleCatalog() {
+		if !model.Incomplete && model.Digest != "" {
+			members = append(members, model)
+		}
+	}
+	return s.newBundle(everythingFamily, s.baseURL()+"/api/everything/torrent", members)
+}
+
+// everythingFamily names the whole-catalog bundle. Family names have a colon,
+// so it can't clash with one.
+const everythingFamily = "everything"
+
+// getEverything serves GET /api/everything: what the whole-catalog torrent
+// covers, and while it's being built, how far hashing has got.
+func (s *Server) getEverything(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.everythingBundle())
+}
+
+// getEverythingTorrent serves GET /api/everything/torrent, building it first
+// if the catalog changed since it was last built. That hashes the whole
+// catalog, so with admin.token set only an admin's request starts it.
+func (s *Server) getEverythingTorrent(w http.ResponseWriter, r *http.Request) {
+	bundle := s.everythingBundle()
+	if len(bundle.Models) == 0 {
+		http.Error(w, "No models to bundle", http.StatusNotFound)
+		return
+	}
+	if bundle.TorrentStatus == "absent" && s.adminToken != "" && !s.isAdmin(r) {
+		http.Error(w, "The everything torrent isn't built for the current catalog; an admin request builds it", http.StatusForbidden)
+		return
+	}
+	s.serveBundle(w, r, bundle, "ollama-models-everything")
+}
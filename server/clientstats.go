@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// ClientTransfer is how much one client address has received from this
+// server since it started, over HTTP and from the embedded seeder.
+type ClientTransfer struct {
+	Address      string    `json:"address"`
+	HTTPBytes    int64     `json:"http_bytes"`
+	HTTPRequests int64     `json:"http_requests"`
+	SeederBytes  int64     `json:"seeder_bytes"`
+	TotalBytes   int64     `json:"total_bytes"`
+	TotalHuman   string    `json:"total_human"`
+	LastSeen     time.Time `json:"last_seen"` // latest HTTP request; zero for seeder-only clients
+}
+
+// clientStats counts HTTP response bytes per client address and day.
+type clientStats struct {
+	mu       sync.Mutex
+	days     map[clientDay]*dayTransfer
+	lastSeen map[string]time.Time
+}
+
+// clientDay keys transfer history: a client address on a day, YYYY-MM-DD in
+// UTC like the tracker's completion history.
+type clientDay struct {
+	Address string
+	Day     string
+}
+
+type dayTransfer struct {
+	HTTPBytes    int64
+	HTTPRequests int64
+	SeederBytes  int64
+}
+
+func today() string {
+	return time.Now().UTC().Format(time.DateOnly)
+}
+
+func newClientStats() *clientStats {
+	return &clientStats{days: make(map[clientDay]*dayTransfer), lastSeen: make(map[string]time.Time)}
+}
+
+func (c *clientStats) add(addr string, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := clientDay{addr, today()}
+	day, ok := c.days[key]
+	if !ok {
+		day = &dayTransfer{}
+		c.days[key] = day
+	}
+	day.HTTPBytes += n
+	day.HTTPRequests++
+	c.lastSeen[addr] = time.Now()
+}
+
+// countTransfers wraps the web server's handler to count what each client
+// address is sent: blobs, torrents, scripts and everything else.
+func (s *Server) countTransfers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &countingWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		addr, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			addr = r.RemoteAddr
+		}
+		s.clientStats.add(addr, cw.n)
+	})
+}
+
+// countingWriter counts the body bytes written to a response.
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection, so streamed
+// responses can flush.
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ReadFrom keeps the sendfile path of the underlying connection, which
+// io.Copy from an *os.File in http.ServeContent would otherwise lose.
+func (w *countingWriter) ReadFrom(src io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, src)
+	}
+	w.n += n
+	return n, err
+}
+
+// peerConnClosed adds a closed connection's upload to its address's total
+// for the day. The torrent client calls it with its lock held, and reading
+// the connection's stats takes that lock, so it's read once the lock is free.
+func (s *Seeder) peerConnClosed(pc *torrent.PeerConn) {
+	if pc.Torrent() == nil {
+		return // closed during the handshake, before anything was sent
+	}
+	go func() {
+		stats := pc.Stats()
+		uploaded := stats.BytesWrittenData.Int64()
+		if uploaded == 0 {
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.uploaded[clientDay{peerHost(pc), today()}] += uploaded
+	}()
+}
+
+// peerUploads returns the bytes uploaded to each peer address by day, over
+// closed connections and, counted today, the ones still open.
+func (s *Seeder) peerUploads() map[clientDay]int64 {
+	s.mu.Lock()
+	uploads := make(map[clientDay]int64, len(s.uploaded))
+	for key, n := range s.uploaded {
+		uploads[key] = n
+	}
+	torrents := make([]*torrent.Torrent, 0, len(s.torrents))
+	for _, t := range s.torrents {
+		torrents = append(torrents, t)
+	}
+	s.mu.Unlock()
+
+	day := today()
+	for _, t := range torrents {
+		for _, pc := range t.PeerConns() {
+			stats := pc.Stats()
+			if n := stats.BytesWrittenData.Int64(); n > 0 {
+				uploads[clientDay{peerHost(pc), day}] += n
+			}
+		}
+	}
+	return uploads
+}
+
+func peerHost(pc *torrent.PeerConn) string {
+	addr := pc.RemoteAddr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// clientHistory returns HTTP and seeder transfers per client and day, from
+// the given day on; a zero time returns everything.
+func (s *Server) clientHistory(since time.Time) map[clientDay]dayTransfer {
+	sinceDay := since.UTC().Format(time.DateOnly)
+	history := make(map[clientDay]dayTransfer)
+
+	s.clientStats.mu.Lock()
+	for key, day := range s.clientStats.days {
+		if since.IsZero() || key.Day >= sinceDay {
+			history[key] = *day
+		}
+	}
+	s.clientStats.mu.Unlock()
+
+	if s.seeder != nil {
+		for key, n := range s.seeder.peerUploads() {
+			if since.IsZero() || key.Day >= sinceDay {
+				day := history[key]
+				day.SeederBytes = n
+				history[key] = day
+			}
+		}
+	}
+	return history
+}
+
+// clientTransfers lists every client address by total bytes received, most
+// first.
+func (s *Server) clientTransfers() []ClientTransfer {
+	byAddr := make(map[string]ClientTransfer)
+	for key, day := range s.clientHistory(time.Time{}) {
+		client := byAddr[key.Address]
+		client.Address = key.Address
+		client.HTTPBytes += day.HTTPBytes
+		client.HTTPRequests += day.HTTPRequests
+		client.SeederBytes += day.SeederBytes
+		byAddr[key.Address] = client
+	}
+
+	s.clientStats.mu.Lock()
+	transfers := make([]ClientTransfer, 0, len(byAddr))
+	for addr, client := range byAddr {
+		client.TotalBytes = client.HTTPBytes + client.SeederBytes
+		client.TotalHuman = formatSize(client.TotalBytes)
+		client.LastSeen = s.clientStats.lastSeen[addr]
+		transfers = append(transfers, client)
+	}
+	s.clientStats.mu.Unlock()
+
+	sort.Slice(transfers, func(i, j int) bool {
+		if transfers[i].TotalBytes != transfers[j].TotalBytes {
+			return transfers[i].TotalBytes > transfers[j].TotalBytes
+		}
+		return transfers[i].Address < transfers[j].Address
+	})
+	return transfers
+}
+
+// topClients returns the n clients that have received the most.
+func (s *Server) topClients(n int) []ClientTransfer {
+	transfers := s.clientTransfers()
+	return transfers[:min(n, len(transfers))]
+}
+
+// getClientStats serves per-client transfer totals, optionally only the top
+// ?limit=N, to spot machines downloading the same model over and over.
+func (s *Server) getClientStats(w http.ResponseWriter, r *http.Request) {
+	transfers := s.clientTransfers()
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit >= 0 && limit < len(transfers) {
+		transfers = transfers[:limit]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfers)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ModelComparison lists the blobs two models share and the ones only each
+// has. Going from A to B downloads only what's in OnlyB.
+type ModelComparison struct {
+	A            string         `json:"a"`
+	B            string         `json:"b"`
+	Shared       []ManifestBlob `json:"shared"`
+	OnlyA        []ManifestBlob `json:"only_a"`
+	OnlyB        []ManifestBlob `json:"only_b"`
+	SharedBytes  int64          `json:"shared_bytes"`
+	OnlyABytes   int64          `json:"only_a_bytes"`
+	OnlyBBytes   int64          `json:"only_b_bytes"`
+	UpgradeHuman string         `json:"upgrade_human"` // OnlyBBytes, formatted
+	Summary      string         `json:"summary"`
+}
+
+// ManifestBlob is the config or a layer of a model's manifest.
+type ManifestBlob struct {
+	Digest    string `json:"digest"`
+	MediaType string `json:"media_type"`
+	Kind      string `json:"kind"` // model, template, params, license, system, adapter, projector, config...
+	Size      int64  `json:"size"`
+	SizeHuman string `json:"size_human"`
+}
+
+// manifestBlobs returns a manifest's config followed by its layers.
+func manifestBlobs(data []byte) ([]ManifestBlob, error) {
+	type descriptor struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+		Size      int64  `json:"size"`
+	}
+	var manifest struct {
+		Config descriptor   `json:"config"`
+		Layers []descriptor `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	var blobs []ManifestBlob
+	for i, d := range append([]descriptor{manifest.Config}, manifest.Layers...) {
+		if d.Digest == "" {
+			continue
+		}
+		kind := "config"
+		if i > 0 {
+			// application/vnd.ollama.image.model -> model
+			kind = d.MediaType[strings.LastIndex(d.MediaType, ".")+1:]
+		}
+		blobs = append(blobs, ManifestBlob{
+			Digest:    d.Digest,
+			MediaType: d.MediaType,
+			Kind:      kind,
+			Size:      d.Size,
+			SizeHuman: formatSize(d.Size),
+		})
+	}
+	return blobs, nil
+}
+
+// modelBlobs reads the blobs of a catalog model from its manifest.
+func (s *Server) modelBlobs(name string) ([]ManifestBlob, error) {
+	data, err := s.readManifest(name)
+	if err != nil {
+		return nil, err
+	}
+	return manifestBlobs(data)
+}
+
+// compareModels splits the blobs of two models into shared and unique ones.
+func compareModels(a, b string, blobsA, blobsB []ManifestBlob) ModelComparison {
+	comparison := ModelComparison{A: a, B: b, Shared: []ManifestBlob{}, OnlyA: []ManifestBlob{}, OnlyB: []ManifestBlob{}}
+	inA := make(map[string]bool, len(blobsA))
+	for _, blob := range blobsA {
+		inA[blob.Digest] = true
+	}
+	inB := make(map[string]bool, len(blobsB))
+	for _, blob := range blobsB {
+		inB[blob.Digest] = true
+		if inA[blob.Digest] {
+			comparison.Shared = append(comparison.Shared, blob)
+			comparison.SharedBytes += blob.Size
+		} else {
+			comparison.OnlyB = append(comparison.OnlyB, blob)
+			comparison.OnlyBBytes += blob.Size
+		}
+	}
+	for _, blob := range blobsA {
+		if !inB[blob.Digest] {
+			comparison.OnlyA = append(comparison.OnlyA, blob)
+			comparison.OnlyABytes += blob.Size
+		}
+	}
+
+	comparison.UpgradeHuman = formatSize(comparison.OnlyBBytes)
+	comparison.Summary = fmt.Sprintf("Going from %s to %s needs %s of new data; %s is shared",
+		a, b, comparison.UpgradeHuman, formatSize(comparison.SharedBytes))
+	return comparison
+}
+
+// getModelComparison compares the layers of ?a= and ?b=, so users can tell
+// how much switching from one model to the other actually downloads.
+func (s *Server) getModelComparison(w http.ResponseWriter, r *http.Request) {
+	names := []string{r.URL.Query().Get("a"), r.URL.Query().Get("b")}
+	if names[0] == "" || names[1] == "" {
+		http.Error(w, "both ?a= and ?b= model names are required", http.StatusBadRequest)
+		return
+	}
+
+	var blobs [2][]ManifestBlob
+	for i, name := range names {
+		if _, ok := s.modelByName(name); !ok {
+			http.Error(w, fmt.Sprintf("model %q not found", name), http.StatusNotFound)
+			return
+		}
+		var err error
+		if blobs[i], err = s.modelBlobs(name); err != nil {
+			s.logger.Warnf("Failed to read manifest of %s: %v", name, err)
+			http.Error(w, fmt.Sprintf("failed to read the manifest of %s", name), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(compareModels(names[0], names[1], blobs[0], blobs[1]))
+}
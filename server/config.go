@@ -0,0 +1,587 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Config is the server configuration, read from the YAML config file,
+// OLLAMA_BT_* environment variables, and command-line flags. Keys are the mapstructure
+// tags; config.yaml.example documents each of them.
+type Config struct {
+	Profile string `mapstructure:"profile"` // lan, wan, or airgap; see profiles.go
+
+	Port         string   `mapstructure:"port"`
+	ModelsDir    string   `mapstructure:"models_dir"`
+	StateDir     string   `mapstructure:"state_dir"`     // tracker swarms, certificates, hashing journals
+	DownloadsDir string   `mapstructure:"downloads_dir"` // files listed at /downloads/; default <state_dir>/downloads
+	ExternalURL  string   `mapstructure:"external_url"`
+	Models       []string `mapstructure:"models"`        // allowlist of names or globs; empty publishes every model
+	HTTPFallback bool     `mapstructure:"http_fallback"` // let install scripts without BitTorrent download blobs over HTTP
+	TorrentCache int      `mapstructure:"torrent_cache"` // KiB of .torrent files kept in memory; 0 reads them from disk
+	AlignBlobs   bool     `mapstructure:"align_blobs"`   // start each blob of a new torrent on a piece boundary, reusing its hashes
+
+	ModelVersions int `mapstructure:"model_versions"` // earlier versions kept per model after its tag moves; 0 keeps none
+
+	TLSPort      string       `mapstructure:"tls_port"`
+	TLSCertFile  string       `mapstructure:"tls_cert_file"`
+	TLSKeyFile   string       `mapstructure:"tls_key_file"`
+	RedirectHTTP bool         `mapstructure:"redirect_http"`
+	ACME         ACMESettings `mapstructure:"acme"`
+
+	MDNS         bool   `mapstructure:"mdns"`
+	MDNSHostname string `mapstructure:"mdns_hostname"`
+
+	TrackerURL    string                `mapstructure:"tracker_url"`  // default: embedded tracker or local privtracker
+	TrackerURLs   []string              `mapstructure:"tracker_urls"` // more external trackers, health-checked
+	TrackerHealth TrackerHealthSettings `mapstructure:"tracker_health"`
+	Tracker       TrackerSettings       `mapstructure:"tracker"`
+	Seeder        SeederSettings        `mapstructure:"seeder"`
+
+	Federation FederationSettings `mapstructure:"federation"`
+	Mirror     MirrorSettings     `mapstructure:"mirror"`
+	HA         HASettings         `mapstructure:"ha"`
+	Watch      WatchSettings      `mapstructure:"watch"`
+	Integrity  IntegritySettings  `mapstructure:"integrity"`
+	Metrics    MetricsSettings    `mapstructure:"metrics"`
+	Logging    LoggingSettings    `mapstructure:"logging"`
+	Branding   BrandingSettings   `mapstructure:"branding"`
+
+	TorrentMetadata TorrentMetadataSettings `mapstructure:"torrent_metadata"`
+	ScriptSigning   ScriptSigningSettings   `mapstructure:"script_signing"`
+	Admin           AdminSettings           `mapstructure:"admin"`
+	Notifications   NotificationSettings    `mapstructure:"notifications"`
+
+	ModelOverrides []ModelOverride `mapstructure:"model_overrides"`
+}
+
+type ACMESettings struct {
+	Domains      []string `mapstructure:"domains"`
+	Email        string   `mapstructure:"email"`
+	DirectoryURL string   `mapstructure:"directory_url"` // empty means Let's Encrypt
+	CacheDir     string   `mapstructure:"cache_dir"`     // default <state_dir>/acme
+}
+
+type TrackerHealthSettings struct {
+	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+type TrackerSettings struct {
+	Embedded       bool              `mapstructure:"embedded"`
+	Interval       time.Duration     `mapstructure:"interval"`
+	MinInterval    time.Duration     `mapstructure:"min_interval"`
+	PeerTimeout    time.Duration     `mapstructure:"peer_timeout"` // 0 means twice the interval
+	DefaultNumWant int               `mapstructure:"default_numwant"`
+	MaxNumWant     int               `mapstructure:"max_numwant"`
+	Whitelist      bool              `mapstructure:"whitelist"`
+	RequirePasskey bool              `mapstructure:"require_passkey"`
+	Passkeys       map[string]string `mapstructure:"passkeys"` // client name -> passkey
+}
+
+type SeederSettings struct {
+	Embedded   bool   `mapstructure:"embedded"`
+	Port       int    `mapstructure:"port"`
+	LSD        bool   `mapstructure:"lsd"`
+	PEX        bool   `mapstructure:"pex"`
+	UTP        bool   `mapstructure:"utp"`
+	TCP        bool   `mapstructure:"tcp"`
+	Encryption string `mapstructure:"encryption"`
+
+	MaxUploadRate        int            `mapstructure:"max_upload_rate"`         // KiB/s
+	TorrentMaxUploadRate int            `mapstructure:"torrent_max_upload_rate"` // KiB/s
+	ModelUploadRates     map[string]int `mapstructure:"model_upload_rates"`      // KiB/s by model name
+
+	Policy       string        `mapstructure:"policy"`
+	Pinned       []string      `mapstructure:"pinned"`
+	Models       []string      `mapstructure:"models"`
+	RecentWindow time.Duration `mapstructure:"recent_window"`
+
+	WarmupWindow      time.Duration `mapstructure:"warmup_window"`
+	WarmupConnections int           `mapstructure:"warmup_connections"`
+
+	MaxConnections     int `mapstructure:"max_connections"`
+	HalfOpenPerTorrent int `mapstructure:"half_open_per_torrent"`
+	MaxHalfOpen        int `mapstructure:"max_half_open"`
+}
+
+type FederationSettings struct {
+	Site              string        `mapstructure:"site"` // default hostname
+	RefreshInterval   time.Duration `mapstructure:"refresh_interval"`
+	Peers             []string      `mapstructure:"peers"`
+	RegisterWith      []string      `mapstructure:"register_with"`
+	RegistrationToken string        `mapstructure:"registration_token"`
+	RegistrationTTL   time.Duration `mapstructure:"registration_ttl"`
+	PushToken         string        `mapstructure:"push_token"`
+	PushTo            []string      `mapstructure:"push_to"`
+}
+
+type MirrorSettings struct {
+	UpstreamURL string                 `mapstructure:"upstream_url"` // shorthand for one entry in Upstreams
+	Window      string                 `mapstructure:"window"`
+	MaxRate     int                    `mapstructure:"max_rate"`
+	Interval    time.Duration          `mapstructure:"interval"`
+	Upstreams   []mirrorUpstreamConfig `mapstructure:"upstreams"`
+}
+
+type HASettings struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	NodeID         string        `mapstructure:"node_id"` // default hostname
+	LeaseTTL       time.Duration `mapstructure:"lease_ttl"`
+	RescanInterval time.Duration `mapstructure:"rescan_interval"`
+}
+
+type WatchSettings struct {
+	Dir      string        `mapstructure:"dir"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+type IntegritySettings struct {
+	Interval time.Duration `mapstructure:"interval"` // 0 disables background verification
+	MaxRate  int           `mapstructure:"max_rate"` // KiB/s
+}
+
+type MetricsSettings struct {
+	MaxModels int `mapstructure:"max_models"` // models labeled individually on /metrics; the rest are summed as "other"
+}
+
+// TorrentMetadataSettings tag the torrents the server creates. Comment and
+// created by are outside the info dictionary; source is inside it, so it
+// changes the info-hash.
+type TorrentMetadataSettings struct {
+	Comment   string `mapstructure:"comment"` // {model} is replaced with the model name
+	CreatedBy string `mapstructure:"created_by"`
+	Source    string `mapstructure:"source"`
+}
+
+type LoggingSettings struct {
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"`
+}
+
+// setConfigDefaults registers the default of every setting that has one.
+// Defaults that depend on other settings, such as acme.cache_dir, are
+// filled in by loadConfig.
+func setConfigDefaults(homeDir string) {
+	hostname, _ := os.Hostname()
+
+	viper.SetDefault("models_dir", filepath.Join(homeDir, ".ollama", "models"))
+	viper.SetDefault("state_dir", filepath.Join(homeDir, ".ollama-bt-lancache"))
+	viper.SetDefault("http_fallback", true)
+	viper.SetDefault("torrent_cache", 65536)
+	viper.SetDefault("align_blobs", false)
+	viper.SetDefault("model_versions", 5)
+
+	viper.SetDefault("tracker_health.interval", "1m")
+	viper.SetDefault("tracker_health.timeout", "10s")
+
+	viper.SetDefault("tracker.interval", "2m")
+	viper.SetDefault("tracker.min_interval", "1m")
+	viper.SetDefault("tracker.default_numwant", 50)
+	viper.SetDefault("tracker.max_numwant", 200)
+	viper.SetDefault("tracker.whitelist", true)
+
+	viper.SetDefault("seeder.lsd", true)
+	viper.SetDefault("seeder.pex", true)
+	viper.SetDefault("seeder.utp", true)
+	viper.SetDefault("seeder.tcp", true)
+	viper.SetDefault("seeder.encryption", "prefer")
+	viper.SetDefault("seeder.policy", "all")
+	viper.SetDefault("seeder.recent_window", "24h")
+	viper.SetDefault("seeder.warmup_window", "2h")
+	viper.SetDefault("seeder.warmup_connections", 200)
+
+	viper.SetDefault("federation.site", hostname)
+	viper.SetDefault("federation.refresh_interval", "5m")
+	viper.SetDefault("federation.registration_ttl", "15m")
+
+	viper.SetDefault("mirror.interval", "10m")
+
+	viper.SetDefault("ha.node_id", hostname)
+	viper.SetDefault("ha.lease_ttl", "15s")
+	viper.SetDefault("ha.rescan_interval", "1m")
+
+	viper.SetDefault("watch.interval", "30s")
+
+	viper.SetDefault("integrity.interval", "24h")
+	viper.SetDefault("integrity.max_rate", 51200)
+
+	viper.SetDefault("metrics.max_models", 50)
+
+	viper.SetDefault("logging.level", "info")
+	viper.SetDefault("logging.format", "text")
+
+	viper.SetDefault("torrent_metadata.comment", "Ollama model: {model}")
+	viper.SetDefault("torrent_metadata.created_by", "ollama-bt-lancache")
+
+	viper.SetDefault("branding.title", "Ollama BitTorrent Lancache")
+	viper.SetDefault("branding.accent_color", "#007bff")
+
+	viper.SetDefault("script_signing.enabled", true)
+
+	viper.SetDefault("admin.profile_keep", 24)
+
+	viper.SetDefault("notifications.min_free_space", 20)
+	viper.SetDefault("notifications.disk_check_interval", "5m")
+}
+
+// envPrefix namespaces the environment variables for every setting: a key's
+// dots become underscores, so seeder.max_upload_rate is read from
+// OLLAMA_BT_SEEDER_MAX_UPLOAD_RATE.
+const envPrefix = "OLLAMA_BT"
+
+// bindEnv binds every setting in Config to its environment variable. Viper's
+// AutomaticEnv only consults the environment for keys it already knows from
+// a default or the config file, so without this a setting with no default
+// couldn't be configured from the environment alone.
+func bindEnv() {
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	for _, key := range configKeys(reflect.TypeOf(Config{}), "") {
+		viper.BindEnv(key)
+	}
+}
+
+// configKeys lists the keys of a settings struct. Maps and lists of
+// structs, such as seeder.model_upload_rates, are single keys whose
+// environment variables hold JSON.
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := prefix + field.Tag.Get("mapstructure")
+		if field.Type.Kind() == reflect.Struct {
+			keys = append(keys, configKeys(field.Type, key+".")...)
+		} else {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// legacySettings are sections and keys of the original config.yaml.example
+// that no longer exist, with what replaced them. A config file copied from it
+// still loads: they're ignored with a warning, and server.port is read as
+// port.
+var legacySettings = map[string]string{
+	"server":       "the listening port is now port",
+	"tracker.url":  "the announce URL is now tracker_url",
+	"tracker.port": "the embedded tracker is served on port",
+	"bittorrent":   "the BitTorrent settings are now under seeder",
+	"web":          "the web UI is customized under branding",
+	"security":     "access is controlled with admin.token and tracker passkeys",
+}
+
+// legacySetting returns what replaced a key of the original configuration.
+func legacySetting(key string) (string, bool) {
+	for legacy, hint := range legacySettings {
+		if key == legacy || strings.HasPrefix(key, legacy+".") {
+			return hint, true
+		}
+	}
+	return "", false
+}
+
+// loadConfig decodes and validates the configuration. Every problem is
+// reported at once, including keys that don't match any setting, so a typo
+// in the config file fails loudly instead of silently using a default. Keys
+// of the original configuration are the exception, see legacySettings.
+func loadConfig() (*Config, error) {
+	if viper.IsSet("server.port") && !viper.IsSet("port") {
+		viper.Set("port", viper.GetString("server.port"))
+	}
+
+	var cfg Config
+	var md mapstructure.Metadata
+	decode := func(dc *mapstructure.DecoderConfig) {
+		dc.Metadata = &md
+		dc.DecodeHook = mapstructure.ComposeDecodeHookFunc(emptyDurationHook, jsonEnvHook, dc.DecodeHook)
+	}
+	if err := viper.Unmarshal(&cfg, decode); err != nil {
+		var decodeErr *mapstructure.Error
+		if errors.As(err, &decodeErr) {
+			return nil, fmt.Errorf("invalid configuration: %s", strings.Join(decodeErr.Errors, "; "))
+		}
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	// Directories are often written as ~/..., which nothing else expands
+	for _, dir := range []*string{&cfg.ModelsDir, &cfg.StateDir, &cfg.DownloadsDir, &cfg.ACME.CacheDir} {
+		if expanded, err := homedir.Expand(*dir); err == nil {
+			*dir = expanded
+		}
+	}
+	if cfg.ACME.CacheDir == "" {
+		cfg.ACME.CacheDir = filepath.Join(cfg.StateDir, "acme")
+	}
+	if cfg.DownloadsDir == "" {
+		cfg.DownloadsDir = filepath.Join(cfg.StateDir, "downloads")
+	}
+	if cfg.ScriptSigning.KeyFile == "" {
+		cfg.ScriptSigning.KeyFile = filepath.Join(cfg.StateDir, "script-signing.key")
+	}
+	if cfg.Admin.ProfileDir == "" {
+		cfg.Admin.ProfileDir = filepath.Join(cfg.StateDir, "profiles")
+	}
+	// Not relative to wherever the server happens to be started from
+	if abs, err := filepath.Abs(cfg.DownloadsDir); err == nil {
+		cfg.DownloadsDir = abs
+	}
+
+	problems := cfg.validate()
+	sort.Strings(md.Unused)
+	for _, key := range md.Unused {
+		if hint, ok := legacySetting(key); ok {
+			logger.Warnf("Ignoring %q from an older configuration: %s", key, hint)
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("unknown setting %q", key))
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return &cfg, nil
+}
+
+// emptyDurationHook decodes "" as a zero duration, which the config file uses
+// for "use the default" (e.g. tracker.peer_timeout).
+func emptyDurationHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if to == reflect.TypeOf(time.Duration(0)) && from.Kind() == reflect.String && data.(string) == "" {
+		return time.Duration(0), nil
+	}
+	return data, nil
+}
+
+// jsonEnvHook decodes maps and lists given as a JSON string, which is how
+// they're set from the environment, e.g.
+// OLLAMA_BT_SEEDER_MODEL_UPLOAD_RATES='{"llama3:70b": 20480}'. Plain lists
+// can also be comma-separated.
+func jsonEnvHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String || (to.Kind() != reflect.Map && to.Kind() != reflect.Slice) {
+		return data, nil
+	}
+	value := strings.TrimSpace(data.(string))
+	if !strings.HasPrefix(value, "{") && !strings.HasPrefix(value, "[") {
+		return data, nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return decoded, nil
+}
+
+func (c *Config) validate() []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	checkPort := func(key, value string) {
+		if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+			add("%s must be a port number between 1 and 65535, got %q", key, value)
+		}
+	}
+	checkPositive := func(key string, d time.Duration) {
+		if d <= 0 {
+			add("%s must be a positive duration such as \"30s\" or \"5m\", got %s", key, d)
+		}
+	}
+	checkNonNegative := func(key string, n int) {
+		if n < 0 {
+			add("%s must not be negative, got %d", key, n)
+		}
+	}
+	checkURL := func(key, value string) {
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("%s must be an http(s) URL, got %q", key, value)
+		}
+	}
+
+	checkPort("port", c.Port)
+	checkPort("tls_port", c.TLSPort)
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		add("tls_cert_file and tls_key_file must be set together")
+	}
+	if c.ExternalURL != "" {
+		checkURL("external_url", c.ExternalURL)
+	}
+	if c.ModelsDir == "" {
+		add("models_dir must not be empty")
+	}
+	if c.StateDir == "" {
+		add("state_dir must not be empty")
+	}
+	for _, pattern := range c.Models {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			add("models: invalid model name or pattern %q", pattern)
+		}
+	}
+
+	for _, tracker := range append([]string{c.TrackerURL}, c.TrackerURLs...) {
+		if tracker == "" {
+			continue
+		}
+		if u, err := url.Parse(tracker); err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "udp") || u.Host == "" {
+			add("tracker URL %q must be an http(s) or udp URL", tracker)
+		}
+	}
+	checkPositive("tracker_health.interval", c.TrackerHealth.Interval)
+	checkPositive("tracker_health.timeout", c.TrackerHealth.Timeout)
+
+	checkPositive("tracker.interval", c.Tracker.Interval)
+	checkPositive("tracker.min_interval", c.Tracker.MinInterval)
+	if c.Tracker.MinInterval > c.Tracker.Interval {
+		add("tracker.min_interval (%s) must not be longer than tracker.interval (%s)", c.Tracker.MinInterval, c.Tracker.Interval)
+	}
+	if c.Tracker.PeerTimeout < 0 {
+		add("tracker.peer_timeout must not be negative, got %s", c.Tracker.PeerTimeout)
+	}
+	if c.Tracker.DefaultNumWant < 1 || c.Tracker.MaxNumWant < 1 {
+		add("tracker.default_numwant and tracker.max_numwant must be at least 1")
+	} else if c.Tracker.DefaultNumWant > c.Tracker.MaxNumWant {
+		add("tracker.default_numwant (%d) must not exceed tracker.max_numwant (%d)", c.Tracker.DefaultNumWant, c.Tracker.MaxNumWant)
+	}
+
+	if c.Seeder.Port < 1 || c.Seeder.Port > 65535 {
+		add("seeder.port must be a port number between 1 and 65535, got %d", c.Seeder.Port)
+	}
+	if !c.Seeder.UTP && !c.Seeder.TCP {
+		add("seeder.utp and seeder.tcp can't both be disabled")
+	}
+	switch c.Seeder.Encryption {
+	case "prefer", "require", "disable":
+	default:
+		add("seeder.encryption must be prefer, require, or disable, got %q", c.Seeder.Encryption)
+	}
+	switch c.Seeder.Policy {
+	case "all", "pinned", "recent", "list":
+	default:
+		add("seeder.policy must be all, pinned, recent, or list, got %q", c.Seeder.Policy)
+	}
+	checkNonNegative("seeder.max_upload_rate", c.Seeder.MaxUploadRate)
+	checkNonNegative("seeder.torrent_max_upload_rate", c.Seeder.TorrentMaxUploadRate)
+	for model, rate := range c.Seeder.ModelUploadRates {
+		checkNonNegative("seeder.model_upload_rates."+model, rate)
+	}
+	checkPositive("seeder.recent_window", c.Seeder.RecentWindow)
+	if c.Seeder.WarmupWindow < 0 {
+		add("seeder.warmup_window must not be negative, got %s", c.Seeder.WarmupWindow)
+	}
+	checkNonNegative("seeder.warmup_connections", c.Seeder.WarmupConnections)
+	checkNonNegative("seeder.max_connections", c.Seeder.MaxConnections)
+	checkNonNegative("seeder.half_open_per_torrent", c.Seeder.HalfOpenPerTorrent)
+	checkNonNegative("seeder.max_half_open", c.Seeder.MaxHalfOpen)
+
+	checkPositive("federation.refresh_interval", c.Federation.RefreshInterval)
+	checkPositive("federation.registration_ttl", c.Federation.RegistrationTTL)
+	for _, peer := range c.Federation.Peers {
+		checkURL("federation.peers", peer)
+	}
+	for _, primary := range c.Federation.RegisterWith {
+		checkURL("federation.register_with", primary)
+	}
+	for _, edge := range c.Federation.PushTo {
+		checkURL("federation.push_to", edge)
+	}
+	if len(c.Federation.RegisterWith) > 0 && c.Federation.RegistrationToken == "" {
+		add("federation.register_with requires federation.registration_token")
+	}
+	if len(c.Federation.PushTo) > 0 && c.Federation.PushToken == "" {
+		add("federation.push_to requires federation.push_token")
+	}
+
+	checkPositive("mirror.interval", c.Mirror.Interval)
+	for _, upstream := range c.Mirror.upstreams() {
+		checkURL("mirror upstream", upstream.URL)
+		if _, err := parseReplicationWindow(upstream.Window); err != nil {
+			add("mirror upstream %s: %v", upstream.URL, err)
+		}
+		checkNonNegative("mirror upstream max_rate", upstream.MaxRate)
+	}
+	if len(c.Mirror.upstreams()) > 0 && !c.Seeder.Embedded {
+		add("mirror mode requires the embedded seeder (seeder.embedded)")
+	}
+
+	if c.HA.Enabled && c.HA.NodeID == "" {
+		add("ha.node_id must be set when ha.enabled is true")
+	}
+	checkPositive("ha.lease_ttl", c.HA.LeaseTTL)
+	checkPositive("ha.rescan_interval", c.HA.RescanInterval)
+
+	checkPositive("watch.interval", c.Watch.Interval)
+
+	if c.Integrity.Interval < 0 {
+		add("integrity.interval must not be negative, got %s", c.Integrity.Interval)
+	}
+	checkNonNegative("integrity.max_rate", c.Integrity.MaxRate)
+	checkNonNegative("metrics.max_models", c.Metrics.MaxModels)
+	checkNonNegative("torrent_cache", c.TorrentCache)
+	checkNonNegative("model_versions", c.ModelVersions)
+
+	if c.Admin.Listen != "" && c.Admin.Token == "" {
+		add("admin.listen requires admin.token")
+	}
+	if c.Admin.ProfileInterval < 0 {
+		add("admin.profile_interval must not be negative, got %s", c.Admin.ProfileInterval)
+	}
+	if c.Admin.ProfileInterval > 0 && c.Admin.ProfileKeep < 1 {
+		add("admin.profile_keep must be at least 1, got %d", c.Admin.ProfileKeep)
+	}
+
+	problems = append(problems, c.validateProfile()...)
+	problems = append(problems, c.Branding.validate()...)
+	problems = append(problems, c.Notifications.validate()...)
+
+	for i, override := range c.ModelOverrides {
+		if err := override.validate(); err != nil {
+			add("model_overrides[%d]: %v", i, err)
+		}
+	}
+
+	if _, err := logrus.ParseLevel(c.Logging.Level); err != nil {
+		add("logging.level must be debug, info, warn, or error, got %q", c.Logging.Level)
+	}
+	if c.Logging.Format != "text" && c.Logging.Format != "json" {
+		add("logging.format must be text or json, got %q", c.Logging.Format)
+	}
+
+	return problems
+}
+
+// upstreams returns mirror.upstreams plus the mirror.upstream_url shorthand.
+func (m MirrorSettings) upstreams() []mirrorUpstreamConfig {
+	upstreams := append([]mirrorUpstreamConfig{}, m.Upstreams...)
+	if m.UpstreamURL != "" {
+		upstreams = append(upstreams, mirrorUpstreamConfig{URL: m.UpstreamURL, Window: m.Window, MaxRate: m.MaxRate})
+	}
+	return upstreams
+}
+
+// applyLogging configures the logger from the logging section.
+func applyLogging(logger *logrus.Logger, cfg LoggingSettings) {
+	if level, err := logrus.ParseLevel(cfg.Level); err == nil {
+		logger.SetLevel(level)
+	}
+	if cfg.Format == "json" {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logger.SetFormatter(&logrus.TextFormatter{})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// torrentProblems compares an existing model .torrent with the model as it
+// is on disk now: every file the torrent lists must exist with the recorded
+// size, and every blob in the current manifest must be in the torrent. A
+// re-pulled tag or a pruned blob shows up here, before clients get metadata
+// they can never complete. A piece size, private flag or source that no
+// longer matches the configuration also calls for a new torrent.
+func (s *Server) torrentProblems(torrentPath string, model *Model) []string {
+	mi, err := metainfo.LoadFromFile(torrentPath)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to load torrent: %v", err)}
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return []string{fmt.Sprintf("failed to decode info: %v", err)}
+	}
+
+	var problems []string
+	settings := s.modelSettings(model.Name)
+	if pieceLength := min(settings.PieceSize, info.TotalLength()); info.PieceLength != pieceLength {
+		problems = append(problems, fmt.Sprintf("piece size is %d, configured %d", info.PieceLength, pieceLength))
+	}
+	if private := info.Private != nil && *info.Private; private != settings.Private {
+		problems = append(problems, fmt.Sprintf("private flag is %t, configured %t", private, settings.Private))
+	}
+	if info.Source != s.torrentMeta.Source {
+		problems = append(problems, fmt.Sprintf("source is %q, configured %q", info.Source, s.torrentMeta.Source))
+	}
+
+	listed := make(map[string]bool)
+	for _, file := range info.UpvertedFiles() {
+		rel := filepath.Join(file.Path...)
+		listed[rel] = true
+		stat, err := os.Stat(filepath.Join(s.modelsDir, rel))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s is missing", strings.Join(file.Path, "/")))
+		} else if stat.Size() != file.Length {
+			problems = append(problems, fmt.Sprintf("%s is %d bytes, torrent has %d", strings.Join(file.Path, "/"), stat.Size(), file.Length))
+		}
+	}
+
+	manifestPath, err := s.manifestPath(model.Name)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return append(problems, fmt.Sprintf("failed to read manifest: %v", err))
+	}
+	digests, err := manifestDigests(data)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	for _, digest := range digests {
+		rel, err := filepath.Rel(s.modelsDir, s.blobPath(digest))
+		if err == nil && !listed[rel] {
+			if _, err := os.Stat(s.blobPath(digest)); err == nil {
+				problems = append(problems, fmt.Sprintf("blob %s is not in the torrent", digest))
+			}
+		}
+	}
+	return problems
+}
+
+// missingBlobs lists the digests, from a manifest, that have no blob in the
+// models directory.
+func (s *Server) missingBlobs(digests []string) []string {
+	var missing []string
+	for _, digest := range digests {
+		if _, err := os.Stat(s.blobPath(digest)); err != nil {
+			missing = append(missing, digest)
+		}
+	}
+	return missing
+}
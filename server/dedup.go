@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// DedupReport compares the catalog's logical size, every model counted in
+// full, with what its blobs take on disk. Models built on the same base share
+// its layers, and so do tags of one model, so the difference can be large.
+type DedupReport struct {
+	Summary       string       `json:"summary"` // e.g. "12 models, 310 GB logical, 190 GB on disk"
+	Models        int          `json:"models"`
+	Blobs         int          `json:"blobs"`
+	LogicalBytes  int64        `json:"logical_bytes"`
+	LogicalHuman  string       `json:"logical_human"`
+	PhysicalBytes int64        `json:"physical_bytes"`
+	PhysicalHuman string       `json:"physical_human"`
+	SavedBytes    int64        `json:"saved_bytes"`
+	SavedHuman    string       `json:"saved_human"`
+	SharedBlobs   []SharedBlob `json:"shared_blobs"` // blobs used by more than one model, largest savings first
+}
+
+// SharedBlob is a blob referenced by more than one model.
+type SharedBlob struct {
+	Digest     string   `json:"digest"`
+	Size       int64    `json:"size"`
+	Models     []string `json:"models"`
+	SavedBytes int64    `json:"saved_bytes"` // size × (models - 1)
+}
+
+// dedupReport adds up the blobs of every catalog model. Blobs that aren't on
+// disk, such as those of an incomplete model, count toward neither size.
+func (s *Server) dedupReport() DedupReport {
+	users := s.blobUsers()
+	hidden := s.hiddenNames()
+	report := DedupReport{Models: len(s.catalog()), SharedBlobs: []SharedBlob{}}
+	for digest, models := range users {
+		info, err := os.Stat(s.blobPath(digest))
+		if err != nil {
+			continue
+		}
+		size := info.Size()
+		report.Blobs++
+		report.PhysicalBytes += size
+		report.LogicalBytes += size * int64(len(models))
+		if len(models) > 1 {
+			report.SharedBlobs = append(report.SharedBlobs, SharedBlob{
+				Digest:     digest,
+				Size:       size,
+				Models:     redactHidden(models, hidden),
+				SavedBytes: size * int64(len(models)-1),
+			})
+		}
+	}
+	sort.Slice(report.SharedBlobs, func(i, j int) bool {
+		a, b := report.SharedBlobs[i], report.SharedBlobs[j]
+		if a.SavedBytes != b.SavedBytes {
+			return a.SavedBytes > b.SavedBytes
+		}
+		return a.Digest < b.Digest
+	})
+
+	report.SavedBytes = report.LogicalBytes - report.PhysicalBytes
+	report.LogicalHuman = formatSize(report.LogicalBytes)
+	report.PhysicalHuman = formatSize(report.PhysicalBytes)
+	report.SavedHuman = formatSize(report.SavedBytes)
+	report.Summary = fmt.Sprintf("%d models, %s logical, %s on disk", report.Models, report.LogicalHuman, report.PhysicalHuman)
+	return report
+}
+
+// getDedupReport serves the deduplication report.
+func (s *Server) getDedupReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.dedupReport())
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// DeletedModel reports what deleting a model removed.
+type DeletedModel struct {
+	Model        string   `json:"model"`
+	Manifest     string   `json:"manifest"`
+	Torrent      string   `json:"torrent,omitempty"`
+	RemovedBlobs []string `json:"removed_blobs"`
+	KeptBlobs    []string `json:"kept_blobs"` // still used by another manifest
+	FreedBytes   int64    `json:"freed_bytes"`
+	FreedHuman   string   `json:"freed_human"`
+}
+
+// referencedBlobs returns the digests used by every manifest on disk except
+// skip, including models the allowlist doesn't publish, and by the earlier
+// versions kept outside skipVersions. It fails when a manifest can't be read,
+// since its blobs would then look unused. A manifest that doesn't parse, such
+// as a quarantined one or a push still being written, keeps every digest that
+// appears in it.
+func (s *Server) referencedBlobs(skip, skipVersions string) (map[string]bool, error) {
+	used := make(map[string]bool)
+	addManifest := func(path string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		digests, err := manifestDigests(data)
+		if err != nil {
+			s.logger.Warnf("Keeping every blob mentioned by %s, which doesn't parse: %v", path, err)
+			digests = mentionedDigests(data)
+		}
+		for _, digest := range digests {
+			used[digest] = true
+		}
+		return nil
+	}
+
+	err := filepath.Walk(filepath.Join(s.modelsDir, "manifests"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || path == skip {
+			return nil
+		}
+		return addManifest(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Torrents of earlier versions stay downloadable while their blobs are kept
+	kept, _ := filepath.Glob(filepath.Join(s.stateDir, "versions", "*", "*.manifest"))
+	for _, path := range kept {
+		if filepath.Dir(path) == skipVersions {
+			continue
+		}
+		if err := addManifest(path); err != nil {
+			return nil, err
+		}
+	}
+	return used, nil
+}
+
+var mentionedDigest = regexp.MustCompile(`sha256[:-][0-9a-f]{64}`)
+
+// mentionedDigests finds every blob digest in data, however it's laid out.
+func mentionedDigests(data []byte) []string {
+	var digests []string
+	for _, match := range mentionedDigest.FindAll(data, -1) {
+		digests = append(digests, "sha256:"+string(match[len("sha256:"):]))
+	}
+	return digests
+}
+
+// deleteModel removes a model's manifest and torrent, and the blobs no other
+// manifest uses, like `ollama rm` on the server itself.
+func (s *Server) deleteModel(name string) (DeletedModel, error) {
+	model, _ := s.modelByName(name)
+	manifestPath, err := s.manifestPath(name)
+	if err != nil {
+		return DeletedModel{}, err
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return DeletedModel{}, err
+	}
+	digests, err := manifestDigests(data)
+	if err != nil {
+		return DeletedModel{}, err
+	}
+	used, err := s.referencedBlobs(manifestPath, s.versionsDir(name))
+	if err != nil {
+		return DeletedModel{}, fmt.Errorf("failed to check which blobs are shared: %w", err)
+	}
+
+	if s.seeder != nil && model.InfoHash != "" {
+		s.seeder.drop(model.InfoHash)
+	}
+	if err := os.Remove(manifestPath); err != nil {
+		return DeletedModel{}, err
+	}
+	// Leave no empty model directory behind; Remove fails on other tags
+	os.Remove(filepath.Dir(manifestPath))
+
+	deleted := DeletedModel{Model: name, Manifest: manifestPath, RemovedBlobs: []string{}, KeptBlobs: []string{}}
+	if model.TorrentFile != "" {
+		if err := os.Remove(model.TorrentFile); err == nil {
+			deleted.Torrent = model.TorrentFile
+		} else if !os.IsNotExist(err) {
+			s.logger.Warnf("Failed to remove torrent of %s: %v", name, err)
+		}
+	}
+	// Earlier versions only download while their blobs are around
+	if err := os.RemoveAll(s.versionsDir(name)); err != nil {
+		s.logger.Warnf("Failed to remove the kept versions of %s: %v", name, err)
+	}
+	for _, digest := range digests {
+		if used[digest] {
+			deleted.KeptBlobs = append(deleted.KeptBlobs, digest)
+			continue
+		}
+		path := s.blobPath(digest)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			s.logger.Warnf("Failed to remove blob %s of %s: %v", digest, name, err)
+			continue
+		}
+		used[digest] = true // a manifest may list a blob twice
+		deleted.RemovedBlobs = append(deleted.RemovedBlobs, digest)
+		deleted.FreedBytes += info.Size()
+	}
+	sort.Strings(deleted.RemovedBlobs)
+	sort.Strings(deleted.KeptBlobs)
+	deleted.FreedHuman = formatSize(deleted.FreedBytes)
+	return deleted, nil
+}
+
+// handleDeleteModel serves DELETE /api/models/{name}, behind the admin token.
+func (s *Server) handleDeleteModel(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, ok := s.modelByName(name); !ok {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+	// Servers sharing a models directory leave writes to the leader
+	if !s.lease.isLeader() {
+		http.Error(w, "Not the leader; delete on the other server of the pair", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.deleteMu.Lock()
+	deleted, err := s.deleteModel(name)
+	s.deleteMu.Unlock()
+	if err != nil {
+		s.logger.Errorf("Failed to delete %s: %v", name, err)
+		http.Error(w, fmt.Sprintf("Failed to delete %s: %v", name, err), http.StatusInternalServerError)
+		return
+	}
+	s.logger.Infof("Deleted model %s: removed %d blobs (%s), kept %d shared", name, len(deleted.RemovedBlobs), deleted.FreedHuman, len(deleted.KeptBlobs))
+	if err := s.discoverModels(); err != nil {
+		s.logger.Errorf("Failed to rediscover models: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deleted)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/gorilla/mux"
+)
+
+// A delta is what a client holding an earlier version of a model is missing
+// from the current one: the layers the new manifest added, and the manifest.
+// The earlier version has to be one this server kept (see versions.go), named
+// by its manifest digest in ?from=. Each file comes with its URL and its index
+// in the model's torrent, so a BitTorrent client can select just those files:
+//
+//	aria2c --select-file=$(curl -s ".../delta?from=sha256:...&format=select") ...
+
+// FileSelection is the part of a model's files a client still needs, as HTTP
+// URLs and as a selection of files from the model's torrent.
+type FileSelection struct {
+	TorrentURL string      `json:"torrent_url"`
+	Files      []DeltaFile `json:"files"` // blobs, then the manifest
+	Size       int64       `json:"size"`
+	SizeHuman  string      `json:"size_human"`
+	FullSize   int64       `json:"full_size"` // what downloading the whole model would transfer
+	Select     string      `json:"select"`    // 1-based torrent file indices, for aria2c --select-file
+}
+
+// ModelDelta lists the files a client needs to go from one version of a model
+// to the current one.
+type ModelDelta struct {
+	Model string `json:"model"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	FileSelection
+}
+
+// DeltaFile is a file of a delta, with its position among the files of the
+// torrent, padding files included.
+type DeltaFile struct {
+	BlobFile
+	TorrentIndex int `json:"torrent_index"`
+}
+
+// torrentFileIndices maps each file path of a torrent, under its name, to its
+// index in the info dictionary's file list.
+func torrentFileIndices(data []byte) (map[string]int, error) {
+	var torrent TorrentFile
+	if err := bencode.Unmarshal(data, &torrent); err != nil {
+		return nil, fmt.Errorf("failed to decode torrent: %w", err)
+	}
+	indices := make(map[string]int, len(torrent.Info.Files))
+	for i, file := range torrent.Info.Files {
+		indices[strings.Join(file.Path, "/")] = i
+	}
+	return indices, nil
+}
+
+// modelDelta works out what a client at the version from is missing.
+func (s *Server) modelDelta(model Model, from string) (ModelDelta, error) {
+	id := strings.TrimPrefix(from, "sha256:")
+	var old []byte
+	var err error
+	if "sha256:"+id == model.Digest {
+		old, err = s.readManifest(model.Name)
+	} else {
+		old, err = os.ReadFile(filepath.Join(s.versionsDir(model.Name), id+".manifest"))
+	}
+	if err != nil {
+		return ModelDelta{}, err
+	}
+	oldDigests, err := manifestDigests(old)
+	if err != nil {
+		return ModelDelta{}, err
+	}
+	// A client already at the current version has its manifest too
+	have := map[string]bool{"sha256:" + id: true}
+	for _, digest := range oldDigests {
+		have[digest] = true
+	}
+
+	selection, err := s.selectFiles(model, have)
+	if err != nil {
+		return ModelDelta{}, err
+	}
+	return ModelDelta{Model: model.Name, From: "sha256:" + id, To: model.Digest, FileSelection: selection}, nil
+}
+
+// selectFiles lists the files of a model whose digests aren't in have. The
+// manifest's digest is the model's, so a client that has it can say so.
+func (s *Server) selectFiles(model Model, have map[string]bool) (FileSelection, error) {
+	listing, err := s.blobListing(model)
+	if err != nil {
+		return FileSelection{}, err
+	}
+	torrent, err := s.torrentCache.get(model.TorrentFile)
+	if err != nil {
+		return FileSelection{}, err
+	}
+	indices, err := torrentFileIndices(torrent.data)
+	if err != nil {
+		return FileSelection{}, err
+	}
+
+	selection := FileSelection{
+		TorrentURL: fmt.Sprintf("%s/api/models/%s/torrent", s.baseURL(), url.PathEscape(model.Name)),
+		Files:      []DeltaFile{},
+	}
+	var selected []string
+	for _, file := range listing.Files {
+		selection.FullSize += file.Size
+		if have["sha256:"+file.SHA256] {
+			continue
+		}
+		index, ok := indices[file.Path]
+		if !ok {
+			// Rebuilt since the listing was read; the client should retry
+			return FileSelection{}, fmt.Errorf("%s is not in the torrent", file.Path)
+		}
+		selection.Files = append(selection.Files, DeltaFile{BlobFile: file, TorrentIndex: index})
+		selection.Size += file.Size
+		selected = append(selected, strconv.Itoa(index+1))
+	}
+	selection.SizeHuman = formatSize(selection.Size)
+	selection.Select = strings.Join(selected, ",")
+	return selection, nil
+}
+
+// writeFileSelection writes a selection in the ?format= a client asked for.
+func writeFileSelection(w http.ResponseWriter, r *http.Request, selection FileSelection, body interface{}) {
+	switch r.URL.Query().Get("format") {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain")
+		for _, file := range selection.Files {
+			fmt.Fprintf(w, "%s %d %s %s\n", file.SHA256, file.Size, file.Path, file.URL)
+		}
+	case "select":
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, selection.Select)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// getModelDelta serves GET /api/models/{name}/delta?from=sha256:<hex>. With
+// ?format=text it's one "sha256 size path url" line per file like the blob
+// listing, and ?format=select gives just the torrent file indices.
+func (s *Server) getModelDelta(w http.ResponseWriter, r *http.Request) {
+	model, ok := s.modelByName(mux.Vars(r)["name"])
+	if !ok {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+	if model.Incomplete || model.InfoHash == "" {
+		http.Error(w, fmt.Sprintf("The torrent of %s isn't ready", model.Name), http.StatusConflict)
+		return
+	}
+	from := r.URL.Query().Get("from")
+	if !versionHex.MatchString(strings.TrimPrefix(from, "sha256:")) {
+		http.Error(w, "from: expected sha256:<64 hex digits>, the digest of the version you have", http.StatusBadRequest)
+		return
+	}
+
+	delta, err := s.modelDelta(model, from)
+	if os.IsNotExist(err) {
+		http.Error(w, fmt.Sprintf("No version %s of %s is kept; download the whole model", from, model.Name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.logger.Errorf("Failed to work out the delta of %s from %s: %v", model.Name, from, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	writeFileSelection(w, r, delta.FileSelection, delta)
+}
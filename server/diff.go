@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// CatalogDiff compares this server's catalog with another lancache's, for
+// scripting targeted replication.
+type CatalogDiff struct {
+	Peer          string      `json:"peer"`
+	MissingOnPeer []Model     `json:"missing_on_peer"` // ours, not on the peer
+	MissingLocal  []Model     `json:"missing_local"`   // the peer's, not ours
+	Different     []ModelPair `json:"different"`       // same name, different info-hash
+}
+
+// ModelPair is a model both servers hold under one name but built from
+// different pulls of the tag.
+type ModelPair struct {
+	Name  string `json:"name"`
+	Local Model  `json:"local"`
+	Peer  Model  `json:"peer"`
+}
+
+// getCatalogDiff compares the catalog with the one ?peer=URL publishes. Any
+// lancache can be compared, not only configured federation peers.
+func (s *Server) getCatalogDiff(w http.ResponseWriter, r *http.Request) {
+	peer := strings.TrimSuffix(r.URL.Query().Get("peer"), "/")
+	u, err := url.Parse(peer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "peer must be an http(s) URL", http.StatusBadRequest)
+		return
+	}
+
+	catalog, err := fetchCatalog(peer)
+	if err != nil {
+		s.logger.Warnf("Failed to fetch catalog from %s: %v", peer, err)
+		http.Error(w, "Failed to fetch peer catalog: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diffCatalogs(peer, s.visibleCatalog(), catalog.Models))
+}
+
+// diffCatalogs compares two model lists by name, each result sorted by name.
+func diffCatalogs(peer string, local, remote []Model) CatalogDiff {
+	diff := CatalogDiff{Peer: peer, MissingOnPeer: []Model{}, MissingLocal: []Model{}, Different: []ModelPair{}}
+
+	remoteByName := make(map[string]Model, len(remote))
+	for _, model := range remote {
+		remoteByName[model.Name] = model
+	}
+	localNames := make(map[string]bool, len(local))
+	for _, model := range local {
+		localNames[model.Name] = true
+		other, ok := remoteByName[model.Name]
+		switch {
+		case !ok:
+			diff.MissingOnPeer = append(diff.MissingOnPeer, model)
+		case other.InfoHash != model.InfoHash:
+			diff.Different = append(diff.Different, ModelPair{Name: model.Name, Local: model, Peer: other})
+		}
+	}
+	for _, model := range remote {
+		if !localNames[model.Name] {
+			diff.MissingLocal = append(diff.MissingLocal, model)
+		}
+	}
+
+	sort.Slice(diff.MissingOnPeer, func(i, j int) bool { return diff.MissingOnPeer[i].Name < diff.MissingOnPeer[j].Name })
+	sort.Slice(diff.MissingLocal, func(i, j int) bool { return diff.MissingLocal[i].Name < diff.MissingLocal[j].Name })
+	sort.Slice(diff.Different, func(i, j int) bool { return diff.Different[i].Name < diff.Different[j].Name })
+	return diff
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventDownloadCompleted is sent for every download a client completes. It
+// can be frequent, so webhooks only get it when they list it in events.
+const eventDownloadCompleted = "download_completed"
+
+// ServerEvent is one message on the /api/events stream.
+type ServerEvent struct {
+	Event   string    `json:"event"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	Details any       `json:"details,omitempty"`
+}
+
+// DownloadCompleted is the details of a download_completed event.
+type DownloadCompleted struct {
+	Completion
+	Model string `json:"model,omitempty"` // empty for torrents not in the catalog
+}
+
+// eventStream fans events out to /api/events subscribers. A subscriber that
+// falls behind misses events rather than holding up the sender.
+type eventStream struct {
+	mu          sync.Mutex
+	subscribers map[chan ServerEvent]bool
+}
+
+func newEventStream() *eventStream {
+	return &eventStream{subscribers: make(map[chan ServerEvent]bool)}
+}
+
+func (e *eventStream) publish(event ServerEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (e *eventStream) subscribe() chan ServerEvent {
+	ch := make(chan ServerEvent, 64)
+	e.mu.Lock()
+	e.subscribers[ch] = true
+	e.mu.Unlock()
+	return ch
+}
+
+func (e *eventStream) unsubscribe(ch chan ServerEvent) {
+	e.mu.Lock()
+	delete(e.subscribers, ch)
+	e.mu.Unlock()
+}
+
+// downloadCompleted turns a completion reported to the embedded tracker into
+// a download_completed event.
+func (s *Server) downloadCompleted(c Completion) {
+	details := DownloadCompleted{Completion: c}
+	name := c.InfoHash
+	if model, ok := s.modelByInfoHash(c.InfoHash); ok {
+		details.Model = model.Name
+		name = model.Name
+	}
+	who := c.IP
+	if c.Client != "" {
+		who = fmt.Sprintf("%s (%s)", c.Client, c.IP)
+	}
+	s.notifyDetails(eventDownloadCompleted, fmt.Sprintf("%s finished downloading %s (%d seeders, %d downloading)", who, name, c.Seeders, c.Leechers), details)
+}
+
+// streamEvents serves server events as Server-Sent Events, so a dashboard
+// can follow a rollout live. ?events= limits the stream to a comma-separated
+// list of events.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	var only []string
+	if list := r.URL.Query().Get("events"); list != "" {
+		only = strings.Split(list, ",")
+		for _, event := range only {
+			if !containsString(notificationEvents, event) {
+				http.Error(w, fmt.Sprintf("unknown event %q (want %s)", event, strings.Join(notificationEvents, ", ")), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // don't let a reverse proxy buffer the stream
+	rc := http.NewResponseController(w)
+	fmt.Fprint(w, ": connected\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	events := s.events.subscribe()
+	defer s.events.unsubscribe(events)
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case event := <-events:
+			if len(only) > 0 && !containsString(only, event.Event) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// StatsRow is one line of the statistics export: a model's completed
+// downloads on a day, or what a client received on a day.
+type StatsRow struct {
+	Type         string `json:"type"` // model or client
+	Date         string `json:"date"` // YYYY-MM-DD, UTC
+	Model        string `json:"model,omitempty"`
+	InfoHash     string `json:"info_hash,omitempty"`
+	Client       string `json:"client,omitempty"`
+	Downloads    int64  `json:"downloads"`
+	HTTPRequests int64  `json:"http_requests"`
+	HTTPBytes    int64  `json:"http_bytes"`
+	SeederBytes  int64  `json:"seeder_bytes"`
+	Bytes        int64  `json:"bytes"` // a model's downloads × its size, or a client's HTTP and seeder bytes
+}
+
+var statsColumns = []string{"type", "date", "model", "info_hash", "client", "downloads", "http_requests", "http_bytes", "seeder_bytes", "bytes"}
+
+// statsRows collects the export's rows for ?range= and ?type= (models,
+// clients, or both when empty), oldest day first. Model history comes from
+// the embedded tracker and is kept across restarts; client history is kept
+// in memory since the server started.
+func (s *Server) statsRows(r *http.Request) ([]StatsRow, error) {
+	since, _, err := statsRange(r, "all")
+	if err != nil {
+		return nil, err
+	}
+	kind := r.URL.Query().Get("type")
+	if kind != "" && kind != "models" && kind != "clients" {
+		return nil, fmt.Errorf("invalid type %q (want models or clients)", kind)
+	}
+
+	rows := []StatsRow{}
+	if kind != "clients" && s.tracker != nil {
+		models := make(map[string]Model)
+		for _, model := range s.catalog() {
+			if model.InfoHash != "" {
+				models[model.InfoHash] = model
+			}
+		}
+		for infoHash, days := range s.tracker.CompletionsByDay(since) {
+			model := models[infoHash] // unknown once removed from the catalog
+			if model.Hidden {
+				continue
+			}
+			for day, n := range days {
+				rows = append(rows, StatsRow{
+					Type:      "model",
+					Date:      day,
+					Model:     model.Name,
+					InfoHash:  infoHash,
+					Downloads: n,
+					Bytes:     n * model.Size,
+				})
+			}
+		}
+	}
+	if kind != "models" {
+		for key, day := range s.clientHistory(since) {
+			rows = append(rows, StatsRow{
+				Type:         "client",
+				Date:         key.Day,
+				Client:       key.Address,
+				HTTPRequests: day.HTTPRequests,
+				HTTPBytes:    day.HTTPBytes,
+				SeederBytes:  day.SeederBytes,
+				Bytes:        day.HTTPBytes + day.SeederBytes,
+			})
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.Type != b.Type {
+			return a.Type > b.Type // models first
+		}
+		if a.InfoHash != b.InfoHash {
+			return a.InfoHash < b.InfoHash
+		}
+		return a.Client < b.Client
+	})
+	return rows, nil
+}
+
+// exportStats dumps per-model and per-client history for spreadsheets and
+// BI tools, as ?format=csv or JSON (the default).
+func (s *Server) exportStats(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.statsRows(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rows)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="ollama-bt-lancache-stats.csv"`)
+		cw := csv.NewWriter(w)
+		cw.Write(statsColumns)
+		for _, row := range rows {
+			cw.Write([]string{
+				row.Type, row.Date, row.Model, row.InfoHash, row.Client,
+				strconv.FormatInt(row.Downloads, 10),
+				strconv.FormatInt(row.HTTPRequests, 10),
+				strconv.FormatInt(row.HTTPBytes, 10),
+				strconv.FormatInt(row.SeederBytes, 10),
+				strconv.FormatInt(row.Bytes, 10),
+			})
+		}
+		cw.Flush()
+	default:
+		http.Error(w, "format must be csv or json", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Capabilities tells install scripts which transports this server offers, so
+// they can pick one before installing anything.
+type Capabilities struct {
+	BitTorrent    bool     `json:"bittorrent"`
+	HTTPFallback  bool     `json:"http_fallback"` // models can be fetched blob by blob over HTTP
+	SignedScripts bool     `json:"signed_scripts"`
+	ScriptClients []string `json:"script_clients"` // values for install.sh?client=
+}
+
+func (s *Server) getCapabilities(w http.ResponseWriter, r *http.Request) {
+	clients := make([]string, 0, len(bashVariants))
+	for client := range bashVariants {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Capabilities{
+		BitTorrent:    true,
+		HTTPFallback:  s.httpFallback,
+		SignedScripts: s.signer != nil,
+		ScriptClients: clients,
+	})
+}
+
+// BlobFile is one file of a model, as a client without BitTorrent downloads
+// it: from URL to Path under its Ollama models directory.
+type BlobFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	URL    string `json:"url"`
+}
+
+type BlobListing struct {
+	Model string     `json:"model"`
+	Files []BlobFile `json:"files"`
+}
+
+// getModelBlobs lists the files that make up a model for direct HTTP
+// download. The manifest comes last, so Ollama doesn't see the model before
+// its blobs are in place. With ?format=text it's one "sha256 size path url"
+// line per file, for scripts with nothing to parse JSON.
+func (s *Server) getModelBlobs(w http.ResponseWriter, r *http.Request) {
+	if !s.httpFallback {
+		http.Error(w, "HTTP downloads are disabled on this server", http.StatusForbidden)
+		return
+	}
+	model, ok := s.modelByName(mux.Vars(r)["name"])
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if model.Incomplete {
+		http.Error(w, fmt.Sprintf("Model %s is incomplete", model.Name), http.StatusConflict)
+		return
+	}
+
+	listing, err := s.blobListing(model)
+	if err != nil {
+		s.logger.Errorf("Failed to list blobs of %s: %v", model.Name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain")
+		for _, file := range listing.Files {
+			fmt.Fprintf(w, "%s %d %s %s\n", file.SHA256, file.Size, file.Path, file.URL)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listing)
+}
+
+// blobListing describes a model's blobs and manifest, served from the web
+// seed paths.
+func (s *Server) blobListing(model Model) (BlobListing, error) {
+	listing := BlobListing{Model: model.Name, Files: []BlobFile{}}
+	manifestPath, err := s.manifestPath(model.Name)
+	if err != nil {
+		return listing, err
+	}
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return listing, err
+	}
+	digests, err := manifestDigests(manifest)
+	if err != nil {
+		return listing, err
+	}
+
+	base := s.baseURL() + "/webseed/models/"
+	for _, digest := range digests {
+		info, err := os.Stat(s.blobPath(digest))
+		if err != nil {
+			return listing, err
+		}
+		path := "blobs/" + strings.Replace(digest, ":", "-", 1)
+		listing.Files = append(listing.Files, BlobFile{
+			Path:   path,
+			SHA256: strings.TrimPrefix(digest, "sha256:"),
+			Size:   info.Size(),
+			URL:    base + path,
+		})
+	}
+
+	rel, err := filepath.Rel(s.modelsDir, manifestPath)
+	if err != nil {
+		return listing, err
+	}
+	sum := sha256.Sum256(manifest)
+	listing.Files = append(listing.Files, BlobFile{
+		Path:   filepath.ToSlash(rel),
+		SHA256: hex.EncodeToString(sum[:]),
+		Size:   int64(len(manifest)),
+		URL:    base + filepath.ToSlash(rel),
+	})
+	return listing, nil
+}
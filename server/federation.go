@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// FederationCatalog is one server's own model catalog, as exchanged between
+// federation peers.
+type FederationCatalog struct {
+	Site    string         `json:"site"`
+	URL     string         `json:"url"`
+	Models  []Model        `json:"models"`
+	Partial []PartialModel `json:"partial,omitempty"` // models still being mirrored
+}
+
+// PartialModel is a model a server has started but not finished downloading.
+type PartialModel struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Completed int64  `json:"completed"`
+}
+
+// FederatedModel is a model in the combined catalog with every site that
+// holds it. Sites are listed with this server first, then in peer order.
+type FederatedModel struct {
+	Name      string          `json:"name"`
+	Size      int64           `json:"size"`
+	SizeHuman string          `json:"size_human"`
+	Sites     []FederatedSite `json:"sites"`
+}
+
+type FederatedSite struct {
+	Site       string `json:"site"`
+	URL        string `json:"url"`
+	TorrentURL string `json:"torrent_url"`
+	InfoHash   string `json:"info_hash"` // differs between sites that pulled different builds of a tag
+}
+
+var federationClient = &http.Client{Timeout: 30 * time.Second}
+
+// withFederation adds the other lancache servers of a federation to a
+// .torrent: each peer's tracker gets its own announce-list tier after ours
+// (BEP 12), and every server is listed as a web seed (BEP 19). Clients in a
+// branch office then fall back to, and fetch from, whichever server they reach.
+func (s *Server) withFederation(data []byte) ([]byte, error) {
+	var torrent map[string]bencode.Bytes
+	if err := bencode.Unmarshal(data, &torrent); err != nil {
+		return nil, fmt.Errorf("failed to decode torrent: %w", err)
+	}
+
+	var tiers [][]string
+	if raw, ok := torrent["announce-list"]; ok {
+		if err := bencode.Unmarshal(raw, &tiers); err != nil {
+			return nil, fmt.Errorf("failed to decode announce-list: %w", err)
+		}
+	} else if raw, ok := torrent["announce"]; ok {
+		var announce string
+		if err := bencode.Unmarshal(raw, &announce); err != nil {
+			return nil, fmt.Errorf("failed to decode announce: %w", err)
+		}
+		tiers = [][]string{{announce}}
+	}
+
+	known := make(map[string]bool)
+	for _, tier := range tiers {
+		for _, announce := range tier {
+			known[announce] = true
+		}
+	}
+
+	webseeds := []string{s.baseURL() + "/webseed/"}
+	for _, peer := range s.federationPeers {
+		peer = strings.TrimSuffix(peer, "/")
+		if announce := peer + "/announce"; !known[announce] {
+			tiers = append(tiers, []string{announce})
+			known[announce] = true
+		}
+		webseeds = append(webseeds, peer+"/webseed/")
+	}
+	// Registered servers only add HTTP capacity; clients keep our tracker
+	for _, peer := range s.registeredPeers() {
+		if webseed := peer + "/webseed/"; !containsString(webseeds, webseed) {
+			webseeds = append(webseeds, webseed)
+		}
+	}
+
+	torrent["announce-list"] = bencode.MustMarshal(tiers)
+	torrent["url-list"] = bencode.MustMarshal(webseeds)
+	return bencode.Marshal(torrent)
+}
+
+// maxRegisteredPeers bounds the web seeds other servers can register.
+const maxRegisteredPeers = 64
+
+// registration is what a lancache posts to /api/federation/register.
+type registration struct {
+	URL string `json:"url"`
+}
+
+// registerPeer lets another lancache announce itself as a web seed for our
+// torrents. Registrations expire unless renewed within the registration TTL,
+// so a decommissioned server drops out of newly served torrents on its own.
+// Registration is off unless federation.registration_token is set.
+func (s *Server) registerPeer(w http.ResponseWriter, r *http.Request) {
+	if s.registrationToken == "" {
+		http.Error(w, "Registration is not enabled on this server", http.StatusForbidden)
+		return
+	}
+	want := "Bearer " + s.registrationToken
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+		http.Error(w, "Invalid registration token", http.StatusForbidden)
+		return
+	}
+
+	var reg registration
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&reg); err != nil {
+		http.Error(w, "Invalid registration", http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(reg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Registration needs an http(s) URL", http.StatusBadRequest)
+		return
+	}
+	peer := strings.TrimSuffix(reg.URL, "/")
+
+	cutoff := time.Now().Add(-s.registrationTTL)
+	s.federationMu.Lock()
+	_, renewed := s.registrations[peer]
+	if !renewed {
+		for other, seen := range s.registrations {
+			if seen.Before(cutoff) {
+				delete(s.registrations, other)
+			}
+		}
+		if len(s.registrations) >= maxRegisteredPeers {
+			s.federationMu.Unlock()
+			http.Error(w, fmt.Sprintf("At most %d servers can register", maxRegisteredPeers), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	s.registrations[peer] = time.Now()
+	s.federationMu.Unlock()
+
+	if !renewed {
+		s.logger.Infof("Registered web seed %s", peer)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// registeredPeers lists the servers whose registrations haven't expired.
+func (s *Server) registeredPeers() []string {
+	cutoff := time.Now().Add(-s.registrationTTL)
+
+	s.federationMu.Lock()
+	defer s.federationMu.Unlock()
+	var peers []string
+	for peer, seen := range s.registrations {
+		if seen.Before(cutoff) {
+			delete(s.registrations, peer)
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+func (s *Server) getRegisteredPeers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(append([]string{}, s.registeredPeers()...))
+}
+
+// registerLoop registers this server with each primary in
+// federation.register_with, renewing well within the primaries' TTL.
+func (s *Server) registerLoop(primaries []string, every time.Duration) {
+	if every < time.Minute {
+		every = time.Minute
+	}
+	body, _ := json.Marshal(registration{URL: s.baseURL()})
+	for {
+		for _, primary := range primaries {
+			primary = strings.TrimSuffix(primary, "/")
+			if err := s.register(primary, body); err != nil {
+				s.logger.Warnf("Failed to register with %s: %v", primary, err)
+			}
+		}
+		time.Sleep(every)
+	}
+}
+
+func (s *Server) register(primary string, body []byte) error {
+	req, err := http.NewRequest("POST", primary+"/api/federation/register", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.registrationToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.registrationToken)
+	}
+
+	resp, err := federationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// webseedHandler serves model manifests and blobs for web seeds and the
+// HTTP fallback. Model torrents are named "models", so a client requests
+// /webseed/models/<path inside the models directory>. Files go out through
+// http.ServeContent straight from the *os.File, so the kernel copies them
+// to the socket (sendfile) for whole files and ranges alike, and a 40 GB
+// blob never passes through Go's memory; only HTTPS has to copy it to
+// encrypt it.
+func (s *Server) webseedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rel := strings.TrimPrefix(r.URL.Path, "/webseed/models/")
+		if rel == r.URL.Path || strings.HasSuffix(rel, "/") || path.Clean("/"+rel) != "/"+rel ||
+			!(strings.HasPrefix(rel, "blobs/") || strings.HasPrefix(rel, "manifests/") || strings.HasPrefix(rel, ".pad/")) {
+			http.NotFound(w, r)
+			return
+		}
+
+		f, err := os.Open(filepath.Join(s.modelsDir, filepath.FromSlash(rel)))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Set up front, so ServeContent doesn't read the file to sniff a
+		// type. Blobs are named by their digest and never change, which
+		// makes the digest a strong ETag that If-Range resumes can rely on.
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if strings.HasPrefix(rel, "blobs/sha256-") {
+			w.Header().Set("ETag", `"`+strings.TrimPrefix(rel, "blobs/")+`"`)
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		http.ServeContent(w, r, "", info.ModTime(), f)
+	})
+}
+
+// localCatalog is what this server advertises to its federation peers.
+func (s *Server) localCatalog() FederationCatalog {
+	catalog := FederationCatalog{Site: s.federationSite, URL: s.baseURL(), Models: s.visibleCatalog()}
+	if s.seeder != nil {
+		catalog.Partial = s.seeder.partialModels()
+	}
+	return catalog
+}
+
+// federationLoop keeps the peers' catalogs fresh. A peer that can't be
+// reached keeps its last known catalog, so a flaky WAN link doesn't make
+// models flicker in and out of the combined listing.
+func (s *Server) federationLoop(interval time.Duration) {
+	s.refreshFederation()
+	for range time.Tick(interval) {
+		s.refreshFederation()
+	}
+}
+
+func (s *Server) refreshFederation() {
+	for _, peer := range s.federationPeers {
+		peer = strings.TrimSuffix(peer, "/")
+		catalog, err := fetchCatalog(peer)
+		if err != nil {
+			s.logger.Warnf("Failed to fetch catalog from %s: %v", peer, err)
+			continue
+		}
+
+		s.federationMu.Lock()
+		s.peerCatalogs[peer] = catalog
+		s.federationMu.Unlock()
+	}
+}
+
+func fetchCatalog(peer string) (FederationCatalog, error) {
+	var catalog FederationCatalog
+
+	resp, err := federationClient.Get(peer + "/api/federation/catalog")
+	if err != nil {
+		return catalog, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return catalog, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&catalog); err != nil {
+		return catalog, fmt.Errorf("failed to decode catalog: %w", err)
+	}
+
+	if catalog.URL == "" {
+		catalog.URL = peer
+	}
+	if catalog.Site == "" {
+		if u, err := url.Parse(peer); err == nil {
+			catalog.Site = u.Hostname()
+		}
+	}
+	return catalog, nil
+}
+
+// federationCatalogs returns our catalog followed by the last known catalog
+// of each peer.
+func (s *Server) federationCatalogs() []FederationCatalog {
+	catalogs := []FederationCatalog{s.localCatalog()}
+	s.federationMu.Lock()
+	defer s.federationMu.Unlock()
+	for _, peer := range s.federationPeers {
+		if catalog, ok := s.peerCatalogs[strings.TrimSuffix(peer, "/")]; ok {
+			catalogs = append(catalogs, catalog)
+		}
+	}
+	return catalogs
+}
+
+// federatedModels merges this server's catalog with its peers', one entry
+// per model name.
+func (s *Server) federatedModels() []FederatedModel {
+	catalogs := s.federationCatalogs()
+
+	byName := make(map[string]*FederatedModel)
+	var names []string
+	for _, catalog := range catalogs {
+		for _, model := range catalog.Models {
+			merged, ok := byName[model.Name]
+			if !ok {
+				merged = &FederatedModel{Name: model.Name, Size: model.Size, SizeHuman: formatSize(model.Size)}
+				byName[model.Name] = merged
+				names = append(names, model.Name)
+			}
+			merged.Sites = append(merged.Sites, FederatedSite{
+				Site:       catalog.Site,
+				URL:        catalog.URL,
+				TorrentURL: catalog.URL + "/api/models/" + model.Name + "/torrent",
+				InfoHash:   model.InfoHash,
+			})
+		}
+	}
+
+	sort.Strings(names)
+	models := make([]FederatedModel, 0, len(names))
+	for _, name := range names {
+		models = append(models, *byName[name])
+	}
+	return models
+}
+
+func (s *Server) getFederationCatalog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.localCatalog())
+}
+
+func (s *Server) getFederatedModels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.federatedModels())
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+)
+
+// rssFeed is an RSS 2.0 document listing the catalog's torrents, for RSS
+// auto-downloaders such as qBittorrent or Flexget.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title     string       `xml:"title"`
+	Link      string       `xml:"link"`
+	GUID      rssGUID      `xml:"guid"`
+	PubDate   string       `xml:"pubDate"`
+	Enclosure rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// rssEnclosure points at the .torrent; its length is the .torrent's size,
+// not the payload's.
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// serveFeed publishes every model and watched torrent as an RSS item with
+// the .torrent as its enclosure, newest first. Items are keyed by info-hash,
+// so a model re-pulled as a new build shows up as a new item.
+func (s *Server) serveFeed(w http.ResponseWriter, r *http.Request) {
+	base := s.baseURL()
+	type entry struct {
+		item rssItem
+		at   time.Time
+	}
+	var entries []entry
+
+	for _, model := range s.listedModels(r) {
+		if model.InfoHash == "" {
+			continue
+		}
+		torrentURL := fmt.Sprintf("%s/api/models/%s/torrent", base, url.PathEscape(model.Name))
+		if key := r.URL.Query().Get("key"); key != "" {
+			torrentURL += "?key=" + url.QueryEscape(key)
+		}
+		entries = append(entries, entry{rssItem{
+			Title:     fmt.Sprintf("%s (%s)", model.Name, formatSize(model.Size)),
+			Link:      torrentURL,
+			GUID:      rssGUID{Value: model.InfoHash},
+			PubDate:   model.CreatedAt.UTC().Format(time.RFC1123Z),
+			Enclosure: rssEnclosure{URL: torrentURL, Length: fileSize(model.TorrentFile), Type: "application/x-bittorrent"},
+		}, model.CreatedAt})
+	}
+	for _, ext := range s.externalTorrents() {
+		torrentURL := fmt.Sprintf("%s/api/torrents/%s/torrent", base, ext.InfoHash)
+		entries = append(entries, entry{rssItem{
+			Title:     fmt.Sprintf("%s (%s)", ext.Name, formatSize(ext.Size)),
+			Link:      torrentURL,
+			GUID:      rssGUID{Value: ext.InfoHash},
+			PubDate:   ext.AddedAt.UTC().Format(time.RFC1123Z),
+			Enclosure: rssEnclosure{URL: torrentURL, Length: fileSize(ext.TorrentFile), Type: "application/x-bittorrent"},
+		}, ext.AddedAt})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].at.After(entries[j].at) })
+	items := make([]rssItem, len(entries))
+	for i, e := range entries {
+		items[i] = e.item
+	}
+
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       s.branding.Title,
+			Link:        base,
+			Description: "Ollama models and other torrents available from this lancache",
+			Items:       items,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		s.logger.Errorf("Failed to encode feed: %v", err)
+	}
+}
+
+// fileSize returns the size of a file, or 0 if it can't be read.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+)
+
+// Groups tag models for a purpose, such as a workshop or "vision", set with
+// model_overrides. Listings, scripts and client sync take ?group= to only
+// offer one group's models, so a class pulls its assigned set.
+
+// groupName matches group names, which go into scripts and URLs as they are.
+var groupName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// ModelGroup is a group and the listed models in it.
+type ModelGroup struct {
+	Name      string   `json:"name"`
+	Models    []string `json:"models"`
+	Size      int64    `json:"size"`
+	SizeHuman string   `json:"size_human"`
+}
+
+// inGroup filters models to one group; an empty group keeps them all.
+func inGroup(models []Model, group string) []Model {
+	if group == "" {
+		return models
+	}
+	var filtered []Model
+	for _, model := range models {
+		if containsString(model.Groups, group) {
+			filtered = append(filtered, model)
+		}
+	}
+	return filtered
+}
+
+// listedModels is the catalog listed to a request, narrowed to ?group=.
+func (s *Server) listedModels(r *http.Request) []Model {
+	return inGroup(s.catalogFor(r), r.URL.Query().Get("group"))
+}
+
+// modelGroups sums up the groups of the given models, by name.
+func modelGroups(models []Model) []ModelGroup {
+	byName := make(map[string]*ModelGroup)
+	for _, model := range models {
+		for _, name := range model.Groups {
+			group, ok := byName[name]
+			if !ok {
+				group = &ModelGroup{Name: name}
+				byName[name] = group
+			}
+			group.Models = append(group.Models, model.Name)
+			group.Size += model.Size
+		}
+	}
+
+	groups := make([]ModelGroup, 0, len(byName))
+	for _, group := range byName {
+		sort.Strings(group.Models)
+		group.SizeHuman = formatSize(group.Size)
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// getGroups lists the groups of the models /api/models would list.
+func (s *Server) getGroups(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(modelGroups(s.catalogFor(r)))
+}
+
+func validateGroups(groups []string) error {
+	for _, group := range groups {
+		if !groupName.MatchString(group) {
+			return fmt.Errorf("invalid group %q: use letters, digits, '.', '_' and '-'", group)
+		}
+	}
+	return nil
+}
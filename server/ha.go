@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// leaderLease elects one of several servers sharing a state directory and
+// models directory (over NFS or replicated storage) to perform writes:
+// creating and migrating .torrent files, saving tracker state, and mirroring.
+// The leader renews a lease file; when it stops, another node takes over
+// once the lease expires. A nil lease means this server runs alone and is
+// always the leader.
+type leaderLease struct {
+	path   string
+	node   string
+	ttl    time.Duration
+	logger *logrus.Logger
+
+	mu     sync.Mutex
+	leader bool
+}
+
+type leaseRecord struct {
+	Node    string    `json:"node"`
+	Expires time.Time `json:"expires"`
+}
+
+func newLeaderLease(path, node string, ttl time.Duration, logger *logrus.Logger) *leaderLease {
+	return &leaderLease{path: path, node: node, ttl: ttl, logger: logger}
+}
+
+func (l *leaderLease) isLeader() bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leader
+}
+
+// holder returns the node named in the lease file, if the lease is current.
+func (l *leaderLease) holder() (string, bool) {
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return "", false
+	}
+	var record leaseRecord
+	if err := json.Unmarshal(data, &record); err != nil || time.Now().After(record.Expires) {
+		return "", false
+	}
+	return record.Node, true
+}
+
+// refresh takes or renews the lease if it's free or already ours, and reports
+// whether leadership changed. Shared filesystems don't offer a reliable lock,
+// so the lease is written and then read back: when two nodes race for an
+// expired lease, the rename that lands last wins and the other steps down.
+func (l *leaderLease) refresh() (leader, changed bool) {
+	holder, current := l.holder()
+	leader = false
+	if !current || holder == l.node {
+		leader = l.write() == nil
+		if leader {
+			holder, current = l.holder()
+			leader = current && holder == l.node
+		}
+	}
+
+	l.mu.Lock()
+	changed = leader != l.leader
+	l.leader = leader
+	l.mu.Unlock()
+
+	if changed && leader {
+		l.logger.Infof("This node (%s) is now the leader", l.node)
+	} else if changed {
+		l.logger.Warnf("This node (%s) is no longer the leader", l.node)
+	}
+	return leader, changed
+}
+
+func (l *leaderLease) write() error {
+	data, err := json.Marshal(leaseRecord{Node: l.node, Expires: time.Now().Add(l.ttl)})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	tmp := l.path + "." + l.node + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		l.logger.Warnf("Failed to write leader lease: %v", err)
+		return err
+	}
+	return nil
+}
+
+// haLoop renews the lease and keeps the catalog in step with the shared
+// models directory: followers pick up .torrent files the leader created, and
+// a newly elected leader creates any the previous one hadn't got to.
+func (s *Server) haLoop(rescan time.Duration) {
+	renew := time.NewTicker(s.lease.ttl / 3)
+	catalog := time.NewTicker(rescan)
+	for {
+		select {
+		case <-renew.C:
+			if leader, changed := s.lease.refresh(); !changed || !leader {
+				continue
+			}
+		case <-catalog.C:
+		}
+
+		if err := s.discoverModels(); err != nil {
+			s.logger.Warnf("Failed to rediscover models: %v", err)
+			continue
+		}
+		s.seedCatalog()
+	}
+}
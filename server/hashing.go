@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// hashReadSize is the least data read from a file at a time while hashing.
+// Reads this large keep hashing close to disk speed on NVMe hosts.
+const hashReadSize = 8 << 20
+
+// hashMemory bounds the read buffers of all hashing workers together.
+const hashMemory = 512 << 20
+
+// hashWorkers is how many chunks of chunkSize bytes are hashed at once: one
+// per CPU, as long as their buffers fit in hashMemory.
+func hashWorkers(chunkSize int64) int {
+	return max(1, min(runtime.NumCPU(), int(hashMemory/chunkSize)))
+}
+
+// hashProgress counts how much of a torrent has been hashed, for builds that
+// report their progress. Piece hashes reused from earlier torrents count as
+// hashed straight away. A nil *hashProgress counts nothing.
+type hashProgress struct {
+	total int64 // bytes in the torrent's files
+	done  atomic.Int64
+}
+
+func (p *hashProgress) add(n int64) {
+	if p != nil {
+		p.done.Add(n)
+	}
+}
+
+// fraction is how much is hashed, from 0 to 1. Padding and the short last
+// piece count as whole pieces, so it's capped.
+func (p *hashProgress) fraction() float64 {
+	if p == nil || p.total == 0 {
+		return 0
+	}
+	return min(1, float64(p.done.Load())/float64(p.total))
+}
+
+// pieceData reads a torrent's files as the single stream its pieces are cut
+// from. Reads at different offsets can run concurrently.
+type pieceData struct {
+	files   []*os.File
+	paths   []string
+	lengths []int64
+	ends    []int64 // offset in the stream where each file ends
+}
+
+func openPieceData(files []File, basePath string) (*pieceData, error) {
+	data := &pieceData{}
+	var end int64
+	for _, file := range files {
+		path := filepath.Join(basePath, filepath.Join(file.Path...))
+		f, err := os.Open(path)
+		if err != nil {
+			data.Close()
+			return nil, fmt.Errorf("failed to open file %s: %w", path, err)
+		}
+		end += file.Length
+		data.files = append(data.files, f)
+		data.paths = append(data.paths, path)
+		data.lengths = append(data.lengths, file.Length)
+		data.ends = append(data.ends, end)
+	}
+	return data, nil
+}
+
+func (d *pieceData) Close() {
+	for _, f := range d.files {
+		f.Close()
+	}
+}
+
+func (d *pieceData) size() int64 {
+	if len(d.ends) == 0 {
+		return 0
+	}
+	return d.ends[len(d.ends)-1]
+}
+
+// checkSizes reports a file whose size isn't the one it was listed with,
+// which would shift every later piece.
+func (d *pieceData) checkSizes() error {
+	for i, f := range d.files {
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat file %s: %w", d.paths[i], err)
+		}
+		if info.Size() != d.lengths[i] {
+			return fmt.Errorf("file %s changed size while hashing (%d bytes, expected %d)", d.paths[i], info.Size(), d.lengths[i])
+		}
+	}
+	return nil
+}
+
+// position finds the file a stream offset falls in, and the offset in it.
+// The end of the stream is the end of the last file.
+func (d *pieceData) position(offset int64) (int, int64) {
+	for i, end := range d.ends {
+		if offset < end || i == len(d.ends)-1 {
+			return i, offset - (end - d.lengths[i])
+		}
+	}
+	return 0, 0
+}
+
+// readAt fills buf from the stream at offset, across file boundaries.
+func (d *pieceData) readAt(buf []byte, offset int64) error {
+	for len(buf) > 0 {
+		i, fileOffset := d.position(offset)
+		n := min(int64(len(buf)), d.ends[i]-offset)
+		if _, err := d.files[i].ReadAt(buf[:n], fileOffset); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("file %s changed size while hashing", d.paths[i])
+			}
+			return fmt.Errorf("failed to read file %s: %w", d.paths[i], err)
+		}
+		buf, offset = buf[n:], offset+n
+	}
+	return nil
+}
+
+// hashPieces hashes pieces first up to end, with one worker per buffer
+// taking chunks of as many pieces as a buffer holds. Pieces don't depend on
+// each other, so the hashes only need putting back in order.
+func (d *pieceData) hashPieces(first, end, pieceLength int64, buffers [][]byte) ([]byte, error) {
+	hashes := make([]byte, (end-first)*sha1.Size)
+	chunkPieces := int64(len(buffers[0])) / pieceLength
+	chunks := make(chan int64)
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	var failed atomic.Bool // the rest of the chunks are skipped
+	for _, buffer := range buffers {
+		wg.Add(1)
+		go func(buffer []byte) {
+			defer wg.Done()
+			for chunk := range chunks {
+				if failed.Load() {
+					continue
+				}
+				last := min(chunk+chunkPieces, end)
+				n := min(last*pieceLength, d.size()) - chunk*pieceLength
+				if err := d.readAt(buffer[:n], chunk*pieceLength); err != nil {
+					errOnce.Do(func() { firstErr = err })
+					failed.Store(true)
+					continue
+				}
+				for piece := chunk; piece < last; piece++ {
+					from := (piece - chunk) * pieceLength
+					hash := sha1.Sum(buffer[from:min(from+pieceLength, n)])
+					copy(hashes[(piece-first)*sha1.Size:], hash[:])
+				}
+			}
+		}(buffer)
+	}
+	for chunk := first; chunk < end; chunk += chunkPieces {
+		chunks <- chunk
+	}
+	close(chunks)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return hashes, nil
+}
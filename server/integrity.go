@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// BlobCheck is a blob whose contents no longer match the digest in its name.
+type BlobCheck struct {
+	Digest  string    `json:"digest"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Actual  string    `json:"actual"` // digest of the contents as read, or the read error
+	Checked time.Time `json:"checked"`
+	Models  []string  `json:"models"` // catalog models using the blob
+}
+
+// IntegrityReport is the outcome of the latest background verification pass.
+type IntegrityReport struct {
+	LastRun  time.Time   `json:"last_run"`
+	Duration string      `json:"duration"`
+	Checked  int         `json:"checked"`
+	Corrupt  []BlobCheck `json:"corrupt"`
+}
+
+// integrityLoop re-hashes every blob on an interval. Reads are throttled so
+// a pass over a large models directory doesn't compete with seeding.
+func (s *Server) integrityLoop(interval time.Duration, kibPerSec int) {
+	for range time.Tick(interval) {
+		s.verifyBlobs(newUploadLimiter(kibPerSec))
+	}
+}
+
+// verifyBlobs checks every sha256-* blob against its name and replaces the
+// integrity report.
+func (s *Server) verifyBlobs(limiter *rate.Limiter) {
+	start := time.Now()
+	blobsDir := filepath.Join(s.modelsDir, "blobs")
+	entries, err := os.ReadDir(blobsDir)
+	if err != nil {
+		s.logger.Warnf("Failed to read blobs directory: %v", err)
+		return
+	}
+
+	users := s.blobUsers()
+	report := IntegrityReport{Corrupt: []BlobCheck{}}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "sha256-") {
+			continue
+		}
+		digest := strings.Replace(entry.Name(), "-", ":", 1)
+		blobPath := filepath.Join(blobsDir, entry.Name())
+
+		actual, size, err := hashBlob(blobPath, limiter)
+		if os.IsNotExist(err) {
+			continue // removed during the pass
+		}
+		report.Checked++
+		if err != nil {
+			actual = err.Error()
+		}
+		if actual == digest {
+			continue
+		}
+
+		s.logger.Errorf("Blob %s is corrupt: contents hash to %s (used by %s)", blobPath, actual, strings.Join(users[digest], ", "))
+		report.Corrupt = append(report.Corrupt, BlobCheck{
+			Digest:  digest,
+			Path:    blobPath,
+			Size:    size,
+			Actual:  actual,
+			Checked: time.Now(),
+			Models:  users[digest],
+		})
+	}
+
+	report.LastRun = start
+	report.Duration = time.Since(start).Round(time.Second).String()
+	s.logger.Infof("Verified %d blobs in %s: %d corrupt", report.Checked, report.Duration, len(report.Corrupt))
+
+	s.integrityMu.Lock()
+	s.integrity = report
+	s.integrityMu.Unlock()
+
+	if len(report.Corrupt) > 0 {
+		var models []string
+		for _, blob := range report.Corrupt {
+			for _, model := range blob.Models {
+				if !containsString(models, model) {
+					models = append(models, model)
+				}
+			}
+		}
+		message := fmt.Sprintf("%d of %d blobs are corrupt", len(report.Corrupt), report.Checked)
+		if len(models) > 0 {
+			message += ", affecting " + strings.Join(models, ", ")
+		}
+		s.notify(eventVerificationFailed, fmt.Sprintf("%s. See %s/api/integrity", message, s.baseURL()))
+	}
+}
+
+// hashBlob returns the "sha256:<hex>" digest and size of a file, reading
+// through limiter when it's set.
+func hashBlob(path string, limiter *rate.Limiter) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	buf := make([]byte, 256*1024)
+	var size int64
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if limiter != nil {
+				limiter.WaitN(context.Background(), n)
+			}
+			hash.Write(buf[:n])
+			size += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", size, err
+		}
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// blobUsers maps each blob digest to the catalog models whose manifests
+// reference it.
+func (s *Server) blobUsers() map[string][]string {
+	users := make(map[string][]string)
+	for _, model := range s.catalog() {
+		manifestPath, err := s.manifestPath(model.Name)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(manifestPath)
+		if err != nil {
+			continue
+		}
+		digests, err := manifestDigests(data)
+		if err != nil {
+			continue
+		}
+		for _, digest := range digests {
+			users[digest] = append(users[digest], model.Name)
+		}
+	}
+	for _, models := range users {
+		sort.Strings(models)
+	}
+	return users
+}
+
+// integrityReport returns the latest verification pass; LastRun is zero
+// until the first pass completes.
+func (s *Server) integrityReport() IntegrityReport {
+	s.integrityMu.Lock()
+	defer s.integrityMu.Unlock()
+	return s.integrity
+}
+
+func (s *Server) getIntegrity(w http.ResponseWriter, r *http.Request) {
+	report := s.integrityReport()
+	hidden := s.hiddenNames()
+	corrupt := make([]BlobCheck, len(report.Corrupt))
+	for i, blob := range report.Corrupt {
+		blob.Models = redactHidden(blob.Models, hidden)
+		corrupt[i] = blob
+	}
+	report.Corrupt = corrupt
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// journalInterval is how much data is hashed between journal checkpoints.
+const journalInterval = 256 << 20
+
+// hashJournal records how far piece hashing of one torrent got, so a crash
+// or deploy in the middle of hashing a 50 GB blob resumes from the last
+// checkpoint instead of from zero. It's stored in the state directory under
+// a fingerprint of the file list, and only matches the exact same files:
+// <fingerprint>.json holds the position and <fingerprint>.pieces the piece
+// hashes so far, appended at each checkpoint.
+type hashJournal struct {
+	path string // without extension; empty when journaling is disabled
+
+	FileIndex int   `json:"file_index"` // file hashing got to
+	Offset    int64 `json:"offset"`     // bytes of it already hashed, up to a piece boundary
+	NumPieces int   `json:"num_pieces"` // completed pieces in the .pieces file
+
+	pieces []byte // hashes loaded on resume
+}
+
+// openHashJournal loads the journal for hashing files with pieceLength, or
+// starts an empty one. The fingerprint covers each file's path, length, and
+// modification time, so a journal is never applied to changed data.
+func (s *Server) openHashJournal(files []File, basePath string, pieceLength int64) *hashJournal {
+	if s.stateDir == "" {
+		return &hashJournal{}
+	}
+
+	fingerprint := sha1.New()
+	fmt.Fprintf(fingerprint, "%s\n%d\n", basePath, pieceLength)
+	for _, file := range files {
+		var modTime int64
+		if info, err := os.Stat(filepath.Join(basePath, filepath.Join(file.Path...))); err == nil {
+			modTime = info.ModTime().UnixNano()
+		}
+		fmt.Fprintf(fingerprint, "%s\n%d\n%d\n", strings.Join(file.Path, "/"), file.Length, modTime)
+	}
+	fresh := &hashJournal{path: filepath.Join(s.stateDir, "hashing", hex.EncodeToString(fingerprint.Sum(nil)))}
+
+	data, err := os.ReadFile(fresh.path + ".json")
+	if err != nil {
+		fresh.finish()
+		return fresh
+	}
+	var saved hashJournal
+	if err := json.Unmarshal(data, &saved); err == nil {
+		saved.pieces, err = os.ReadFile(fresh.path + ".pieces")
+	}
+	if err != nil || saved.FileIndex >= len(files) || saved.Offset > files[saved.FileIndex].Length ||
+		len(saved.pieces) < saved.NumPieces*20 {
+		s.logger.Warnf("Ignoring unusable hashing journal %s", fresh.path)
+		fresh.finish()
+		return fresh
+	}
+	// Hashes appended after the last position was saved are recomputed
+	saved.pieces = saved.pieces[:saved.NumPieces*20]
+	saved.path = fresh.path
+	s.logger.Infof("Resuming hashing at %s, offset %d", strings.Join(files[saved.FileIndex].Path, "/"), saved.Offset)
+	return &saved
+}
+
+// checkpoint saves the hashing position: new piece hashes are appended to
+// the .pieces file first, then the position is replaced atomically. Failing
+// to save only costs work after a crash, so errors are logged and hashing
+// carries on.
+func (j *hashJournal) checkpoint(s *Server, fileIndex int, offset int64, pieces []byte) {
+	if j.path == "" {
+		return
+	}
+	err := os.MkdirAll(filepath.Dir(j.path), 0755)
+	if err == nil {
+		err = j.appendPieces(pieces)
+	}
+	var tmp string
+	if err == nil {
+		j.FileIndex, j.Offset, j.NumPieces = fileIndex, offset, len(pieces)/20
+		var data []byte
+		if data, err = json.Marshal(j); err == nil {
+			tmp, err = writeTemp(j.path+".json", data)
+		}
+	}
+	if err == nil {
+		if err = os.Rename(tmp, j.path+".json"); err != nil {
+			os.Remove(tmp)
+		}
+	}
+	if err != nil {
+		s.logger.Warnf("Failed to save hashing journal: %v", err)
+	}
+}
+
+func (j *hashJournal) appendPieces(pieces []byte) error {
+	f, err := os.OpenFile(j.path+".pieces", os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(pieces[j.NumPieces*20:], int64(j.NumPieces*20)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// finish removes the journal once hashing is complete or abandoned.
+func (j *hashJournal) finish() {
+	if j.path != "" {
+		os.Remove(j.path + ".json")
+		os.Remove(j.path + ".pieces")
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/spf13/cobra"
+)
+
+// loadtestOptions are the flags of the loadtest subcommand.
+type loadtestOptions struct {
+	server   string
+	model    string
+	peers    int
+	ramp     time.Duration
+	timeout  time.Duration
+	interval time.Duration
+	dir      string
+	keep     bool
+}
+
+// loadtestCommand simulates a workshop: many clients fetching the same
+// model's torrent and downloading it at once, from the server's seeder, its
+// web seeds and each other. It's for capacity planning before the real thing.
+func loadtestCommand() *cobra.Command {
+	var opts loadtestOptions
+	cmd := &cobra.Command{
+		Use:   "loadtest",
+		Short: "Simulate a swarm of clients downloading a model",
+		Long: `Starts N in-process BitTorrent peers that fetch a model's torrent from a
+server and download it together, reporting aggregate throughput and how the
+tracker behaves. Each peer stores its copy on disk, so make sure --dir has
+room for N copies of the model.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runLoadtest(opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.server, "server", "http://localhost:8080", "URL of the server to test")
+	cmd.Flags().StringVar(&opts.model, "model", "", "model to download, e.g. granite3.3:8b")
+	cmd.Flags().IntVar(&opts.peers, "peers", 10, "number of virtual peers")
+	cmd.Flags().DurationVar(&opts.ramp, "ramp", 0, "spread peer start-up over this long instead of starting all at once")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", time.Hour, "give up on peers that haven't finished after this long")
+	cmd.Flags().DurationVar(&opts.interval, "interval", 5*time.Second, "how often to print progress")
+	cmd.Flags().StringVar(&opts.dir, "dir", "", "where peers store their downloads (default a temporary directory)")
+	cmd.Flags().BoolVar(&opts.keep, "keep", false, "keep the downloaded data afterwards")
+	cmd.MarkFlagRequired("model")
+	return cmd
+}
+
+// loadtestPeer is one virtual client.
+type loadtestPeer struct {
+	client   *torrent.Client
+	torrent  *torrent.Torrent
+	started  time.Time
+	done     chan struct{} // closed once it has the whole model
+	finished time.Time
+}
+
+// swarmStats collects what the tracker told the peers.
+type swarmStats struct {
+	mu            sync.Mutex
+	announces     int
+	failures      int
+	peersReturned int
+	lastError     string
+}
+
+func (st *swarmStats) record(infoHash string, result announceResult) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.announces++
+	if result.Error != "" {
+		st.failures++
+		st.lastError = result.Error
+	} else {
+		st.peersReturned += result.Peers
+	}
+}
+
+func runLoadtest(opts loadtestOptions) error {
+	if opts.peers < 1 {
+		return fmt.Errorf("--peers must be at least 1")
+	}
+	mi, err := fetchLoadtestTorrent(strings.TrimSuffix(opts.server, "/"), opts.model)
+	if err != nil {
+		return err
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return fmt.Errorf("invalid torrent: %w", err)
+	}
+
+	dir := opts.dir
+	if dir == "" {
+		if dir, err = os.MkdirTemp("", "ollama-bt-loadtest-"); err != nil {
+			return err
+		}
+	}
+	if !opts.keep {
+		defer os.RemoveAll(dir)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	fmt.Printf("Load test: %d peers downloading %s (%s, %s) from %s\n",
+		opts.peers, opts.model, formatSize(info.TotalLength()), mi.HashInfoBytes().HexString(), opts.server)
+	fmt.Printf("Trackers: %s\n", strings.Join(announceURLs(mi), ", "))
+
+	stats := &swarmStats{}
+	var mu sync.Mutex
+	var peers []*loadtestPeer
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, peer := range peers {
+			peer.client.Close()
+		}
+	}()
+
+	// Peers join over the ramp, like a room of people pasting the same
+	// command at slightly different times
+	start := time.Now()
+	go func() {
+		for i := 0; i < opts.peers; i++ {
+			peer, err := startLoadtestPeer(mi, filepath.Join(dir, fmt.Sprintf("peer-%03d", i)), stats)
+			if err != nil {
+				logger.Errorf("Failed to start peer %d: %v", i, err)
+				cancel()
+				return
+			}
+			mu.Lock()
+			peers = append(peers, peer)
+			mu.Unlock()
+			if opts.ramp > 0 && i < opts.peers-1 {
+				select {
+				case <-time.After(opts.ramp / time.Duration(opts.peers-1)):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+	var lastRead int64
+	lastTick := start
+	for {
+		select {
+		case <-ctx.Done():
+		case now := <-ticker.C:
+			mu.Lock()
+			report := summarizeSwarm(peers)
+			mu.Unlock()
+			rate := float64(report.read-lastRead) / now.Sub(lastTick).Seconds()
+			lastRead, lastTick = report.read, now
+			stats.mu.Lock()
+			announces, failures := stats.announces, stats.failures
+			stats.mu.Unlock()
+			fmt.Printf("[%6s] %d/%d peers running, %d complete | %s/s aggregate | %s from web seeds, %s from peers | %d connections | %d announces, %d failed\n",
+				now.Sub(start).Round(time.Second), report.running, opts.peers, report.complete,
+				formatSize(int64(rate)), formatSize(report.webSeeds), formatSize(report.peerConns),
+				report.connections, announces, failures)
+			if report.complete == opts.peers {
+				cancel()
+			}
+			continue
+		}
+		break
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	printLoadtestSummary(peers, opts.peers, info.TotalLength(), time.Since(start), stats)
+	return nil
+}
+
+// fetchLoadtestTorrent downloads a model's torrent the way an install script
+// does.
+func fetchLoadtestTorrent(server, model string) (*metainfo.MetaInfo, error) {
+	resp, err := http.Get(server + "/api/models/" + url.PathEscape(model) + "/torrent")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the torrent: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("failed to fetch the torrent: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return metainfo.Load(resp.Body)
+}
+
+func announceURLs(mi *metainfo.MetaInfo) []string {
+	urls := mi.UpvertedAnnounceList().DistinctValues()
+	sort.Strings(urls)
+	return urls
+}
+
+// startLoadtestPeer starts a torrent client of its own, listening on a
+// random port, and has it download the whole torrent into dir.
+func startLoadtestPeer(mi *metainfo.MetaInfo, dir string, stats *swarmStats) (*loadtestPeer, error) {
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.ListenPort = 0
+	cfg.NoDHT = true
+	cfg.Seed = true // finished peers keep serving the rest, as real clients do
+	cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	cfg.Slogger = slog.New(&announceLog{
+		next:   slog.NewTextHandler(io.Discard, nil),
+		record: stats.record,
+	})
+	client, err := torrent.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	t, err := client.AddTorrent(mi)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	peer := &loadtestPeer{client: client, torrent: t, started: time.Now(), done: make(chan struct{})}
+	t.DownloadAll()
+	go func() {
+		select {
+		case <-t.Complete().On():
+			peer.finished = time.Now()
+			close(peer.done)
+		case <-client.Closed():
+		}
+	}()
+	return peer, nil
+}
+
+// swarmReport adds up the peers' stats.
+type swarmReport struct {
+	running     int
+	complete    int
+	read        int64 // data bytes downloaded by all peers
+	webSeeds    int64
+	peerConns   int64
+	connections int
+}
+
+func summarizeSwarm(peers []*loadtestPeer) swarmReport {
+	report := swarmReport{running: len(peers)}
+	for _, peer := range peers {
+		stats := peer.torrent.Stats()
+		report.read += stats.BytesReadData.Int64()
+		report.webSeeds += stats.WebSeeds.BytesReadData.Int64()
+		report.peerConns += stats.PeerConns.BytesReadData.Int64()
+		report.connections += stats.ActivePeers
+		if peer.torrent.Complete().Bool() {
+			report.complete++
+		}
+	}
+	return report
+}
+
+func printLoadtestSummary(peers []*loadtestPeer, wanted int, size int64, elapsed time.Duration, stats *swarmStats) {
+	report := summarizeSwarm(peers)
+	var times []time.Duration
+	for _, peer := range peers {
+		select {
+		case <-peer.done:
+			times = append(times, peer.finished.Sub(peer.started))
+		default:
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	fmt.Println()
+	fmt.Println("Summary")
+	fmt.Printf("  Peers completed:      %d of %d in %s\n", len(times), wanted, elapsed.Round(time.Second))
+	if len(times) > 0 {
+		fmt.Printf("  Time to complete:     fastest %s, median %s, slowest %s\n",
+			times[0].Round(time.Second), times[len(times)/2].Round(time.Second), times[len(times)-1].Round(time.Second))
+	}
+	fmt.Printf("  Downloaded:           %s in total (%s per peer)\n", formatSize(report.read), formatSize(size))
+	fmt.Printf("  Aggregate throughput: %s/s\n", formatSize(int64(float64(report.read)/elapsed.Seconds())))
+	if report.read > 0 {
+		fmt.Printf("  From web seeds:       %s (%.0f%%)\n", formatSize(report.webSeeds), 100*float64(report.webSeeds)/float64(report.read))
+		fmt.Printf("  From peers:           %s (%.0f%%)\n", formatSize(report.peerConns), 100*float64(report.peerConns)/float64(report.read))
+	}
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	fmt.Printf("  Tracker announces:    %d, %d failed\n", stats.announces, stats.failures)
+	if ok := stats.announces - stats.failures; ok > 0 {
+		fmt.Printf("  Peers per announce:   %.1f on average\n", float64(stats.peersReturned)/float64(ok))
+	}
+	if stats.lastError != "" {
+		fmt.Printf("  Last announce error:  %s\n", stats.lastError)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// Local Service Discovery (BEP 14): seeders multicast the info-hashes they
+// have so LAN peers find each other even while the tracker is unreachable.
+const (
+	lsdAddr     = "239.192.152.143:6771"
+	lsdInterval = 5 * time.Minute
+
+	peerSourceLSD torrent.PeerSource = "Lsd"
+)
+
+// startLSD joins the LSD multicast group, announces every seeded torrent
+// periodically, and adds peers heard from other hosts to matching torrents.
+func (s *Seeder) startLSD() error {
+	group, err := net.ResolveUDPAddr("udp4", lsdAddr)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return fmt.Errorf("failed to join LSD multicast group: %w", err)
+	}
+
+	sender, err := net.DialUDP("udp4", nil, group)
+	if err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to open LSD socket: %w", err)
+	}
+
+	// The cookie lets us recognise our own announces looped back to us
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	cookie := hex.EncodeToString(buf)
+
+	go s.lsdListen(listener, cookie)
+	go s.lsdAnnounceLoop(sender, cookie)
+
+	s.logger.Infof("Local Service Discovery enabled on %s", lsdAddr)
+	return nil
+}
+
+func (s *Seeder) lsdAnnounceLoop(conn *net.UDPConn, cookie string) {
+	// Give the first torrents a moment to be added before announcing
+	time.Sleep(5 * time.Second)
+	for {
+		for _, infoHash := range s.infoHashes() {
+			msg := fmt.Sprintf("BT-SEARCH * HTTP/1.1\r\nHost: %s\r\nPort: %d\r\nInfohash: %s\r\ncookie: %s\r\n\r\n\r\n",
+				lsdAddr, s.client.LocalPort(), infoHash, cookie)
+			if _, err := conn.Write([]byte(msg)); err != nil {
+				s.logger.Debugf("LSD announce failed: %v", err)
+			}
+		}
+		time.Sleep(lsdInterval)
+	}
+}
+
+func (s *Seeder) lsdListen(conn *net.UDPConn, cookie string) {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			s.logger.Warnf("LSD listener stopped: %v", err)
+			return
+		}
+
+		// Announces are HTTP-style requests; reuse the HTTP parser for headers
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf[:n])))
+		if err != nil || req.Method != "BT-SEARCH" {
+			continue
+		}
+		if req.Header.Get("Cookie") == cookie {
+			continue
+		}
+
+		port, err := strconv.Atoi(req.Header.Get("Port"))
+		if err != nil || port <= 0 || port > 65535 {
+			continue
+		}
+		ip, ok := netip.AddrFromSlice(from.IP.To4())
+		if !ok {
+			continue
+		}
+		addr := netip.AddrPortFrom(ip, uint16(port))
+
+		for _, infoHash := range req.Header.Values("Infohash") {
+			t, ok := s.torrent(strings.ToLower(infoHash))
+			if !ok {
+				continue
+			}
+			t.AddPeers([]torrent.PeerInfo{{Addr: addr, Source: peerSourceLSD}})
+			s.logger.Debugf("LSD peer %s for %s", addr, infoHash)
+		}
+	}
+}
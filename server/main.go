@@ -1,16 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"io"
+	"math"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/anacrolix/torrent/bencode"
@@ -19,15 +27,31 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 type Model struct {
 	Name         string    `json:"name"`
 	Size         int64     `json:"size"`
+	SizeHuman    string    `json:"size_human"` // Size as the web UI shows it
 	Path         string    `json:"path"`
 	TorrentFile  string    `json:"torrent_file"`
 	CreatedAt    time.Time `json:"created_at"`
 	InfoHash     string    `json:"info_hash"`
+
+	// Models whose manifest refers to blobs that aren't on disk get no torrent
+	Incomplete   bool      `json:"incomplete,omitempty"`
+	MissingBlobs []string  `json:"missing_blobs,omitempty"`
+
+	TorrentStatus string `json:"torrent_status,omitempty"` // pending, ready, or failed; see torrentqueue.go
+
+	Hidden bool `json:"hidden,omitempty"` // left out of listings by model_overrides
+
+	Groups []string `json:"groups,omitempty"` // from model_overrides, see groups.go
+
+	Digest string `json:"digest,omitempty"` // sha256 of the manifest, naming this version; see versions.go
+
+	Description string `json:"description,omitempty"` // markdown set from the admin API, see notes.go
 }
 
 // Torrent structures for creating .torrent files
@@ -45,6 +69,7 @@ type TorrentInfo struct {
 	PieceLength int64    `bencode:"piece length"`
 	Pieces      string   `bencode:"pieces"`
 	Private     int      `bencode:"private,omitempty"`
+	Source      string   `bencode:"source,omitempty"` // from torrent_metadata.source
 	Name        string   `bencode:"name"`
 	Length      int64    `bencode:"length,omitempty"`      // For single file
 	Files       []File   `bencode:"files,omitempty"`       // For multiple files
@@ -53,15 +78,99 @@ type TorrentInfo struct {
 type File struct {
 	Length int64    `bencode:"length"`
 	Path   []string `bencode:"path"`
+	Attr   string   `bencode:"attr,omitempty"` // "p" for BEP 47 padding files
 }
 
 type Server struct {
-	models     []Model
-	modelsDir  string
-	serverIP   string
-	port       string
-	trackerURL string
-	logger     *logrus.Logger
+	models          []Model
+	modelsMu        sync.RWMutex // models is replaced when the catalog is rediscovered
+	discovered      bool         // whether models has been discovered once
+	modelsDir       string
+	serverIP        string
+	port            string
+	trackerURL      string
+	tlsPort         string
+	tlsCertFile     string
+	tlsKeyFile      string
+	redirectHTTP    bool
+	acmeDomains     []string
+	acmeEmail       string
+	acmeDirURL      string
+	acmeCacheDir    string
+	acmeManager     *autocert.Manager
+	mdnsEnabled     bool
+	mdnsHostname    string
+	externalURL     string
+	trackers        []string // announce URLs: trackerURL first, then tracker_urls
+	trackerHealthMu sync.Mutex
+	trackerHealth   map[string]*TrackerHealth // latest health check, keyed by announce URL
+	stateDir        string
+	downloadsDir    string // files served at /downloads/
+	httpFallback    bool   // whether /api/models/{name}/blobs is offered
+	alignBlobs      bool   // new torrents pad blobs to piece boundaries, see blobpieces.go
+	modelVersions   int    // earlier versions kept per model after its tag moves, see versions.go
+	torrentCache    *torrentCache // served .torrent files; nil reads them from disk each time
+	metricsModels   int           // models labeled individually on /metrics, see metrics.go
+	clientStats     *clientStats  // HTTP bytes sent per client address
+	federationPeers []string
+	federationSite  string
+	federationMu    sync.Mutex
+	peerCatalogs    map[string]FederationCatalog // keyed by peer URL
+
+	// Lancaches registered as extra web seeds: last registration by URL
+	registrations     map[string]time.Time
+	registrationTTL   time.Duration
+	registrationToken string
+
+	pushToken string // shared secret for /api/federation/push, sent and accepted
+
+	adminToken string     // bearer token for the admin listener and model deletion
+	deleteMu   sync.Mutex // one model deletion at a time, and no manifest written during one, so shared blobs are counted right
+	uploadsMu  sync.Mutex
+	uploading  map[string]bool // digests of blobs, or "tus:<id>", being uploaded; see upload.go
+	jobsMu     sync.Mutex
+	jobs       []*Job // bulk operations, oldest first; see bulk.go
+	nextJobID  int
+	jobRunning bool // whether the job worker is running
+
+	visibility   map[string]ModelVisibility // set from the admin API, see visibility.go
+	visibilityMu sync.Mutex
+	notes        map[string]ModelNote // descriptions set from the admin API, see notes.go
+	notesMu      sync.Mutex
+
+	bundleMu        sync.Mutex
+	bundlesBuilding map[string]*hashProgress // families whose bundle torrent is queued or being built, see bundles.go
+
+	webhooks []WebhookSettings // notified of events, see notify.go
+	events   *eventStream      // /api/events subscribers, see events.go
+
+	overrides     []ModelOverride // per-model publishing settings, matched by name or glob
+	allowedModels []string        // models allowlist; empty publishes every model
+	branding      BrandingSettings
+	torrentMeta   TorrentMetadataSettings // comment, created by and source of new torrents
+	signer        *scriptSigner           // signs served scripts; nil when signing is disabled
+
+	mirrorSources []mirrorSource // upstream lancaches this server replicates from
+	lease         *leaderLease   // set when running as part of a high-availability pair
+	torrentMu     sync.Mutex
+	torrentLocks  map[string]*sync.Mutex // per .torrent path, held while checking and creating it
+	problemsMu    sync.Mutex
+	quarantine    []QuarantinedManifest // malformed manifests from the latest discovery
+	hashMu        sync.Mutex
+	hashQueue     []string        // models waiting for their torrents, see torrentqueue.go
+	hashQueued    map[string]bool // queued or being hashed
+	bundleQueue   []ModelBundle   // bundles waiting for their torrents, after the models
+	hashing       bool            // whether the hash worker is running
+	manifestMu    sync.Mutex
+	manifests     map[string]parsedManifest // by path, reused while the file is unchanged
+	integrityMu   sync.Mutex
+	integrity     IntegrityReport // latest background blob verification
+	watchDir      string
+	watchMu       sync.Mutex
+	external      []ExternalTorrent // torrents found in watchDir
+	tracker       *Tracker
+	seeder        *Seeder
+	logger        *logrus.Logger
 }
 
 var (
@@ -80,8 +189,43 @@ func main() {
 
 	cmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.ollama-bt-lancache.yaml)")
 	cmd.PersistentFlags().StringVarP(&port, "port", "p", "8080", "port to listen on")
+	cmd.PersistentFlags().String("profile", "", "preset defaults for a deployment: lan, wan, or airgap")
+	cmd.PersistentFlags().String("tls-port", "8443", "port for the HTTPS listener")
+	cmd.PersistentFlags().String("tls-cert", "", "TLS certificate file (enables HTTPS)")
+	cmd.PersistentFlags().String("tls-key", "", "TLS private key file")
+	cmd.PersistentFlags().Bool("redirect-http", false, "redirect plain HTTP requests to HTTPS")
+	cmd.PersistentFlags().StringSlice("acme-domain", nil, "obtain HTTPS certificates via ACME for this domain (repeatable)")
+	cmd.PersistentFlags().String("acme-directory", "", "ACME directory URL (default Let's Encrypt)")
+	cmd.PersistentFlags().Bool("mdns", false, "advertise the web UI and tracker over mDNS/DNS-SD")
+	cmd.PersistentFlags().String("mdns-hostname", "ollama-bt-lancache", "hostname to advertise under .local")
+	cmd.PersistentFlags().Bool("embedded-tracker", false, "serve a BitTorrent tracker at /announce on the web port")
+	cmd.PersistentFlags().Bool("embedded-seeder", false, "seed all catalog models from this process")
+	cmd.PersistentFlags().Int("seeder-port", 6881, "BitTorrent listen port for the embedded seeder")
+	cmd.PersistentFlags().String("downloads-dir", "", "directory of extra files listed at /downloads/ (default <state_dir>/downloads)")
+	cmd.PersistentFlags().String("watch-dir", "", "directory of extra .torrent files (and their data) to list and seed")
+	cmd.PersistentFlags().StringSlice("models", nil, "publish only these models (names or globs, repeatable; default all)")
+	cmd.PersistentFlags().String("external-url", "", "URL clients use to reach this server (default http://<local IP>:<port>)")
 
 	viper.BindPFlag("port", cmd.PersistentFlags().Lookup("port"))
+	viper.BindPFlag("profile", cmd.PersistentFlags().Lookup("profile"))
+	viper.BindPFlag("tls_port", cmd.PersistentFlags().Lookup("tls-port"))
+	viper.BindPFlag("tls_cert_file", cmd.PersistentFlags().Lookup("tls-cert"))
+	viper.BindPFlag("tls_key_file", cmd.PersistentFlags().Lookup("tls-key"))
+	viper.BindPFlag("redirect_http", cmd.PersistentFlags().Lookup("redirect-http"))
+	viper.BindPFlag("acme.domains", cmd.PersistentFlags().Lookup("acme-domain"))
+	viper.BindPFlag("acme.directory_url", cmd.PersistentFlags().Lookup("acme-directory"))
+	viper.BindPFlag("mdns", cmd.PersistentFlags().Lookup("mdns"))
+	viper.BindPFlag("mdns_hostname", cmd.PersistentFlags().Lookup("mdns-hostname"))
+	viper.BindPFlag("external_url", cmd.PersistentFlags().Lookup("external-url"))
+	viper.BindPFlag("models", cmd.PersistentFlags().Lookup("models"))
+	viper.BindPFlag("tracker.embedded", cmd.PersistentFlags().Lookup("embedded-tracker"))
+	viper.BindPFlag("seeder.embedded", cmd.PersistentFlags().Lookup("embedded-seeder"))
+	viper.BindPFlag("seeder.port", cmd.PersistentFlags().Lookup("seeder-port"))
+	viper.BindPFlag("watch.dir", cmd.PersistentFlags().Lookup("watch-dir"))
+	viper.BindPFlag("downloads_dir", cmd.PersistentFlags().Lookup("downloads-dir"))
+
+	cmd.AddCommand(loadtestCommand())
+	cmd.AddCommand(uploadCommand())
 
 	if err := cmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -93,38 +237,153 @@ func run(cmd *cobra.Command, args []string) {
 	// Initialize configuration
 	initConfig()
 
-	// Get models directory
-	homeDir, err := homedir.Dir()
+	cfg, err := loadConfig()
 	if err != nil {
-		logger.Fatal("Failed to get home directory:", err)
-	}
-
-	modelsDir := filepath.Join(homeDir, ".ollama", "models")
-	if !viper.IsSet("models_dir") {
-		viper.Set("models_dir", modelsDir)
+		logger.Fatal(err)
 	}
+	applyLogging(logger, cfg.Logging)
 
 	// Get local IP address
-	localIP, err := getLocalIP()
+	var localIP string
+	if cfg.Profile == "airgap" {
+		localIP, err = interfaceIP()
+	} else {
+		localIP, err = getLocalIP()
+	}
 	if err != nil {
 		logger.Fatal("Failed to get local IP:", err)
 	}
 
 	// Set default tracker URL if not configured - use local privtracker
-	if !viper.IsSet("tracker_url") {
+	trackerURLSet := cfg.TrackerURL != ""
+	if !trackerURLSet && len(cfg.TrackerURLs) > 0 {
+		cfg.TrackerURL = cfg.TrackerURLs[0]
+	} else if !trackerURLSet {
 		// Use local privtracker on port 1337 with hash-based room name
 		// Room name is SHA1 hash of "ollama" for proper privtracker compatibility
-		viper.Set("tracker_url", fmt.Sprintf("http://%s:1337/8ed4322e8e2790b8c928d381ce8d07cfd966e909/announce", localIP))
+		cfg.TrackerURL = fmt.Sprintf("http://%s:1337/8ed4322e8e2790b8c928d381ce8d07cfd966e909/announce", localIP)
 	}
 
 	// Initialize server
 	server := &Server{
-		models:     []Model{},
-		modelsDir:  viper.GetString("models_dir"),
-		serverIP:   localIP,
-		port:       viper.GetString("port"),
-		trackerURL: viper.GetString("tracker_url"),
-		logger:     logger,
+		models:          []Model{},
+		modelsDir:       cfg.ModelsDir,
+		serverIP:        localIP,
+		port:            cfg.Port,
+		trackerURL:      cfg.TrackerURL,
+		tlsPort:         cfg.TLSPort,
+		tlsCertFile:     cfg.TLSCertFile,
+		tlsKeyFile:      cfg.TLSKeyFile,
+		redirectHTTP:    cfg.RedirectHTTP,
+		acmeDomains:     cfg.ACME.Domains,
+		acmeEmail:       cfg.ACME.Email,
+		acmeDirURL:      cfg.ACME.DirectoryURL,
+		acmeCacheDir:    cfg.ACME.CacheDir,
+		mdnsEnabled:     cfg.MDNS,
+		mdnsHostname:    cfg.MDNSHostname,
+		externalURL:     cfg.ExternalURL,
+		stateDir:        cfg.StateDir,
+		downloadsDir:    cfg.DownloadsDir,
+		httpFallback:    cfg.HTTPFallback,
+		alignBlobs:      cfg.AlignBlobs,
+		modelVersions:   cfg.ModelVersions,
+		torrentCache:    newTorrentCache(int64(cfg.TorrentCache) * 1024),
+		metricsModels:   cfg.Metrics.MaxModels,
+		clientStats:     newClientStats(),
+		federationPeers: cfg.Federation.Peers,
+		federationSite:  cfg.Federation.Site,
+		peerCatalogs:    make(map[string]FederationCatalog),
+		trackerHealth:   make(map[string]*TrackerHealth),
+
+		registrations:     make(map[string]time.Time),
+		registrationTTL:   cfg.Federation.RegistrationTTL,
+		registrationToken: cfg.Federation.RegistrationToken,
+
+		pushToken: cfg.Federation.PushToken,
+
+		adminToken: cfg.Admin.Token,
+		uploading:  make(map[string]bool),
+
+		webhooks: cfg.Notifications.Webhooks,
+		events:   newEventStream(),
+		overrides:     cfg.ModelOverrides,
+		allowedModels: cfg.Models,
+		branding:      cfg.Branding,
+		torrentMeta:   cfg.TorrentMetadata,
+
+		integrity: IntegrityReport{Corrupt: []BlobCheck{}},
+		watchDir:  cfg.Watch.Dir,
+		logger:    logger,
+	}
+
+	// Created up front so there's somewhere to copy installers and tools to
+	if err := os.MkdirAll(server.downloadsDir, 0755); err != nil {
+		logger.Fatal("Failed to create downloads directory:", err)
+	}
+
+	if cfg.ScriptSigning.Enabled {
+		signer, err := loadScriptSigner(cfg.ScriptSigning.KeyFile)
+		if err != nil {
+			logger.Fatal("Failed to load script signing key: ", err)
+		}
+		server.signer = signer
+		logger.Infof("Install scripts are signed with minisign key %s (public key at /minisign.pub)", signer.KeyID())
+	}
+
+	// The embedded tracker is served from our own listener, so it becomes
+	// the default announce URL unless one was configured explicitly
+	if cfg.Tracker.Embedded {
+		// Passkeys are configured as client name -> key
+		passkeys := make(map[string]string)
+		for client, key := range cfg.Tracker.Passkeys {
+			passkeys[key] = client
+		}
+
+		server.tracker = newTracker(trackerConfig{
+			StateDir:       server.stateDir,
+			Interval:       cfg.Tracker.Interval,
+			MinInterval:    cfg.Tracker.MinInterval,
+			PeerTimeout:    cfg.Tracker.PeerTimeout,
+			DefaultNumWant: cfg.Tracker.DefaultNumWant,
+			MaxNumWant:     cfg.Tracker.MaxNumWant,
+			Whitelist:      cfg.Tracker.Whitelist,
+			Passkeys:       passkeys,
+			RequirePasskey: cfg.Tracker.RequirePasskey,
+		}, logger)
+		server.tracker.known = server.hasInfoHash
+		server.tracker.completed = server.downloadCompleted
+		go server.tracker.persistLoop(30 * time.Second)
+		go server.tracker.reapLoop()
+		if !trackerURLSet {
+			server.trackerURL = server.baseURL() + "/announce"
+		}
+	}
+
+	// With several trackers, new torrents list them all and clients are
+	// steered towards the ones that pass health checks
+	server.setTrackers(cfg.TrackerURLs)
+	go server.trackerHealthLoop(cfg.TrackerHealth.Interval, cfg.TrackerHealth.Timeout)
+
+	// Servers sharing state and models directories elect a leader for
+	// writes; take the lease now if it's free so a lone node creates torrents
+	if cfg.HA.Enabled {
+		server.lease = newLeaderLease(
+			filepath.Join(server.stateDir, "leader.json"),
+			cfg.HA.NodeID,
+			cfg.HA.LeaseTTL,
+			logger,
+		)
+		server.lease.refresh()
+		if server.tracker != nil {
+			server.tracker.leader = server.lease.isLeader
+		}
+	}
+
+	if err := server.loadVisibility(); err != nil {
+		logger.Warnf("Failed to load model visibility: %v", err)
+	}
+	if err := server.loadNotes(); err != nil {
+		logger.Warnf("Failed to load model descriptions: %v", err)
 	}
 
 	// Discover models
@@ -132,8 +391,144 @@ func run(cmd *cobra.Command, args []string) {
 		logger.Fatal("Failed to discover models:", err)
 	}
 
+	// Seed the catalog ourselves instead of relying on seeder.py
+	if cfg.Seeder.Embedded {
+		seeder, err := newSeeder(seederConfig{
+			ModelsDir:  server.modelsDir,
+			ListenPort: cfg.Seeder.Port,
+			LSD:        cfg.Seeder.LSD,
+			PEX:        cfg.Seeder.PEX,
+			UTP:        cfg.Seeder.UTP,
+			TCP:        cfg.Seeder.TCP,
+			Encryption: cfg.Seeder.Encryption,
+
+			MaxUploadRate:        cfg.Seeder.MaxUploadRate,
+			TorrentMaxUploadRate: cfg.Seeder.TorrentMaxUploadRate,
+			ModelUploadRates:     cfg.Seeder.ModelUploadRates,
+
+			Policy:       cfg.Seeder.Policy,
+			Pinned:       cfg.Seeder.Pinned,
+			Models:       cfg.Seeder.Models,
+			RecentWindow: cfg.Seeder.RecentWindow,
+
+			WarmupWindow: cfg.Seeder.WarmupWindow,
+			WarmupConns:  cfg.Seeder.WarmupConnections,
+
+			MaxConns:           cfg.Seeder.MaxConnections,
+			HalfOpenPerTorrent: cfg.Seeder.HalfOpenPerTorrent,
+			MaxHalfOpen:        cfg.Seeder.MaxHalfOpen,
+		}, logger)
+		if err != nil {
+			logger.Fatal("Failed to start embedded seeder:", err)
+		}
+		defer seeder.Close()
+		seeder.seedOverride = func(name string) string { return server.modelSettings(name).Seed }
+		seeder.verifyFailed = func(name string, err error) {
+			server.notify(eventVerificationFailed, fmt.Sprintf("The seeder couldn't verify %s: %v", name, err))
+		}
+		server.seeder = seeder
+
+		server.seedCatalog()
+
+		// Both only act under the recent policy, which a reload can switch to
+		go seeder.expireLoop()
+		// Announces from clients that already have the .torrent count as requests
+		if server.tracker != nil {
+			server.tracker.announced = func(infoHash string) {
+				if model, ok := server.modelByInfoHash(infoHash); ok {
+					seeder.requested(model)
+				}
+			}
+		}
+
+		if seeder.config.LSD {
+			if err := seeder.startLSD(); err != nil {
+				logger.Warnf("Failed to start Local Service Discovery: %v", err)
+			}
+		}
+	}
+
+	for _, upstream := range cfg.Mirror.upstreams() {
+		window, _ := parseReplicationWindow(upstream.Window) // validated by loadConfig
+		server.mirrorSources = append(server.mirrorSources, mirrorSource{
+			URL:     strings.TrimSuffix(upstream.URL, "/"),
+			Window:  window,
+			MaxRate: upstream.MaxRate,
+		})
+	}
+
+	// A mirror downloads through the embedded seeder's client
+	if len(server.mirrorSources) > 0 {
+		go server.mirrorLoop(cfg.Mirror.Interval)
+	}
+
+	if primaries := cfg.Federation.RegisterWith; len(primaries) > 0 {
+		go server.registerLoop(primaries, server.registrationTTL/3)
+	}
+
+	if edges := cfg.Federation.PushTo; len(edges) > 0 {
+		go server.pushLoop(edges, cfg.Federation.RefreshInterval)
+	}
+
+	if len(server.federationPeers) > 0 {
+		go server.federationLoop(cfg.Federation.RefreshInterval)
+	}
+
+	// Pick up admin-supplied torrents after the seeder is running, so they're
+	// seeded as soon as they're listed
+	if server.watchDir != "" {
+		if err := server.scanWatchDir(); err != nil {
+			logger.Warnf("Failed to scan watch directory: %v", err)
+		}
+		go server.watchLoop(cfg.Watch.Interval)
+	}
+
+	if interval := cfg.Integrity.Interval; interval > 0 {
+		go server.integrityLoop(interval, cfg.Integrity.MaxRate)
+	}
+
+	if len(server.webhooks) > 0 && cfg.Notifications.MinFreeSpace > 0 {
+		go server.diskLoop(int64(cfg.Notifications.MinFreeSpace)<<30, cfg.Notifications.DiskCheckInterval)
+	}
+
+	if server.lease != nil {
+		go server.haLoop(cfg.HA.RescanInterval)
+	}
+
+	go server.reloadLoop()
+
+	if cfg.Admin.Listen != "" {
+		go server.startAdminServer(cfg.Admin.Listen)
+	}
+	if cfg.Admin.ProfileInterval > 0 {
+		go server.profileLoop(cfg.Admin.ProfileDir, cfg.Admin.ProfileInterval, cfg.Admin.ProfileKeep)
+	}
+
+	// Advertise over mDNS; failure here shouldn't keep the cache offline
+	if server.mdnsEnabled {
+		if mdnsServer, err := server.startMDNS(); err != nil {
+			logger.Warnf("Failed to start mDNS advertisement: %v", err)
+		} else {
+			defer mdnsServer.Shutdown()
+		}
+	}
+
+	// SIGINT and SIGTERM stop the listeners, letting open requests finish,
+	// and then the deferred cleanups run
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start HTTP server
-	server.startHTTPServer()
+	server.startHTTPServer(ctx)
+
+	// Announces since the last periodic save would otherwise be lost; in a
+	// high-availability pair only the leader writes the shared state file
+	if server.tracker != nil && server.lease.isLeader() {
+		if err := server.tracker.save(); err != nil {
+			logger.Warnf("Failed to save tracker state: %v", err)
+		}
+	}
+	logger.Info("Server stopped")
 }
 
 func initConfig() {
@@ -151,11 +546,29 @@ func initConfig() {
 		viper.SetConfigName(".ollama-bt-lancache")
 	}
 
-	viper.AutomaticEnv()
+	home, err := homedir.Dir()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	setConfigDefaults(home)
+	bindEnv()
 
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
 	}
+	// The profile can itself come from the config file
+	applyProfile(viper.GetString("profile"))
+}
+
+// baseURL is the address clients should use to reach this server. It
+// defaults to the detected LAN IP but can be overridden with external_url
+// when the server is NAT'd or fronted by a proxy with a DNS name.
+func (s *Server) baseURL() string {
+	if s.externalURL != "" {
+		return strings.TrimSuffix(s.externalURL, "/")
+	}
+	return fmt.Sprintf("http://%s:%s", s.serverIP, s.port)
 }
 
 func getLocalIP() (string, error) {
@@ -173,22 +586,45 @@ func (s *Server) discoverModels() error {
 	s.logger.Infof("Discovering Ollama models in: %s", s.modelsDir)
 
 	// Parse Ollama manifest files to find actual models
-	models, err := s.parseOllamaManifests()
+	models, pending, err := s.parseOllamaManifests()
 	if err != nil {
 		s.logger.Warnf("Failed to parse Ollama manifests: %v", err)
 		// Fallback to directory scanning
 		return s.discoverModelsFromDirectories()
 	}
 
+	s.modelsMu.Lock()
+	previous, rediscovered := s.models, s.discovered
 	s.models = models
-	s.logger.Infof("Discovered %d Ollama models", len(s.models))
+	s.discovered = true
+	s.modelsMu.Unlock()
+	s.logger.Infof("Discovered %d Ollama models", len(models))
+	s.warnUnmatchedAllowlist(models)
+	s.queueTorrents(pending)
+
+	s.migrateVersionDirs(models)
+	for _, model := range models {
+		if model.TorrentStatus == torrentReady {
+			s.recordVersion(model)
+		}
+	}
+
+	// The first discovery finds the whole catalog, not new models
+	if rediscovered {
+		s.announceNewModels(previous, models)
+	}
 	
 	return nil
 }
 
-func (s *Server) parseOllamaManifests() ([]Model, error) {
+// parseOllamaManifests lists the models in the manifests directory, along
+// with the ones whose torrents still need creating.
+func (s *Server) parseOllamaManifests() ([]Model, []string, error) {
 	var models []Model
 	modelMap := make(map[string]Model) // For deduplication
+	quarantine := []QuarantinedManifest{}
+	seen := make(map[string]bool) // manifests to keep parsed for the next rescan
+	var pending []string          // models whose torrents need creating
 	manifestsDir := filepath.Join(s.modelsDir, "manifests")
 	
 	// Walk through the manifests directory structure
@@ -228,24 +664,70 @@ func (s *Server) parseOllamaManifests() ([]Model, error) {
 					modelName = fmt.Sprintf("%s:%s", parts[1], tag)
 				}
 				
+				// Models outside the allowlist stay private to this host
+				if modelName != "" && !s.published(modelName) {
+					s.logger.Debugf("Skipping model %s: not in the models allowlist", modelName)
+					modelName = ""
+				}
+
+				// A malformed manifest is quarantined rather than published
+				// as a model no client could download
+				var manifest parsedManifest
 				if modelName != "" {
-					// Calculate model size by reading the manifest
-					size, err := s.calculateModelSize(path)
+					seen[path] = true
+					var err error
+					if manifest, err = s.parseManifest(path, info); err == nil {
+						err = manifest.err
+					}
 					if err != nil {
-						s.logger.Warnf("Failed to calculate size for %s: %v", modelName, err)
-						size = 0
+						s.logger.Warnf("Quarantined manifest %s for %s: %v", path, modelName, err)
+						quarantine = append(quarantine, QuarantinedManifest{
+							Model: modelName,
+							Path:  path,
+							Error: err.Error(),
+							Since: time.Now(),
+						})
+						modelName = ""
 					}
-					
+				}
+
+				if modelName != "" {
+					settings := s.modelSettings(modelName)
 					model := Model{
 						Name:      modelName,
 						Path:      s.modelsDir, // All models share the same blobs directory
-						Size:      size,
-						CreatedAt: time.Now(),
+						Size:      manifest.size,
+						SizeHuman: formatSize(manifest.size),
+						CreatedAt: info.ModTime(), // when the model was pulled
+						Hidden:    settings.Hidden,
+						Groups:    settings.Groups,
+						Digest:    manifest.digest,
+
+						Description: s.modelDescription(modelName),
 					}
 					
-					// Generate individual torrent file for this specific model
-					if torrentFile, err := s.generateModelTorrentFile(&model); err == nil {
-						model.TorrentFile = torrentFile
+					// A model with blobs missing, such as an interrupted pull,
+					// is listed but gets no torrent until it's complete
+					if missing := s.missingBlobs(manifest.digests); len(missing) > 0 {
+						model.Incomplete = true
+						model.MissingBlobs = missing
+						s.logger.Warnf("Model %s is incomplete: %d blobs missing", modelName, len(missing))
+					}
+
+					// An existing torrent is listed right away; one that needs
+					// hashing is created in the background, so a large catalog
+					// doesn't hold up startup or a rescan
+					if !model.Incomplete {
+						model.TorrentStatus = torrentPending
+						if torrentFile, ok := s.existingModelTorrent(&model); ok {
+							model.TorrentFile = torrentFile
+							model.TorrentStatus = torrentReady
+							if infoHash, err := torrentInfoHash(torrentFile); err == nil {
+								model.InfoHash = infoHash
+							}
+						} else if s.lease.isLeader() {
+							pending = append(pending, model.Name)
+						}
 					}
 					
 					// Add to map for deduplication
@@ -262,19 +744,21 @@ func (s *Server) parseOllamaManifests() ([]Model, error) {
 	for _, model := range modelMap {
 		models = append(models, model)
 	}
+	if err == nil {
+		s.setQuarantine(quarantine)
+		s.retainManifests(seen)
+	}
 	
-	return models, err
+	return models, pending, err
 }
 
-func (s *Server) calculateModelSize(manifestPath string) (int64, error) {
-	// Read the manifest file to calculate total size
-	data, err := os.ReadFile(manifestPath)
-	if err != nil {
-		return 0, err
-	}
-	
+// manifestSize adds up the sizes of a manifest's config and layers.
+func manifestSize(data []byte) (int64, error) {
 	// Parse JSON manifest
 	var manifest struct {
+		Config struct {
+			Size int64 `json:"size"`
+		} `json:"config"`
 		Layers []struct {
 			Size int64 `json:"size"`
 		} `json:"layers"`
@@ -284,7 +768,7 @@ func (s *Server) calculateModelSize(manifestPath string) (int64, error) {
 		return 0, err
 	}
 	
-	var totalSize int64
+	totalSize := manifest.Config.Size
 	for _, layer := range manifest.Layers {
 		totalSize += layer.Size
 	}
@@ -300,8 +784,9 @@ func (s *Server) discoverModelsFromDirectories() error {
 		return fmt.Errorf("failed to read models directory: %w", err)
 	}
 
+	var models []Model
 	for _, entry := range entries {
-		if entry.IsDir() && entry.Name() != "manifests" && entry.Name() != "blobs" {
+		if entry.IsDir() && entry.Name() != "manifests" && entry.Name() != "blobs" && s.published(entry.Name()) {
 			modelPath := filepath.Join(s.modelsDir, entry.Name())
 			model := Model{
 				Name:      entry.Name(),
@@ -312,6 +797,7 @@ func (s *Server) discoverModelsFromDirectories() error {
 			// Get model size
 			if size, err := getDirSize(modelPath); err == nil {
 				model.Size = size
+				model.SizeHuman = formatSize(size)
 			}
 
 			// Generate torrent file
@@ -319,11 +805,14 @@ func (s *Server) discoverModelsFromDirectories() error {
 				model.TorrentFile = torrentFile
 			}
 
-			s.models = append(s.models, model)
+			models = append(models, model)
 			s.logger.Infof("Discovered model: %s (Size: %d bytes)", model.Name, model.Size)
 		}
 	}
 
+	s.modelsMu.Lock()
+	s.models = models
+	s.modelsMu.Unlock()
 	return nil
 }
 
@@ -341,17 +830,62 @@ func getDirSize(path string) (int64, error) {
 	return size, err
 }
 
+// modelTorrentPath is where the torrent of a model is kept.
+func (s *Server) modelTorrentPath(name string) string {
+	safeName := strings.ReplaceAll(name, ":", "_")
+	return filepath.Join(s.modelsDir, fmt.Sprintf("%s.torrent", safeName))
+}
+
+// existingModelTorrent returns a model's torrent if it's on disk and still
+// matches the model, so it can be listed without hashing anything. A torrent
+// that's being created is reported as not there yet rather than waited for,
+// so a rescan doesn't block on hashing.
+func (s *Server) existingModelTorrent(model *Model) (string, bool) {
+	torrentPath := s.modelTorrentPath(model.Name)
+	unlock, ok := s.tryLockTorrent(torrentPath)
+	if !ok {
+		return torrentPath, false
+	}
+	defer unlock()
+	return torrentPath, s.torrentUsable(torrentPath, model)
+}
+
+// torrentUsable reports whether the torrent at torrentPath can be served for
+// model as it is. The caller holds the torrent's lock.
+func (s *Server) torrentUsable(torrentPath string, model *Model) bool {
+	if _, err := os.Stat(torrentPath); err != nil {
+		return false
+	}
+	problems := s.torrentProblems(torrentPath, model)
+	if len(problems) == 0 || !s.lease.isLeader() {
+		if s.lease.isLeader() {
+			s.migrateTorrentAnnounce(torrentPath)
+		}
+		s.logger.Infof("Using existing torrent file: %s", torrentPath)
+		return true
+	}
+	// Serving it would hand out metadata no client can complete
+	s.logger.Warnf("Regenerating %s, which no longer matches the model: %s", torrentPath, strings.Join(problems, "; "))
+	return false
+}
+
 func (s *Server) generateModelTorrentFile(model *Model) (string, error) {
 	// Create individual torrent file for this specific model
-	safeName := strings.ReplaceAll(model.Name, ":", "_")
-	torrentPath := filepath.Join(s.modelsDir, fmt.Sprintf("%s.torrent", safeName))
+	torrentPath := s.modelTorrentPath(model.Name)
+
+	// A rescan and a request can both find the torrent missing
+	unlock := s.lockTorrent(torrentPath)
+	defer unlock()
 	
 	// Check if torrent file already exists
-	if _, err := os.Stat(torrentPath); err == nil {
-		s.logger.Infof("Using existing torrent file: %s", torrentPath)
+	if s.torrentUsable(torrentPath, model) {
 		return torrentPath, nil
 	}
 	
+	if !s.lease.isLeader() {
+		return "", fmt.Errorf("no torrent file yet for %s; the leader creates it", model.Name)
+	}
+
 	s.logger.Infof("Creating individual torrent file for model: %s", model.Name)
 	
 	// Create torrent for this specific model only
@@ -366,34 +900,35 @@ func (s *Server) generateModelTorrentFile(model *Model) (string, error) {
 		return "", fmt.Errorf("failed to encode torrent: %w", err)
 	}
 	
-	if err := os.WriteFile(torrentPath, torrentData, 0644); err != nil {
-		return "", fmt.Errorf("failed to write torrent file: %w", err)
+	if err := s.publishTorrent(torrentPath, torrentData); err != nil {
+		return "", err
 	}
 	
 	s.logger.Infof("Created individual torrent file: %s", torrentPath)
 	return torrentPath, nil
 }
 
-func (s *Server) createModelSpecificTorrentFile(model *Model) (*TorrentFile, error) {
-	// Parse the model name to get the manifest path
-	modelPath := strings.Replace(model.Name, ":", "/", 1)
-	
-	// Try both possible manifest path formats
-	var manifestPath string
-	var err error
-	
+// manifestPath finds the manifest of a model in the models directory.
+func (s *Server) manifestPath(name string) (string, error) {
+	modelPath := strings.Replace(name, ":", "/", 1)
+
 	// Format 1: manifests/registry.ollama.ai/{model}/{tag}.json
-	manifestPath1 := filepath.Join(s.modelsDir, "manifests", "registry.ollama.ai", modelPath+".json")
-	if _, err = os.Stat(manifestPath1); err == nil {
-		manifestPath = manifestPath1
-	} else {
-		// Format 2: manifests/registry.ollama.ai/library/{model}/{tag}
-		manifestPath2 := filepath.Join(s.modelsDir, "manifests", "registry.ollama.ai", "library", modelPath)
-		if _, err = os.Stat(manifestPath2); err == nil {
-			manifestPath = manifestPath2
-		} else {
-			return nil, fmt.Errorf("manifest not found for model %s (tried both formats)", model.Name)
-		}
+	manifestPath := filepath.Join(s.modelsDir, "manifests", "registry.ollama.ai", modelPath+".json")
+	if _, err := os.Stat(manifestPath); err == nil {
+		return manifestPath, nil
+	}
+	// Format 2: manifests/registry.ollama.ai/library/{model}/{tag}
+	manifestPath = filepath.Join(s.modelsDir, "manifests", "registry.ollama.ai", "library", modelPath)
+	if _, err := os.Stat(manifestPath); err == nil {
+		return manifestPath, nil
+	}
+	return "", fmt.Errorf("manifest not found for model %s (tried both formats)", name)
+}
+
+func (s *Server) createModelSpecificTorrentFile(model *Model) (*TorrentFile, error) {
+	manifestPath, err := s.manifestPath(model.Name)
+	if err != nil {
+		return nil, err
 	}
 	
 	// Read and parse the manifest
@@ -402,16 +937,25 @@ func (s *Server) createModelSpecificTorrentFile(model *Model) (*TorrentFile, err
 		return nil, fmt.Errorf("failed to read manifest: %w", err)
 	}
 	
+	type blobRef struct {
+		Digest string `json:"digest"`
+		Size   int64  `json:"size"`
+	}
 	var manifest struct {
-		Layers []struct {
-			Digest string `json:"digest"`
-			Size   int64  `json:"size"`
-		} `json:"layers"`
+		Config blobRef   `json:"config"`
+		Layers []blobRef `json:"layers"`
 	}
 	
 	if err := json.Unmarshal(manifestData, &manifest); err != nil {
 		return nil, fmt.Errorf("failed to parse manifest: %w", err)
 	}
+
+	// Ollama won't run a model without its config blob, so it's shipped
+	// alongside the layers
+	blobs := manifest.Layers
+	if manifest.Config.Digest != "" {
+		blobs = append([]blobRef{manifest.Config}, blobs...)
+	}
 	
 	// Create file list for this model
 	var files []File
@@ -429,15 +973,14 @@ func (s *Server) createModelSpecificTorrentFile(model *Model) (*TorrentFile, err
 	})
 	totalSize += int64(len(manifestData))
 	
-	// Add layer files
-	for _, layer := range manifest.Layers {
+	// Add the config and layer files
+	for _, layer := range blobs {
 		digest := strings.TrimPrefix(layer.Digest, "sha256:")
 		layerPath := filepath.Join(s.modelsDir, "blobs", fmt.Sprintf("sha256-%s", digest))
 		
-		// Check if the layer file exists
+		// A torrent without every blob could never produce a working model
 		if _, err := os.Stat(layerPath); err != nil {
-			s.logger.Warnf("Layer file not found: %s", layerPath)
-			continue
+			return nil, fmt.Errorf("blob %s of model %s is missing", layer.Digest, model.Name)
 		}
 		
 		relLayerPath, err := filepath.Rel(s.modelsDir, layerPath)
@@ -458,30 +1001,40 @@ func (s *Server) createModelSpecificTorrentFile(model *Model) (*TorrentFile, err
 	}
 	
 	// Calculate piece hashes
-	pieceLength := int64(32 * 1024) // 32KB pieces for smaller metadata
+	settings := s.modelSettings(model.Name)
+	pieceLength := settings.PieceSize
 	if totalSize < pieceLength {
 		pieceLength = totalSize
 	}
 	
-	pieces, err := s.calculatePieceHashesForFiles(files, s.modelsDir, pieceLength)
+	var pieces string
+	if s.alignBlobs && pieceLength == settings.PieceSize {
+		files, pieces, err = s.alignedPieces(files[1:], files[:1], pieceLength, nil)
+	} else {
+		pieces, err = s.calculatePieceHashesForFiles(files, s.modelsDir, pieceLength)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate piece hashes: %w", err)
 	}
 	
 	// Create torrent info
-			torrentInfo := TorrentInfo{
-			PieceLength: pieceLength,
-			Pieces:      pieces,
-			Name:        "models", // Use "models" as the torrent name to match file structure
-			Files:       files,
-			Private:     1, // Private torrent for local network distribution
-		}
+	torrentInfo := TorrentInfo{
+		PieceLength: pieceLength,
+		Pieces:      pieces,
+		Name:        "models", // Use "models" as the torrent name to match file structure
+		Files:       files,
+		Source:      s.torrentMeta.Source,
+	}
+	if settings.Private {
+		torrentInfo.Private = 1 // Private torrent for local network distribution
+	}
 	
 	// Create torrent file for private tracker
 	torrent := &TorrentFile{
 		Announce:     s.trackerURL,
-		Comment:      fmt.Sprintf("Ollama model: %s", model.Name),
-		CreatedBy:    "ollama-bt-lancache",
+		AnnounceList: s.announceList(),
+		Comment:      s.torrentComment(model.Name),
+		CreatedBy:    s.torrentMeta.CreatedBy,
 		CreationDate: time.Now().Unix(),
 		Encoding:     "UTF-8",
 		Info:         torrentInfo,
@@ -490,64 +1043,216 @@ func (s *Server) createModelSpecificTorrentFile(model *Model) (*TorrentFile, err
 	return torrent, nil
 }
 
+// torrentComment fills in the configured comment for a model's torrent.
+func (s *Server) torrentComment(modelName string) string {
+	return strings.ReplaceAll(s.torrentMeta.Comment, "{model}", modelName)
+}
+
+// torrentInfoHash returns the hex info-hash of a .torrent file: the SHA1 of
+// its bencoded info dictionary, exactly as stored on disk.
+func torrentInfoHash(torrentPath string) (string, error) {
+	data, err := os.ReadFile(torrentPath)
+	if err != nil {
+		return "", err
+	}
+
+	var torrent struct {
+		Info bencode.Bytes `bencode:"info"`
+	}
+	if err := bencode.Unmarshal(data, &torrent); err != nil {
+		return "", fmt.Errorf("failed to decode torrent: %w", err)
+	}
+
+	hash := sha1.Sum(torrent.Info)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// lockTorrent serializes checking, creating, and rewriting one .torrent
+// file and returns the unlock function.
+func (s *Server) lockTorrent(torrentPath string) func() {
+	lock := s.torrentLock(torrentPath)
+	lock.Lock()
+	return lock.Unlock
+}
+
+// tryLockTorrent is lockTorrent without waiting: it fails while another
+// goroutine holds the torrent's lock, such as one hashing it.
+func (s *Server) tryLockTorrent(torrentPath string) (func(), bool) {
+	lock := s.torrentLock(torrentPath)
+	if !lock.TryLock() {
+		return nil, false
+	}
+	return lock.Unlock, true
+}
+
+func (s *Server) torrentLock(torrentPath string) *sync.Mutex {
+	s.torrentMu.Lock()
+	defer s.torrentMu.Unlock()
+	if s.torrentLocks == nil {
+		s.torrentLocks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := s.torrentLocks[torrentPath]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.torrentLocks[torrentPath] = lock
+	}
+	return lock
+}
+
+// writeTemp writes data to a uniquely named temporary file next to path, to
+// be renamed over it. Readers of path never see a partial write.
+func writeTemp(path string, data []byte) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// migrateTorrentAnnounce points an existing .torrent at the configured tracker
+// when tracker_url has changed since it was created. Only the announce fields
+// are rewritten; the info dictionary is kept byte-for-byte, so the info-hash
+// and existing swarms are unaffected.
+func (s *Server) migrateTorrentAnnounce(torrentPath string) {
+	data, err := os.ReadFile(torrentPath)
+	if err != nil {
+		s.logger.Warnf("Failed to read %s: %v", torrentPath, err)
+		return
+	}
+
+	var torrent map[string]bencode.Bytes
+	if err := bencode.Unmarshal(data, &torrent); err != nil {
+		s.logger.Warnf("Failed to decode %s: %v", torrentPath, err)
+		return
+	}
+
+	var announce string
+	if raw, ok := torrent["announce"]; ok {
+		bencode.Unmarshal(raw, &announce)
+	}
+	if announce == s.trackerURL {
+		return
+	}
+
+	torrent["announce"] = bencode.MustMarshal(s.trackerURL)
+	if raw, ok := torrent["announce-list"]; ok {
+		var tiers [][]string
+		if err := bencode.Unmarshal(raw, &tiers); err == nil {
+			for _, tier := range tiers {
+				for i := range tier {
+					if tier[i] == announce {
+						tier[i] = s.trackerURL
+					}
+				}
+			}
+			torrent["announce-list"] = bencode.MustMarshal(tiers)
+		}
+	}
+
+	data, err = bencode.Marshal(torrent)
+	if err != nil {
+		s.logger.Warnf("Failed to encode %s: %v", torrentPath, err)
+		return
+	}
+
+	// Write via a temp file so a crash never leaves a truncated torrent
+	tmp, err := writeTemp(torrentPath, data)
+	if err != nil {
+		s.logger.Warnf("Failed to write %s: %v", torrentPath, err)
+		return
+	}
+	if err := os.Rename(tmp, torrentPath); err != nil {
+		os.Remove(tmp)
+		s.logger.Warnf("Failed to replace %s: %v", torrentPath, err)
+		return
+	}
+
+	s.logger.Infof("Migrated %s from tracker %s to %s", torrentPath, announce, s.trackerURL)
+}
+
 func (s *Server) calculatePieceHashesForFiles(files []File, basePath string, pieceLength int64) (string, error) {
-	var pieces []byte
-	var currentPiece []byte
-	var currentPieceSize int64
-	
-	for _, file := range files {
-		filePath := filepath.Join(basePath, filepath.Join(file.Path...))
-		
-		// Open the file
-		f, err := os.Open(filePath)
+	return s.hashFiles(files, basePath, pieceLength, nil)
+}
+
+// hashFiles hashes the pieces of files, counting what it hashes in progress
+// when that isn't nil.
+func (s *Server) hashFiles(files []File, basePath string, pieceLength int64, progress *hashProgress) (string, error) {
+	// Pick up where an interrupted run left off, at the first piece the
+	// journal has no hash for
+	journal := s.openHashJournal(files, basePath, pieceLength)
+	pieces := journal.pieces
+
+	data, err := openPieceData(files, basePath)
+	if err != nil {
+		return "", err
+	}
+	defer data.Close()
+	if err := data.checkSizes(); err != nil {
+		journal.finish()
+		return "", err
+	}
+
+	// Workers read chunks of whole pieces, at least hashReadSize each,
+	// straight into their own buffers and hash the pieces where they landed.
+	// The journal is saved after each round of about journalInterval.
+	chunkPieces := (hashReadSize + pieceLength - 1) / pieceLength
+	buffers := make([][]byte, hashWorkers(chunkPieces*pieceLength))
+	for i := range buffers {
+		buffers[i] = make([]byte, chunkPieces*pieceLength)
+	}
+	roundPieces := int64(len(buffers)) * chunkPieces
+	roundPieces *= max(1, journalInterval/(roundPieces*pieceLength))
+
+	numPieces := (data.size() + pieceLength - 1) / pieceLength
+	progress.add(int64(len(pieces)/sha1.Size) * pieceLength)
+	for next := int64(len(pieces) / sha1.Size); next < numPieces; {
+		end := min(next+roundPieces, numPieces)
+		hashes, err := data.hashPieces(next, end, pieceLength, buffers)
 		if err != nil {
-			return "", fmt.Errorf("failed to open file %s: %w", filePath, err)
+			return "", err
 		}
-		
-		// Read the file in chunks
-		buffer := make([]byte, 64*1024) // 64KB buffer
-		for {
-			n, err := f.Read(buffer)
-			if n > 0 {
-				currentPiece = append(currentPiece, buffer[:n]...)
-				currentPieceSize += int64(n)
-				
-				// If we have a complete piece, hash it
-				for currentPieceSize >= pieceLength {
-					hash := sha1.Sum(currentPiece[:pieceLength])
-					pieces = append(pieces, hash[:]...)
-					
-					// Remove the hashed piece from currentPiece
-					currentPiece = currentPiece[pieceLength:]
-					currentPieceSize -= pieceLength
-				}
-			}
-			if err != nil {
-				if err == io.EOF {
-					break
-				}
-				f.Close()
-				return "", fmt.Errorf("failed to read file %s: %w", filePath, err)
-			}
+		pieces = append(pieces, hashes...)
+		progress.add((end - next) * pieceLength)
+		next = end
+
+		if next < numPieces {
+			fileIndex, offset := data.position(next * pieceLength)
+			journal.checkpoint(s, fileIndex, offset, pieces)
 		}
-		f.Close()
 	}
-	
-	// Hash any remaining data as the final piece
-	if currentPieceSize > 0 {
-		hash := sha1.Sum(currentPiece)
-		pieces = append(pieces, hash[:]...)
+
+	// A file that changed since it was listed would shift every later piece
+	if err := data.checkSizes(); err != nil {
+		journal.finish()
+		return "", err
 	}
-	
+	journal.finish()
+
 	return string(pieces), nil
 }
 
 func (s *Server) generateTorrentFile(model Model) (string, error) {
 	// Create a single torrent file for all models
 	torrentPath := filepath.Join(s.modelsDir, "models.torrent")
+	unlock := s.lockTorrent(torrentPath)
+	defer unlock()
 	
 	// Check if torrent already exists
 	if _, err := os.Stat(torrentPath); err == nil {
+		s.migrateTorrentAnnounce(torrentPath)
 		s.logger.Infof("Using existing torrent file: %s", torrentPath)
 		return torrentPath, nil
 	}
@@ -564,8 +1269,8 @@ func (s *Server) generateTorrentFile(model Model) (string, error) {
 		return "", fmt.Errorf("failed to marshal torrent: %w", err)
 	}
 	
-	if err := os.WriteFile(torrentPath, torrentData, 0644); err != nil {
-		return "", fmt.Errorf("failed to write torrent file: %w", err)
+	if err := s.publishTorrent(torrentPath, torrentData); err != nil {
+		return "", err
 	}
 	
 	s.logger.Infof("Created torrent file: %s", torrentPath)
@@ -607,6 +1312,12 @@ func (s *Server) createTorrentFile(modelPath, modelName string) (*TorrentFile, e
 	if err != nil {
 		return nil, fmt.Errorf("failed to walk directory: %w", err)
 	}
+
+	// Pieces are hashed over the files in exactly this order, so sort it
+	// canonically: the same content gives the same torrent on every host
+	sort.Slice(files, func(i, j int) bool {
+		return strings.Join(files[i].Path, "/") < strings.Join(files[j].Path, "/")
+	})
 	
 	// Calculate piece hashes with proper alignment
 	pieceLength := int64(1024 * 1024) // 1MB pieces
@@ -614,7 +1325,7 @@ func (s *Server) createTorrentFile(modelPath, modelName string) (*TorrentFile, e
 		pieceLength = totalSize
 	}
 	
-	pieces, err := s.calculatePieceHashes(modelPath, pieceLength)
+	pieces, err := s.calculatePieceHashesForFiles(files, modelPath, pieceLength)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate piece hashes: %w", err)
 	}
@@ -626,13 +1337,14 @@ func (s *Server) createTorrentFile(modelPath, modelName string) (*TorrentFile, e
 		Name:        "models", // Use "models" as the root name to match file structure
 		Files:       files,
 		Private:     1, // Private torrent for local network distribution
+		Source:      s.torrentMeta.Source,
 	}
 	
 	// Create torrent file for private tracker
 	torrent := &TorrentFile{
 		Announce:     s.trackerURL,
-		Comment:      fmt.Sprintf("Ollama models directory - %s", modelName),
-		CreatedBy:    "ollama-bt-lancache",
+		Comment:      s.torrentComment(modelName),
+		CreatedBy:    s.torrentMeta.CreatedBy,
 		CreationDate: time.Now().Unix(),
 		Encoding:     "UTF-8",
 		Info:         torrentInfo,
@@ -641,121 +1353,274 @@ func (s *Server) createTorrentFile(modelPath, modelName string) (*TorrentFile, e
 	return torrent, nil
 }
 
-func (s *Server) calculatePieceHashes(modelPath string, pieceLength int64) (string, error) {
-	var pieces []byte
-	var currentPiece []byte
-	
-	// Collect all files first to process them in order
-	var files []string
-	err := filepath.Walk(modelPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			files = append(files, path)
-		}
-		return nil
-	})
-	
-	if err != nil {
-		return "", err
-	}
-	
-	// Process files in order to maintain consistent piece boundaries
-	for _, filePath := range files {
-		file, err := os.Open(filePath)
-		if err != nil {
-			return "", err
-		}
-		
-		buffer := make([]byte, 64*1024) // 64KB buffer for reading
-		for {
-			n, err := file.Read(buffer)
-			if err != nil && err.Error() != "EOF" {
-				file.Close()
-				return "", err
-			}
-			
-			if n == 0 {
-				break
-			}
-			
-			// Add data to current piece
-			currentPiece = append(currentPiece, buffer[:n]...)
-			
-			// If we have a complete piece, hash it
-			for len(currentPiece) >= int(pieceLength) {
-				pieceData := currentPiece[:pieceLength]
-				hash := sha1.Sum(pieceData)
-				pieces = append(pieces, hash[:]...)
-				currentPiece = currentPiece[pieceLength:]
-			}
-		}
-		file.Close()
-	}
-	
-	// Hash the final partial piece if it exists
-	if len(currentPiece) > 0 {
-		hash := sha1.Sum(currentPiece)
-		pieces = append(pieces, hash[:]...)
-	}
-	
-	return string(pieces), nil
-}
-
-
-
-func (s *Server) startHTTPServer() {
+func (s *Server) startHTTPServer(ctx context.Context) {
 	r := mux.NewRouter()
 
 	// API routes
 	r.HandleFunc("/api/models", s.getModels).Methods("GET")
+	r.HandleFunc("/api/models/compare", s.getModelComparison).Methods("GET")
+	r.HandleFunc("/api/groups", s.getGroups).Methods("GET")
+	r.HandleFunc("/api/bundles", s.getBundles).Methods("GET")
+	r.HandleFunc("/api/bundles/{family}/torrent", s.getBundleTorrent).Methods("GET")
+	r.HandleFunc("/api/everything", s.getEverything).Methods("GET")
+	r.HandleFunc("/api/everything/torrent", s.getEverythingTorrent).Methods("GET")
 	r.HandleFunc("/api/models/{name}/torrent", s.getTorrentFile).Methods("GET")
+	r.HandleFunc("/api/models/{name}/blobs", s.getModelBlobs).Methods("GET")
+	r.HandleFunc("/api/models/{name}/versions", s.getModelVersions).Methods("GET")
+	r.HandleFunc("/api/models/{name}/manifest", s.getModelManifest).Methods("GET", "HEAD")
+	r.HandleFunc("/api/models/{name}/delta", s.getModelDelta).Methods("GET")
+	r.HandleFunc("/api/models/{name}/missing", s.postMissing).Methods("POST")
+	r.HandleFunc("/api/models/{name}/metalink", s.getModelMetalink).Methods("GET")
+	if s.adminToken != "" {
+		// Each verification reads every byte of the model twice
+		r.Handle("/api/models/{name}/verify", s.requireAdmin(http.HandlerFunc(s.verifyModel))).Methods("POST")
+		r.Handle("/api/models/{name}", s.requireAdmin(http.HandlerFunc(s.handleDeleteModel))).Methods("DELETE")
+		r.Handle("/api/models/{name}/regenerate", s.requireAdmin(http.HandlerFunc(s.handleRegenerateTorrent))).Methods("POST")
+		r.Handle("/api/models/{name}/visibility", s.requireAdmin(http.HandlerFunc(s.putModelVisibility))).Methods("PUT")
+		r.Handle("/api/models/{name}/description", s.requireAdmin(http.HandlerFunc(s.putModelDescription))).Methods("PUT")
+		r.Handle("/api/models/hidden", s.requireAdmin(http.HandlerFunc(s.getHiddenModels))).Methods("GET")
+		r.Handle("/api/uploads/blobs/{digest}", s.requireAdmin(http.HandlerFunc(s.getUploadedBlob))).Methods("HEAD")
+		r.Handle("/api/uploads/blobs/{digest}", s.requireAdmin(http.HandlerFunc(s.receiveUploadedBlob))).Methods("PUT")
+		r.Handle("/api/uploads/models", s.requireAdmin(http.HandlerFunc(s.receiveUploadedModel))).Methods("POST")
+		r.HandleFunc("/api/uploads/tus/", s.tusOptions).Methods("OPTIONS")
+		r.Handle("/api/uploads/tus/", s.requireAdmin(http.HandlerFunc(s.createTusUpload))).Methods("POST")
+		r.Handle("/api/uploads/tus/{id}", s.requireAdmin(http.HandlerFunc(s.headTusUpload))).Methods("HEAD")
+		r.Handle("/api/uploads/tus/{id}", s.requireAdmin(http.HandlerFunc(s.patchTusUpload))).Methods("PATCH")
+		r.Handle("/api/uploads/tus/{id}", s.requireAdmin(http.HandlerFunc(s.deleteTusUpload))).Methods("DELETE")
+		r.Handle("/api/torrents", s.requireAdmin(http.HandlerFunc(s.receiveTorrent))).Methods("POST")
+		r.Handle("/api/jobs", s.requireAdmin(http.HandlerFunc(s.getJobs))).Methods("GET")
+		r.Handle("/api/jobs/{id}", s.requireAdmin(http.HandlerFunc(s.getJob))).Methods("GET")
+		r.Handle("/api/jobs/{action}", s.requireAdmin(http.HandlerFunc(s.postJob))).Methods("POST")
+	}
+	// After /api/models/hidden, which would otherwise look like a model
+	r.HandleFunc("/api/models/{name}", s.getModel).Methods("GET")
+	r.HandleFunc("/api/capabilities", s.getCapabilities).Methods("GET")
+	r.HandleFunc("/api/torrents", s.getExternalTorrents).Methods("GET")
+	r.HandleFunc("/feed.xml", s.serveFeed).Methods("GET")
+	r.HandleFunc("/api/trackers", s.getTrackerHealth).Methods("GET")
+	r.HandleFunc("/metrics", s.serveMetrics).Methods("GET")
+	r.HandleFunc("/api/integrity", s.getIntegrity).Methods("GET")
+	r.HandleFunc("/api/stats/clients", s.getClientStats).Methods("GET")
+	r.HandleFunc("/api/stats/export", s.exportStats).Methods("GET")
+	r.HandleFunc("/api/stats/dedup", s.getDedupReport).Methods("GET")
+	r.HandleFunc("/api/problems", s.getProblems).Methods("GET")
+	r.HandleFunc("/api/events", s.streamEvents).Methods("GET")
+	r.HandleFunc("/api/federation/catalog", s.getFederationCatalog).Methods("GET")
+	r.HandleFunc("/api/diff", s.getCatalogDiff).Methods("GET")
+	r.HandleFunc("/api/federation/models", s.getFederatedModels).Methods("GET")
+	r.HandleFunc("/api/federation/register", s.registerPeer).Methods("POST")
+	r.HandleFunc("/api/federation/registered", s.getRegisteredPeers).Methods("GET")
+	r.HandleFunc("/api/federation/push", s.receivePush).Methods("POST")
+	r.HandleFunc("/api/federation/push/blobs/{digest}", s.receivePushedBlob).Methods("PUT")
+	r.HandleFunc("/federation/availability", s.serveAvailability).Methods("GET")
+	r.HandleFunc("/api/torrents/{infohash}/torrent", s.getExternalTorrentFile).Methods("GET")
+
+	// Embedded tracker
+	if s.tracker != nil {
+		r.HandleFunc("/announce", s.tracker.handleAnnounce).Methods("GET")
+		r.HandleFunc("/announce/{key}", s.tracker.handleAnnounce).Methods("GET")
+		r.HandleFunc("/scrape", s.tracker.handleScrape).Methods("GET")
+		r.HandleFunc("/scrape/{key}", s.tracker.handleScrape).Methods("GET")
+		r.HandleFunc("/tracker/stats", s.serveTrackerStats).Methods("GET")
+		r.HandleFunc("/api/stats/downloads", s.getDownloadStats).Methods("GET")
+		r.HandleFunc("/api/stats/savings", s.getSavings).Methods("GET")
+		r.HandleFunc("/api/stats/popular", s.getPopularModels).Methods("GET")
+	}
+
+	if s.seeder != nil {
+		r.HandleFunc("/api/seeder/torrents", s.getSeederTorrents).Methods("GET")
+	}
 
 	// Downloads directory
+	// Model blobs over HTTP for BEP 19 web seeds
+	r.PathPrefix("/webseed/versions/").Handler(s.versionWebseedHandler()).Methods("GET", "HEAD")
+	r.PathPrefix("/webseed/").Handler(s.webseedHandler()).Methods("GET", "HEAD")
+	r.PathPrefix("/v2/").Handler(s.registryHandler()).Methods("GET", "HEAD")
+
+	r.HandleFunc("/branding/logo", s.serveLogo).Methods("GET")
+	r.HandleFunc("/models/{name}", s.serveModelPage).Methods("GET")
 	r.HandleFunc("/downloads/", s.serveDownloads).Methods("GET")
 	r.HandleFunc("/downloads/{filename}", s.serveDownloadFile).Methods("GET")
 
 	// Static files
 	r.HandleFunc("/install.ps1", s.servePowerShellScript).Methods("GET")
+	r.HandleFunc("/install.ps1.minisig", s.servePowerShellScript).Methods("GET")
 	r.HandleFunc("/install.sh", s.serveBashScript).Methods("GET")
+	r.HandleFunc("/install.sh.minisig", s.serveBashScript).Methods("GET")
 	r.HandleFunc("/client.py", s.serveClientScript).Methods("GET")
+	r.HandleFunc("/client.py.minisig", s.serveClientScript).Methods("GET")
+	r.HandleFunc("/ollama-bt-seed.service", s.serveSeedService).Methods("GET")
+	r.HandleFunc("/ollama-bt-seed.service.minisig", s.serveSeedService).Methods("GET")
+	r.HandleFunc("/ollama-bt-seed.xml", s.serveSeedTask).Methods("GET")
+	r.HandleFunc("/ollama-bt-seed.xml.minisig", s.serveSeedTask).Methods("GET")
+	r.HandleFunc("/docker-compose.yml", s.serveCompose).Methods("GET")
+	r.HandleFunc("/docker-compose.yml.minisig", s.serveCompose).Methods("GET")
+	r.HandleFunc("/ollama-bt-playbook.yml", s.servePlaybook).Methods("GET")
+	r.HandleFunc("/ollama-bt-playbook.yml.minisig", s.servePlaybook).Methods("GET")
+	r.HandleFunc("/bootstrap/cloud-init.yaml", s.serveCloudInit).Methods("GET")
+	r.HandleFunc("/bootstrap/cloud-init.yaml.minisig", s.serveCloudInit).Methods("GET")
+	r.HandleFunc("/bootstrap/kickstart.ks", s.serveKickstart).Methods("GET")
+	r.HandleFunc("/bootstrap/kickstart.ks.minisig", s.serveKickstart).Methods("GET")
+	r.HandleFunc("/minisign.pub", s.servePublicKey).Methods("GET")
 
 	// Web interface
 	r.HandleFunc("/", s.serveWebInterface).Methods("GET")
 
+	// Plain HTTP stays up alongside TLS so clients with the old URL baked
+	// into their scripts keep working (or get redirected, if enabled)
+	counted := s.countTransfers(r)
+	handler := counted
+	if s.tlsEnabled() {
+		if s.acmeEnabled() {
+			s.acmeManager = s.newACMEManager()
+		}
+		tlsDone := make(chan struct{})
+		go func() {
+			s.startTLSServer(ctx, counted)
+			close(tlsDone)
+		}()
+		defer func() { <-tlsDone }()
+		if s.redirectHTTP {
+			handler = http.HandlerFunc(s.redirectToHTTPS)
+		}
+		if s.acmeManager != nil {
+			// http-01 challenges arrive on the plain listener
+			handler = s.acmeManager.HTTPHandler(handler)
+		}
+	}
+
 	s.logger.Infof("Starting server on %s:%s", s.serverIP, s.port)
-	s.logger.Fatal(http.ListenAndServe(":"+s.port, r))
+	server := &http.Server{Addr: ":" + s.port, Handler: handler}
+	s.serveUntil(ctx, server, server.ListenAndServe)
+}
+
+// shutdownGrace is how long open requests get to finish at shutdown.
+const shutdownGrace = 10 * time.Second
+
+// serveUntil runs a listener until ctx is done, then shuts it down, giving
+// open requests shutdownGrace to finish before their connections are closed.
+func (s *Server) serveUntil(ctx context.Context, server *http.Server, listen func() error) {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Warnf("Closing connections still open on %s: %v", server.Addr, err)
+			server.Close()
+		}
+	}()
+	if err := listen(); err != http.ErrServerClosed {
+		s.logger.Fatal(err)
+	}
+	<-stopped
 }
 
 func (s *Server) getModels(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s.models)
+	json.NewEncoder(w).Encode(s.listedModels(r))
+}
+
+// catalog returns the current model catalog.
+func (s *Server) catalog() []Model {
+	s.modelsMu.RLock()
+	defer s.modelsMu.RUnlock()
+	return s.models
+}
+
+// updateModel applies change to a model's catalog entry and returns the
+// result. Callers of catalog keep the slice after the lock is released, so
+// the catalog is replaced with a changed copy rather than written in place.
+func (s *Server) updateModel(name string, change func(*Model)) (Model, bool) {
+	s.modelsMu.Lock()
+	defer s.modelsMu.Unlock()
+	models := make([]Model, len(s.models))
+	copy(models, s.models)
+	var updated Model
+	found := false
+	for i := range models {
+		if models[i].Name == name {
+			change(&models[i])
+			updated, found = models[i], true
+		}
+	}
+	s.models = models
+	return updated, found
+}
+
+// hasInfoHash reports whether a catalog model's or watched torrent has the
+// given hex info-hash.
+func (s *Server) hasInfoHash(infoHash string) bool {
+	if _, ok := s.modelByInfoHash(infoHash); ok {
+		return true
+	}
+	for _, ext := range s.externalTorrents() {
+		if ext.InfoHash == infoHash {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) modelByName(name string) (Model, bool) {
+	for _, model := range s.catalog() {
+		if model.Name == name {
+			return model, true
+		}
+	}
+	return Model{}, false
+}
+
+func (s *Server) modelByInfoHash(infoHash string) (Model, bool) {
+	for _, model := range s.catalog() {
+		if model.InfoHash == infoHash {
+			return model, true
+		}
+	}
+	return Model{}, false
 }
 
 func (s *Server) getTorrentFile(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	modelName := vars["name"]
 
-	for _, model := range s.models {
+	// name@digest pins a version, current or kept; see versions.go
+	modelName, digest, pinned := strings.Cut(modelName, "@")
+	if pinned {
+		model, ok := s.modelByName(modelName)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if digest != model.Digest && "sha256:"+digest != model.Digest {
+			s.getVersionTorrent(w, r, model, digest)
+			return
+		}
+	}
+
+	for _, model := range s.catalog() {
 		if model.Name == modelName {
-			// Serve the individual torrent file for this specific model
-			safeName := strings.ReplaceAll(modelName, ":", "_")
-			torrentPath := filepath.Join(s.modelsDir, fmt.Sprintf("%s.torrent", safeName))
-			
-			// Check if torrent file exists
-			if _, err := os.Stat(torrentPath); os.IsNotExist(err) {
-				s.logger.Errorf("Torrent file not found: %s", torrentPath)
-				http.NotFound(w, r)
+			if model.Incomplete {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"error":           "model is incomplete",
+					"missing_digests": model.MissingBlobs,
+				})
 				return
 			}
-			
-			// Set headers
-			w.Header().Set("Content-Type", "application/x-bittorrent")
-			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.torrent\"", modelName))
-			
-			// Serve the file
-			http.ServeFile(w, r, torrentPath)
+			if model.TorrentStatus == torrentPending || model.TorrentStatus == torrentFailed {
+				s.torrentUnavailable(w, model)
+				return
+			}
+
+			if s.seeder != nil && model.InfoHash != "" {
+				s.seeder.requested(model)
+			}
+
+			// Serve the individual torrent file for this specific model
+			s.serveTorrent(w, r, s.modelTorrentPath(modelName), modelName, "")
 			return
 		}
 	}
@@ -763,119 +1628,70 @@ func (s *Server) getTorrentFile(w http.ResponseWriter, r *http.Request) {
 	http.NotFound(w, r)
 }
 
-func (s *Server) servePowerShellScript(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.Header().Set("Content-Disposition", "attachment; filename=\"install.ps1\"")
-	
-	// Read the actual install.ps1 file from the parent directory
-	scriptPath := "../install.ps1"
-	content, err := os.ReadFile(scriptPath)
-	if err != nil {
-		s.logger.Errorf("Failed to read install.ps1: %v", err)
-		// Fallback to generated script if file not found
-		script := generatePowerShellScript(s.serverIP, s.port)
-		w.Write([]byte(script))
+// serveTorrent serves the .torrent at torrentPath as name.torrent, with this
+// request's trackers, federation peers and passkey added. A webseed, if
+// given, replaces the web seeds federation would add.
+func (s *Server) serveTorrent(w http.ResponseWriter, r *http.Request, torrentPath, name, webseed string) {
+	// Check if torrent file exists
+	torrent, err := s.torrentCache.get(torrentPath)
+	if os.IsNotExist(err) {
+		s.logger.Errorf("Torrent file not found: %s", torrentPath)
+		http.NotFound(w, r)
 		return
-	}
-	
-	// Replace all server URL references with actual server IP
-	scriptContent := string(content)
-	serverURL := fmt.Sprintf("http://%s:%s", s.serverIP, s.port)
-	
-	// Replace various patterns of server URLs
-	scriptContent = strings.ReplaceAll(scriptContent, "http://localhost:8080", serverURL)
-	scriptContent = strings.ReplaceAll(scriptContent, "localhost:8080", fmt.Sprintf("%s:%s", s.serverIP, s.port))
-	scriptContent = strings.ReplaceAll(scriptContent, `$Server = "http://localhost:8080"`, fmt.Sprintf(`$Server = "%s"`, serverURL))
-	scriptContent = strings.ReplaceAll(scriptContent, `(default: http://localhost:8080)`, fmt.Sprintf(`(default: %s)`, serverURL))
-	
-	// Replace hardcoded IP addresses with dynamic server IP
-	scriptContent = strings.ReplaceAll(scriptContent, `$Server = "http://10.37.254.211:8080"`, fmt.Sprintf(`$Server = "%s"`, serverURL))
-	scriptContent = strings.ReplaceAll(scriptContent, `(default: http://10.37.254.211:8080)`, fmt.Sprintf(`(default: %s)`, serverURL))
-	
-	// Replace any other hardcoded IP patterns
-	re := strings.NewReplacer(
-		`http://10.37.254.211:8080`, serverURL,
-		`http://192.168.1.100:8080`, serverURL,
-		`http://172.20.10.209:8080`, serverURL,
-		`192.168.1.100:8080`, fmt.Sprintf("%s:%s", s.serverIP, s.port),
-	)
-	scriptContent = re.Replace(scriptContent)
-	
-	w.Write([]byte(scriptContent))
-}
-
-func (s *Server) serveBashScript(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.Header().Set("Content-Disposition", "attachment; filename=\"install.sh\"")
-	
-	// Read the actual install.sh file from the parent directory
-	scriptPath := "../install.sh"
-	content, err := os.ReadFile(scriptPath)
-	if err != nil {
-		s.logger.Errorf("Failed to read install.sh: %v", err)
-		// Fallback to generated script if file not found
-		script := generateBashScript(s.serverIP, s.port)
-		w.Write([]byte(script))
+	} else if err != nil {
+		s.logger.Errorf("Failed to read %s: %v", torrentPath, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	
-	// Replace all server URL references with actual server IP
-	scriptContent := string(content)
-	serverURL := fmt.Sprintf("http://%s:%s", s.serverIP, s.port)
-	
-	// Replace various patterns of server URLs
-	scriptContent = strings.ReplaceAll(scriptContent, "http://localhost:8080", serverURL)
-	scriptContent = strings.ReplaceAll(scriptContent, "localhost:8080", fmt.Sprintf("%s:%s", s.serverIP, s.port))
-	scriptContent = strings.ReplaceAll(scriptContent, `SERVER_URL="http://localhost:8080"`, fmt.Sprintf(`SERVER_URL="%s"`, serverURL))
-	scriptContent = strings.ReplaceAll(scriptContent, `(default: http://localhost:8080)`, fmt.Sprintf(`(default: %s)`, serverURL))
-	
-	// Replace hardcoded IP addresses with dynamic server IP
-	// This handles cases where the script has a hardcoded IP like "http://10.37.254.211:8080"
-	scriptContent = strings.ReplaceAll(scriptContent, `SERVER_URL="http://10.37.254.211:8080"`, fmt.Sprintf(`SERVER_URL="%s"`, serverURL))
-	scriptContent = strings.ReplaceAll(scriptContent, `(default: http://10.37.254.211:8080)`, fmt.Sprintf(`(default: %s)`, serverURL))
-	
-	// Replace any other hardcoded IP patterns (more flexible approach)
-	// This regex-like replacement handles various IP patterns
-	re := strings.NewReplacer(
-		`http://10.37.254.211:8080`, serverURL,
-		`http://192.168.1.100:8080`, serverURL,
-		`http://172.20.10.209:8080`, serverURL,
-		`192.168.1.100:8080`, fmt.Sprintf("%s:%s", s.serverIP, s.port),
-	)
-	scriptContent = re.Replace(scriptContent)
-	
-	w.Write([]byte(scriptContent))
-}
 
-func (s *Server) serveClientScript(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.Header().Set("Content-Disposition", "attachment; filename=\"client.py\"")
+	// Set headers
+	w.Header().Set("Content-Type", "application/x-bittorrent")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.torrent\"", name))
 
-	// Read the client.py file from the parent directory
-	clientPath := "../client.py"
-	content, err := os.ReadFile(clientPath)
-	if err != nil {
-		s.logger.Errorf("Failed to read client.py: %v", err)
-		http.Error(w, "Client script not found", http.StatusNotFound)
-		return
+	key := r.URL.Query().Get("key")
+	if key != "" && s.tracker != nil {
+		if _, ok := s.tracker.config.Passkeys[key]; !ok {
+			http.Error(w, "Invalid passkey", http.StatusForbidden)
+			return
+		}
 	}
 
-	w.Write(content)
-}
-
+	// Federation peers and passkeys live outside the info dictionary,
+	// so they're added per request without changing the info-hash
+	federated := len(s.federationPeers) > 0 || len(s.registeredPeers()) > 0
+	multiTracker := len(s.trackerList()) > 1
+	data, etag, modTime := torrent.data, torrent.etag, torrent.modTime
+	if federated || multiTracker || (key != "" && s.tracker != nil) || webseed != "" {
+		var err error
+		if multiTracker {
+			data, err = s.withTrackerHealth(data)
+		}
+		if err == nil && federated {
+			data, err = s.withFederation(data)
+		}
+		if err == nil && webseed != "" {
+			data, err = withWebseeds(data, []string{webseed})
+		}
+		if err == nil && key != "" && s.tracker != nil {
+			data, err = withPasskey(data, key)
+		}
+		if err != nil {
+			s.logger.Errorf("Failed to rewrite %s: %v", torrentPath, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		etag, modTime = torrentETag(data), time.Time{}
+	}
 
+	// Clients polling during a rollout get 304 Not Modified while
+	// the torrent they have is still current
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+}
 
 func (s *Server) serveDownloads(w http.ResponseWriter, r *http.Request) {
-	downloadsDir := "downloads"
-	
-	// Create downloads directory if it doesn't exist
-	if err := os.MkdirAll(downloadsDir, 0755); err != nil {
-		http.Error(w, "Failed to create downloads directory", http.StatusInternalServerError)
-		return
-	}
-
 	// List files in downloads directory
-	entries, err := os.ReadDir(downloadsDir)
+	entries, err := os.ReadDir(s.downloadsDir)
 	if err != nil {
 		http.Error(w, "Failed to read downloads directory", http.StatusInternalServerError)
 		return
@@ -887,7 +1703,7 @@ func (s *Server) serveDownloads(w http.ResponseWriter, r *http.Request) {
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Downloads - Ollama BitTorrent Lancache</title>
+    <title>Downloads - {{.Title}}</title>
     <style>
         body { font-family: Arial, sans-serif; margin: 40px; background-color: #f5f5f5; }
         .container { max-width: 1200px; margin: 0 auto; background: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
@@ -925,7 +1741,7 @@ func (s *Server) serveDownloads(w http.ResponseWriter, r *http.Request) {
         {{else}}
         <div class="empty-state">
             <h3>No files available</h3>
-            <p>Upload files to the downloads/ directory to make them available here.</p>
+            <p>Copy files into the server's downloads directory (downloads_dir) to make them available here.</p>
         </div>
         {{end}}
     </div>
@@ -939,7 +1755,8 @@ func (s *Server) serveDownloads(w http.ResponseWriter, r *http.Request) {
 
 	var files []FileInfo
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		// Hidden files include uploads in progress, see tus.go
+		if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
 			info, err := entry.Info()
 			if err == nil {
 				files = append(files, FileInfo{
@@ -952,8 +1769,10 @@ func (s *Server) serveDownloads(w http.ResponseWriter, r *http.Request) {
 
 	tmplData := struct {
 		Files []FileInfo
+		Title string
 	}{
 		Files: files,
+		Title: s.branding.Title,
 	}
 
 	t, err := template.New("downloads").Parse(tmpl)
@@ -975,7 +1794,7 @@ func (s *Server) serveDownloadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	filePath := filepath.Join("downloads", filename)
+	filePath := filepath.Join(s.downloadsDir, filename)
 	
 	// Check if file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -997,17 +1816,22 @@ func (s *Server) serveWebInterface(w http.ResponseWriter, r *http.Request) {
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Ollama BitTorrent Lancache</title>
+    <title>{{.Branding.Title}}</title>
+    <link rel="alternate" type="application/rss+xml" title="{{.Branding.Title}}" href="/feed.xml">
     <style>
         body { font-family: Arial, sans-serif; margin: 40px; background-color: #f5f5f5; }
         .container { max-width: 1200px; margin: 0 auto; background: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
         h1 { color: #333; text-align: center; }
         .model-grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(300px, 1fr)); gap: 20px; margin-top: 30px; }
+        .clients-table { width: 100%; border-collapse: collapse; margin-top: 15px; }
+        .clients-table th, .clients-table td { text-align: left; padding: 8px; border-bottom: 1px solid #ddd; }
+        .clients-table .num { text-align: right; }
         .model-card { border: 1px solid #ddd; border-radius: 8px; padding: 20px; background: #fafafa; }
         .model-name { font-size: 18px; font-weight: bold; color: #333; margin-bottom: 10px; }
         .model-size { color: #666; margin-bottom: 10px; }
-        .download-btn { background: #007bff; color: white; padding: 10px 20px; border: none; border-radius: 4px; cursor: pointer; text-decoration: none; display: inline-block; }
-        .download-btn:hover { background: #0056b3; }
+        .download-btn { background: {{.Branding.AccentColor}}; color: white; padding: 10px 20px; border: none; border-radius: 4px; cursor: pointer; text-decoration: none; display: inline-block; }
+        .download-btn:hover { filter: brightness(0.85); }
+        .logo { max-height: 48px; vertical-align: middle; margin-right: 10px; }
         .install-scripts { margin-top: 30px; padding: 20px; background: #e9ecef; border-radius: 8px; }
         .script-section { margin-bottom: 20px; }
         .script-title { font-weight: bold; margin-bottom: 10px; }
@@ -1016,18 +1840,130 @@ func (s *Server) serveWebInterface(w http.ResponseWriter, r *http.Request) {
 </head>
 <body>
     <div class="container">
-        <h1>🚀 Ollama BitTorrent Lancache</h1>
+        <h1>{{with .Branding.LogoURL}}<img src="{{.}}" alt="" class="logo">{{else}}🚀 {{end}}{{.Branding.Title}}</h1>
         <p style="text-align: center; color: #666;">Efficiently distribute Ollama models using BitTorrent</p>
+
+        {{with .Branding.Announcement}}
+        <div style="background: #d1ecf1; border: 1px solid #bee5eb; color: #0c5460; border-radius: 4px; padding: 15px; margin-top: 20px; font-weight: bold;">
+            📢 {{.}}
+        </div>
+        {{end}}
+
+        {{with .Savings}}{{if .SavedBytes}}
+        <div style="background: #d4edda; border: 1px solid #c3e6cb; color: #155724; border-radius: 4px; padding: 15px; margin-top: 20px;">
+            💾 <strong>{{.SavedHuman}}</strong> of internet bandwidth saved in the last 30 days: {{.Downloads}} downloads served from this cache ({{$.SavedAllTime}} all time, <a href="/api/stats/savings?range=30d">details</a>)
+        </div>
+        {{end}}{{end}}
+
+        {{range .TrackerOutages}}
+        <div style="background: #f8d7da; border: 1px solid #f5c6cb; color: #721c24; border-radius: 4px; padding: 15px; margin-top: 20px;">
+            <strong>⚠️ Tracker down:</strong> {{.URL}} has failed health checks since {{.Since.Format "2006-01-02 15:04:05"}} ({{.LastError}}). Clients are being sent to the other trackers.
+        </div>
+        {{end}}
         
+        {{with .Dedup}}{{if .SavedBytes}}
+        <p style="color: #666; margin-top: 20px;">📦 {{.Summary}}: shared layers save {{.SavedHuman}} (<a href="/api/stats/dedup">details</a>)</p>
+        {{end}}{{end}}
+
+        {{if .Group}}
+        <p style="color: #666; margin-top: 20px;">🏷️ Showing the {{.Group}} group: <code>curl -sSL "{{.ServerURL}}/install.sh?group={{.Group}}" | bash</code> installs all of it (<a href="/">show all models</a>)</p>
+        {{end}}
+
         <div class="model-grid">
             {{range .Models}}
             <div class="model-card">
-                <div class="model-name">{{.Name}}</div>
-                <div class="model-size">Size: {{.Size}} bytes</div>
+                <div class="model-name"><a href="/models/{{.Name}}" style="color: inherit; text-decoration: none;">{{.Name}}</a></div>
+                <div class="model-size">Size: {{formatSize .Size}}</div>
+                {{if .Groups}}<div style="margin-bottom: 10px;">{{range .Groups}}<a href="/?group={{.}}" style="font-size: 12px; margin-right: 6px;">#{{.}}</a>{{end}}</div>{{end}}
+                {{if .Incomplete}}
+                <div style="color: #721c24; margin-bottom: 10px;">⚠️ Incomplete: {{len .MissingBlobs}} blob(s) missing</div>
+                {{else if eq .TorrentStatus "pending"}}
+                <div style="color: #856404; margin-bottom: 10px;">⏳ Hashing: the torrent will be ready shortly</div>
+                {{else if eq .TorrentStatus "failed"}}
+                <div style="color: #721c24; margin-bottom: 10px;">⚠️ The torrent couldn't be created; see the server log</div>
+                {{else}}
                 <a href="/api/models/{{.Name}}/torrent" class="download-btn">Download Torrent</a>
+                {{end}}
+                {{if $.Admin}}
+                <button class="download-btn" style="background: #6c757d;" data-model="{{.Name}}" onclick="verifyModel(this)">Verify</button>
+                {{if not .Incomplete}}<button class="download-btn" style="background: #fd7e14;" data-model="{{.Name}}" onclick="regenerateTorrent(this)">Regenerate Torrent</button>{{end}}
+                <button class="download-btn" style="background: #6f42c1;" data-model="{{.Name}}" onclick="setHidden(this, true)">Hide</button>
+                <button class="download-btn" style="background: #dc3545;" data-model="{{.Name}}" onclick="deleteModel(this)">Delete</button>
+                {{end}}
+                <pre class="verify-result" style="display: none; white-space: pre-wrap; font-size: 12px;"></pre>
+                {{if not .Incomplete}}
+                <div class="script-code" style="margin-top: 10px; font-size: 12px;">curl -sSL "{{$.ServerURL}}/install.sh?model={{.Name}}" | bash
+
+Invoke-WebRequest -Uri "{{$.ServerURL}}/install.ps1?model={{.Name}}" -OutFile "install.ps1"; .\install.ps1</div>
+                {{end}}
+            </div>
+            {{end}}
+        </div>
+
+        {{if .Admin}}
+        <p style="margin-top: 20px;"><button class="download-btn" style="background: #6f42c1;" onclick="showHiddenModels(this)">Show Hidden Models</button></p>
+        <div id="hidden-models"></div>
+        {{end}}
+
+        {{if .Other}}
+        <h2>📦 Other Torrents</h2>
+        <div class="model-grid">
+            {{range .Other}}
+            <div class="model-card">
+                <div class="model-name">{{.Name}}</div>
+                <div class="model-size">Size: {{formatSize .Size}}</div>
+                <a href="/api/torrents/{{.InfoHash}}/torrent" class="download-btn">Download Torrent</a>
             </div>
             {{end}}
         </div>
+        {{end}}
+
+        {{if .Remote}}
+        <h2>🌐 Elsewhere in the Federation</h2>
+        <div class="model-grid">
+            {{range .Remote}}
+            <div class="model-card">
+                <div class="model-name">{{.Name}}</div>
+                <div class="model-size">Size: {{formatSize .Size}}</div>
+                <div style="color: #666; margin-bottom: 10px;">At: {{range $i, $site := .Sites}}{{if $i}}, {{end}}{{$site.Site}}{{end}}</div>
+                <a href="{{(index .Sites 0).TorrentURL}}" class="download-btn">Download Torrent</a>
+            </div>
+            {{end}}
+        </div>
+        {{end}}
+
+        {{if .Popular}}
+        <h2>🔥 Most Popular</h2>
+        <p style="color: #666;">Downloads completed in the last 7 days, and peers in each swarm right now (<a href="/api/stats/popular">JSON</a>). Popular models are good candidates to pin on the seeder.</p>
+        <table class="clients-table">
+            <tr><th>Model</th><th class="num">Downloads</th><th class="num">Seeders</th><th class="num">Leechers</th></tr>
+            {{range .Popular}}
+            <tr>
+                <td>{{.Model}}</td>
+                <td class="num"><strong>{{.Completed}}</strong></td>
+                <td class="num">{{.Seeders}}</td>
+                <td class="num">{{.Leechers}}</td>
+            </tr>
+            {{end}}
+        </table>
+        {{end}}
+
+        {{if .TopClients}}
+        <h2>📈 Top Consumers</h2>
+        <p style="color: #666;">Data sent to each client since the server started (<a href="/api/stats/clients">all clients as JSON</a>). A machine far above the rest may be downloading the same model in a loop.</p>
+        <table class="clients-table">
+            <tr><th>Client</th><th class="num">HTTP</th><th class="num">Seeder</th><th class="num">Total</th><th>Last HTTP Request</th></tr>
+            {{range .TopClients}}
+            <tr>
+                <td>{{.Address}}</td>
+                <td class="num">{{formatSize .HTTPBytes}}</td>
+                <td class="num">{{formatSize .SeederBytes}}</td>
+                <td class="num"><strong>{{.TotalHuman}}</strong></td>
+                <td>{{if not .LastSeen.IsZero}}{{.LastSeen.Format "2006-01-02 15:04:05"}}{{end}}</td>
+            </tr>
+            {{end}}
+        </table>
+        {{end}}
 
         <div class="install-scripts">
             <h2>🚀 Quick Installation</h2>
@@ -1039,43 +1975,104 @@ func (s *Server) serveWebInterface(w http.ResponseWriter, r *http.Request) {
             <div class="script-section">
                 <div class="script-title">📋 List Available Models</div>
                 <div class="script-code"># Windows (PowerShell)
-Invoke-WebRequest -Uri "http://{{.ServerIP}}:{{.Port}}/install.ps1" -OutFile "install.ps1"; .\install.ps1 -List
+Invoke-WebRequest -Uri "{{.ServerURL}}/install.ps1" -OutFile "install.ps1"; .\install.ps1 -List
 
 # Linux/macOS (Bash)
-curl -sSL "http://{{.ServerIP}}:{{.Port}}/install.sh" | bash -s -- --list</div>
+curl -sSL "{{.ServerURL}}/install.sh" | bash -s -- --list</div>
             </div>
             
             <div class="script-section">
                 <div class="script-title">📥 Download Specific Model</div>
+                <p style="margin: 0 0 10px 0;">Each model above has its own ready-made command. The same works with any model name:</p>
                 <div class="script-code"># Windows (PowerShell)
-Invoke-WebRequest -Uri "http://{{.ServerIP}}:{{.Port}}/install.ps1" -OutFile "install.ps1"; .\install.ps1 -Model granite3.3:8b
+Invoke-WebRequest -Uri "{{.ServerURL}}/install.ps1" -OutFile "install.ps1"; .\install.ps1 -Model granite3.3:8b
 
 # Linux/macOS (Bash)
-curl -sSL "http://{{.ServerIP}}:{{.Port}}/install.sh" | bash -s -- --model granite3.3:8b</div>
+curl -sSL "{{.ServerURL}}/install.sh" | bash -s -- --model granite3.3:8b</div>
+            </div>
+            
+
+            
+            <div class="script-section">
+                <div class="script-title">⚙️ Without Python</div>
+                <div class="script-code"># Linux/macOS (Bash), using aria2c instead of libtorrent
+curl -sSL "{{.ServerURL}}/install.sh?client=aria2c" | bash -s -- --model granite3.3:8b
+
+# NAS or minimal Linux with Transmission (uses a running transmission-daemon if there is one)
+curl -sSL "{{.ServerURL}}/install.sh?client=transmission" | bash -s -- --model granite3.3:8b</div>
             </div>
             
+            <div class="script-section">
+                <div class="script-title">🌱 Keep Seeding in the Background</div>
+                <div class="script-code"># Windows (PowerShell): registers a Scheduled Task from {{.ServerURL}}/ollama-bt-seed.xml
+Invoke-WebRequest -Uri "{{.ServerURL}}/install.ps1" -OutFile "install.ps1"; .\install.ps1 -Seeder
 
+# Linux (Bash): installs a systemd user unit from {{.ServerURL}}/ollama-bt-seed.service
+curl -sSL "{{.ServerURL}}/install.sh" | bash -s -- --seeder</div>
+            </div>
+            
+            <div class="script-section">
+                <div class="script-title">🐳 Run in a Container</div>
+                <div class="script-code"># Syncs every model into ~/.ollama and keeps seeding; add ?model=NAME for just one
+curl -sSL "{{.ServerURL}}/docker-compose.yml" -o docker-compose.yml
+docker compose up -d</div>
+            </div>
+            
+            <div class="script-section">
+                <div class="script-title">🖥️ Roll Out to a Fleet (Ansible)</div>
+                <p style="margin: 0 0 10px 0;">Installs the client on every host in an inventory and keeps it syncing and seeding as a systemd user service.</p>
+                <a href="/ollama-bt-playbook.yml" class="download-btn">Download Playbook</a>
+                <div class="script-code" style="margin-top: 10px;">ansible-playbook -i inventory ollama-bt-playbook.yml</div>
+            </div>
+            
+            <div class="script-section">
+                <div class="script-title">🧪 Provision Lab Machines</div>
+                <p style="margin: 0 0 10px 0;">User data for freshly imaged VMs: installs the client as a system service that syncs models into Ollama's directory and keeps seeding. Pick models with <code>?models=NAME,NAME</code> and the directory with <code>?dir=/path</code>.</p>
+                <div class="script-code"># cloud-init
+curl -sSL "{{.ServerURL}}/bootstrap/cloud-init.yaml?models=granite3.3:8b" -o user-data
+
+# kickstart (%post section; %include it or paste it in)
+curl -sSL "{{.ServerURL}}/bootstrap/kickstart.ks?models=granite3.3:8b" -o ollama-bt.ks</div>
+            </div>
             
             <div class="script-section">
                 <div class="script-title">🧹 Clean Up Virtual Environment</div>
                 <div class="script-code"># Windows (PowerShell)
-Invoke-WebRequest -Uri "http://{{.ServerIP}}:{{.Port}}/install.ps1" -OutFile "install.ps1"; .\install.ps1 -Clean
+Invoke-WebRequest -Uri "{{.ServerURL}}/install.ps1" -OutFile "install.ps1"; .\install.ps1 -Clean
 
 # Linux/macOS (Bash)
-curl -sSL "http://{{.ServerIP}}:{{.Port}}/install.sh" | bash -s -- --clean</div>
+curl -sSL "{{.ServerURL}}/install.sh" | bash -s -- --clean</div>
             </div>
             
+            {{with .Signer}}
+            <div class="script-section">
+                <div class="script-title">🔏 Verify Before Running</div>
+                <p style="margin: 0 0 10px 0;">Every script is signed with minisign key <strong>{{.KeyID}}</strong>. Fetch the public key once and compare its ID with the one your administrator published, then check each script against its <code>.minisig</code> before running it. Query parameters such as <code>?model=</code> go on both URLs.</p>
+                <div class="script-code"># Linux/macOS (Bash)
+curl -sSL "{{$.ServerURL}}/minisign.pub" -o lancache.pub
+curl -sSL "{{$.ServerURL}}/install.sh" -o install.sh
+curl -sSL "{{$.ServerURL}}/install.sh.minisig" -o install.sh.minisig
+minisign -Vm install.sh -p lancache.pub && bash install.sh --model granite3.3:8b
+
+# Windows (PowerShell)
+Invoke-WebRequest -Uri "{{$.ServerURL}}/minisign.pub" -OutFile "lancache.pub"
+Invoke-WebRequest -Uri "{{$.ServerURL}}/install.ps1" -OutFile "install.ps1"
+Invoke-WebRequest -Uri "{{$.ServerURL}}/install.ps1.minisig" -OutFile "install.ps1.minisig"
+minisign -Vm install.ps1 -p lancache.pub; if ($?) { .\install.ps1 -Model granite3.3:8b }</div>
+            </div>
+            {{end}}
+            
             <div class="script-section">
                 <div class="script-title">📖 Manual Installation</div>
                 <div class="script-code"># Windows (PowerShell)
 Set-ExecutionPolicy -ExecutionPolicy RemoteSigned -Scope CurrentUser
-Invoke-WebRequest -Uri "http://{{.ServerIP}}:{{.Port}}/install.ps1" -OutFile "install.ps1"
+Invoke-WebRequest -Uri "{{.ServerURL}}/install.ps1" -OutFile "install.ps1"
 .\install.ps1 -List                    # List models
 .\install.ps1 -Model granite3.3:8b    # Download specific model
 .\install.ps1 -Clean                  # Clean up
 
 # Linux/macOS (Bash)
-curl -sSL "http://{{.ServerIP}}:{{.Port}}/install.sh" -o install.sh
+curl -sSL "{{.ServerURL}}/install.sh" -o install.sh
 chmod +x install.sh
 ./install.sh --list                    # List models
 ./install.sh --model granite3.3:8b    # Download specific model
@@ -1091,41 +2088,163 @@ chmod +x install.sh
     </div>
 
     <script>
-        function formatSize(bytes) {
-            if (bytes === 0) return '0 Bytes';
-            const k = 1024;
-            const sizes = ['Bytes', 'KB', 'MB', 'GB', 'TB'];
-            const i = Math.floor(Math.log(bytes) / Math.log(k));
-            return parseFloat((bytes / Math.pow(k, i)).toFixed(2)) + ' ' + sizes[i];
+        // Check a model's blobs and piece hashes on the server
+        function verifyModel(button) {
+            const result = button.parentElement.querySelector('.verify-result');
+            button.disabled = true;
+            button.textContent = 'Verifying...';
+            adminFetch('/api/models/' + encodeURIComponent(button.dataset.model) + '/verify', 'POST')
+                .then(function(report) {
+                    const bad = [];
+                    report.blobs.forEach(function(blob) {
+                        if (!blob.ok) bad.push((blob.digest || blob.path) + ': ' + (blob.error || 'contents hash to ' + blob.actual));
+                    });
+                    (report.torrent.errors || []).forEach(function(err) { bad.push(err); });
+                    if (report.torrent.bad_pieces) bad.push(report.torrent.bad_pieces.length + ' of ' + report.torrent.pieces + ' pieces fail their hash');
+                    result.textContent = report.ok ? '✅ All blobs and ' + report.torrent.pieces + ' pieces verified' : '❌ ' + bad.join('\n');
+                })
+                .catch(function(err) { result.textContent = '❌ ' + err.message; })
+                .finally(function() {
+                    result.style.display = 'block';
+                    button.disabled = false;
+                    button.textContent = 'Verify';
+                });
         }
-        
-        // Format sizes on page load
-        document.addEventListener('DOMContentLoaded', function() {
-            const sizeElements = document.querySelectorAll('.model-size');
-            sizeElements.forEach(function(el) {
-                const text = el.textContent;
-                const match = text.match(/Size: (\d+)/);
-                if (match) {
-                    const bytes = parseInt(match[1]);
-                    el.textContent = 'Size: ' + formatSize(bytes);
-                }
+
+        // Call an admin endpoint with the admin token, asked for once per tab
+        function adminFetch(url, method, body) {
+            const token = sessionStorage.getItem('adminToken') || prompt('Admin token');
+            if (!token) return Promise.reject(new Error('An admin token is required'));
+            const options = { method: method, headers: { 'Authorization': 'Bearer ' + token } };
+            if (body) options.body = JSON.stringify(body);
+            return fetch(url, options).then(function(resp) {
+                if (resp.status === 401) sessionStorage.removeItem('adminToken');
+                if (!resp.ok) return resp.text().then(function(text) { throw new Error(text.trim()); });
+                sessionStorage.setItem('adminToken', token);
+                return resp.json();
+            });
+        }
+
+        // Run a model action and show what it answered under the model
+        function adminAction(button, method, path, describe, body) {
+            const result = button.parentElement.querySelector('.verify-result');
+            button.disabled = true;
+            adminFetch('/api/models/' + encodeURIComponent(button.dataset.model) + path, method, body)
+                .then(function(answer) {
+                    result.textContent = describe(answer);
+                    result.style.display = 'block';
+                    setTimeout(function() { location.reload(); }, 1500);
+                })
+                .catch(function(err) {
+                    result.textContent = '❌ ' + err.message;
+                    result.style.display = 'block';
+                    button.disabled = false;
+                });
+        }
+
+        function deleteModel(button) {
+            if (!confirm('Delete ' + button.dataset.model + '? Blobs no other model uses are removed from disk.')) return;
+            adminAction(button, 'DELETE', '', function(deleted) {
+                return '🗑️ Deleted, ' + deleted.freed_human + ' freed' + (deleted.kept_blobs.length ? ' (' + deleted.kept_blobs.length + ' shared blobs kept)' : '');
+            });
+        }
+
+        function setHidden(button, hidden) {
+            adminAction(button, 'PUT', '/visibility', function() {
+                return hidden ? '🙈 Hidden from listings' : '👀 Listed again';
+            }, { hidden: hidden });
+        }
+
+        // Hidden models aren't on this page for everyone, so they're fetched on demand
+        function showHiddenModels(button) {
+            const list = document.getElementById('hidden-models');
+            adminFetch('/api/models/hidden', 'GET')
+                .then(function(models) {
+                    list.innerHTML = '';
+                    if (models.length === 0) list.textContent = 'No models are hidden.';
+                    models.forEach(function(model) {
+                        const card = document.createElement('div');
+                        card.className = 'model-card';
+                        const name = document.createElement('div');
+                        name.className = 'model-name';
+                        name.textContent = model.name + (model.visible_to.length ? ' (listed for ' + model.visible_to.join(', ') + ')' : '');
+                        const unhide = document.createElement('button');
+                        unhide.className = 'download-btn';
+                        unhide.textContent = 'Unhide';
+                        unhide.dataset.model = model.name;
+                        unhide.onclick = function() { setHidden(unhide, false); };
+                        const result = document.createElement('pre');
+                        result.className = 'verify-result';
+                        result.style.display = 'none';
+                        card.append(name, unhide, result);
+                        list.appendChild(card);
+                    });
+                    button.style.display = 'none';
+                })
+                .catch(function(err) { list.textContent = '❌ ' + err.message; });
+        }
+
+        function regenerateTorrent(button) {
+            if (!confirm('Rebuild the torrent of ' + button.dataset.model + '? Clients need to fetch the new .torrent if its info-hash changes.')) return;
+            adminAction(button, 'POST', '/regenerate', function() {
+                return '⏳ The torrent is being rebuilt';
             });
-        });
+        }
     </script>
 </body>
 </html>`
 
 	tmplData := struct {
 		Models    []Model
-		ServerIP  string
-		Port      string
+		Group     string // from ?group=, see groups.go
+		Other     []ExternalTorrent
+		Remote    []FederatedModel // models only peer sites hold
+		ServerURL string
+
+		Dedup        DedupReport
+		TopClients   []ClientTransfer
+		Popular      []ModelPopularity // top five of the last 7 days; empty without the embedded tracker
+		Savings      *SavingsReport // last 30 days; nil without the embedded tracker
+		SavedAllTime string
+
+		TrackerOutages []TrackerHealth
+		Branding       BrandingSettings
+		Signer         *scriptSigner
+		Admin          bool // admin.token is set, so models can be deleted and their torrents rebuilt
 	}{
-		Models:    s.models,
-		ServerIP:  s.serverIP,
-		Port:      s.port,
+		Models:    inGroup(s.visibleCatalog(), r.URL.Query().Get("group")),
+		Group:     r.URL.Query().Get("group"),
+		Other:     s.externalTorrents(),
+		ServerURL: s.baseURL(),
+
+		Dedup:      s.dedupReport(),
+		TopClients: s.topClients(10),
+
+		TrackerOutages: s.trackerOutages(),
+		Branding:       s.branding,
+		Signer:         s.signer,
+		Admin:          s.adminToken != "",
+	}
+	if s.tracker != nil {
+		recent := s.savings(time.Now().AddDate(0, 0, -29), "30d")
+		tmplData.Savings = &recent
+		tmplData.SavedAllTime = s.savings(time.Time{}, "all").SavedHuman
+		for _, model := range s.popularity(time.Now().AddDate(0, 0, -6)) {
+			if len(tmplData.Popular) == 5 || model.Completed == 0 && model.ActivePeers == 0 {
+				break
+			}
+			tmplData.Popular = append(tmplData.Popular, model)
+		}
+	}
+	if len(s.federationPeers) > 0 {
+		for _, model := range s.federatedModels() {
+			if model.Sites[0].URL != s.baseURL() {
+				tmplData.Remote = append(tmplData.Remote, model)
+			}
+		}
 	}
 
-	t, err := template.New("web").Parse(tmpl)
+	t, err := template.New("web").Funcs(template.FuncMap{"formatSize": formatSize}).Parse(tmpl)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -1134,125 +2253,21 @@ chmod +x install.sh
 	t.Execute(w, tmplData)
 }
 
-func generatePowerShellScript(serverIP, port string) string {
-	return fmt.Sprintf(`# Ollama BitTorrent Lancache Installer for Windows
-# Run this script as Administrator
-
-param(
-    [string]$Model = "all"
-)
-
-Write-Host "🚀 Installing Ollama BitTorrent Lancache..." -ForegroundColor Green
-
-# Check if Python is installed
-try {
-    $pythonVersion = python --version 2>&1
-    Write-Host "Python found: $pythonVersion" -ForegroundColor Green
-} catch {
-    Write-Host "❌ Python not found. Please install Python 3.8+ from https://python.org" -ForegroundColor Red
-    exit 1
-}
-
-# Create virtual environment
-$venvPath = "$env:USERPROFILE\.ollama-bt-venv"
-if (Test-Path $venvPath) {
-    Write-Host "Virtual environment already exists at $venvPath" -ForegroundColor Yellow
-} else {
-    Write-Host "Creating virtual environment..." -ForegroundColor Yellow
-    python -m venv $venvPath
-}
-
-# Activate virtual environment
-Write-Host "Activating virtual environment..." -ForegroundColor Yellow
-& "$venvPath\Scripts\Activate.ps1"
-
-# Install required packages
-Write-Host "Installing required packages..." -ForegroundColor Yellow
-pip install --upgrade pip
-pip install libtorrent requests
-
-# Seeder script is available in the project repository
-
-# Download models based on parameter
-if ($Model -eq "all") {
-    Write-Host "Downloading all available models..." -ForegroundColor Green
-    Write-Host "Please use the seeder script from the project repository" -ForegroundColor Yellow
-} else {
-    Write-Host "Downloading model: $Model" -ForegroundColor Green
-    Write-Host "Please use the seeder script from the project repository" -ForegroundColor Yellow
-}
-
-Write-Host "✅ Installation complete!" -ForegroundColor Green
-Write-Host "Models downloaded to: $env:USERPROFILE\.ollama\models" -ForegroundColor Green
-`, serverIP, port, serverIP, port, serverIP, port)
-}
-
-func generateBashScript(serverIP, port string) string {
-	return fmt.Sprintf(`#!/bin/bash
-# Ollama BitTorrent Lancache Installer for Linux/macOS
-
-set -e
-
-MODEL=${1:-"all"}
-SERVER_URL="http://%s:%s"
-
-echo "🚀 Installing Ollama BitTorrent Lancache..."
-
-# Check if Python is installed
-if ! command -v python3 &> /dev/null; then
-    echo "❌ Python 3 not found. Please install Python 3.8+"
-    exit 1
-fi
-
-PYTHON_VERSION=$(python3 --version 2>&1)
-echo "Python found: $PYTHON_VERSION"
-
-# Create virtual environment
-VENV_PATH="$HOME/.ollama-bt-venv"
-if [ -d "$VENV_PATH" ]; then
-    echo "Virtual environment already exists at $VENV_PATH"
-else
-    echo "Creating virtual environment..."
-    python3 -m venv "$VENV_PATH"
-fi
-
-# Activate virtual environment
-echo "Activating virtual environment..."
-source "$VENV_PATH/bin/activate"
-
-# Install required packages
-echo "Installing required packages..."
-pip install --upgrade pip
-pip install libtorrent requests
-
-# Seeder script is available in the project repository
-
-# Download models based on parameter
-if [ "$MODEL" = "all" ]; then
-    echo "Downloading all available models..."
-    echo "Please use the seeder script from the project repository"
-else
-    echo "Downloading model: $MODEL"
-    echo "Please use the seeder script from the project repository"
-fi
-
-echo "✅ Installation complete!"
-echo "Models downloaded to: $HOME/.ollama/models"
-`, serverIP, port)
-}
-
+// formatSize formats a byte count for people, e.g. "4.92 GB". The web UI,
+// the API's size_human fields and the feed all use it, so they agree.
 func formatSize(bytes int64) string {
 	if bytes == 0 {
 		return "0 Bytes"
 	}
-	
+
 	const k = 1024
 	sizes := []string{"Bytes", "KB", "MB", "GB", "TB"}
+	size := float64(bytes)
 	i := 0
-	for bytes >= k && i < len(sizes)-1 {
-		bytes /= k
+	for size >= k && i < len(sizes)-1 {
+		size /= k
 		i++
 	}
-	
-	return fmt.Sprintf("%.2f %s", float64(bytes), sizes[i])
+
+	return strconv.FormatFloat(math.Round(size*100)/100, 'f', -1, 64) + " " + sizes[i]
 }
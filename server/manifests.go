@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultManifestMediaType is what Ollama's manifests are when they don't say.
+const defaultManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+
+// parsedManifest is what discovery needs from one version of a manifest.
+type parsedManifest struct {
+	modTime  time.Time
+	fileSize int64
+	digest   string   // of the manifest itself, naming this version
+	digests  []string // config and layer digests
+	size     int64    // total size of the config and layers
+	err      error    // why the manifest can't be used, if it can't
+}
+
+// parseManifest reads and parses a manifest, reusing the previous result
+// while the file's mtime and size are unchanged, so rescans of a large
+// catalog only parse what changed. Read errors aren't cached.
+func (s *Server) parseManifest(path string, info os.FileInfo) (parsedManifest, error) {
+	s.manifestMu.Lock()
+	cached, ok := s.manifests[path]
+	s.manifestMu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.fileSize == info.Size() {
+		return cached, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return parsedManifest{}, err
+	}
+	parsed := parsedManifest{modTime: info.ModTime(), fileSize: info.Size(), digest: manifestDigest(data)}
+	if parsed.digests, parsed.err = manifestDigests(data); parsed.err == nil {
+		parsed.size, parsed.err = manifestSize(data)
+	}
+
+	s.manifestMu.Lock()
+	if s.manifests == nil {
+		s.manifests = make(map[string]parsedManifest)
+	}
+	s.manifests[path] = parsed
+	s.manifestMu.Unlock()
+	return parsed, nil
+}
+
+// retainManifests forgets the manifests a discovery didn't come across.
+func (s *Server) retainManifests(seen map[string]bool) {
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+	for path := range s.manifests {
+		if !seen[path] {
+			delete(s.manifests, path)
+		}
+	}
+}
+
+// modelManifest reads the manifest of a model's current version, or of a
+// kept one when digest names it.
+func (s *Server) modelManifest(model Model, digest string) ([]byte, error) {
+	id := strings.TrimPrefix(digest, "sha256:")
+	if digest == "" || "sha256:"+id == model.Digest {
+		return s.readManifest(model.Name)
+	}
+	if !versionHex.MatchString(id) {
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(filepath.Join(s.versionsDir(model.Name), id+".manifest"))
+}
+
+// serveManifestData serves a manifest byte-for-byte, so its digest can be
+// checked against Docker-Content-Digest and the catalog's.
+func serveManifestData(w http.ResponseWriter, r *http.Request, data []byte) {
+	var parsed struct {
+		MediaType string `json:"mediaType"`
+	}
+	mediaType := defaultManifestMediaType
+	if json.Unmarshal(data, &parsed) == nil && parsed.MediaType != "" {
+		mediaType = parsed.MediaType
+	}
+	digest := manifestDigest(data)
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("ETag", `"`+digest+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// getModelManifest serves GET /api/models/{name}/manifest, the manifest as
+// Ollama stores it. name@digest serves a kept version, as for torrents.
+func (s *Server) getModelManifest(w http.ResponseWriter, r *http.Request) {
+	name, digest, _ := strings.Cut(mux.Vars(r)["name"], "@")
+	model, ok := s.modelByName(name)
+	if !ok {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+	data, err := s.modelManifest(model, digest)
+	if os.IsNotExist(err) {
+		http.Error(w, fmt.Sprintf("No version %s of %s is kept", digest, model.Name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.logger.Errorf("Failed to read the manifest of %s: %v", model.Name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	serveManifestData(w, r, data)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// renderMarkdown turns a model description into HTML. It covers what notes
+// need: headings, paragraphs, lists, code, emphasis and links. Everything
+// else is escaped, so a description can't add markup or scripts to a page.
+func renderMarkdown(src string) template.HTML {
+	var out strings.Builder
+	var paragraph []string
+	list := "" // ul or ol while inside a list
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + renderInline(strings.Join(paragraph, " ")) + "</p>\n")
+			paragraph = nil
+		}
+		if list != "" {
+			out.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+
+		case trimmed == "":
+			flush()
+
+		case markdownHeading.MatchString(trimmed):
+			flush()
+			m := markdownHeading.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + level + ">" + renderInline(m[2]) + "</h" + level + ">\n")
+
+		case markdownBullet.MatchString(trimmed), markdownNumbered.MatchString(trimmed):
+			kind, item := "ul", markdownBullet.FindStringSubmatch(trimmed)
+			if item == nil {
+				kind, item = "ol", markdownNumbered.FindStringSubmatch(trimmed)
+			}
+			if list != kind {
+				flush()
+				list = kind
+				out.WriteString("<" + kind + ">\n")
+			}
+			out.WriteString("<li>" + renderInline(item[1]) + "</li>\n")
+
+		default:
+			if list != "" {
+				flush()
+			}
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return template.HTML(out.String())
+}
+
+var (
+	markdownHeading  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	markdownBullet   = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+	markdownNumbered = regexp.MustCompile(`^\d+[.)]\s+(.*)$`)
+
+	markdownLink   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	markdownStrong = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	markdownEm     = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+)
+
+// renderInline renders code spans, links and emphasis within a line.
+func renderInline(text string) string {
+	var out strings.Builder
+	// Odd parts are between backticks, and are code as they are
+	for i, part := range strings.Split(text, "`") {
+		if i%2 == 1 {
+			out.WriteString("<code>" + html.EscapeString(part) + "</code>")
+			continue
+		}
+		part = html.EscapeString(part)
+		// Emphasis applies around and inside links, but never to a URL
+		last := 0
+		for _, m := range markdownLink.FindAllStringSubmatchIndex(part, -1) {
+			text, href := part[m[2]:m[3]], part[m[4]:m[5]]
+			if !linkable(href) {
+				continue
+			}
+			out.WriteString(renderEmphasis(part[last:m[0]]))
+			out.WriteString(`<a href="` + href + `">` + renderEmphasis(text) + `</a>`)
+			last = m[1]
+		}
+		out.WriteString(renderEmphasis(part[last:]))
+	}
+	return out.String()
+}
+
+// linkable reports whether a link may point at href: http(s), or a path on
+// this server. "//host" and "/\host" are other hosts to a browser.
+func linkable(href string) bool {
+	if strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") {
+		return true
+	}
+	return strings.HasPrefix(href, "/") && !strings.HasPrefix(href, "//") && !strings.HasPrefix(href, `/\`)
+}
+
+// renderEmphasis renders bold and italic text.
+func renderEmphasis(text string) string {
+	text = markdownStrong.ReplaceAllString(text, "<strong>$1$2</strong>")
+	return markdownEm.ReplaceAllString(text, "<em>$1$2</em>")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/mdns"
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+// mdnsZone lets a single responder answer for every service we advertise.
+type mdnsZone []*mdns.MDNSService
+
+func (z mdnsZone) Records(q dns.Question) []dns.RR {
+	var records []dns.RR
+	for _, service := range z {
+		records = append(records, service.Records(q)...)
+	}
+	return records
+}
+
+// startMDNS advertises the web UI (and the tracker, when it runs on this
+// host) over DNS-SD so clients can find the cache as <hostname>.local.
+func (s *Server) startMDNS() (*mdns.Server, error) {
+	hostName := strings.TrimSuffix(s.mdnsHostname, ".local") + ".local."
+	ips := []net.IP{net.ParseIP(s.serverIP)}
+
+	httpPort, err := strconv.Atoi(s.port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", s.port, err)
+	}
+
+	web, err := mdns.NewMDNSService("Ollama BitTorrent Lancache", "_http._tcp", "", hostName, httpPort, ips, []string{"path=/", "api=/api/models"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create web service record: %w", err)
+	}
+	zone := mdnsZone{web}
+
+	if trackerPort, announcePath, ok := s.localTrackerEndpoint(); ok {
+		tracker, err := mdns.NewMDNSService("Ollama BitTorrent Lancache Tracker", "_bittorrent-tracker._tcp", "", hostName, trackerPort, ips, []string{"path=" + announcePath})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tracker service record: %w", err)
+		}
+		zone = append(zone, tracker)
+	}
+
+	server, err := mdns.NewServer(&mdns.Config{
+		Zone:   zone,
+		Logger: log.New(s.logger.WriterLevel(logrus.DebugLevel), "mdns: ", 0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infof("Advertising %s over mDNS", strings.TrimSuffix(hostName, "."))
+	return server, nil
+}
+
+// localTrackerEndpoint returns the port and announce path of the tracker if
+// it is served from this machine; remote trackers are not ours to advertise.
+func (s *Server) localTrackerEndpoint() (int, string, bool) {
+	u, err := url.Parse(s.trackerURL)
+	if err != nil {
+		return 0, "", false
+	}
+
+	host := u.Hostname()
+	if host != s.serverIP && host != "localhost" && host != "127.0.0.1" {
+		return 0, "", false
+	}
+
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return 0, "", false
+	}
+	return port, u.Path, true
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// A Metalink (RFC 5854) describes a model's files with their sizes and
+// SHA-256 checksums, and where to get them: the torrent and a magnet link for
+// BitTorrent, plus each file's direct HTTP URL. aria2c downloads from all of
+// them at once and verifies each file from the one .meta4:
+//
+//	aria2c -d ~/.ollama "http://server:8080/api/models/llama3:8b/metalink"
+
+// Metalink is the metalink element of a .meta4.
+type Metalink struct {
+	XMLName   xml.Name       `xml:"urn:ietf:params:xml:ns:metalink metalink"`
+	Generator string         `xml:"generator"`
+	Published string         `xml:"published"`
+	Files     []MetalinkFile `xml:"file"`
+}
+
+// MetalinkFile is one file of a model. Its name is its path under the Ollama
+// directory, which is also its path in the torrent.
+type MetalinkFile struct {
+	Name     string        `xml:"name,attr"`
+	Size     int64         `xml:"size"`
+	Hash     MetalinkHash  `xml:"hash"`
+	MetaURLs []MetalinkURL `xml:"metaurl"`
+	URLs     []MetalinkURL `xml:"url"`
+}
+
+type MetalinkHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// MetalinkURL is a url or metaurl element. A metaurl's name is the file's
+// path in the torrent.
+type MetalinkURL struct {
+	Priority  int    `xml:"priority,attr"`
+	MediaType string `xml:"mediatype,attr,omitempty"`
+	Name      string `xml:"name,attr,omitempty"`
+	URL       string `xml:",chardata"`
+}
+
+// magnetURI links to a model's torrent by info-hash, with the trackers and
+// this server's web seed so a client can start without the .torrent.
+func (s *Server) magnetURI(model Model, key string) string {
+	params := url.Values{}
+	for _, announce := range s.trackerList() {
+		// Passkeys only mean something to our own tracker, as in withPasskey
+		if key != "" && announce == s.trackerURL {
+			announce = strings.TrimSuffix(announce, "/") + "/" + url.PathEscape(key)
+		}
+		params.Add("tr", announce)
+	}
+	params.Set("dn", model.Name)
+	params.Set("ws", s.baseURL()+"/webseed/")
+	// xt stays unescaped and first, as some clients expect
+	return "magnet:?xt=urn:btih:" + model.InfoHash + "&" + params.Encode()
+}
+
+// modelMetalink describes a model's files for a Metalink client. Without
+// http_fallback, only BitTorrent sources are listed.
+func (s *Server) modelMetalink(model Model, key string) (Metalink, error) {
+	listing, err := s.blobListing(model)
+	if err != nil {
+		return Metalink{}, err
+	}
+
+	torrentURL := fmt.Sprintf("%s/api/models/%s/torrent", s.baseURL(), url.PathEscape(model.Name))
+	if key != "" {
+		torrentURL += "?key=" + url.QueryEscape(key)
+	}
+	magnet := s.magnetURI(model, key)
+
+	metalink := Metalink{
+		Generator: "ollama-bt-lancache",
+		Published: model.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	for _, file := range listing.Files {
+		// The torrent is named "models", like the directory it unpacks to
+		name := "models/" + file.Path
+		entry := MetalinkFile{
+			Name: name,
+			Size: file.Size,
+			Hash: MetalinkHash{Type: "sha-256", Value: file.SHA256},
+			MetaURLs: []MetalinkURL{
+				{Priority: 1, MediaType: "torrent", Name: name, URL: torrentURL},
+				{Priority: 2, MediaType: "torrent", Name: name, URL: magnet},
+			},
+		}
+		if s.httpFallback {
+			entry.URLs = []MetalinkURL{{Priority: 3, URL: file.URL}}
+		}
+		metalink.Files = append(metalink.Files, entry)
+	}
+	return metalink, nil
+}
+
+// getModelMetalink serves GET /api/models/{name}/metalink as a .meta4. Like
+// the torrent, ?key=PASSKEY puts a passkey in its announce URLs.
+func (s *Server) getModelMetalink(w http.ResponseWriter, r *http.Request) {
+	model, ok := s.modelByName(mux.Vars(r)["name"])
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if model.Incomplete || model.InfoHash == "" {
+		http.Error(w, fmt.Sprintf("The torrent of %s isn't ready", model.Name), http.StatusConflict)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key != "" && s.tracker != nil {
+		if _, ok := s.tracker.config.Passkeys[key]; !ok {
+			http.Error(w, "Invalid passkey", http.StatusForbidden)
+			return
+		}
+	} else {
+		key = ""
+	}
+
+	metalink, err := s.modelMetalink(model, key)
+	if err != nil {
+		s.logger.Errorf("Failed to describe %s as a metalink: %v", model.Name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	data, err := xml.MarshalIndent(metalink, "", "  ")
+	if err != nil {
+		s.logger.Errorf("Failed to encode the metalink of %s: %v", model.Name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/metalink4+xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.meta4\"", model.Name))
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// otherModels labels the models beyond metrics.max_models, hidden models and
+// torrents that aren't in the catalog, so a large catalog can't blow up the number of series.
+const otherModels = "other"
+
+// modelLabels are the labels of a per-model series.
+type modelLabels struct {
+	model    string
+	infoHash string
+}
+
+// serveMetrics exposes server health in the Prometheus text format.
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	status := s.trackerStatus()
+	fmt.Fprintln(w, "# HELP ollama_bt_lancache_tracker_up Whether the tracker passed its latest health check.")
+	fmt.Fprintln(w, "# TYPE ollama_bt_lancache_tracker_up gauge")
+	for _, health := range status {
+		up := 0
+		if health.Healthy {
+			up = 1
+		}
+		fmt.Fprintf(w, "ollama_bt_lancache_tracker_up{url=%q} %d\n", health.URL, up)
+	}
+	fmt.Fprintln(w, "# HELP ollama_bt_lancache_tracker_last_check_timestamp_seconds When the tracker was last health-checked.")
+	fmt.Fprintln(w, "# TYPE ollama_bt_lancache_tracker_last_check_timestamp_seconds gauge")
+	for _, health := range status {
+		if !health.Checked.IsZero() {
+			fmt.Fprintf(w, "ollama_bt_lancache_tracker_last_check_timestamp_seconds{url=%q} %d\n", health.URL, health.Checked.Unix())
+		}
+	}
+
+	report := s.integrityReport()
+	fmt.Fprintln(w, "# HELP ollama_bt_lancache_corrupt_blobs Blobs whose contents didn't match their digest in the latest verification pass.")
+	fmt.Fprintln(w, "# TYPE ollama_bt_lancache_corrupt_blobs gauge")
+	fmt.Fprintf(w, "ollama_bt_lancache_corrupt_blobs %d\n", len(report.Corrupt))
+	if !report.LastRun.IsZero() {
+		fmt.Fprintln(w, "# HELP ollama_bt_lancache_blob_verification_timestamp_seconds When the latest blob verification pass started.")
+		fmt.Fprintln(w, "# TYPE ollama_bt_lancache_blob_verification_timestamp_seconds gauge")
+		fmt.Fprintf(w, "ollama_bt_lancache_blob_verification_timestamp_seconds %d\n", report.LastRun.Unix())
+	}
+
+	labels := s.metricsLabels()
+	if s.seeder != nil {
+		uploaded := make(map[modelLabels]int64)
+		peers := make(map[modelLabels]int64)
+		for _, status := range s.seeder.status() {
+			l := labels(status.InfoHash)
+			uploaded[l] += status.Uploaded
+			peers[l] += int64(status.Peers)
+		}
+		writeModelMetric(w, "ollama_bt_lancache_seeder_uploaded_bytes_total", "counter", "Bytes the embedded seeder uploaded to peers.", uploaded)
+		writeModelMetric(w, "ollama_bt_lancache_seeder_peers", "gauge", "Peers connected to the embedded seeder.", peers)
+	}
+	if s.tracker != nil {
+		seeders := make(map[modelLabels]int64)
+		leechers := make(map[modelLabels]int64)
+		completed := make(map[modelLabels]int64)
+		for _, st := range s.tracker.Stats() {
+			l := labels(st.InfoHash)
+			seeders[l] += int64(st.Seeders)
+			leechers[l] += int64(st.Leechers)
+			completed[l] += st.Completed
+		}
+		writeModelMetric(w, "ollama_bt_lancache_tracker_seeders", "gauge", "Peers announcing a complete copy to the embedded tracker.", seeders)
+		writeModelMetric(w, "ollama_bt_lancache_tracker_leechers", "gauge", "Peers announcing an incomplete copy to the embedded tracker.", leechers)
+		writeModelMetric(w, "ollama_bt_lancache_downloads_completed_total", "counter", "Downloads clients reported completed to the embedded tracker.", completed)
+	}
+}
+
+// metricsLabels returns the labels for a torrent's series. The largest
+// metrics.max_models visible catalog models get their own; a model's size doesn't
+// change, so neither does its series as traffic shifts.
+func (s *Server) metricsLabels() func(infoHash string) modelLabels {
+	models := s.visibleCatalog()
+	sort.Slice(models, func(i, j int) bool {
+		if models[i].Size != models[j].Size {
+			return models[i].Size > models[j].Size
+		}
+		return models[i].Name < models[j].Name
+	})
+	labeled := make(map[string]string)
+	for _, model := range models {
+		if len(labeled) == s.metricsModels {
+			break
+		}
+		if model.InfoHash != "" {
+			labeled[model.InfoHash] = model.Name
+		}
+	}
+	return func(infoHash string) modelLabels {
+		if name, ok := labeled[infoHash]; ok {
+			return modelLabels{model: name, infoHash: infoHash}
+		}
+		return modelLabels{model: otherModels}
+	}
+}
+
+// writeModelMetric writes one per-model metric, sorted by model name.
+func writeModelMetric(w io.Writer, name, kind, help string, values map[modelLabels]int64) {
+	if len(values) == 0 {
+		return
+	}
+	series := make([]modelLabels, 0, len(values))
+	for l := range values {
+		series = append(series, l)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].model < series[j].model
+	})
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+	for _, l := range series {
+		fmt.Fprintf(w, "%s{model=%q,info_hash=%q} %d\n", name, l.model, l.infoHash, values[l])
+	}
+}
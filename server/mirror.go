@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// mirrorSource is an upstream lancache this server replicates from. Over a
+// WAN link, replication can be limited to a daily window and a rate cap.
+type mirrorSource struct {
+	URL     string
+	Window  replicationWindow
+	MaxRate int // download cap in KiB/s; 0 means unlimited
+}
+
+// mirrorUpstreamConfig is one entry of mirror.upstreams.
+type mirrorUpstreamConfig struct {
+	URL     string `mapstructure:"url"`
+	Window  string `mapstructure:"window"`   // e.g. "22:00-06:00"; empty means always
+	MaxRate int    `mapstructure:"max_rate"` // KiB/s
+}
+
+// replicationWindow is a daily time-of-day range in local time, such as
+// 22:00-06:00. The zero value is always open.
+type replicationWindow struct {
+	start, end time.Duration // offsets from midnight
+	set        bool
+}
+
+func parseReplicationWindow(window string) (replicationWindow, error) {
+	if window == "" {
+		return replicationWindow{}, nil
+	}
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return replicationWindow{}, fmt.Errorf("invalid replication window %q (want HH:MM-HH:MM)", window)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return replicationWindow{}, fmt.Errorf("invalid replication window %q (want HH:MM-HH:MM)", window)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return replicationWindow{}, fmt.Errorf("invalid replication window %q (want HH:MM-HH:MM)", window)
+	}
+	return replicationWindow{
+		start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		end:   time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+		set:   true,
+	}, nil
+}
+
+// open reports whether t falls inside the window. Windows whose end is before
+// their start run past midnight.
+func (w replicationWindow) open(t time.Time) bool {
+	if !w.set || w.start == w.end {
+		return true
+	}
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// mirrorLoop keeps a branch-office server in step with its upstream lancaches:
+// models an upstream has and we don't are downloaded over BitTorrent into
+// the models directory, then published from here with our own tracker.
+func (s *Server) mirrorLoop(interval time.Duration) {
+	s.syncMirrors()
+	for range time.Tick(interval) {
+		s.syncMirrors()
+	}
+}
+
+func (s *Server) syncMirrors() {
+	// Servers sharing a models directory leave mirroring to the leader
+	if !s.lease.isLeader() {
+		return
+	}
+	for _, source := range s.mirrorSources {
+		if source.Window.open(time.Now()) {
+			s.syncMirror(source)
+		}
+	}
+}
+
+// syncMirror fetches missing models one at a time, so a mirror catching up on
+// a large catalog doesn't saturate the WAN link with parallel swarms.
+func (s *Server) syncMirror(source mirrorSource) {
+	upstream, err := fetchModels(source.URL)
+	if err != nil {
+		s.logger.Warnf("Failed to fetch catalog from %s: %v", source.URL, err)
+		return
+	}
+
+	local := make(map[string]bool)
+	for _, model := range s.catalog() {
+		local[model.Name] = true
+	}
+
+	for _, model := range upstream {
+		if local[model.Name] || model.InfoHash == "" || !s.published(model.Name) {
+			continue
+		}
+		// Don't start another multi-gigabyte model as the window closes
+		if !source.Window.open(time.Now()) {
+			return
+		}
+
+		s.logger.Infof("Mirroring %s from %s", model.Name, source.URL)
+		if err := s.mirrorModel(source, model); err != nil {
+			s.logger.Warnf("Failed to mirror %s: %v", model.Name, err)
+			continue
+		}
+		s.logger.Infof("Mirrored %s", model.Name)
+		s.notify(eventMirrorCompleted, fmt.Sprintf("Mirrored %s (%s) from %s", model.Name, formatSize(model.Size), source.URL))
+	}
+}
+
+// mirrorModel downloads one upstream model and adds it to our catalog. The
+// upstream torrent only carries the upstream's trackers, so once the data is
+// complete it's dropped and the model is seeded from our own .torrent.
+func (s *Server) mirrorModel(source mirrorSource, model Model) error {
+	torrentURL := source.URL + "/api/models/" + url.PathEscape(model.Name) + "/torrent"
+	resp, err := federationClient.Get(torrentURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s fetching torrent", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read torrent: %w", err)
+	}
+
+	open := func() bool { return source.Window.open(time.Now()) }
+	if err := s.seeder.download(model.Name, data, source.MaxRate, open); err != nil {
+		return err
+	}
+
+	if err := s.discoverModels(); err != nil {
+		return fmt.Errorf("failed to rediscover models: %w", err)
+	}
+	s.seedCatalog()
+	return nil
+}
+
+func fetchModels(server string) ([]Model, error) {
+	resp, err := federationClient.Get(server + "/api/models")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var models []Model
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		return nil, fmt.Errorf("failed to decode models: %w", err)
+	}
+	return models, nil
+}
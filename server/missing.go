@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Models often share layers, such as two quantizations with one tokenizer or
+// fine-tunes of one base. A client says which blobs it already has, from any
+// model, and gets back only the ones it still needs for this one.
+
+// maxHaveDigests bounds the digests a client can send.
+const maxHaveDigests = 10000
+
+// HaveRequest is the body of POST /api/models/{name}/missing.
+type HaveRequest struct {
+	Digests []string `json:"digests"` // sha256:<hex> of blobs, or of the model's manifest
+}
+
+// MissingFiles is what a client needs of a model, given what it has.
+type MissingFiles struct {
+	Model  string `json:"model"`
+	Digest string `json:"digest"` // of the model's manifest
+	FileSelection
+}
+
+// postMissing serves POST /api/models/{name}/missing. Like the delta, it
+// answers in JSON, or with ?format=text or ?format=select.
+func (s *Server) postMissing(w http.ResponseWriter, r *http.Request) {
+	model, ok := s.modelByName(mux.Vars(r)["name"])
+	if !ok {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+	if model.Incomplete || model.InfoHash == "" {
+		http.Error(w, fmt.Sprintf("The torrent of %s isn't ready", model.Name), http.StatusConflict)
+		return
+	}
+
+	var req HaveRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Digests) > maxHaveDigests {
+		http.Error(w, fmt.Sprintf("At most %d digests", maxHaveDigests), http.StatusBadRequest)
+		return
+	}
+	have := make(map[string]bool, len(req.Digests))
+	for _, digest := range req.Digests {
+		if !strings.HasPrefix(digest, "sha256:") || !versionHex.MatchString(strings.TrimPrefix(digest, "sha256:")) {
+			http.Error(w, fmt.Sprintf("Invalid digest %q: expected sha256:<64 hex digits>", digest), http.StatusBadRequest)
+			return
+		}
+		have[digest] = true
+	}
+
+	selection, err := s.selectFiles(model, have)
+	if err != nil {
+		s.logger.Errorf("Failed to work out what is missing of %s: %v", model.Name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	writeFileSelection(w, r, selection, MissingFiles{Model: model.Name, Digest: model.Digest, FileSelection: selection})
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Admins can attach a description to a model: what it's for, licensing or
+// usage notes. It's markdown, shown on the model's page at /models/{name} and
+// returned as "description" by the API.
+
+// maxDescriptionSize bounds a model's description.
+const maxDescriptionSize = 64 << 10
+
+// ModelNote is the description set for a model from the admin API.
+type ModelNote struct {
+	Description string    `json:"description"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (s *Server) notesPath() string {
+	return filepath.Join(s.stateDir, "notes.json")
+}
+
+// loadNotes restores the descriptions set by a previous run.
+func (s *Server) loadNotes() error {
+	s.notes = make(map[string]ModelNote)
+	data, err := os.ReadFile(s.notesPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &s.notes); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", s.notesPath(), err)
+	}
+	return nil
+}
+
+// modelDescription returns the description set for a model, if any.
+func (s *Server) modelDescription(name string) string {
+	s.notesMu.Lock()
+	defer s.notesMu.Unlock()
+	return s.notes[name].Description
+}
+
+// setNote records a model's description, or clears it when empty, and
+// applies it to the catalog straight away. The caller holds notesMu.
+func (s *Server) setNote(name string, note ModelNote) error {
+	if note.Description == "" {
+		delete(s.notes, name)
+	} else {
+		s.notes[name] = note
+	}
+	data, err := json.MarshalIndent(s.notes, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.stateDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := writeTemp(s.notesPath(), data)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.notesPath()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	s.updateModel(name, func(m *Model) { m.Description = note.Description })
+	return nil
+}
+
+// getModel serves GET /api/models/{name}: one model, description included.
+// Hidden models are served by name, as their torrents are.
+func (s *Server) getModel(w http.ResponseWriter, r *http.Request) {
+	model, ok := s.modelByName(mux.Vars(r)["name"])
+	if !ok {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model)
+}
+
+// putModelDescription serves PUT /api/models/{name}/description, behind the
+// admin token, with a {"description": "..."} body. An empty description
+// removes it.
+func (s *Server) putModelDescription(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, ok := s.modelByName(name); !ok {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+	var note ModelNote
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDescriptionSize*2)).Decode(&note); err != nil {
+		http.Error(w, "Invalid description", http.StatusBadRequest)
+		return
+	}
+	note.Description = strings.TrimSpace(note.Description)
+	if len(note.Description) > maxDescriptionSize {
+		http.Error(w, fmt.Sprintf("The description is over %d bytes", maxDescriptionSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	note.UpdatedAt = time.Now()
+
+	s.notesMu.Lock()
+	err := s.setNote(name, note)
+	s.notesMu.Unlock()
+	if err != nil {
+		s.logger.Errorf("Failed to save the description of %s: %v", name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if note.Description == "" {
+		s.logger.Infof("Removed the description of %s", name)
+	} else {
+		s.logger.Infof("Updated the description of %s", name)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
+
+// serveModelPage shows one model at /models/{name}: its description,
+// versions and how to install it.
+func (s *Server) serveModelPage(w http.ResponseWriter, r *http.Request) {
+	model, ok := s.modelByName(mux.Vars(r)["name"])
+	if !ok {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+
+	tmpl := `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Model.Name}} - {{.Branding.Title}}</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; background-color: #f5f5f5; }
+        .container { max-width: 1200px; margin: 0 auto; background: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
+        h1 { color: #333; text-align: center; }
+        .back-link { margin-bottom: 20px; }
+        .back-link a { color: #007bff; text-decoration: none; }
+        .back-link a:hover { text-decoration: underline; }
+        .model-size { color: #666; margin-bottom: 10px; text-align: center; }
+        .description { margin-top: 30px; line-height: 1.5; }
+        .description pre { background: #f8f9fa; padding: 15px; border-radius: 4px; overflow-x: auto; }
+        .description code { background: #f8f9fa; padding: 1px 4px; border-radius: 3px; }
+        .download-btn { background: {{.Branding.AccentColor}}; color: white; padding: 10px 20px; border: none; border-radius: 4px; cursor: pointer; text-decoration: none; display: inline-block; }
+        .download-btn:hover { filter: brightness(0.85); }
+        .script-code { background: #f8f9fa; padding: 15px; border-radius: 4px; font-family: monospace; white-space: pre-wrap; font-size: 12px; margin-top: 10px; }
+        .versions { width: 100%; border-collapse: collapse; margin-top: 15px; }
+        .versions th, .versions td { text-align: left; padding: 8px; border-bottom: 1px solid #ddd; font-size: 13px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="back-link">
+            <a href="/">← Back to Main Page</a>
+        </div>
+        <h1>{{.Model.Name}}</h1>
+        <div class="model-size">Size: {{.Model.SizeHuman}}{{if .Model.Groups}} · {{range .Model.Groups}}<a href="/?group={{.}}" style="margin-right: 6px;">#{{.}}</a>{{end}}{{end}}</div>
+
+        {{if .Model.Incomplete}}
+        <div style="color: #721c24;">⚠️ Incomplete: {{len .Model.MissingBlobs}} blob(s) missing</div>
+        {{else if eq .Model.TorrentStatus "pending"}}
+        <div style="color: #856404;">⏳ Hashing: the torrent will be ready shortly</div>
+        {{else if eq .Model.TorrentStatus "failed"}}
+        <div style="color: #721c24;">⚠️ The torrent couldn't be created; see the server log</div>
+        {{else}}
+        <a href="/api/models/{{.Model.Name}}/torrent" class="download-btn">Download Torrent</a>
+        <a href="/api/models/{{.Model.Name}}/metalink" class="download-btn" style="background: #6c757d;">Metalink</a>
+        <div class="script-code">curl -sSL "{{.ServerURL}}/install.sh?model={{.Model.Name}}" | bash
+
+Invoke-WebRequest -Uri "{{.ServerURL}}/install.ps1?model={{.Model.Name}}" -OutFile "install.ps1"; .\install.ps1</div>
+        {{end}}
+
+        <div class="description">
+            {{if .Description}}{{.Description}}{{else}}<p style="color: #666;">No description yet.</p>{{end}}
+        </div>
+
+        {{if .Admin}}
+        <h3>Edit Description</h3>
+        <textarea id="description" rows="12" style="width: 100%; font-family: monospace;">{{.Model.Description}}</textarea>
+        <p><button class="download-btn" onclick="saveDescription(this)">Save</button> <span id="save-result"></span></p>
+        <p style="color: #666; font-size: 12px;">Markdown: headings, lists, <code>code</code>, **bold**, *italics* and [links](https://example.com).</p>
+        {{end}}
+
+        {{if gt (len .Versions) 1}}
+        <h3>Versions</h3>
+        <table class="versions">
+            <tr><th>Digest</th><th>Seen</th><th>Size</th><th></th></tr>
+            {{range .Versions}}
+            <tr>
+                <td><code>{{.Digest}}</code>{{if .Current}} (current){{end}}</td>
+                <td>{{.SeenAt.Format "2006-01-02 15:04"}}</td>
+                <td>{{.SizeHuman}}</td>
+                <td>{{if .Available}}<a href="{{.TorrentURL}}">torrent</a>{{else}}blobs pruned{{end}}</td>
+            </tr>
+            {{end}}
+        </table>
+        {{end}}
+    </div>
+    {{if .Admin}}
+    <script>
+        function saveDescription(button) {
+            const result = document.getElementById('save-result');
+            const token = sessionStorage.getItem('adminToken') || prompt('Admin token');
+            if (!token) return;
+            button.disabled = true;
+            fetch('/api/models/' + encodeURIComponent({{.Model.Name}}) + '/description', {
+                method: 'PUT',
+                headers: { 'Authorization': 'Bearer ' + token },
+                body: JSON.stringify({ description: document.getElementById('description').value })
+            }).then(function(resp) {
+                if (resp.status === 401) sessionStorage.removeItem('adminToken');
+                if (!resp.ok) return resp.text().then(function(text) { throw new Error(text.trim()); });
+                sessionStorage.setItem('adminToken', token);
+                location.reload();
+            }).catch(function(err) {
+                result.textContent = '❌ ' + err.message;
+                button.disabled = false;
+            });
+        }
+    </script>
+    {{end}}
+</body>
+</html>`
+
+	tmplData := struct {
+		Model       Model
+		Description template.HTML
+		Versions    []ModelVersion
+		ServerURL   string
+		Branding    BrandingSettings
+		Admin       bool
+	}{
+		Model:       model,
+		Description: renderMarkdown(model.Description),
+		Versions:    s.modelVersionList(model),
+		ServerURL:   s.baseURL(),
+		Branding:    s.branding,
+		Admin:       s.adminToken != "",
+	}
+
+	t, err := template.New("model").Parse(tmpl)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	t.Execute(w, tmplData)
+}
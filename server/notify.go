@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Events that can be sent to webhooks.
+const (
+	eventModelDiscovered    = "model_discovered"    // a model entered the catalog
+	eventModelPublished     = "model_published"     // a new model's torrent is ready
+	eventMirrorCompleted    = "mirror_completed"    // a model finished downloading from an upstream lancache
+	eventVerificationFailed = "verification_failed" // a blob or torrent didn't match its hashes
+	eventDiskLow            = "disk_low"            // the models directory is running out of space
+)
+
+var notificationEvents = []string{eventModelDiscovered, eventModelPublished, eventMirrorCompleted, eventVerificationFailed, eventDiskLow, eventDownloadCompleted}
+
+// NotificationSettings configure webhooks, so lab admins hear about problems
+// before users do.
+type NotificationSettings struct {
+	Webhooks          []WebhookSettings `mapstructure:"webhooks"`
+	MinFreeSpace      int               `mapstructure:"min_free_space"`      // GiB free in models_dir below which disk_low is sent; 0 disables
+	DiskCheckInterval time.Duration     `mapstructure:"disk_check_interval"` // how often free space is checked
+}
+
+// WebhookSettings are one webhook and the events it gets.
+type WebhookSettings struct {
+	URL    string   `mapstructure:"url"`
+	Format string   `mapstructure:"format"` // slack, discord, or json; guessed from the URL when empty
+	Events []string `mapstructure:"events"` // empty sends every event but download_completed
+}
+
+func (n NotificationSettings) validate() []string {
+	var problems []string
+	for i, hook := range n.Webhooks {
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("notifications.webhooks[%d].url must be an http(s) URL, got %q", i, hook.URL))
+		}
+		switch hook.Format {
+		case "", "slack", "discord", "json":
+		default:
+			problems = append(problems, fmt.Sprintf("notifications.webhooks[%d].format must be slack, discord, or json, got %q", i, hook.Format))
+		}
+		for _, event := range hook.Events {
+			if !containsString(notificationEvents, event) {
+				problems = append(problems, fmt.Sprintf("notifications.webhooks[%d].events: unknown event %q (want %s)", i, event, strings.Join(notificationEvents, ", ")))
+			}
+		}
+	}
+	if n.MinFreeSpace < 0 {
+		problems = append(problems, fmt.Sprintf("notifications.min_free_space must not be negative, got %d", n.MinFreeSpace))
+	}
+	if n.DiskCheckInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("notifications.disk_check_interval must be positive, got %s", n.DiskCheckInterval))
+	}
+	return problems
+}
+
+// format is the payload a webhook expects.
+func (w WebhookSettings) format() string {
+	if w.Format != "" {
+		return w.Format
+	}
+	switch {
+	case strings.Contains(w.URL, "hooks.slack.com"):
+		return "slack"
+	case strings.Contains(w.URL, "discord.com/api/webhooks"), strings.Contains(w.URL, "discordapp.com/api/webhooks"):
+		return "discord"
+	}
+	return "json"
+}
+
+func (w WebhookSettings) wants(event string) bool {
+	if len(w.Events) == 0 {
+		return event != eventDownloadCompleted
+	}
+	return containsString(w.Events, event)
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// notify sends an event to every webhook that wants it, in the background so
+// a slow or unreachable webhook never holds up the caller. Failures are only
+// logged.
+func (s *Server) notify(event, message string) {
+	s.notifyDetails(event, message, nil)
+}
+
+// notifyDetails is notify with details for JSON webhooks, such as the
+// metadata of the model an event is about. Every event also goes to the
+// /api/events stream.
+func (s *Server) notifyDetails(event, message string, details any) {
+	s.events.publish(ServerEvent{Event: event, Message: message, Time: time.Now().UTC(), Details: details})
+	for _, hook := range s.webhooks {
+		if !hook.wants(event) {
+			continue
+		}
+		go func(hook WebhookSettings) {
+			if err := s.postWebhook(hook, event, message, details); err != nil {
+				s.logger.Warnf("Failed to send %s notification: %v", event, err)
+			}
+		}(hook)
+	}
+}
+
+func (s *Server) postWebhook(hook WebhookSettings, event, message string, details any) error {
+	text := fmt.Sprintf("[%s] %s", s.branding.Title, message)
+	var payload any
+	switch hook.format() {
+	case "slack":
+		payload = map[string]string{"text": text}
+	case "discord":
+		payload = map[string]string{"content": text}
+	default:
+		fields := map[string]any{
+			"event":   event,
+			"message": message,
+			"server":  s.baseURL(),
+			"time":    time.Now().UTC(),
+		}
+		if details != nil {
+			fields["details"] = details
+		}
+		payload = fields
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := webhookClient.Post(hook.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// ModelEvent is the metadata JSON webhooks get with model_discovered, enough
+// for downstream automation to fetch the model without another request.
+type ModelEvent struct {
+	Name          string         `json:"name"`
+	Size          int64          `json:"size"`
+	SizeHuman     string         `json:"size_human"`
+	CreatedAt     time.Time      `json:"created_at"`
+	InfoHash      string         `json:"info_hash,omitempty"` // empty until the torrent is ready
+	TorrentStatus string         `json:"torrent_status,omitempty"`
+	TorrentURL    string         `json:"torrent_url,omitempty"`
+	Layers        []ManifestBlob `json:"layers,omitempty"`
+	Incomplete    bool           `json:"incomplete,omitempty"`
+}
+
+// announceNewModels sends model_discovered for every listed model in
+// current that wasn't in previous.
+func (s *Server) announceNewModels(previous, current []Model) {
+	known := make(map[string]bool, len(previous))
+	for _, model := range previous {
+		known[model.Name] = true
+	}
+	for _, model := range current {
+		if known[model.Name] || model.Hidden {
+			continue
+		}
+		event := ModelEvent{
+			Name:          model.Name,
+			Size:          model.Size,
+			SizeHuman:     formatSize(model.Size),
+			CreatedAt:     model.CreatedAt,
+			InfoHash:      model.InfoHash,
+			TorrentStatus: model.TorrentStatus,
+			Incomplete:    model.Incomplete,
+		}
+		if !model.Incomplete {
+			event.TorrentURL = fmt.Sprintf("%s/api/models/%s/torrent", s.baseURL(), url.PathEscape(model.Name))
+		}
+		if layers, err := s.modelBlobs(model.Name); err == nil {
+			event.Layers = layers
+		}
+		s.notifyDetails(eventModelDiscovered, fmt.Sprintf("New model %s (%s) is in the catalog", model.Name, event.SizeHuman), event)
+	}
+}
+
+// diskLoop sends disk_low once when free space in the models directory
+// drops below minFree bytes, and again only after it has recovered.
+func (s *Server) diskLoop(minFree int64, interval time.Duration) {
+	low := false
+	for ; ; time.Sleep(interval) {
+		free, err := freeSpace(s.modelsDir)
+		if err != nil {
+			s.logger.Warnf("Failed to check free space: %v", err)
+			continue
+		}
+		if free < minFree && !low {
+			s.logger.Warnf("Only %s free in %s", formatSize(free), s.modelsDir)
+			s.notify(eventDiskLow, fmt.Sprintf("Only %s free in %s (warning below %s)", formatSize(free), s.modelsDir, formatSize(minFree)))
+		}
+		low = free < minFree
+	}
+}
+
+// freeSpace returns the bytes available to this process on the filesystem
+// holding path.
+func freeSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"path"
+)
+
+// ModelOverride changes how the models matching a name or glob are
+// published. Fields left unset keep the defaults; when several entries
+// match, later ones win.
+type ModelOverride struct {
+	Match     string   `mapstructure:"match"`      // model name or path.Match glob, e.g. "llama3:70b" or "*:*-experimental"
+	PieceSize int64    `mapstructure:"piece_size"` // bytes, a power of two
+	Private   *bool    `mapstructure:"private"`    // set the private flag (BEP 27)
+	Seed      string   `mapstructure:"seed"`       // always or never; empty follows seeder.policy
+	Hidden    *bool    `mapstructure:"hidden"`     // left out of listings but still served by name
+	VisibleTo []string `mapstructure:"visible_to"` // clients from tracker.passkeys that still see it listed
+	Groups    []string `mapstructure:"groups"`     // added to the groups of earlier matches, see groups.go
+}
+
+// modelSettings are a model's publishing settings after overrides.
+type modelSettings struct {
+	PieceSize int64
+	Private   bool
+	Seed      string
+	Hidden    bool
+	VisibleTo []string
+	Groups    []string
+}
+
+// defaultPieceSize keeps the metadata of small models small.
+const defaultPieceSize = 32 * 1024
+
+func (o ModelOverride) validate() error {
+	if o.Match == "" {
+		return fmt.Errorf("match must not be empty")
+	}
+	if _, err := path.Match(o.Match, ""); err != nil {
+		return fmt.Errorf("invalid match pattern %q: %w", o.Match, err)
+	}
+	if o.PieceSize != 0 && (o.PieceSize < 16*1024 || o.PieceSize > 64<<20 || o.PieceSize&(o.PieceSize-1) != 0) {
+		return fmt.Errorf("piece_size must be a power of two between 16 KiB and 64 MiB, got %d", o.PieceSize)
+	}
+	switch o.Seed {
+	case "", "always", "never":
+	default:
+		return fmt.Errorf("seed must be always or never, got %q", o.Seed)
+	}
+	return validateGroups(o.Groups)
+}
+
+// modelSettings resolves the overrides that apply to a model.
+func (s *Server) modelSettings(name string) modelSettings {
+	settings := modelSettings{PieceSize: defaultPieceSize, Private: true}
+	for _, override := range s.overrides {
+		if ok, _ := path.Match(override.Match, name); !ok {
+			continue
+		}
+		if override.PieceSize != 0 {
+			settings.PieceSize = override.PieceSize
+		}
+		if override.Private != nil {
+			settings.Private = *override.Private
+		}
+		if override.Seed != "" {
+			settings.Seed = override.Seed
+		}
+		if override.Hidden != nil {
+			settings.Hidden = *override.Hidden
+		}
+		if override.VisibleTo != nil {
+			settings.VisibleTo = override.VisibleTo
+		}
+		for _, group := range override.Groups {
+			if !containsString(settings.Groups, group) {
+				settings.Groups = append(settings.Groups, group)
+			}
+		}
+	}
+	// Set from the admin API, see visibility.go
+	if v, ok := s.modelVisibility(name); ok {
+		settings.Hidden = v.Hidden
+		settings.VisibleTo = v.VisibleTo
+	}
+	return settings
+}
+
+// published reports whether the models allowlist lets a model into the
+// catalog. An empty allowlist publishes every model on the host.
+func (s *Server) published(name string) bool {
+	if len(s.allowedModels) == 0 {
+		return true
+	}
+	for _, pattern := range s.allowedModels {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// warnUnmatchedAllowlist logs allowlist entries that match no model, which
+// are usually typos or models that haven't been pulled yet.
+func (s *Server) warnUnmatchedAllowlist(models []Model) {
+	for _, pattern := range s.allowedModels {
+		matched := false
+		for _, model := range models {
+			if ok, _ := path.Match(pattern, model.Name); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			s.logger.Warnf("No model matches %q in the models allowlist", pattern)
+		}
+	}
+}
+
+// visibleCatalog is the catalog without hidden models, for listings: the
+// web UI, /api/models, the feed, and what federation peers see.
+func (s *Server) visibleCatalog() []Model {
+	var visible []Model
+	for _, model := range s.catalog() {
+		if !model.Hidden {
+			visible = append(visible, model)
+		}
+	}
+	return visible
+}
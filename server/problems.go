@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// QuarantinedManifest is a manifest that couldn't be parsed. Its model is
+// left out of the catalog until the manifest is fixed or the model re-pulled.
+type QuarantinedManifest struct {
+	Model string    `json:"model"`
+	Path  string    `json:"path"`
+	Error string    `json:"error"`
+	Since time.Time `json:"since"` // first discovery that found it malformed
+}
+
+// Problems is what /api/problems reports for an admin to act on.
+type Problems struct {
+	Quarantined []QuarantinedManifest `json:"quarantined_manifests"`
+}
+
+// setQuarantine replaces the quarantine list after a discovery, keeping when
+// each manifest was first found malformed.
+func (s *Server) setQuarantine(found []QuarantinedManifest) {
+	s.problemsMu.Lock()
+	defer s.problemsMu.Unlock()
+	since := make(map[string]time.Time, len(s.quarantine))
+	for _, q := range s.quarantine {
+		since[q.Path] = q.Since
+	}
+	for i := range found {
+		if t, ok := since[found[i].Path]; ok {
+			found[i].Since = t
+		}
+	}
+	s.quarantine = found
+}
+
+func (s *Server) getProblems(w http.ResponseWriter, r *http.Request) {
+	s.problemsMu.Lock()
+	problems := Problems{Quarantined: append([]QuarantinedManifest{}, s.quarantine...)}
+	s.problemsMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(problems)
+}
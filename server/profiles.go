@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// profiles bundle defaults for common deployments. They're registered as
+// viper defaults, so anything set in the config file, the environment or on
+// the command line still wins over the preset.
+var profiles = map[string]map[string]interface{}{
+	// One site: private torrents announced on the LAN, found over mDNS
+	"lan": {
+		"mdns":              true,
+		"seeder.lsd":        true,
+		"seeder.pex":        true,
+		"seeder.encryption": "prefer",
+	},
+	// Links between sites: encrypted peer connections, no LAN multicast, and
+	// upload caps that leave room for other traffic
+	"wan": {
+		"seeder.lsd":                     false,
+		"seeder.encryption":              "require",
+		"seeder.max_upload_rate":         51200, // 50 MiB/s
+		"seeder.torrent_max_upload_rate": 12800, // 12.5 MiB/s
+	},
+	// No Internet: our own tracker, nothing fetched from outside, and the
+	// address taken from the network interfaces instead of a route lookup
+	"airgap": {
+		"mdns":             true,
+		"seeder.lsd":       true,
+		"tracker.embedded": true,
+	},
+}
+
+// applyProfile registers the defaults of the named profile. An unknown name
+// is left for validation to report.
+func applyProfile(name string) {
+	for key, value := range profiles[name] {
+		viper.SetDefault(key, value)
+	}
+}
+
+func profileNames() []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateProfile reports settings that contradict the chosen profile.
+func (c *Config) validateProfile() []string {
+	if c.Profile == "" {
+		return nil
+	}
+	if _, ok := profiles[c.Profile]; !ok {
+		return []string{fmt.Sprintf("profile must be one of %v, got %q", profileNames(), c.Profile)}
+	}
+
+	var problems []string
+	if c.Profile == "airgap" {
+		if len(c.Mirror.upstreams()) > 0 {
+			problems = append(problems, "the airgap profile doesn't fetch from upstreams; remove the mirror settings")
+		}
+		if len(c.ACME.Domains) > 0 {
+			problems = append(problems, "the airgap profile can't reach an ACME server; use tls_cert_file and tls_key_file")
+		}
+	}
+	return problems
+}
+
+// interfaceIP returns the first IPv4 address of an interface that's up and
+// not loopback. Unlike getLocalIP it doesn't need a route to the Internet.
+func interfaceIP() (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				return ipNet.IP.String(), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no network interface with an IPv4 address")
+}
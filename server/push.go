@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ModelPush is what a curating server posts to an edge's
+// /api/federation/push. Blobs the edge doesn't have are either uploaded
+// beforehand to /api/federation/push/blobs/{digest} or, with Torrent set,
+// downloaded by the edge over BitTorrent.
+type ModelPush struct {
+	Name     string          `json:"name"`
+	Manifest json.RawMessage `json:"manifest"`
+	Torrent  []byte          `json:"torrent,omitempty"` // base64 in JSON
+}
+
+var (
+	// Only library models: discovery names a model by its directory under
+	// registry.ollama.ai/library and its tag, which a namespace would break
+	pushModelName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*:[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	pushDigest    = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+)
+
+// maxPushSize bounds a push: a manifest and a .torrent, base64-encoded.
+const maxPushSize = 32 << 20
+
+// pushAuthorized checks a push against federation.push_token. Pushing is
+// disabled when no token is configured.
+func (s *Server) pushAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	want := "Bearer " + s.pushToken
+	if s.pushToken == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+		http.Error(w, "Invalid push token", http.StatusForbidden)
+		return false
+	}
+	// Servers sharing a models directory leave writes to the leader
+	if !s.lease.isLeader() {
+		http.Error(w, "Not the leader; push to the other server of the pair", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// receivePush adds a pushed model to the catalog. With every blob present
+// the manifest is written straight away (201 Created). Otherwise the pushed
+// torrent is downloaded in the background (202 Accepted), and the model is
+// published with our own .torrent once it completes, as in mirror mode.
+func (s *Server) receivePush(w http.ResponseWriter, r *http.Request) {
+	if !s.pushAuthorized(w, r) {
+		return
+	}
+
+	var push ModelPush
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushSize)).Decode(&push); err != nil {
+		http.Error(w, "Invalid push", http.StatusBadRequest)
+		return
+	}
+	if !pushModelName.MatchString(push.Name) {
+		http.Error(w, "Invalid model name: expected model:tag, without a namespace", http.StatusBadRequest)
+		return
+	}
+	if !s.published(push.Name) {
+		http.Error(w, "Model is not in this server's models allowlist", http.StatusForbidden)
+		return
+	}
+	digests, err := manifestDigests(push.Manifest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A deletion meanwhile could remove blobs found here
+	s.deleteMu.Lock()
+	var missing []string
+	for _, digest := range digests {
+		if _, err := os.Stat(s.blobPath(digest)); err != nil {
+			missing = append(missing, digest)
+		}
+	}
+	if len(missing) == 0 {
+		err = s.writeManifest(push.Name, push.Manifest)
+	}
+	s.deleteMu.Unlock()
+
+	if len(missing) == 0 {
+		if err != nil {
+			s.logger.Errorf("Failed to write pushed manifest for %s: %v", push.Name, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		s.logger.Infof("Received pushed model %s", push.Name)
+		if err := s.discoverModels(); err != nil {
+			s.logger.Errorf("Failed to rediscover models: %v", err)
+		}
+		if s.seeder != nil {
+			s.seedCatalog()
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	if len(push.Torrent) == 0 || s.seeder == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string][]string{"missing_blobs": missing})
+		return
+	}
+
+	s.logger.Infof("Downloading pushed model %s (%d blobs missing)", push.Name, len(missing))
+	go func() {
+		always := func() bool { return true }
+		if err := s.seeder.download(push.Name, push.Torrent, 0, always); err != nil {
+			s.logger.Warnf("Failed to download pushed model %s: %v", push.Name, err)
+			return
+		}
+		if err := s.discoverModels(); err != nil {
+			s.logger.Errorf("Failed to rediscover models: %v", err)
+		}
+		s.seedCatalog()
+		s.logger.Infof("Received pushed model %s", push.Name)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// receivePushedBlob stores one blob ahead of a push. The upload is written
+// under a temporary name and only kept if it matches its digest.
+func (s *Server) receivePushedBlob(w http.ResponseWriter, r *http.Request) {
+	if !s.pushAuthorized(w, r) {
+		return
+	}
+
+	digest := mux.Vars(r)["digest"]
+	if !pushDigest.MatchString(digest) {
+		http.Error(w, "Invalid digest", http.StatusBadRequest)
+		return
+	}
+	blobPath := s.blobPath(digest)
+	if _, err := os.Stat(blobPath); err == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0755); err != nil {
+		s.logger.Errorf("Failed to create blobs directory: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(blobPath), ".push-*")
+	if err != nil {
+		s.logger.Errorf("Failed to create blob: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), r.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		http.Error(w, "Failed to receive blob", http.StatusBadRequest)
+		return
+	}
+	if "sha256:"+hex.EncodeToString(hash.Sum(nil)) != digest {
+		http.Error(w, "Blob does not match its digest", http.StatusBadRequest)
+		return
+	}
+	if err := os.Rename(tmp.Name(), blobPath); err != nil {
+		s.logger.Errorf("Failed to store blob %s: %v", digest, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// manifestDigests returns the config and layer digests a manifest refers to.
+func manifestDigests(manifest []byte) ([]string, error) {
+	var parsed struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(manifest, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if len(parsed.Layers) == 0 {
+		return nil, fmt.Errorf("manifest has no layers")
+	}
+
+	var digests []string
+	if parsed.Config.Digest != "" {
+		digests = append(digests, parsed.Config.Digest)
+	}
+	for _, layer := range parsed.Layers {
+		digests = append(digests, layer.Digest)
+	}
+	for _, digest := range digests {
+		if !pushDigest.MatchString(digest) {
+			return nil, fmt.Errorf("invalid digest %q in manifest", digest)
+		}
+	}
+	return digests, nil
+}
+
+func (s *Server) blobPath(digest string) string {
+	return filepath.Join(s.modelsDir, "blobs", strings.Replace(digest, ":", "-", 1))
+}
+
+// writeManifest stores a library model's manifest where Ollama looks for it,
+// under registry.ollama.ai/library.
+func (s *Server) writeManifest(name string, manifest []byte) error {
+	modelPath := strings.Replace(name, ":", string(filepath.Separator), 1)
+	manifestPath := filepath.Join(s.modelsDir, "manifests", "registry.ollama.ai", "library", modelPath)
+	if err := os.MkdirAll(filepath.Dir(manifestPath), 0755); err != nil {
+		return err
+	}
+	tmp := manifestPath + ".push"
+	if err := os.WriteFile(tmp, manifest, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, manifestPath)
+}
+
+// pushLoop publishes models to edge servers: each edge is compared with our
+// catalog and sent whatever it lacks, with our .torrent so it fetches the
+// blobs over BitTorrent.
+func (s *Server) pushLoop(edges []string, interval time.Duration) {
+	for {
+		if s.lease.isLeader() {
+			for _, edge := range edges {
+				s.pushMissing(strings.TrimSuffix(edge, "/"))
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (s *Server) pushMissing(edge string) {
+	catalog, err := fetchCatalog(edge)
+	if err != nil {
+		s.logger.Warnf("Failed to fetch catalog from %s: %v", edge, err)
+		return
+	}
+	// Models the edge is already downloading are listed as partial
+	pending := make(map[string]bool)
+	for _, partial := range catalog.Partial {
+		pending[partial.Name] = true
+	}
+
+	for _, model := range diffCatalogs(edge, s.visibleCatalog(), catalog.Models).MissingOnPeer {
+		if pending[model.Name] || model.TorrentFile == "" {
+			continue
+		}
+		if err := s.pushModel(edge, model); err != nil {
+			s.logger.Warnf("Failed to push %s to %s: %v", model.Name, edge, err)
+			continue
+		}
+		s.logger.Infof("Pushed %s to %s", model.Name, edge)
+	}
+}
+
+func (s *Server) pushModel(edge string, model Model) error {
+	manifestPath, err := s.manifestPath(model.Name)
+	if err != nil {
+		return err
+	}
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	torrent, err := os.ReadFile(model.TorrentFile)
+	if err != nil {
+		return fmt.Errorf("failed to read torrent: %w", err)
+	}
+
+	body, err := json.Marshal(ModelPush{Name: model.Name, Manifest: manifest, Torrent: torrent})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", edge+"/api/federation/push", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.pushToken)
+
+	resp, err := federationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// RegeneratedTorrent is the answer to a regenerate request. The new torrent
+// is created in the background; its info-hash is in the catalog once the
+// model's torrent_status is ready again.
+type RegeneratedTorrent struct {
+	Model         string `json:"model"`
+	OldInfoHash   string `json:"old_info_hash,omitempty"`
+	TorrentStatus string `json:"torrent_status"`
+}
+
+// regenerateTorrent throws away a model's torrent and the piece hashes saved
+// for its blobs, and queues a new one built with the current settings. The
+// old torrent stops being seeded straight away.
+func (s *Server) regenerateTorrent(model Model) error {
+	torrentPath := s.modelTorrentPath(model.Name)
+	unlock := s.lockTorrent(torrentPath)
+	err := os.Remove(torrentPath)
+	unlock()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Saved hashes would otherwise carry over whatever made the torrent suspect
+	if s.stateDir != "" {
+		if data, err := s.readManifest(model.Name); err == nil {
+			if digests, err := manifestDigests(data); err == nil {
+				for _, digest := range digests {
+					name := strings.Replace(digest, ":", "-", 1)
+					saved, _ := filepath.Glob(filepath.Join(s.stateDir, "pieces", "*", name))
+					for _, path := range saved {
+						os.Remove(path)
+					}
+				}
+			}
+		}
+	}
+
+	if s.seeder != nil && model.InfoHash != "" {
+		s.seeder.drop(model.InfoHash)
+	}
+	s.updateModel(model.Name, func(m *Model) {
+		m.TorrentFile = ""
+		m.InfoHash = ""
+		m.TorrentStatus = torrentPending
+	})
+	s.queueTorrents([]string{model.Name})
+	return nil
+}
+
+// readManifest reads a catalog model's manifest.
+func (s *Server) readManifest(name string) ([]byte, error) {
+	manifestPath, err := s.manifestPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(manifestPath)
+}
+
+// handleRegenerateTorrent serves POST /api/models/{name}/regenerate, behind
+// the admin token.
+func (s *Server) handleRegenerateTorrent(w http.ResponseWriter, r *http.Request) {
+	model, ok := s.modelByName(mux.Vars(r)["name"])
+	if !ok {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+	if model.Incomplete {
+		http.Error(w, "Model is incomplete; its torrent is created once every blob is present", http.StatusConflict)
+		return
+	}
+	if model.TorrentStatus == torrentPending {
+		http.Error(w, "The torrent is already being created", http.StatusConflict)
+		return
+	}
+	// Servers sharing a models directory leave writes to the leader
+	if !s.lease.isLeader() {
+		http.Error(w, "Not the leader; regenerate on the other server of the pair", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := s.regenerateTorrent(model); err != nil {
+		s.logger.Errorf("Failed to regenerate the torrent of %s: %v", model.Name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	s.logger.Infof("Regenerating the torrent of %s", model.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(RegeneratedTorrent{
+		Model:         model.Name,
+		OldInfoHash:   model.InfoHash,
+		TorrentStatus: torrentPending,
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The registry API serves manifests and blobs at the paths of the OCI
+// distribution spec, /v2/<name>/manifests/<reference> and
+// /v2/<name>/blobs/sha256:<hex>, with the headers Docker clients expect, so
+// HTTP caches and registry mirrors already on the network can sit in front of
+// the lancache without rewriting URLs. Blobs are shared by every model, so
+// for them the name only has to be well formed.
+
+// registryName matches a repository name such as library/llama3.
+var registryName = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+
+// registryError writes an error in the registry API's format.
+func registryError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+// registryHandler serves GET and HEAD under /v2/.
+func (s *Server) registryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+
+		// The version check clients make before anything else
+		if r.URL.Path == "/v2/" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{}"))
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, "/v2/")
+		if i := strings.LastIndex(rest, "/manifests/"); i >= 0 {
+			name, reference := rest[:i], rest[i+len("/manifests/"):]
+			if !registryName.MatchString(name) {
+				registryError(w, http.StatusNotFound, "NAME_INVALID", "invalid repository name")
+				return
+			}
+			s.serveRegistryManifest(w, r, name, reference)
+			return
+		}
+		i := strings.LastIndex(rest, "/blobs/")
+		if i < 0 {
+			registryError(w, http.StatusNotFound, "UNSUPPORTED", "only manifests and blobs are served")
+			return
+		}
+		name, digest := rest[:i], rest[i+len("/blobs/"):]
+		if !registryName.MatchString(name) {
+			registryError(w, http.StatusNotFound, "NAME_INVALID", "invalid repository name")
+			return
+		}
+		if !strings.HasPrefix(digest, "sha256:") || !versionHex.MatchString(strings.TrimPrefix(digest, "sha256:")) {
+			registryError(w, http.StatusBadRequest, "DIGEST_INVALID", "expected sha256:<64 hex digits>")
+			return
+		}
+		s.serveRegistryBlob(w, r, digest)
+	})
+}
+
+// registryTag matches a tag in a manifest reference.
+var registryTag = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// serveRegistryManifest serves the manifest of a model by tag or digest.
+// Repositories are named as in Ollama's registry: library/llama3 and llama3
+// are both the llama3 model, and llama3/manifests/8b is llama3:8b. A digest
+// can name any model's current version, or a kept earlier one.
+func (s *Server) serveRegistryManifest(w http.ResponseWriter, r *http.Request, name, reference string) {
+	repository := strings.TrimPrefix(name, "library/")
+	unknown := func() {
+		registryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+	}
+
+	var data []byte
+	var err error
+	if strings.HasPrefix(reference, "sha256:") {
+		if !versionHex.MatchString(strings.TrimPrefix(reference, "sha256:")) {
+			registryError(w, http.StatusBadRequest, "DIGEST_INVALID", "expected sha256:<64 hex digits>")
+			return
+		}
+		err = os.ErrNotExist
+		for _, model := range s.catalog() {
+			if strings.HasPrefix(model.Name, repository+":") {
+				if data, err = s.modelManifest(model, reference); err == nil {
+					break
+				}
+			}
+		}
+	} else {
+		if !registryTag.MatchString(reference) {
+			registryError(w, http.StatusBadRequest, "TAG_INVALID", "invalid tag")
+			return
+		}
+		model, ok := s.modelByName(repository + ":" + reference)
+		if !ok {
+			unknown()
+			return
+		}
+		data, err = s.modelManifest(model, "")
+	}
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.logger.Errorf("Failed to read the manifest of %s:%s: %v", repository, reference, err)
+		}
+		unknown()
+		return
+	}
+	serveManifestData(w, r, data)
+}
+
+// serveRegistryBlob serves a blob from the models directory, with range
+// support like /webseed/.
+func (s *Server) serveRegistryBlob(w http.ResponseWriter, r *http.Request, digest string) {
+	f, err := os.Open(s.blobPath(digest))
+	if err != nil {
+		registryError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		registryError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+
+	// Blobs never change, so caches can keep them for good
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("ETag", `"`+digest+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/viper"
+)
+
+// reloadLoop re-reads the configuration whenever the process gets SIGHUP, so
+// tuning a running server doesn't mean rediscovering and rehashing every
+// model.
+func (s *Server) reloadLoop() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		s.reloadConfig()
+	}
+}
+
+// reloadConfig applies the settings that can change at runtime: logging,
+// the extra trackers in tracker_urls, and the seeder's upload caps and
+// seeding policy. Other settings keep their startup values until a restart.
+// A configuration that fails validation is rejected as a whole.
+func (s *Server) reloadConfig() {
+	if err := viper.ReadInConfig(); err != nil {
+		s.logger.Errorf("Failed to reload configuration: %v", err)
+		return
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		s.logger.Errorf("Keeping the current configuration: %v", err)
+		return
+	}
+
+	applyLogging(s.logger, cfg.Logging)
+	s.setTrackers(cfg.TrackerURLs)
+	if s.seeder != nil {
+		s.seeder.reconfigure(seederConfig{
+			MaxUploadRate:        cfg.Seeder.MaxUploadRate,
+			TorrentMaxUploadRate: cfg.Seeder.TorrentMaxUploadRate,
+			ModelUploadRates:     cfg.Seeder.ModelUploadRates,
+			Policy:               cfg.Seeder.Policy,
+			Pinned:               cfg.Seeder.Pinned,
+			Models:               cfg.Seeder.Models,
+			RecentWindow:         cfg.Seeder.RecentWindow,
+		})
+		s.seedCatalog()
+	}
+	s.logger.Infof("Reloaded configuration from %s", viper.ConfigFileUsed())
+}
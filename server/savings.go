@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// SavingsReport estimates the WAN bandwidth the cache saved: every completed
+// download would otherwise have pulled the whole model from the internet,
+// while the cache pulled it once.
+type SavingsReport struct {
+	Range         string         `json:"range"`
+	Since         *time.Time     `json:"since,omitempty"` // absent for all time
+	Downloads     int64          `json:"downloads"`
+	ServedBytes   int64          `json:"served_bytes"`   // completed downloads × model size
+	UpstreamBytes int64          `json:"upstream_bytes"` // what the cache itself pulled
+	SavedBytes    int64          `json:"saved_bytes"`
+	SavedHuman    string         `json:"saved_human"`
+	Models        []ModelSavings `json:"models"`
+}
+
+// ModelSavings is one model's share of a SavingsReport.
+type ModelSavings struct {
+	Model         string `json:"model"`
+	InfoHash      string `json:"info_hash"`
+	Size          int64  `json:"size"`
+	Downloads     int64  `json:"downloads"`
+	ServedBytes   int64  `json:"served_bytes"`
+	UpstreamBytes int64  `json:"upstream_bytes"`
+	SavedBytes    int64  `json:"saved_bytes"`
+}
+
+// savings builds the report for downloads completed since the given time,
+// zero for all time. Completions come from the embedded tracker. A model
+// counts as pulled from upstream in the range if its manifest was written in
+// it; one that's never been downloaded saves nothing and isn't charged.
+func (s *Server) savings(since time.Time, name string) SavingsReport {
+	report := SavingsReport{Range: name, Models: []ModelSavings{}}
+	if !since.IsZero() {
+		report.Since = &since
+	}
+
+	completions := s.tracker.Completions(since)
+	for _, model := range s.visibleCatalog() {
+		downloads := completions[model.InfoHash]
+		if model.InfoHash == "" || downloads == 0 {
+			continue
+		}
+		entry := ModelSavings{
+			Model:       model.Name,
+			InfoHash:    model.InfoHash,
+			Size:        model.Size,
+			Downloads:   downloads,
+			ServedBytes: downloads * model.Size,
+		}
+		if !model.CreatedAt.Before(since) {
+			entry.UpstreamBytes = model.Size
+		}
+		entry.SavedBytes = max(0, entry.ServedBytes-entry.UpstreamBytes)
+
+		report.Downloads += entry.Downloads
+		report.ServedBytes += entry.ServedBytes
+		report.UpstreamBytes += entry.UpstreamBytes
+		report.SavedBytes += entry.SavedBytes
+		report.Models = append(report.Models, entry)
+	}
+	report.SavedHuman = formatSize(report.SavedBytes)
+	sort.Slice(report.Models, func(i, j int) bool {
+		if report.Models[i].SavedBytes != report.Models[j].SavedBytes {
+			return report.Models[i].SavedBytes > report.Models[j].SavedBytes
+		}
+		return report.Models[i].Model < report.Models[j].Model
+	})
+	return report
+}
+
+// getSavings serves the bandwidth-savings report for a ?range= of days.
+func (s *Server) getSavings(w http.ResponseWriter, r *http.Request) {
+	since, name, err := statsRange(r, "all")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.savings(since, name))
+}
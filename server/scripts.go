@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/template"
+
+	lancache "github.com/jjasghar/ollama-bt-lancache"
+)
+
+// The install scripts are embedded in the binary and rendered with this
+// server's address, so they work however and wherever the server is run.
+var (
+	bashTemplate       = template.Must(template.New("install.sh").Parse(lancache.InstallSh))
+	powerShellTemplate = template.Must(template.New("install.ps1").Parse(lancache.InstallPs1))
+
+	// Alternatives to install.sh for machines that can't run the Python
+	// client, picked with the client query parameter
+	bashVariants = map[string]*template.Template{
+		"aria2c":       template.Must(template.New("install.sh").Parse(lancache.InstallAria2c)),
+		"transmission": template.Must(template.New("install.sh").Parse(lancache.InstallTransmission)),
+	}
+
+	// Service definitions that keep a client seeding what it downloaded
+	seedServiceTemplate = template.Must(template.New("ollama-bt-seed.service").Parse(lancache.SeedService))
+	seedTaskTemplate    = template.Must(template.New("ollama-bt-seed.xml").Parse(lancache.SeedTask))
+
+	composeTemplate = template.Must(template.New("docker-compose.yml").Parse(lancache.DockerCompose))
+
+	// The playbook is full of Ansible's own {{ }} expressions
+	playbookTemplate = template.Must(template.New("ollama-bt-playbook.yml").Delims("[[", "]]").Parse(lancache.AnsiblePlaybook))
+)
+
+// scriptData is what the install script templates can refer to.
+type scriptData struct {
+	ServerURL  string       // base URL clients reach this server at
+	TrackerURL string       // primary announce URL
+	Model      *modelScript // set when the script is pinned to one model
+	Group      string       // models installed when no model is given, see groups.go
+}
+
+// modelScript pins an install script to one model, so it can be run
+// without arguments and checks what it downloaded.
+type modelScript struct {
+	Name         string
+	TorrentURL   string
+	InfoHash     string
+	ManifestPath string   // where the manifest lands, relative to the output directory
+	BlobDir      string   // where the blobs land, relative to the output directory
+	Digests      []string // config and layer blobs
+}
+
+// scriptSafe matches model names that can be pasted into a script's string
+// literals as they are.
+var scriptSafe = regexp.MustCompile(`^[A-Za-z0-9._:/-]+$`)
+
+func (s *Server) scriptData() scriptData {
+	return scriptData{ServerURL: s.baseURL(), TrackerURL: s.trackerURL}
+}
+
+// installScriptData is the template data for an install script request,
+// pinned to the model in the model query parameter if there is one, or to
+// the models of the group in the group query parameter. It
+// writes the error response itself when the model can't be installed.
+func (s *Server) installScriptData(w http.ResponseWriter, r *http.Request) (scriptData, bool) {
+	data := s.scriptData()
+	if group := r.URL.Query().Get("group"); group != "" {
+		if err := validateGroups([]string{group}); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return data, false
+		}
+		data.Group = group
+	}
+	name := r.URL.Query().Get("model")
+	if name == "" {
+		return data, true
+	}
+	if !scriptSafe.MatchString(name) {
+		http.Error(w, "Invalid model name", http.StatusBadRequest)
+		return data, false
+	}
+
+	model, ok := s.modelByName(name)
+	if !ok {
+		http.NotFound(w, r)
+		return data, false
+	}
+	if model.Incomplete || model.InfoHash == "" {
+		http.Error(w, fmt.Sprintf("Model %s is not available for download", name), http.StatusConflict)
+		return data, false
+	}
+
+	pinned, err := s.modelScript(model, r.URL.Query().Get("key"))
+	if err != nil {
+		s.logger.Errorf("Failed to prepare install script for %s: %v", name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return data, false
+	}
+	data.Model = pinned
+	return data, true
+}
+
+// modelScript collects what a pinned install script needs to fetch and check
+// a model. Paths are inside the model's torrent, whose files all sit under
+// a top-level "models" directory.
+func (s *Server) modelScript(model Model, key string) (*modelScript, error) {
+	manifestPath, err := s.manifestPath(model.Name)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	digests, err := manifestDigests(manifest)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(s.modelsDir, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	torrentURL := fmt.Sprintf("%s/api/models/%s/torrent", s.baseURL(), url.PathEscape(model.Name))
+	if key != "" {
+		torrentURL += "?key=" + url.QueryEscape(key)
+	}
+	return &modelScript{
+		Name:         model.Name,
+		TorrentURL:   torrentURL,
+		InfoHash:     model.InfoHash,
+		ManifestPath: "models/" + filepath.ToSlash(rel),
+		BlobDir:      "models/blobs",
+		Digests:      digests,
+	}, nil
+}
+
+// serveScript renders an install script template as a download, or its
+// signature.
+func (s *Server) serveScript(w http.ResponseWriter, r *http.Request, tmpl *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		s.logger.Errorf("Failed to render %s: %v", tmpl.Name(), err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	s.serveSigned(w, r, tmpl.Name(), buf.Bytes())
+}
+
+func (s *Server) servePowerShellScript(w http.ResponseWriter, r *http.Request) {
+	if data, ok := s.installScriptData(w, r); ok {
+		s.serveScript(w, r, powerShellTemplate, data)
+	}
+}
+
+func (s *Server) serveBashScript(w http.ResponseWriter, r *http.Request) {
+	tmpl := bashTemplate
+	if client := r.URL.Query().Get("client"); client != "" {
+		variant, ok := bashVariants[client]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown client %q", client), http.StatusBadRequest)
+			return
+		}
+		tmpl = variant
+	}
+	if data, ok := s.installScriptData(w, r); ok {
+		s.serveScript(w, r, tmpl, data)
+	}
+}
+
+func (s *Server) serveSeedService(w http.ResponseWriter, r *http.Request) {
+	s.serveScript(w, r, seedServiceTemplate, s.scriptData())
+}
+
+func (s *Server) serveSeedTask(w http.ResponseWriter, r *http.Request) {
+	s.serveScript(w, r, seedTaskTemplate, s.scriptData())
+}
+
+// serveCompose renders a compose file that runs the client in a container
+// against this server, optionally pinned to the model in the query.
+func (s *Server) serveCompose(w http.ResponseWriter, r *http.Request) {
+	if data, ok := s.installScriptData(w, r); ok {
+		s.serveScript(w, r, composeTemplate, data)
+	}
+}
+
+func (s *Server) servePlaybook(w http.ResponseWriter, r *http.Request) {
+	s.serveScript(w, r, playbookTemplate, s.scriptData())
+}
+
+func (s *Server) serveClientScript(w http.ResponseWriter, r *http.Request) {
+	s.serveSigned(w, r, "client.py", lancache.ClientPy)
+}
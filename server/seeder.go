@@ -0,0 +1,617 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	g "github.com/anacrolix/generics"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/mse"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// Seeder is a BitTorrent client embedded in the server that seeds every model
+// in the catalog straight from the Ollama models directory, so a LAN
+// deployment doesn't need a separate seeder.py process.
+type Seeder struct {
+	mu       sync.Mutex
+	client   *torrent.Client
+	torrents map[string]*torrent.Torrent // keyed by hex info-hash
+	limiters map[string]*rate.Limiter    // per-torrent upload caps, keyed by hex info-hash
+	fetchers map[string]*rate.Limiter    // per-torrent download caps for mirroring, keyed by hex info-hash
+	names    map[string]string           // model names of seeded torrents, keyed by hex info-hash
+	lastUsed map[string]time.Time        // last torrent download or announce, keyed by hex info-hash
+	external map[string]bool             // torrents from the watch directory, outside the seeding policy
+	fetching map[string]bool             // models being mirrored from another lancache
+	warming  map[string]bool             // new models seeding without their upload cap
+	adding   map[string]bool             // models being added to the client by seed
+	// Latest tracker announce and verification error, keyed by hex info-hash
+	announces map[string]announceResult
+	errors    map[string]string
+	uploaded  map[clientDay]int64 // bytes sent over closed peer connections, keyed by peer IP and day
+	config    seederConfig        // policy and upload caps are guarded by mu; reconfigure changes them
+	logger    *logrus.Logger
+	upload    *rate.Limiter // client-wide upload cap
+
+	// seedOverride returns always or never for models whose model_overrides
+	// take them out of the policy, and "" otherwise
+	seedOverride func(modelName string) string
+	// verifyFailed is told about torrents whose data fails verification
+	verifyFailed func(modelName string, err error)
+
+	conns int // established connections per torrent outside warm-up
+}
+
+type seederConfig struct {
+	ModelsDir  string
+	ListenPort int
+	LSD        bool   // announce torrents via Local Service Discovery (BEP 14)
+	PEX        bool   // exchange peer lists with connected peers (BEP 11)
+	UTP        bool   // accept and dial uTP (BEP 29) connections
+	TCP        bool   // accept and dial TCP connections
+	Encryption string // peer connection encryption: prefer, require, or disable
+
+	// Upload caps in KiB/s; 0 means unlimited
+	MaxUploadRate        int            // across all torrents
+	TorrentMaxUploadRate int            // per model torrent
+	ModelUploadRates     map[string]int // per-model overrides, keyed by model name
+
+	// Which models to seed: all, pinned, recent, or list
+	Policy       string
+	Pinned       []string      // always seeded under the pinned and recent policies
+	Models       []string      // seeded under the list policy
+	RecentWindow time.Duration // how long a requested model stays seeded under the recent policy
+
+	// Newly pulled models get extra connection slots and no per-model upload
+	// cap for this long, so a first rollout isn't stuck behind the long tail
+	WarmupWindow time.Duration
+	WarmupConns  int
+
+	// Connection limits; 0 keeps the client's defaults
+	MaxConns           int // established connections per torrent
+	HalfOpenPerTorrent int // outgoing connection attempts in flight per torrent
+	MaxHalfOpen        int // outgoing connection attempts in flight overall
+}
+
+func newSeeder(config seederConfig, logger *logrus.Logger) (*Seeder, error) {
+	if !config.UTP && !config.TCP {
+		return nil, fmt.Errorf("seeder needs at least one of TCP or uTP enabled")
+	}
+
+	switch config.Policy {
+	case "all", "pinned", "recent", "list":
+	default:
+		return nil, fmt.Errorf("invalid seeding policy %q (want all, pinned, recent, or list)", config.Policy)
+	}
+
+	s := &Seeder{
+		torrents:  make(map[string]*torrent.Torrent),
+		limiters:  make(map[string]*rate.Limiter),
+		fetchers:  make(map[string]*rate.Limiter),
+		names:     make(map[string]string),
+		lastUsed:  make(map[string]time.Time),
+		external:  make(map[string]bool),
+		fetching:  make(map[string]bool),
+		warming:   make(map[string]bool),
+		adding:    make(map[string]bool),
+		announces: make(map[string]announceResult),
+		errors:    make(map[string]string),
+		uploaded:  make(map[clientDay]int64),
+		config:    config,
+		logger:    logger,
+	}
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.Seed = true
+	cfg.NoDHT = true // model torrents are private
+	cfg.ListenPort = config.ListenPort
+	cfg.DisablePEX = !config.PEX
+	cfg.DisableUTP = !config.UTP
+	cfg.DisableTCP = !config.TCP
+	cfg.Slogger = slog.New(&announceLog{
+		next:   slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}),
+		record: s.recordAnnounce,
+	})
+	cfg.Callbacks.PeerConnClosed = s.peerConnClosed
+	if config.MaxConns > 0 {
+		cfg.EstablishedConnsPerTorrent = config.MaxConns
+	}
+	if config.HalfOpenPerTorrent > 0 {
+		cfg.HalfOpenConnsPerTorrent = config.HalfOpenPerTorrent
+	}
+	if config.MaxHalfOpen > 0 {
+		cfg.TotalHalfOpenConns = config.MaxHalfOpen
+	}
+	if err := setEncryption(cfg, config.Encryption); err != nil {
+		return nil, err
+	}
+	// Always set, even when unlimited, so a reload can cap it
+	s.upload = rate.NewLimiter(rate.Inf, 0)
+	setUploadRate(s.upload, config.MaxUploadRate)
+	cfg.UploadRateLimiter = s.upload
+	files := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir: config.ModelsDir,
+		// Torrent paths are already relative to the models directory, so
+		// the torrent name ("models") isn't part of the on-disk path
+		FilePathMaker: func(opts storage.FilePathMakerOpts) string {
+			return filepath.Join(opts.File.BestPath()...)
+		},
+		PieceCompletion: storage.NewMapPieceCompletion(),
+		UsePartFiles:    g.Some(false),
+	})
+	cfg.DefaultStorage = rateLimitedStorage{files, s.limiter, s.fetchLimiter}
+
+	client, err := torrent.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start torrent client: %w", err)
+	}
+	s.client = client
+	s.conns = cfg.EstablishedConnsPerTorrent
+	return s, nil
+}
+
+// uploadRate returns the per-torrent upload cap for a model in KiB/s. The
+// caller holds mu.
+func (s *Seeder) uploadRate(modelName string) int {
+	if rate, ok := s.config.ModelUploadRates[modelName]; ok {
+		return rate
+	}
+	return s.config.TorrentMaxUploadRate
+}
+
+func (s *Seeder) limiter(infoHash string) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limiters[infoHash]
+}
+
+func (s *Seeder) fetchLimiter(infoHash string) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetchers[infoHash]
+}
+
+// setEncryption configures Message Stream Encryption for peer connections.
+// Sites whose IDS flags plaintext BitTorrent can require RC4 for the whole
+// stream; "prefer" still talks to clients that only speak plaintext.
+func setEncryption(cfg *torrent.ClientConfig, mode string) error {
+	preferRC4 := func(provided mse.CryptoMethod) mse.CryptoMethod {
+		if provided&mse.CryptoMethodRC4 != 0 {
+			return mse.CryptoMethodRC4
+		}
+		return provided & mse.CryptoMethodPlaintext
+	}
+
+	switch mode {
+	case "", "prefer":
+		cfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: true}
+		cfg.CryptoSelector = preferRC4
+	case "require":
+		cfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: true, RequirePreferred: true}
+		cfg.CryptoProvides = mse.CryptoMethodRC4
+		cfg.CryptoSelector = func(provided mse.CryptoMethod) mse.CryptoMethod {
+			return provided & mse.CryptoMethodRC4
+		}
+	case "disable":
+		cfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: false, RequirePreferred: true}
+	default:
+		return fmt.Errorf("invalid seeder encryption mode %q (want prefer, require, or disable)", mode)
+	}
+	return nil
+}
+
+// wants reports whether the seeding policy keeps a model seeded at startup.
+// Under the recent policy other models are only seeded once requested.
+func (s *Seeder) wants(model Model) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wantsLocked(model.Name)
+}
+
+func (s *Seeder) wantsLocked(name string) bool {
+	if s.seedOverride != nil {
+		switch s.seedOverride(name) {
+		case "always":
+			return true
+		case "never":
+			return false
+		}
+	}
+	switch s.config.Policy {
+	case "pinned", "recent":
+		return containsString(s.config.Pinned, name)
+	case "list":
+		return containsString(s.config.Models, name)
+	default:
+		return true
+	}
+}
+
+// requested records that a client fetched a model's torrent or announced it.
+// Under the recent policy this starts seeding the model on demand.
+func (s *Seeder) requested(model Model) {
+	s.mu.Lock()
+	s.lastUsed[model.InfoHash] = time.Now()
+	recent := s.config.Policy == "recent"
+	s.mu.Unlock()
+
+	if !recent || (s.seedOverride != nil && s.seedOverride(model.Name) == "never") {
+		return
+	}
+	if err := s.seed(model); err != nil {
+		s.logger.Warnf("Failed to seed %s: %v", model.Name, err)
+	}
+}
+
+// expireLoop stops seeding models nobody has requested within the recent
+// window, so a small VM doesn't keep hundreds of torrents open.
+func (s *Seeder) expireLoop() {
+	for range time.Tick(time.Minute) {
+		s.mu.Lock()
+		if s.config.Policy != "recent" {
+			s.mu.Unlock()
+			continue
+		}
+		cutoff := time.Now().Add(-s.config.RecentWindow)
+		for infoHash := range s.torrents {
+			name := s.names[infoHash]
+			if s.external[infoHash] || s.fetching[infoHash] || s.wantsLocked(name) || s.lastUsed[infoHash].After(cutoff) {
+				continue
+			}
+			s.dropLocked(infoHash)
+			s.logger.Infof("Stopped seeding %s (not requested in %s)", name, s.config.RecentWindow)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// reconfigure applies reloaded upload caps and seeding policy. Caps change on
+// the existing limiters, so active transfers pick them up right away; models
+// still warming up keep running uncapped. Models the new policy doesn't want
+// are dropped; the caller seeds the ones it now wants.
+func (s *Seeder) reconfigure(config seederConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.config.MaxUploadRate = config.MaxUploadRate
+	s.config.TorrentMaxUploadRate = config.TorrentMaxUploadRate
+	s.config.ModelUploadRates = config.ModelUploadRates
+	s.config.Policy = config.Policy
+	s.config.Pinned = config.Pinned
+	s.config.Models = config.Models
+	s.config.RecentWindow = config.RecentWindow
+
+	setUploadRate(s.upload, s.config.MaxUploadRate)
+	for infoHash, limiter := range s.limiters {
+		switch {
+		case s.warming[infoHash]:
+		case s.external[infoHash]:
+			setUploadRate(limiter, s.config.TorrentMaxUploadRate)
+		default:
+			setUploadRate(limiter, s.uploadRate(s.names[infoHash]))
+		}
+	}
+
+	cutoff := time.Now().Add(-s.config.RecentWindow)
+	for infoHash := range s.torrents {
+		name := s.names[infoHash]
+		if s.external[infoHash] || s.fetching[infoHash] || s.wantsLocked(name) {
+			continue
+		}
+		if s.config.Policy == "recent" && s.lastUsed[infoHash].After(cutoff) {
+			continue
+		}
+		s.dropLocked(infoHash)
+		s.logger.Infof("Stopped seeding %s (not wanted by the %s policy)", name, s.config.Policy)
+	}
+}
+
+// drop stops seeding a torrent and forgets everything recorded about it.
+func (s *Seeder) drop(infoHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropLocked(infoHash)
+}
+
+func (s *Seeder) dropLocked(infoHash string) {
+	if t, ok := s.torrents[infoHash]; ok {
+		t.Drop()
+	}
+	delete(s.torrents, infoHash)
+	delete(s.limiters, infoHash)
+	delete(s.fetchers, infoHash)
+	delete(s.names, infoHash)
+	delete(s.lastUsed, infoHash)
+	delete(s.external, infoHash)
+	delete(s.fetching, infoHash)
+	delete(s.warming, infoHash)
+	delete(s.announces, infoHash)
+	delete(s.errors, infoHash)
+}
+
+// seedCatalog starts seeding every catalog model the policy wants that isn't
+// seeded yet.
+func (s *Server) seedCatalog() {
+	if s.seeder == nil {
+		return
+	}
+	for _, model := range s.catalog() {
+		if model.InfoHash == "" || !s.seeder.wants(model) {
+			continue
+		}
+		if err := s.seeder.seed(model); err != nil {
+			s.logger.Warnf("Failed to seed %s: %v", model.Name, err)
+		}
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// seed adds a model's torrent to the client. Piece completion isn't persisted,
+// so the blobs are hashed in the background before they're offered to peers.
+func (s *Seeder) seed(model Model) error {
+	s.mu.Lock()
+	// The torrent queue and seedCatalog can both get here for one model
+	if _, ok := s.torrents[model.InfoHash]; ok || s.adding[model.InfoHash] {
+		s.mu.Unlock()
+		return nil
+	}
+	s.adding[model.InfoHash] = true
+	// The limiter must be in place before the client opens the torrent's
+	// storage, which looks it up without our lock held. It's set even when
+	// uploads are unlimited, so a reload can cap them.
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	setUploadRate(limiter, s.uploadRate(model.Name))
+	s.limiters[model.InfoHash] = limiter
+	warmup := s.config.WarmupWindow
+	s.mu.Unlock()
+
+	t, err := s.client.AddTorrentFromFile(model.TorrentFile)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.limiters, model.InfoHash)
+		delete(s.adding, model.InfoHash)
+		s.mu.Unlock()
+		return fmt.Errorf("failed to add torrent for %s: %w", model.Name, err)
+	}
+
+	s.mu.Lock()
+	s.torrents[model.InfoHash] = t
+	s.names[model.InfoHash] = model.Name
+	delete(s.adding, model.InfoHash)
+	s.mu.Unlock()
+
+	if remaining := warmup - time.Since(model.CreatedAt); remaining > 0 {
+		s.warmUp(model, t, limiter, remaining)
+	}
+
+	go s.verify(model.Name, model.InfoHash, t)
+	return nil
+}
+
+// seedExternal adds a torrent from the watch directory, whose data is stored
+// under dataDir the way any client would save it. External torrents get the
+// default per-torrent upload cap and are seeded regardless of policy.
+func (s *Seeder) seedExternal(ext ExternalTorrent, dataDir string) error {
+	mi, err := metainfo.LoadFromFile(ext.TorrentFile)
+	if err != nil {
+		return fmt.Errorf("failed to load torrent: %w", err)
+	}
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+	if err != nil {
+		return fmt.Errorf("failed to decode torrent: %w", err)
+	}
+
+	s.mu.Lock()
+	if _, ok := s.torrents[ext.InfoHash]; ok {
+		s.mu.Unlock()
+		return nil
+	}
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	setUploadRate(limiter, s.config.TorrentMaxUploadRate)
+	s.limiters[ext.InfoHash] = limiter
+	s.mu.Unlock()
+
+	files := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dataDir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+		UsePartFiles:    g.Some(false),
+	})
+	spec.Storage = rateLimitedStorage{files, s.limiter, s.fetchLimiter}
+
+	t, _, err := s.client.AddTorrentSpec(spec)
+	if err != nil {
+		return fmt.Errorf("failed to add torrent: %w", err)
+	}
+
+	s.mu.Lock()
+	s.torrents[ext.InfoHash] = t
+	s.names[ext.InfoHash] = ext.Name
+	s.external[ext.InfoHash] = true
+	s.mu.Unlock()
+
+	go s.verify(ext.Name, ext.InfoHash, t)
+	return nil
+}
+
+// download fetches a model into the models directory from a torrent made by
+// another lancache, blocking until every piece is on disk. The download is
+// capped at maxRate KiB/s (0 for unlimited) and paused whenever open reports
+// false. The torrent is dropped afterwards; callers seed the model from its
+// local .torrent. A download that receives nothing for downloadStallTimeout,
+// say because no peer has the data, is given up so the caller can move on.
+func (s *Seeder) download(modelName string, data []byte, maxRate int, open func() bool) error {
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to load torrent: %w", err)
+	}
+	infoHash := mi.HashInfoBytes().HexString()
+
+	s.mu.Lock()
+	if _, ok := s.torrents[infoHash]; ok {
+		s.mu.Unlock()
+		return fmt.Errorf("torrent %s is already active", infoHash)
+	}
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	setUploadRate(limiter, s.uploadRate(modelName))
+	s.limiters[infoHash] = limiter
+	if limiter := newUploadLimiter(maxRate); limiter != nil {
+		s.fetchers[infoHash] = limiter
+	}
+	s.mu.Unlock()
+	// Dropping also removes the caps set above if the torrent isn't added
+	defer s.drop(infoHash)
+
+	t, err := s.client.AddTorrent(mi)
+	if err != nil {
+		return fmt.Errorf("failed to add torrent: %w", err)
+	}
+
+	// Listed while downloading, so progress shows in /api/seeder/torrents
+	s.mu.Lock()
+	s.torrents[infoHash] = t
+	s.names[infoHash] = modelName
+	s.fetching[infoHash] = true
+	s.mu.Unlock()
+
+	select {
+	case <-t.GotInfo():
+	case <-t.Closed():
+		return fmt.Errorf("torrent closed before download started")
+	case <-time.After(downloadStallTimeout):
+		return fmt.Errorf("no metadata after %v", downloadStallTimeout)
+	}
+	t.DownloadAll()
+
+	check := time.NewTicker(time.Minute)
+	defer check.Stop()
+	paused := false
+	completed, progressed := t.BytesCompleted(), time.Now()
+	for {
+		select {
+		case <-t.Complete().On():
+			return nil
+		case <-t.Closed():
+			return fmt.Errorf("torrent closed before download finished")
+		case <-check.C:
+			// Time spent paused outside the window doesn't count as a stall
+			if done := t.BytesCompleted(); done > completed || paused {
+				completed, progressed = done, time.Now()
+			} else if time.Since(progressed) > downloadStallTimeout {
+				return fmt.Errorf("no progress for %v at %s of %s", downloadStallTimeout, formatSize(done), formatSize(t.Length()))
+			}
+			if open() == !paused {
+				continue
+			}
+			paused = !paused
+			if paused {
+				t.DisallowDataDownload()
+				s.logger.Infof("Paused download of %s outside its replication window", modelName)
+			} else {
+				t.AllowDataDownload()
+				s.logger.Infof("Resumed download of %s", modelName)
+			}
+		}
+	}
+}
+
+// downloadStallTimeout is how long download waits for data before giving up.
+const downloadStallTimeout = 10 * time.Minute
+
+// partialModels lists the models still being mirrored and how far along
+// they are.
+func (s *Seeder) partialModels() []PartialModel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var partial []PartialModel
+	for infoHash := range s.fetching {
+		t := s.torrents[infoHash]
+		model := PartialModel{Name: s.names[infoHash]}
+		if t.Info() != nil {
+			model.Size = t.Length()
+			model.Completed = t.BytesCompleted()
+		}
+		partial = append(partial, model)
+	}
+	return partial
+}
+
+// verify hashes a torrent's data before it's offered to peers.
+func (s *Seeder) verify(name, infoHash string, t *torrent.Torrent) {
+	if err := t.VerifyData(); err != nil {
+		s.logger.Warnf("Failed to verify %s: %v", name, err)
+		s.recordError(infoHash, err)
+		if s.verifyFailed != nil {
+			s.verifyFailed(name, err)
+		}
+		return
+	}
+	s.logger.Infof("Seeding %s (%s)", name, infoHash)
+}
+
+// warmUp lifts a new model's per-model upload cap and raises its connection
+// limit, restoring both once the warm-up window has passed.
+func (s *Seeder) warmUp(model Model, t *torrent.Torrent, limiter *rate.Limiter, remaining time.Duration) {
+	s.mu.Lock()
+	s.warming[model.InfoHash] = true
+	s.mu.Unlock()
+	limiter.SetLimit(rate.Inf)
+	if s.config.WarmupConns > s.conns {
+		t.SetMaxEstablishedConns(s.config.WarmupConns)
+	}
+	s.logger.Infof("Warming up %s for %s", model.Name, remaining.Round(time.Second))
+
+	time.AfterFunc(remaining, func() {
+		if current, ok := s.torrent(model.InfoHash); !ok || current != t {
+			return
+		}
+		// The cap may have been changed by a reload in the meantime
+		s.mu.Lock()
+		delete(s.warming, model.InfoHash)
+		capped := s.uploadRate(model.Name)
+		s.mu.Unlock()
+		setUploadRate(limiter, capped)
+		t.SetMaxEstablishedConns(s.conns)
+		s.logger.Infof("Warm-up finished for %s", model.Name)
+	})
+}
+
+// torrent returns the seeded torrent for a hex info-hash.
+func (s *Seeder) torrent(infoHash string) (*torrent.Torrent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.torrents[infoHash]
+	return t, ok
+}
+
+// infoHashes lists the hex info-hashes of all seeded torrents.
+func (s *Seeder) infoHashes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hashes := make([]string, 0, len(s.torrents))
+	for infoHash := range s.torrents {
+		hashes = append(hashes, infoHash)
+	}
+	return hashes
+}
+
+func (s *Seeder) Close() {
+	for _, err := range s.client.Close() {
+		s.logger.Warnf("Error closing torrent client: %v", err)
+	}
+}
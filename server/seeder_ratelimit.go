@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"golang.org/x/time/rate"
+)
+
+// The torrent client only has client-wide rate limiters, so per-model caps
+// are applied in storage: uploads read piece data through ReadAt, which waits
+// on the torrent's upload limiter, and downloaded chunks are written through
+// WriteAt, which waits on its download limiter. Hash checks go through WriteTo
+// and aren't throttled.
+type rateLimitedStorage struct {
+	storage.ClientImpl
+	limiter         func(infoHash string) *rate.Limiter
+	downloadLimiter func(infoHash string) *rate.Limiter
+}
+
+type rateLimitedPiece struct {
+	storage.PieceImpl
+	limiter         *rate.Limiter // nil when uploads aren't capped
+	downloadLimiter *rate.Limiter // nil when downloads aren't capped
+}
+
+func (s rateLimitedStorage) OpenTorrent(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	t, err := s.ClientImpl.OpenTorrent(ctx, info, infoHash)
+	if err != nil {
+		return t, err
+	}
+
+	limiter := s.limiter(infoHash.HexString())
+	downloadLimiter := s.downloadLimiter(infoHash.HexString())
+	if limiter == nil && downloadLimiter == nil {
+		return t, nil
+	}
+
+	piece := t.Piece
+	t.Piece = func(p metainfo.Piece) storage.PieceImpl {
+		return rateLimitedPiece{piece(p), limiter, downloadLimiter}
+	}
+	return t, nil
+}
+
+func (p rateLimitedPiece) ReadAt(b []byte, off int64) (int, error) {
+	if p.limiter != nil {
+		if err := p.limiter.WaitN(context.Background(), len(b)); err != nil {
+			return 0, err
+		}
+	}
+	return p.PieceImpl.ReadAt(b, off)
+}
+
+func (p rateLimitedPiece) WriteAt(b []byte, off int64) (int, error) {
+	if p.downloadLimiter != nil {
+		if err := p.downloadLimiter.WaitN(context.Background(), len(b)); err != nil {
+			return 0, err
+		}
+	}
+	return p.PieceImpl.WriteAt(b, off)
+}
+
+// WriteTo is used for hashing; file storage pieces implement it directly.
+func (p rateLimitedPiece) WriteTo(w io.Writer) (int64, error) {
+	return p.PieceImpl.(io.WriterTo).WriteTo(w)
+}
+
+// newUploadLimiter returns a limiter for a KiB/s rate, or nil when unlimited.
+// The burst covers a peer's largest block request even at very low rates.
+// Download caps use the same limiter shape.
+func newUploadLimiter(kibPerSec int) *rate.Limiter {
+	if kibPerSec <= 0 {
+		return nil
+	}
+	burst := kibPerSec * 1024
+	if burst < 1<<18 {
+		burst = 1 << 18
+	}
+	return rate.NewLimiter(rate.Limit(kibPerSec*1024), burst)
+}
+
+// setUploadRate changes a limiter's rate in KiB/s, lifting it when kibPerSec
+// is 0, with the same burst as newUploadLimiter.
+func setUploadRate(limiter *rate.Limiter, kibPerSec int) {
+	if kibPerSec <= 0 {
+		limiter.SetLimit(rate.Inf)
+		return
+	}
+	burst := kibPerSec * 1024
+	if burst < 1<<18 {
+		burst = 1 << 18
+	}
+	limiter.SetBurst(burst)
+	limiter.SetLimit(rate.Limit(kibPerSec * 1024))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// SeederTorrentStatus is the embedded seeder's view of one model torrent.
+type SeederTorrentStatus struct {
+	Model        string          `json:"model"`
+	InfoHash     string          `json:"info_hash"`
+	Size         int64           `json:"size"`
+	Verified     int64           `json:"verified"` // bytes hashed and available to peers
+	Peers        int             `json:"peers"`
+	ActivePeers  int             `json:"active_peers"`
+	Seeders      int             `json:"seeders"`
+	HalfOpen     int             `json:"half_open"`
+	Uploaded     int64           `json:"uploaded"`
+	Ratio        float64         `json:"ratio"`
+	LastAnnounce *announceResult `json:"last_announce,omitempty"`
+	Error        string          `json:"error,omitempty"`
+}
+
+type announceResult struct {
+	Tracker string    `json:"tracker"`
+	Time    time.Time `json:"time"`
+	Peers   int       `json:"peers"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// status reports every seeded torrent, sorted by model name.
+func (s *Seeder) status() []SeederTorrentStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]SeederTorrentStatus, 0, len(s.torrents))
+	for infoHash, t := range s.torrents {
+		status := SeederTorrentStatus{
+			Model:    s.names[infoHash],
+			InfoHash: infoHash,
+			Error:    s.errors[infoHash],
+		}
+		if announce, ok := s.announces[infoHash]; ok {
+			status.LastAnnounce = &announce
+		}
+		if t.Info() != nil {
+			status.Size = t.Length()
+			status.Verified = t.BytesCompleted()
+		}
+
+		stats := t.Stats()
+		status.Peers = stats.TotalPeers
+		status.ActivePeers = stats.ActivePeers
+		status.Seeders = stats.ConnectedSeeders
+		status.HalfOpen = stats.HalfOpenPeers
+		status.Uploaded = stats.BytesWrittenData.Int64()
+		if status.Size > 0 {
+			status.Ratio = float64(status.Uploaded) / float64(status.Size)
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Model < statuses[j].Model
+	})
+	return statuses
+}
+
+// getSeederTorrents serves the embedded seeder's per-torrent state, the first
+// place to look when clients report slow downloads.
+func (s *Server) getSeederTorrents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.seeder.status())
+}
+
+// recordAnnounce keeps results even for torrents seed hasn't registered yet,
+// since the first announce can finish before AddTorrentFromFile returns.
+func (s *Seeder) recordAnnounce(infoHash string, result announceResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.announces[infoHash] = result
+}
+
+func (s *Seeder) recordError(infoHash string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.torrents[infoHash]; ok {
+		s.errors[infoHash] = err.Error()
+	}
+}
+
+// announceLog picks tracker announce results out of the torrent client's log,
+// the only place it exposes them for HTTP and UDP trackers. Records are passed
+// on to next, which decides what actually gets printed.
+type announceLog struct {
+	next   slog.Handler
+	attrs  map[string]string // attributes added with With, keyed by dotted group path
+	group  string
+	record func(infoHash string, result announceResult)
+}
+
+func (h *announceLog) Enabled(ctx context.Context, level slog.Level) bool {
+	return true
+}
+
+func (h *announceLog) Handle(ctx context.Context, r slog.Record) error {
+	if r.Message == "announce failed" || r.Message == "announce returned" {
+		result := announceResult{Tracker: h.attrs["urlKey"], Time: r.Time}
+		r.Attrs(func(a slog.Attr) bool {
+			switch a.Key {
+			case "err":
+				result.Error = a.Value.Resolve().String()
+			case "numPeers":
+				result.Peers = int(a.Value.Resolve().Int64())
+			}
+			return true
+		})
+		if infoHash := h.attrs["torrent.ih"]; infoHash != "" {
+			h.record(infoHash, result)
+		}
+	}
+
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *announceLog) WithAttrs(attrs []slog.Attr) slog.Handler {
+	copied := *h
+	copied.next = h.next.WithAttrs(attrs)
+	copied.attrs = make(map[string]string, len(h.attrs)+len(attrs))
+	for k, v := range h.attrs {
+		copied.attrs[k] = v
+	}
+	for _, a := range attrs {
+		flattenAttr(copied.attrs, h.group, a)
+	}
+	return &copied
+}
+
+func (h *announceLog) WithGroup(name string) slog.Handler {
+	copied := *h
+	copied.next = h.next.WithGroup(name)
+	copied.group = h.group + name + "."
+	return &copied
+}
+
+// flattenAttr doesn't resolve lazy values: the client's torrent name valuer
+// takes locks that may already be held when the logger is derived.
+func flattenAttr(dst map[string]string, prefix string, a slog.Attr) {
+	if a.Value.Kind() == slog.KindGroup {
+		for _, member := range a.Value.Group() {
+			flattenAttr(dst, prefix+a.Key+".", member)
+		}
+		return
+	}
+	if a.Value.Kind() != slog.KindLogValuer {
+		dst[prefix+a.Key] = a.Value.String()
+	}
+}
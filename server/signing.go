@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ScriptSigningSettings control the minisign signatures served next to the
+// install scripts.
+type ScriptSigningSettings struct {
+	Enabled bool   `mapstructure:"enabled"`
+	KeyFile string `mapstructure:"key_file"` // PEM Ed25519 private key; default <state_dir>/script-signing.key, created if missing
+}
+
+// scriptSigner signs served scripts in minisign's format, so clients can
+// check them with `minisign -V` against the server's public key.
+type scriptSigner struct {
+	key   ed25519.PrivateKey
+	keyID [8]byte
+}
+
+// loadScriptSigner reads the signing key, generating one on first start.
+func loadScriptSigner(path string) (*scriptSigner, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createScriptSigner(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM key found", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return newScriptSigner(key), nil
+}
+
+func createScriptSigner(path string) (*scriptSigner, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	return newScriptSigner(key), nil
+}
+
+// newScriptSigner derives the minisign key ID from the public key, so it
+// stays the same for as long as the key does.
+func newScriptSigner(key ed25519.PrivateKey) *scriptSigner {
+	signer := &scriptSigner{key: key}
+	sum := blake2b.Sum256(key.Public().(ed25519.PublicKey))
+	copy(signer.keyID[:], sum[:8])
+	return signer
+}
+
+// KeyID is the key ID as minisign prints it.
+func (sg *scriptSigner) KeyID() string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(sg.keyID[:]))
+}
+
+// PublicKey is the contents of a minisign public key file.
+func (sg *scriptSigner) PublicKey() string {
+	raw := append([]byte("Ed"), sg.keyID[:]...)
+	raw = append(raw, sg.key.Public().(ed25519.PublicKey)...)
+	return fmt.Sprintf("untrusted comment: minisign public key %s\n%s\n", sg.KeyID(), base64.StdEncoding.EncodeToString(raw))
+}
+
+// sign returns a minisign signature file for data: a signature of its
+// BLAKE2b-512 hash, and one over that and the trusted comment.
+func (sg *scriptSigner) sign(data []byte, name string) string {
+	hash := blake2b.Sum512(data)
+	signature := ed25519.Sign(sg.key, hash[:])
+	trusted := fmt.Sprintf("timestamp:%d\tfile:%s\thashed", time.Now().Unix(), name)
+	global := ed25519.Sign(sg.key, append(append([]byte(nil), signature...), trusted...))
+
+	raw := append([]byte("ED"), sg.keyID[:]...)
+	raw = append(raw, signature...)
+	return fmt.Sprintf("untrusted comment: signature from ollama-bt-lancache key %s\n%s\ntrusted comment: %s\n%s\n",
+		sg.KeyID(), base64.StdEncoding.EncodeToString(raw), trusted, base64.StdEncoding.EncodeToString(global))
+}
+
+// serveSigned writes a script, or its minisign signature when the request is
+// for <script>.minisig. Scripts are rendered per request, so the signature is
+// made over the same rendering the client gets from the script's own URL.
+func (s *Server) serveSigned(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	if strings.HasSuffix(r.URL.Path, ".minisig") {
+		if s.signer == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+name+".minisig\"")
+		w.Write([]byte(s.signer.sign(body, name)))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+name+"\"")
+	w.Write(body)
+}
+
+func (s *Server) servePublicKey(w http.ResponseWriter, r *http.Request) {
+	if s.signer == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"minisign.pub\"")
+	w.Write([]byte(s.signer.PublicKey()))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsEnabled reports whether the HTTPS listener should run, either with a
+// static certificate and key or with certificates obtained over ACME.
+func (s *Server) tlsEnabled() bool {
+	return (s.tlsCertFile != "" && s.tlsKeyFile != "") || s.acmeEnabled()
+}
+
+func (s *Server) acmeEnabled() bool {
+	return len(s.acmeDomains) > 0
+}
+
+// newACMEManager builds an autocert manager restricted to the configured
+// domains. A custom directory URL allows internal ACME servers (step-ca,
+// Smallstep, etc.) in place of Let's Encrypt.
+func (s *Server) newACMEManager() *autocert.Manager {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(s.acmeDomains...),
+		Cache:      autocert.DirCache(s.acmeCacheDir),
+		Email:      s.acmeEmail,
+	}
+	if s.acmeDirURL != "" {
+		m.Client = &acme.Client{DirectoryURL: s.acmeDirURL}
+	}
+	return m
+}
+
+func (s *Server) startTLSServer(ctx context.Context, handler http.Handler) {
+	s.logger.Infof("Starting TLS server on %s:%s", s.serverIP, s.tlsPort)
+
+	server := &http.Server{Addr: ":" + s.tlsPort, Handler: handler}
+	if s.acmeManager != nil {
+		s.logger.Infof("Using ACME certificates for %v (cache: %s)", s.acmeDomains, s.acmeCacheDir)
+		server.TLSConfig = s.acmeManager.TLSConfig()
+		s.serveUntil(ctx, server, func() error { return server.ListenAndServeTLS("", "") })
+		return
+	}
+
+	s.serveUntil(ctx, server, func() error { return server.ListenAndServeTLS(s.tlsCertFile, s.tlsKeyFile) })
+}
+
+// redirectToHTTPS sends plain HTTP clients to the TLS listener on the same
+// host, keeping the path and query intact. 308 is used so non-GET requests
+// keep their method and body.
+func (s *Server) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if s.tlsPort != "443" {
+		host = net.JoinHostPort(host, s.tlsPort)
+	}
+
+	target := "https://" + host + r.URL.RequestURI()
+	http.Redirect(w, r, target, http.StatusPermanentRedirect)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// torrentCache keeps recently served .torrent files in memory, so a rollout
+// where hundreds of clients fetch the same torrent doesn't read it from disk
+// each time. The least recently used files go once they add up to more than
+// limit bytes.
+type torrentCache struct {
+	mu      sync.Mutex
+	limit   int64
+	used    int64
+	order   *list.List // of *cachedTorrent, most recently used first
+	entries map[string]*list.Element
+}
+
+// cachedTorrent is one version of a .torrent file.
+type cachedTorrent struct {
+	path    string
+	modTime time.Time
+	data    []byte
+	etag    string
+}
+
+// newTorrentCache returns a cache holding up to limit bytes, or nil (every
+// torrent read from disk) when limit is 0.
+func newTorrentCache(limit int64) *torrentCache {
+	if limit <= 0 {
+		return nil
+	}
+	return &torrentCache{limit: limit, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns a torrent file, from memory while its mtime and size match
+// the cached copy. Torrents are replaced by renaming over them, so a changed
+// file always has a new mtime.
+func (c *torrentCache) get(path string) (*cachedTorrent, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		c.mu.Lock()
+		if elem, ok := c.entries[path]; ok {
+			entry := elem.Value.(*cachedTorrent)
+			if entry.modTime.Equal(info.ModTime()) && int64(len(entry.data)) == info.Size() {
+				c.order.MoveToFront(elem)
+				c.mu.Unlock()
+				return entry, nil
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entry := &cachedTorrent{path: path, modTime: info.ModTime(), data: data, etag: torrentETag(data)}
+	if c != nil {
+		c.add(entry)
+	}
+	return entry, nil
+}
+
+func (c *torrentCache) add(entry *cachedTorrent) {
+	size := int64(len(entry.data))
+	if size > c.limit {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[entry.path]; ok {
+		c.remove(elem)
+	}
+	c.entries[entry.path] = c.order.PushFront(entry)
+	c.used += size
+	for c.used > c.limit {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *torrentCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*cachedTorrent)
+	delete(c.entries, entry.path)
+	c.used -= int64(len(entry.data))
+}
+
+// torrentETag is a strong ETag for the bytes of a torrent as served.
+func torrentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("\"%x\"", sum[:16])
+}
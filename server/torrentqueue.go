@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// TorrentStatus values of a complete model in the catalog.
+const (
+	torrentPending = "pending" // waiting to be hashed, or being hashed
+	torrentReady   = "ready"
+	torrentFailed  = "failed"
+)
+
+// queueTorrents has the torrents of the named catalog models created in the
+// background. Discovery lists the models as pending straight away, so the
+// web UI and API are up within a second of starting even when every model
+// needs hashing. A model already queued isn't queued again.
+func (s *Server) queueTorrents(names []string) {
+	s.hashMu.Lock()
+	defer s.hashMu.Unlock()
+	if s.hashQueued == nil {
+		s.hashQueued = make(map[string]bool)
+	}
+	for _, name := range names {
+		if !s.hashQueued[name] {
+			s.hashQueued[name] = true
+			s.hashQueue = append(s.hashQueue, name)
+		}
+	}
+	if !s.hashing && len(s.hashQueue) > 0 {
+		s.hashing = true
+		go s.hashWorker()
+	}
+}
+
+// hashWorker creates the queued torrents in order, one at a time: each is
+// already hashed in parallel, and one at a time bounds the memory used.
+// Bundles wait for the models, which clients are more likely waiting for.
+func (s *Server) hashWorker() {
+	for {
+		s.hashMu.Lock()
+		if len(s.hashQueue) == 0 {
+			if len(s.bundleQueue) == 0 {
+				s.hashing = false
+				s.hashMu.Unlock()
+				return
+			}
+			bundle := s.bundleQueue[0]
+			s.bundleQueue = s.bundleQueue[1:]
+			s.hashMu.Unlock()
+
+			s.createQueuedBundle(bundle)
+			continue
+		}
+		name := s.hashQueue[0]
+		s.hashQueue = s.hashQueue[1:]
+		s.hashMu.Unlock()
+
+		s.createQueuedTorrent(name)
+
+		s.hashMu.Lock()
+		delete(s.hashQueued, name)
+		s.hashMu.Unlock()
+
+		// A rescan while this was hashing lists the model as pending, and
+		// may have replaced the catalog after it was marked ready
+		if model, ok := s.modelByName(name); ok && model.TorrentStatus == torrentPending && !model.Incomplete {
+			s.queueTorrents([]string{name})
+		}
+	}
+}
+
+// createQueuedTorrent creates a model's torrent and marks it ready in the
+// catalog, or failed. The embedded seeder picks it up as soon as it's ready.
+func (s *Server) createQueuedTorrent(name string) {
+	model, ok := s.modelByName(name)
+	if !ok || model.Incomplete || model.TorrentStatus == torrentReady {
+		return
+	}
+
+	status := torrentReady
+	torrentFile, err := s.generateModelTorrentFile(&model)
+	var infoHash string
+	if err == nil {
+		infoHash, err = torrentInfoHash(torrentFile)
+	}
+	if err != nil {
+		s.logger.Errorf("Failed to create torrent for %s: %v", name, err)
+		status = torrentFailed
+	}
+
+	// The catalog may have been rediscovered meanwhile; update whatever
+	// entry it has now
+	if updated, ok := s.updateModel(name, func(m *Model) {
+		m.TorrentFile = torrentFile
+		m.InfoHash = infoHash
+		m.TorrentStatus = status
+	}); ok {
+		model = updated
+	}
+
+	if status == torrentReady {
+		s.recordVersion(model)
+		s.notify(eventModelPublished, fmt.Sprintf("%s (%s) is ready to download: %s/api/models/%s/torrent", name, formatSize(model.Size), s.baseURL(), url.PathEscape(name)))
+	}
+	if status == torrentReady && s.seeder != nil && s.seeder.wants(model) {
+		if err := s.seeder.seed(model); err != nil {
+			s.logger.Warnf("Failed to seed %s: %v", model.Name, err)
+		}
+	}
+}
+
+// torrentUnavailable answers a request for a torrent that isn't created
+// yet, or couldn't be. Clients that poll retry after Retry-After.
+func (s *Server) torrentUnavailable(w http.ResponseWriter, model Model) {
+	w.Header().Set("Content-Type", "application/json")
+	if model.TorrentStatus == torrentPending {
+		w.Header().Set("Retry-After", "30")
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":          "torrent is not available yet",
+		"torrent_status": model.TorrentStatus,
+	})
+}
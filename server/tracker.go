@@ -0,0 +1,605 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// Tracker is a small HTTP BitTorrent tracker served from the main listener,
+// so a LAN deployment doesn't need a separate privtracker process.
+type Tracker struct {
+	mu        sync.Mutex
+	swarms    map[string]*swarm // keyed by hex info-hash
+	config    trackerConfig
+	statePath string
+	known     func(infoHash string) bool // reports whether a hex info-hash is in the catalog
+	announced func(infoHash string)      // called for every accepted announce
+	completed func(c Completion)         // called for every counted completed event
+	leader    func() bool                // reports whether this server may write the state file
+	logger    *logrus.Logger
+}
+
+type trackerConfig struct {
+	StateDir       string
+	Interval       time.Duration
+	MinInterval    time.Duration     // clients must not re-announce more often than this
+	PeerTimeout    time.Duration     // peers silent for longer are dropped from the swarm
+	DefaultNumWant int               // peers returned when the client doesn't send numwant
+	MaxNumWant     int               // upper bound on peers returned per announce
+	Whitelist      bool              // only track info-hashes present in the catalog
+	Passkeys       map[string]string // passkey -> registered client name
+	RequirePasskey bool              // reject announces without a valid /announce/<key>
+}
+
+type swarm struct {
+	Peers          map[string]*trackerPeer `json:"peers"` // keyed by hex peer_id
+	Completed      int64                   `json:"completed"`
+	CompletedByDay map[string]int64        `json:"completed_by_day,omitempty"` // keyed by YYYY-MM-DD (UTC)
+}
+
+// Completion is a peer reporting that it finished downloading a torrent,
+// with the swarm as it stands after the announce.
+type Completion struct {
+	InfoHash  string    `json:"info_hash"`
+	PeerID    string    `json:"peer_id"`
+	Client    string    `json:"client,omitempty"`
+	IP        string    `json:"ip"`
+	Completed int64     `json:"completed"` // the torrent's completions so far
+	Seeders   int       `json:"seeders"`
+	Leechers  int       `json:"leechers"`
+	Time      time.Time `json:"time"`
+}
+
+type trackerPeer struct {
+	PeerID   string    `json:"peer_id"`          // hex, raw IDs aren't valid JSON strings
+	Client   string    `json:"client,omitempty"` // registered client name, when a passkey was used
+	IP       string    `json:"ip,omitempty"`     // IPv4 endpoint
+	IP6      string    `json:"ip6,omitempty"`    // IPv6 endpoint (BEP 7)
+	Port     int       `json:"port"`
+	Left     int64     `json:"left"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Bencoded tracker responses (BEP 3)
+type announceResponse struct {
+	Interval    int64       `bencode:"interval"`
+	MinInterval int64       `bencode:"min interval,omitempty"`
+	Complete    int         `bencode:"complete"`
+	Incomplete  int         `bencode:"incomplete"`
+	Peers       interface{} `bencode:"peers"` // compact string (BEP 23) or []announcePeer
+	Peers6      string      `bencode:"peers6,omitempty"`
+}
+
+type announcePeer struct {
+	PeerID string `bencode:"peer id,omitempty"`
+	IP     string `bencode:"ip"`
+	Port   int    `bencode:"port"`
+}
+
+type scrapeResponse struct {
+	Files map[string]scrapeFile `bencode:"files"`
+}
+
+type scrapeFile struct {
+	Complete   int   `bencode:"complete"`
+	Downloaded int64 `bencode:"downloaded"`
+	Incomplete int   `bencode:"incomplete"`
+}
+
+type trackerFailure struct {
+	FailureReason string `bencode:"failure reason"`
+}
+
+func newTracker(config trackerConfig, logger *logrus.Logger) *Tracker {
+	t := &Tracker{
+		swarms:    make(map[string]*swarm),
+		config:    config,
+		statePath: filepath.Join(config.StateDir, "tracker.json"),
+		logger:    logger,
+	}
+
+	if err := t.load(); err != nil {
+		logger.Warnf("Failed to load tracker state: %v", err)
+	}
+	return t
+}
+
+// peerTimeout is how long a peer stays in the swarm without re-announcing.
+func (t *Tracker) peerTimeout() time.Duration {
+	if t.config.PeerTimeout > 0 {
+		return t.config.PeerTimeout
+	}
+	return 2 * t.config.Interval
+}
+
+// numWant returns how many peers to hand back for an announce, honoring the
+// client's numwant within the configured cap.
+func (t *Tracker) numWant(r *http.Request) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("numwant"))
+	if err != nil || n < 0 {
+		n = t.config.DefaultNumWant
+	}
+	if n > t.config.MaxNumWant {
+		n = t.config.MaxNumWant
+	}
+	return n
+}
+
+// load restores swarms saved by a previous run. Peers that have gone quiet
+// for longer than the timeout are dropped; completion counters are kept.
+func (t *Tracker) load() error {
+	data, err := os.ReadFile(t.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var swarms map[string]*swarm
+	if err := json.Unmarshal(data, &swarms); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", t.statePath, err)
+	}
+
+	cutoff := time.Now().Add(-t.peerTimeout())
+	for infoHash, sw := range swarms {
+		if sw.Peers == nil {
+			sw.Peers = make(map[string]*trackerPeer)
+		}
+		for id, p := range sw.Peers {
+			if p.LastSeen.Before(cutoff) {
+				delete(sw.Peers, id)
+			}
+		}
+		t.swarms[infoHash] = sw
+	}
+
+	t.logger.Infof("Restored tracker state for %d swarms", len(t.swarms))
+	return nil
+}
+
+// save writes the swarm state via a temp file so a crash mid-write never
+// leaves a truncated state file behind.
+func (t *Tracker) save() error {
+	t.mu.Lock()
+	data, err := json.Marshal(t.swarms)
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.statePath), 0755); err != nil {
+		return err
+	}
+	tmp := t.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.statePath)
+}
+
+func (t *Tracker) persistLoop(every time.Duration) {
+	for range time.Tick(every) {
+		// In a high-availability pair only the leader writes the shared state file
+		if t.leader != nil && !t.leader() {
+			continue
+		}
+		if err := t.save(); err != nil {
+			t.logger.Warnf("Failed to save tracker state: %v", err)
+		}
+	}
+}
+
+// reapLoop periodically drops peers that stopped announcing without sending
+// event=stopped, such as laptops that left the network.
+func (t *Tracker) reapLoop() {
+	every := t.peerTimeout() / 2
+	if every < 30*time.Second {
+		every = 30 * time.Second
+	}
+	for range time.Tick(every) {
+		if removed := t.reap(); removed > 0 {
+			t.logger.Debugf("Tracker reaped %d stale peers", removed)
+		}
+	}
+}
+
+func (t *Tracker) reap() int {
+	cutoff := time.Now().Add(-t.peerTimeout())
+	removed := 0
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for infoHash, sw := range t.swarms {
+		for id, p := range sw.Peers {
+			if p.LastSeen.Before(cutoff) {
+				delete(sw.Peers, id)
+				removed++
+			}
+		}
+		// Keep empty swarms that carry completion history
+		if len(sw.Peers) == 0 && sw.Completed == 0 {
+			delete(t.swarms, infoHash)
+		}
+	}
+	return removed
+}
+
+// authorize checks the optional passkey path segment and returns the name of
+// the registered client it belongs to.
+func (t *Tracker) authorize(r *http.Request) (string, bool) {
+	key := mux.Vars(r)["key"]
+	if key == "" {
+		return "", !t.config.RequirePasskey
+	}
+	client, ok := t.config.Passkeys[key]
+	return client, ok
+}
+
+func (t *Tracker) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	client, ok := t.authorize(r)
+	if !ok {
+		t.fail(w, "invalid passkey")
+		return
+	}
+
+	infoHash := q.Get("info_hash")
+	peerID := q.Get("peer_id")
+	if len(infoHash) != 20 || len(peerID) != 20 {
+		t.fail(w, "invalid info_hash or peer_id")
+		return
+	}
+
+	port, err := strconv.Atoi(q.Get("port"))
+	if err != nil || port <= 0 || port > 65535 {
+		t.fail(w, "invalid port")
+		return
+	}
+	left, _ := strconv.ParseInt(q.Get("left"), 10, 64)
+
+	// Dual-stack clients may report both families; explicit parameters
+	// override the address the request arrived from
+	peer := &trackerPeer{Client: client, Port: port, Left: left, LastSeen: time.Now()}
+	remoteIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+	for _, addr := range []string{remoteIP, q.Get("ip"), q.Get("ipv4"), q.Get("ipv6")} {
+		peer.setAddr(addr)
+	}
+
+	key := hex.EncodeToString([]byte(infoHash))
+	if t.config.Whitelist && t.known != nil && !t.known(key) {
+		t.fail(w, "unregistered torrent")
+		return
+	}
+	if t.announced != nil {
+		t.announced(key)
+	}
+
+	id := hex.EncodeToString([]byte(peerID))
+	peer.PeerID = id
+	event := q.Get("event")
+
+	t.mu.Lock()
+	sw, ok := t.swarms[key]
+	if !ok {
+		sw = &swarm{Peers: make(map[string]*trackerPeer)}
+		t.swarms[key] = sw
+	}
+
+	// A peer that was already seeding can't complete again; some clients
+	// resend the event after a restart
+	completed := false
+	if event == "completed" {
+		if prev, ok := sw.Peers[id]; !ok || prev.Left != 0 {
+			sw.recordCompletion(time.Now())
+			completed = true
+		}
+	}
+	if event == "stopped" {
+		delete(sw.Peers, id)
+	} else {
+		sw.Peers[id] = peer
+	}
+
+	resp := announceResponse{
+		Interval:    int64(t.config.Interval.Seconds()),
+		MinInterval: int64(t.config.MinInterval.Seconds()),
+	}
+	cutoff := time.Now().Add(-t.peerTimeout())
+	var candidates []*trackerPeer
+	for pid, p := range sw.Peers {
+		if p.LastSeen.Before(cutoff) {
+			continue
+		}
+		if p.Left == 0 {
+			resp.Complete++
+		} else {
+			resp.Incomplete++
+		}
+		// Seeds have nothing to gain from other seeds
+		if pid == id || (left == 0 && p.Left == 0) {
+			continue
+		}
+		candidates = append(candidates, p)
+	}
+	total := sw.Completed
+	t.mu.Unlock()
+
+	if completed && t.completed != nil {
+		ip := peer.IP
+		if ip == "" {
+			ip = peer.IP6
+		}
+		t.completed(Completion{
+			InfoHash:  key,
+			PeerID:    id,
+			Client:    client,
+			IP:        ip,
+			Completed: total,
+			Seeders:   resp.Complete,
+			Leechers:  resp.Incomplete,
+			Time:      peer.LastSeen,
+		})
+	}
+
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if n := t.numWant(r); len(candidates) > n {
+		candidates = candidates[:n]
+	}
+
+	if q.Get("compact") == "0" {
+		resp.Peers = dictPeers(candidates, q.Get("no_peer_id") == "1")
+	} else {
+		resp.Peers, resp.Peers6 = compactPeers(candidates)
+	}
+
+	t.write(w, resp)
+}
+
+func (t *Tracker) handleScrape(w http.ResponseWriter, r *http.Request) {
+	if _, ok := t.authorize(r); !ok {
+		t.fail(w, "invalid passkey")
+		return
+	}
+
+	resp := scrapeResponse{Files: make(map[string]scrapeFile)}
+	cutoff := time.Now().Add(-t.peerTimeout())
+
+	t.mu.Lock()
+	for _, infoHash := range r.URL.Query()["info_hash"] {
+		sw, ok := t.swarms[hex.EncodeToString([]byte(infoHash))]
+		if !ok {
+			continue
+		}
+		file := scrapeFile{Downloaded: sw.Completed}
+		for _, p := range sw.Peers {
+			if p.LastSeen.Before(cutoff) {
+				continue
+			}
+			if p.Left == 0 {
+				file.Complete++
+			} else {
+				file.Incomplete++
+			}
+		}
+		resp.Files[infoHash] = file
+	}
+	t.mu.Unlock()
+
+	t.write(w, resp)
+}
+
+// setAddr records addr as the peer's IPv4 or IPv6 endpoint. BEP 7 allows
+// the ipv4/ipv6 parameters to carry a port, which is ignored here.
+func (p *trackerPeer) setAddr(addr string) {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		p.IP = ip4.String()
+	} else {
+		p.IP6 = ip.String()
+	}
+}
+
+func (sw *swarm) recordCompletion(at time.Time) {
+	sw.Completed++
+	if sw.CompletedByDay == nil {
+		sw.CompletedByDay = make(map[string]int64)
+	}
+	sw.CompletedByDay[at.UTC().Format(time.DateOnly)]++
+}
+
+// Completions returns completed downloads per hex info-hash since the given
+// time, at day granularity. A zero time counts everything.
+func (t *Tracker) Completions(since time.Time) map[string]int64 {
+	sinceDay := since.UTC().Format(time.DateOnly)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := make(map[string]int64)
+	for infoHash, sw := range t.swarms {
+		if since.IsZero() {
+			counts[infoHash] = sw.Completed
+			continue
+		}
+		for day, n := range sw.CompletedByDay {
+			if day >= sinceDay {
+				counts[infoHash] += n
+			}
+		}
+	}
+	return counts
+}
+
+// CompletionsByDay returns completed downloads per hex info-hash and day
+// (YYYY-MM-DD, UTC) from the given time on. A zero time returns every day.
+func (t *Tracker) CompletionsByDay(since time.Time) map[string]map[string]int64 {
+	sinceDay := since.UTC().Format(time.DateOnly)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	history := make(map[string]map[string]int64)
+	for infoHash, sw := range t.swarms {
+		for day, n := range sw.CompletedByDay {
+			if since.IsZero() || day >= sinceDay {
+				if history[infoHash] == nil {
+					history[infoHash] = make(map[string]int64)
+				}
+				history[infoHash][day] = n
+			}
+		}
+	}
+	return history
+}
+
+// SwarmStats summarizes one swarm for the stats page and API.
+type SwarmStats struct {
+	InfoHash  string `json:"info_hash"`
+	Model     string `json:"model,omitempty"`
+	Seeders   int    `json:"seeders"`
+	Leechers  int    `json:"leechers"`
+	Completed int64  `json:"completed"`
+}
+
+// Stats returns a snapshot of every swarm the tracker knows about.
+func (t *Tracker) Stats() []SwarmStats {
+	cutoff := time.Now().Add(-t.peerTimeout())
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make([]SwarmStats, 0, len(t.swarms))
+	for infoHash, sw := range t.swarms {
+		st := SwarmStats{InfoHash: infoHash, Completed: sw.Completed}
+		for _, p := range sw.Peers {
+			if p.LastSeen.Before(cutoff) {
+				continue
+			}
+			if p.Left == 0 {
+				st.Seeders++
+			} else {
+				st.Leechers++
+			}
+		}
+		stats = append(stats, st)
+	}
+	return stats
+}
+
+// withPasskey rewrites a .torrent's announce URLs to carry a client passkey.
+// The info dictionary is copied byte-for-byte, so the info-hash is unchanged
+// and every client still joins the same swarm. Announce-list entries for other
+// trackers, such as federation peers, don't know our passkeys and are left alone.
+func withPasskey(data []byte, key string) ([]byte, error) {
+	var torrent map[string]bencode.Bytes
+	if err := bencode.Unmarshal(data, &torrent); err != nil {
+		return nil, fmt.Errorf("failed to decode torrent: %w", err)
+	}
+
+	addKey := func(announce string) string {
+		return strings.TrimSuffix(announce, "/") + "/" + url.PathEscape(key)
+	}
+
+	var announce string
+	if raw, ok := torrent["announce"]; ok {
+		if err := bencode.Unmarshal(raw, &announce); err != nil {
+			return nil, fmt.Errorf("failed to decode announce: %w", err)
+		}
+		torrent["announce"] = bencode.MustMarshal(addKey(announce))
+	}
+
+	if raw, ok := torrent["announce-list"]; ok {
+		var tiers [][]string
+		if err := bencode.Unmarshal(raw, &tiers); err != nil {
+			return nil, fmt.Errorf("failed to decode announce-list: %w", err)
+		}
+		for _, tier := range tiers {
+			for i := range tier {
+				if tier[i] == announce {
+					tier[i] = addKey(tier[i])
+				}
+			}
+		}
+		torrent["announce-list"] = bencode.MustMarshal(tiers)
+	}
+
+	return bencode.Marshal(torrent)
+}
+
+// compactPeers encodes peers as 6-byte IPv4 (BEP 23) and 18-byte IPv6
+// (BEP 7) ip:port entries.
+func compactPeers(peers []*trackerPeer) (string, string) {
+	var v4, v6 []byte
+	for _, p := range peers {
+		if ip := net.ParseIP(p.IP).To4(); ip != nil {
+			v4 = append(v4, ip...)
+			v4 = binary.BigEndian.AppendUint16(v4, uint16(p.Port))
+		}
+		if ip := net.ParseIP(p.IP6).To16(); ip != nil {
+			v6 = append(v6, ip...)
+			v6 = binary.BigEndian.AppendUint16(v6, uint16(p.Port))
+		}
+	}
+	return string(v4), string(v6)
+}
+
+// dictPeers lists each endpoint of each peer, so a dual-stack peer appears
+// once per address family.
+func dictPeers(peers []*trackerPeer, noPeerID bool) []announcePeer {
+	list := make([]announcePeer, 0, len(peers))
+	for _, p := range peers {
+		var peerID string
+		if !noPeerID {
+			rawID, _ := hex.DecodeString(p.PeerID)
+			peerID = string(rawID)
+		}
+		for _, ip := range []string{p.IP, p.IP6} {
+			if ip != "" {
+				list = append(list, announcePeer{PeerID: peerID, IP: ip, Port: p.Port})
+			}
+		}
+	}
+	return list
+}
+
+func (t *Tracker) fail(w http.ResponseWriter, reason string) {
+	t.write(w, trackerFailure{FailureReason: reason})
+}
+
+func (t *Tracker) write(w http.ResponseWriter, v interface{}) {
+	data, err := bencode.Marshal(v)
+	if err != nil {
+		t.logger.Errorf("Failed to encode tracker response: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(data)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// TrackerHealth is the result of the latest health check of one external
+// tracker.
+type TrackerHealth struct {
+	URL       string    `json:"url"`
+	Healthy   bool      `json:"healthy"`
+	Checked   time.Time `json:"checked"`
+	Since     time.Time `json:"since"` // when Healthy last changed
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// trackerHealthLoop checks every configured tracker on an interval and logs
+// outages and recoveries as they happen.
+func (s *Server) trackerHealthLoop(interval, timeout time.Duration) {
+	for {
+		trackers := s.trackerList()
+		if len(trackers) < 2 {
+			trackers = nil // a lone tracker has nothing to fail over to
+		}
+		for _, tracker := range trackers {
+			err := checkTracker(tracker, timeout)
+			now := time.Now()
+
+			s.trackerHealthMu.Lock()
+			health, ok := s.trackerHealth[tracker]
+			if !ok {
+				health = &TrackerHealth{URL: tracker, Healthy: true, Since: now}
+				s.trackerHealth[tracker] = health
+			}
+			healthy := err == nil
+			if healthy != health.Healthy {
+				health.Since = now
+				if healthy {
+					s.logger.Infof("Tracker %s is reachable again", tracker)
+				} else {
+					s.logger.Errorf("Tracker %s is down: %v", tracker, err)
+				}
+			}
+			health.Healthy = healthy
+			health.Checked = now
+			health.LastError = ""
+			if err != nil {
+				health.LastError = err.Error()
+			}
+			s.trackerHealthMu.Unlock()
+		}
+		time.Sleep(interval)
+	}
+}
+
+// checkTracker reports whether a tracker answers announces. Any reply counts,
+// including a failure reason for our made-up info-hash; only timeouts,
+// refused connections, and server errors mean the tracker is down.
+func checkTracker(tracker string, timeout time.Duration) error {
+	u, err := url.Parse(tracker)
+	if err != nil {
+		return err
+	}
+
+	switch u.Scheme {
+	case "udp":
+		return checkUDPTracker(u.Host, timeout)
+	case "http", "https":
+	default:
+		return fmt.Errorf("unsupported tracker scheme %q", u.Scheme)
+	}
+
+	q := u.Query()
+	q.Set("info_hash", strings.Repeat("\x00", 20))
+	q.Set("peer_id", "-LC0000-healthcheck0")
+	q.Set("port", "6881")
+	q.Set("uploaded", "0")
+	q.Set("downloaded", "0")
+	q.Set("left", "0")
+	q.Set("compact", "1")
+	q.Set("numwant", "0")
+	u.RawQuery = q.Encode()
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("tracker returned %s", resp.Status)
+	}
+	return nil
+}
+
+// checkUDPTracker sends the BEP 15 connect request, which every UDP tracker
+// answers before any announce.
+func checkUDPTracker(host string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var transaction [4]byte
+	rand.Read(transaction[:])
+	req := make([]byte, 16)
+	binary.BigEndian.PutUint64(req[0:8], 0x41727101980) // protocol magic
+	binary.BigEndian.PutUint32(req[8:12], 0)            // action: connect
+	copy(req[12:16], transaction[:])
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	resp := make([]byte, 16)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return err
+	}
+	if n < 16 || binary.BigEndian.Uint32(resp[0:4]) != 0 || string(resp[4:8]) != string(transaction[:]) {
+		return fmt.Errorf("invalid connect response")
+	}
+	return nil
+}
+
+// trackerList returns the configured announce URLs, which can change when
+// the configuration is reloaded.
+func (s *Server) trackerList() []string {
+	s.trackerHealthMu.Lock()
+	defer s.trackerHealthMu.Unlock()
+	return append([]string(nil), s.trackers...)
+}
+
+// setTrackers replaces the announce URLs: the primary tracker first, then
+// extra unique ones.
+func (s *Server) setTrackers(extra []string) {
+	trackers := []string{s.trackerURL}
+	for _, announce := range extra {
+		if !containsString(trackers, announce) {
+			trackers = append(trackers, announce)
+		}
+	}
+	s.trackerHealthMu.Lock()
+	s.trackers = trackers
+	s.trackerHealthMu.Unlock()
+}
+
+// trackerStatus returns the latest check of every configured tracker, in
+// configuration order. Trackers not checked yet are reported healthy.
+func (s *Server) trackerStatus() []TrackerHealth {
+	s.trackerHealthMu.Lock()
+	defer s.trackerHealthMu.Unlock()
+	status := make([]TrackerHealth, 0, len(s.trackers))
+	for _, tracker := range s.trackers {
+		if health, ok := s.trackerHealth[tracker]; ok {
+			status = append(status, *health)
+		} else {
+			status = append(status, TrackerHealth{URL: tracker, Healthy: true})
+		}
+	}
+	return status
+}
+
+// announceTiers orders the trackers for an announce-list, one per tier (BEP
+// 12) so clients try them in turn: healthy trackers first, then the rest.
+func (s *Server) announceTiers() [][]string {
+	var healthy, down [][]string
+	for _, health := range s.trackerStatus() {
+		if health.Healthy {
+			healthy = append(healthy, []string{health.URL})
+		} else {
+			down = append(down, []string{health.URL})
+		}
+	}
+	return append(healthy, down...)
+}
+
+// withTrackerHealth reorders a .torrent's configured trackers by health at
+// serve time. Other tiers, such as federation peers, keep their place after
+// them. Only the announce fields change, so the info-hash is unaffected.
+func (s *Server) withTrackerHealth(data []byte) ([]byte, error) {
+	var torrent map[string]bencode.Bytes
+	if err := bencode.Unmarshal(data, &torrent); err != nil {
+		return nil, fmt.Errorf("failed to decode torrent: %w", err)
+	}
+
+	tiers := s.announceTiers()
+	trackers := s.trackerList()
+	if raw, ok := torrent["announce-list"]; ok {
+		var existing [][]string
+		if err := bencode.Unmarshal(raw, &existing); err != nil {
+			return nil, fmt.Errorf("failed to decode announce-list: %w", err)
+		}
+		for _, tier := range existing {
+			var rest []string
+			for _, announce := range tier {
+				if !containsString(trackers, announce) {
+					rest = append(rest, announce)
+				}
+			}
+			if len(rest) > 0 {
+				tiers = append(tiers, rest)
+			}
+		}
+	}
+
+	torrent["announce"] = bencode.MustMarshal(tiers[0][0])
+	torrent["announce-list"] = bencode.MustMarshal(tiers)
+	return bencode.Marshal(torrent)
+}
+
+// announceList is the announce-list for a new torrent, or nil with a single
+// tracker.
+func (s *Server) announceList() [][]string {
+	if len(s.trackerList()) < 2 {
+		return nil
+	}
+	return s.announceTiers()
+}
+
+func (s *Server) getTrackerHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.trackerStatus())
+}
+
+// trackerOutages returns the configured trackers that are currently down.
+func (s *Server) trackerOutages() []TrackerHealth {
+	var outages []TrackerHealth
+	for _, health := range s.trackerStatus() {
+		if !health.Healthy {
+			outages = append(outages, health)
+		}
+	}
+	return outages
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DownloadCount is a leaderboard entry of completed downloads for a model.
+type DownloadCount struct {
+	Model     string `json:"model"`
+	InfoHash  string `json:"info_hash"`
+	Completed int64  `json:"completed"`
+}
+
+// statsRange reads the time range of a stats request: ?range=Nd for the
+// last N days (today included), ?range=all, or the older ?days=N, falling
+// back to def. It returns the start of the range, zero for all time, and its
+// canonical name.
+func statsRange(r *http.Request, def string) (time.Time, string, error) {
+	spec := r.URL.Query().Get("range")
+	if spec == "" {
+		if days := r.URL.Query().Get("days"); days != "" {
+			spec = days + "d"
+		} else {
+			spec = def
+		}
+	}
+	if spec == "all" {
+		return time.Time{}, "all", nil
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(spec, "d"))
+	if err != nil || days < 1 || !strings.HasSuffix(spec, "d") {
+		return time.Time{}, "", fmt.Errorf("invalid range %q (want all or a number of days, like 30d)", spec)
+	}
+	return time.Now().AddDate(0, 0, -(days - 1)), strconv.Itoa(days) + "d", nil
+}
+
+// getDownloadStats ranks catalog models by completed downloads reported to
+// the tracker, optionally limited to a ?range= of days.
+func (s *Server) getDownloadStats(w http.ResponseWriter, r *http.Request) {
+	since, _, err := statsRange(r, "all")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	completions := s.tracker.Completions(since)
+	models := s.visibleCatalog()
+	counts := make([]DownloadCount, 0, len(models))
+	for _, model := range models {
+		counts = append(counts, DownloadCount{
+			Model:     model.Name,
+			InfoHash:  model.InfoHash,
+			Completed: completions[model.InfoHash],
+		})
+	}
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Completed != counts[j].Completed {
+			return counts[i].Completed > counts[j].Completed
+		}
+		return counts[i].Model < counts[j].Model
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
+
+// ModelPopularity is a model's place in the popularity ranking.
+type ModelPopularity struct {
+	Model       string `json:"model"`
+	InfoHash    string `json:"info_hash"`
+	Completed   int64  `json:"completed"` // downloads completed in the range
+	Seeders     int    `json:"seeders"`   // peers announcing right now
+	Leechers    int    `json:"leechers"`
+	ActivePeers int    `json:"active_peers"` // seeders and leechers
+}
+
+// popularity ranks catalog models by downloads completed since the given
+// time, then by the peers in their swarms right now, which puts a model a
+// class is downloading at this moment above an equally downloaded one
+// nobody is using.
+func (s *Server) popularity(since time.Time) []ModelPopularity {
+	completions := s.tracker.Completions(since)
+	swarms := make(map[string]SwarmStats)
+	for _, swarm := range s.tracker.Stats() {
+		swarms[swarm.InfoHash] = swarm
+	}
+
+	models := s.visibleCatalog()
+	ranking := make([]ModelPopularity, 0, len(models))
+	for _, model := range models {
+		if model.InfoHash == "" {
+			continue
+		}
+		swarm := swarms[model.InfoHash]
+		ranking = append(ranking, ModelPopularity{
+			Model:       model.Name,
+			InfoHash:    model.InfoHash,
+			Completed:   completions[model.InfoHash],
+			Seeders:     swarm.Seeders,
+			Leechers:    swarm.Leechers,
+			ActivePeers: swarm.Seeders + swarm.Leechers,
+		})
+	}
+	sort.SliceStable(ranking, func(i, j int) bool {
+		a, b := ranking[i], ranking[j]
+		if a.Completed != b.Completed {
+			return a.Completed > b.Completed
+		}
+		if a.ActivePeers != b.ActivePeers {
+			return a.ActivePeers > b.ActivePeers
+		}
+		return a.Model < b.Model
+	})
+	return ranking
+}
+
+// getPopularModels serves the popularity ranking for a ?range= of days
+// (default 7d), optionally only the top ?limit=N, to help decide what to
+// pin and pre-seed.
+func (s *Server) getPopularModels(w http.ResponseWriter, r *http.Request) {
+	since, _, err := statsRange(r, "7d")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ranking := s.popularity(since)
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit >= 0 && limit < len(ranking) {
+		ranking = ranking[:limit]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ranking)
+}
+
+// serveTrackerStats shows per-swarm activity from the embedded tracker, as
+// HTML for browsers or JSON for ?format=json / Accept: application/json.
+func (s *Server) serveTrackerStats(w http.ResponseWriter, r *http.Request) {
+	names := make(map[string]string)
+	hidden := make(map[string]bool)
+	for _, model := range s.catalog() {
+		if model.InfoHash == "" {
+			continue
+		}
+		if model.Hidden {
+			hidden[model.InfoHash] = true
+		} else {
+			names[model.InfoHash] = model.Name
+		}
+	}
+
+	stats := []SwarmStats{}
+	for _, swarm := range s.tracker.Stats() {
+		if hidden[swarm.InfoHash] {
+			continue
+		}
+		swarm.Model = names[swarm.InfoHash]
+		stats = append(stats, swarm)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Seeders+stats[i].Leechers != stats[j].Seeders+stats[j].Leechers {
+			return stats[i].Seeders+stats[i].Leechers > stats[j].Seeders+stats[j].Leechers
+		}
+		return stats[i].InfoHash < stats[j].InfoHash
+	})
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+		return
+	}
+
+	tmpl := `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta http-equiv="refresh" content="30">
+    <title>Tracker Statistics - Ollama BitTorrent Lancache</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; background-color: #f5f5f5; }
+        .container { max-width: 1200px; margin: 0 auto; background: white; padding: 20px; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); }
+        h1 { color: #333; text-align: center; }
+        .back-link { margin-bottom: 20px; }
+        .back-link a { color: #007bff; text-decoration: none; }
+        .back-link a:hover { text-decoration: underline; }
+        table { width: 100%; border-collapse: collapse; margin-top: 30px; }
+        th, td { text-align: left; padding: 10px; border-bottom: 1px solid #ddd; }
+        th { background: #fafafa; }
+        .hash { font-family: monospace; color: #666; }
+        .num { text-align: right; }
+        .empty-state { text-align: center; color: #666; padding: 40px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="back-link">
+            <a href="/">← Back to Main Page</a>
+        </div>
+        <h1>📡 Tracker Statistics</h1>
+        <p style="text-align: center; color: #666;">Swarm activity on the embedded tracker (<a href="?format=json">JSON</a>)</p>
+
+        {{if .}}
+        <table>
+            <tr><th>Model</th><th>Info Hash</th><th class="num">Seeders</th><th class="num">Leechers</th><th class="num">Completed</th></tr>
+            {{range .}}
+            <tr>
+                <td>{{if .Model}}{{.Model}}{{else}}<em>unknown</em>{{end}}</td>
+                <td class="hash">{{.InfoHash}}</td>
+                <td class="num">{{.Seeders}}</td>
+                <td class="num">{{.Leechers}}</td>
+                <td class="num">{{.Completed}}</td>
+            </tr>
+            {{end}}
+        </table>
+        {{else}}
+        <div class="empty-state">
+            <h3>No swarms yet</h3>
+            <p>Swarms appear here once clients announce to the tracker.</p>
+        </div>
+        {{end}}
+    </div>
+</body>
+</html>`
+
+	t, err := template.New("tracker-stats").Parse(tmpl)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	t.Execute(w, stats)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Uploads can also use the tus resumable upload protocol (https://tus.io,
+// version 1.0.0 with the creation and termination extensions), so any tus
+// client can push a large blob, or a file for /downloads/, over a flaky link.
+// An upload is created with its length and metadata, then PATCHed in any
+// number of requests, each starting at the offset HEAD reports. Uploads
+// survive a restart of the server: what was received stays on disk with a
+// record of the upload under <state_dir>/tus.
+//
+// The metadata says what the upload is: "digest" (sha256:<hex>) for a model
+// blob, which is verified and stored like one PUT to /api/uploads/blobs, or
+// else "filename" for a file in the downloads directory.
+
+const tusVersion = "1.0.0"
+
+var tusID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// TusUpload is an upload in progress, as recorded in <state_dir>/tus.
+type TusUpload struct {
+	ID        string    `json:"id"`
+	Length    int64     `json:"length"`
+	Digest    string    `json:"digest,omitempty"`   // of a model blob
+	Filename  string    `json:"filename,omitempty"` // of a file for /downloads/
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *Server) tusDir() string {
+	return filepath.Join(s.stateDir, "tus")
+}
+
+func (s *Server) tusInfoPath(id string) string {
+	return filepath.Join(s.tusDir(), id+".json")
+}
+
+// tusDataPath is where an upload is received, next to where it ends up so
+// it can be renamed into place.
+func (s *Server) tusDataPath(upload TusUpload) string {
+	if upload.Digest != "" {
+		return filepath.Join(s.modelsDir, "blobs", ".tus-"+upload.ID)
+	}
+	return filepath.Join(s.downloadsDir, ".tus-"+upload.ID)
+}
+
+func (s *Server) tusDestination(upload TusUpload) string {
+	if upload.Digest != "" {
+		return s.blobPath(upload.Digest)
+	}
+	return filepath.Join(s.downloadsDir, upload.Filename)
+}
+
+// loadTusUpload reads the record of an upload.
+func (s *Server) loadTusUpload(id string) (TusUpload, error) {
+	if !tusID.MatchString(id) {
+		return TusUpload{}, os.ErrNotExist
+	}
+	data, err := os.ReadFile(s.tusInfoPath(id))
+	if err != nil {
+		return TusUpload{}, err
+	}
+	var upload TusUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return TusUpload{}, fmt.Errorf("failed to parse %s: %w", s.tusInfoPath(id), err)
+	}
+	return upload, nil
+}
+
+// removeTusUpload discards an upload and what was received of it.
+func (s *Server) removeTusUpload(upload TusUpload) {
+	os.Remove(s.tusDataPath(upload))
+	os.Remove(s.tusInfoPath(upload.ID))
+}
+
+// parseTusMetadata decodes Upload-Metadata: comma-separated keys, each with
+// an optional base64 value.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata value for %q", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// tusResumable checks that a request speaks the version of tus served here.
+func tusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// tusOptions serves OPTIONS /api/uploads/tus/, which tells a client what's
+// supported. It needs no token.
+func (s *Server) tusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,termination")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createTusUpload serves POST /api/uploads/tus/, answering 201 with the
+// upload's URL in Location.
+func (s *Server) createTusUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusResumable(w, r) || !s.uploadAllowed(w) {
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Upload-Length is required", http.StatusBadRequest)
+		return
+	}
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	upload := TusUpload{Length: length, CreatedAt: time.Now()}
+	// tus clients often send the local file name, so a digest takes precedence
+	if digest := metadata["digest"]; digest != "" {
+		if !pushDigest.MatchString(digest) {
+			http.Error(w, "Invalid digest", http.StatusBadRequest)
+			return
+		}
+		upload.Digest = digest
+	} else {
+		filename := metadata["filename"]
+		if filename == "" || strings.HasPrefix(filename, ".") || strings.Contains(filename, "..") || strings.Contains(filename, "/") || strings.Contains(filename, "\\") {
+			http.Error(w, "Upload-Metadata needs a digest, or a valid filename", http.StatusBadRequest)
+			return
+		}
+		upload.Filename = filename
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		s.logger.Errorf("Failed to create upload ID: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	upload.ID = hex.EncodeToString(id)
+
+	if err := s.saveTusUpload(upload); err != nil {
+		s.logger.Errorf("Failed to create upload %s: %v", upload.ID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	s.logger.Infof("Created upload %s of %s (%s)", upload.ID, upload.Digest+upload.Filename, formatSize(length))
+
+	w.Header().Set("Location", "/api/uploads/tus/"+upload.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// saveTusUpload records a new upload and creates the empty file it's
+// received into.
+func (s *Server) saveTusUpload(upload TusUpload) error {
+	data, err := json.MarshalIndent(upload, "", "  ")
+	if err != nil {
+		return err
+	}
+	partial := s.tusDataPath(upload)
+	if err := os.MkdirAll(filepath.Dir(partial), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(partial, nil, 0644); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.tusDir(), 0755); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	tmp, err := writeTemp(s.tusInfoPath(upload.ID), data)
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	if err := os.Rename(tmp, s.tusInfoPath(upload.ID)); err != nil {
+		os.Remove(tmp)
+		os.Remove(partial)
+		return err
+	}
+	return nil
+}
+
+// headTusUpload serves HEAD /api/uploads/tus/{id}: how much has been
+// received, in Upload-Offset.
+func (s *Server) headTusUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusResumable(w, r) {
+		return
+	}
+	upload, err := s.loadTusUpload(mux.Vars(r)["id"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var offset int64
+	if info, err := os.Stat(s.tusDataPath(upload)); err == nil {
+		offset = info.Size()
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// patchTusUpload serves PATCH /api/uploads/tus/{id}, which appends the body
+// at Upload-Offset. Once every byte is in, the upload is moved into place.
+func (s *Server) patchTusUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusResumable(w, r) || !s.uploadAllowed(w) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	start, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || start < 0 {
+		http.Error(w, "Upload-Offset is required", http.StatusBadRequest)
+		return
+	}
+	upload, err := s.loadTusUpload(mux.Vars(r)["id"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !s.uploadStarted("tus:" + upload.ID) {
+		http.Error(w, "This upload is already being written to", http.StatusLocked)
+		return
+	}
+	defer s.uploadFinished("tus:" + upload.ID)
+
+	partial := s.tusDataPath(upload)
+	info, err := os.Stat(partial)
+	if err != nil {
+		s.logger.Errorf("Failed to find the data of upload %s: %v", upload.ID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	offset := info.Size()
+	if start != offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		http.Error(w, fmt.Sprintf("Upload must resume at byte %d", offset), http.StatusConflict)
+		return
+	}
+
+	f, err := os.OpenFile(partial, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		s.logger.Errorf("Failed to open upload %s: %v", upload.ID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// What was received before an interruption is kept for the next PATCH
+	n, err := io.Copy(f, io.LimitReader(r.Body, upload.Length-offset))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	received := offset + n
+	w.Header().Set("Upload-Offset", strconv.FormatInt(received, 10))
+	if err != nil {
+		http.Error(w, "Failed to receive upload", http.StatusBadRequest)
+		return
+	}
+	if received < upload.Length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if upload.Digest != "" {
+		if err := verifyBlobFile(partial, upload.Digest); err != nil {
+			s.removeTusUpload(upload)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := os.Rename(partial, s.tusDestination(upload)); err != nil {
+		s.logger.Errorf("Failed to store upload %s: %v", upload.ID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	os.Remove(s.tusInfoPath(upload.ID))
+	s.logger.Infof("Received upload %s: %s", upload.ID, upload.Digest+upload.Filename)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteTusUpload serves DELETE /api/uploads/tus/{id}, which abandons an
+// upload and frees what it took.
+func (s *Server) deleteTusUpload(w http.ResponseWriter, r *http.Request) {
+	if !tusResumable(w, r) || !s.uploadAllowed(w) {
+		return
+	}
+	upload, err := s.loadTusUpload(mux.Vars(r)["id"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.uploadStarted("tus:" + upload.ID) {
+		http.Error(w, "This upload is being written to", http.StatusLocked)
+		return
+	}
+	defer s.uploadFinished("tus:" + upload.ID)
+
+	s.removeTusUpload(upload)
+	s.logger.Infof("Abandoned upload %s", upload.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/cobra"
+)
+
+// Uploads let an admin add a model from their workstation: each blob is PUT
+// to /api/uploads/blobs/{digest}, resuming with Content-Range after an
+// interruption, then the manifest is POSTed to /api/uploads/models. The
+// model is then torrented and seeded like any other. A tus client can upload
+// the blobs instead, see tus.go.
+
+var uploadContentRange = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+)$`)
+
+// uploadPath is where a blob is received until it's complete and verified.
+// The name is fixed, so an interrupted upload can be resumed.
+func (s *Server) uploadPath(digest string) string {
+	return filepath.Join(s.modelsDir, "blobs", ".upload-"+strings.Replace(digest, ":", "-", 1))
+}
+
+// uploadStarted marks a blob as being received, so two uploads of the same
+// blob can't write to one partial file.
+func (s *Server) uploadStarted(digest string) bool {
+	s.uploadsMu.Lock()
+	defer s.uploadsMu.Unlock()
+	if s.uploading[digest] {
+		return false
+	}
+	s.uploading[digest] = true
+	return true
+}
+
+func (s *Server) uploadFinished(digest string) {
+	s.uploadsMu.Lock()
+	defer s.uploadsMu.Unlock()
+	delete(s.uploading, digest)
+}
+
+// uploadAllowed checks that this server may write to the models directory.
+func (s *Server) uploadAllowed(w http.ResponseWriter) bool {
+	// Servers sharing a models directory leave writes to the leader
+	if !s.lease.isLeader() {
+		http.Error(w, "Not the leader; upload to the other server of the pair", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// getUploadedBlob reports how much of a blob the server has: 200 when it's
+// complete, otherwise 404 with the bytes received so far in Upload-Offset.
+func (s *Server) getUploadedBlob(w http.ResponseWriter, r *http.Request) {
+	digest := mux.Vars(r)["digest"]
+	if !pushDigest.MatchString(digest) {
+		http.Error(w, "Invalid digest", http.StatusBadRequest)
+		return
+	}
+	if info, err := os.Stat(s.blobPath(digest)); err == nil {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(info.Size(), 10))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	var offset int64
+	if info, err := os.Stat(s.uploadPath(digest)); err == nil {
+		offset = info.Size()
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// receiveUploadedBlob stores a blob, or the part of it given by
+// "Content-Range: bytes start-end/size". A part must start where the last
+// one ended. Without Content-Range the body is the whole blob. Once every
+// byte is in, the blob is kept only if it matches its digest.
+func (s *Server) receiveUploadedBlob(w http.ResponseWriter, r *http.Request) {
+	if !s.uploadAllowed(w) {
+		return
+	}
+	digest := mux.Vars(r)["digest"]
+	if !pushDigest.MatchString(digest) {
+		http.Error(w, "Invalid digest", http.StatusBadRequest)
+		return
+	}
+	if _, err := os.Stat(s.blobPath(digest)); err == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	start, end, size := int64(0), int64(0), int64(-1)
+	if header := r.Header.Get("Content-Range"); header != "" {
+		m := uploadContentRange.FindStringSubmatch(header)
+		if m == nil {
+			http.Error(w, "Content-Range must be bytes start-end/size", http.StatusBadRequest)
+			return
+		}
+		start, _ = strconv.ParseInt(m[1], 10, 64)
+		end, _ = strconv.ParseInt(m[2], 10, 64)
+		size, _ = strconv.ParseInt(m[3], 10, 64)
+		if end < start || end >= size {
+			http.Error(w, "Invalid Content-Range", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !s.uploadStarted(digest) {
+		http.Error(w, "This blob is already being uploaded", http.StatusConflict)
+		return
+	}
+	defer s.uploadFinished(digest)
+
+	partial := s.uploadPath(digest)
+	if err := os.MkdirAll(filepath.Dir(partial), 0755); err != nil {
+		s.logger.Errorf("Failed to create blobs directory: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+	if start != 0 && start != offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		http.Error(w, fmt.Sprintf("Upload must resume at byte %d", offset), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if start == 0 {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		s.logger.Errorf("Failed to open upload of %s: %v", digest, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	body := io.Reader(r.Body)
+	if size >= 0 {
+		body = io.LimitReader(r.Body, end-start+1)
+	}
+	// What was received before an interruption is kept for the next attempt
+	n, err := io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 && n == end-start+1 {
+		// Bytes past the range aren't written; the whole part is refused
+		if more, _ := io.CopyN(io.Discard, r.Body, 1); more > 0 {
+			os.Truncate(partial, start)
+			w.Header().Set("Upload-Offset", strconv.FormatInt(start, 10))
+			http.Error(w, "The body is longer than its Content-Range", http.StatusBadRequest)
+			return
+		}
+	}
+	received := start + n
+	w.Header().Set("Upload-Offset", strconv.FormatInt(received, 10))
+	if err != nil {
+		http.Error(w, "Failed to receive blob", http.StatusBadRequest)
+		return
+	}
+	if size >= 0 && received < size {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if err := verifyBlobFile(partial, digest); err != nil {
+		os.Remove(partial)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := os.Rename(partial, s.blobPath(digest)); err != nil {
+		s.logger.Errorf("Failed to store blob %s: %v", digest, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// verifyBlobFile checks that a file hashes to its digest.
+func verifyBlobFile(path, digest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if "sha256:"+hex.EncodeToString(hash.Sum(nil)) != digest {
+		return fmt.Errorf("blob does not match its digest")
+	}
+	return nil
+}
+
+// receiveUploadedModel adds an uploaded model once all its blobs are in:
+// 201 with the model, or 409 listing the blobs still missing.
+func (s *Server) receiveUploadedModel(w http.ResponseWriter, r *http.Request) {
+	if !s.uploadAllowed(w) {
+		return
+	}
+	var upload ModelPush
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushSize)).Decode(&upload); err != nil {
+		http.Error(w, "Invalid upload", http.StatusBadRequest)
+		return
+	}
+	if !pushModelName.MatchString(upload.Name) {
+		http.Error(w, "Invalid model name: expected model:tag, without a namespace", http.StatusBadRequest)
+		return
+	}
+	if !s.published(upload.Name) {
+		http.Error(w, "Model is not in this server's models allowlist", http.StatusForbidden)
+		return
+	}
+	digests, err := manifestDigests(upload.Manifest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A deletion meanwhile could remove blobs found here
+	s.deleteMu.Lock()
+	missing := []string{}
+	for _, digest := range digests {
+		if _, err := os.Stat(s.blobPath(digest)); err != nil {
+			missing = append(missing, digest)
+		}
+	}
+	if len(missing) > 0 {
+		s.deleteMu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string][]string{"missing_blobs": missing})
+		return
+	}
+
+	err = s.writeManifest(upload.Name, upload.Manifest)
+	s.deleteMu.Unlock()
+	if err != nil {
+		s.logger.Errorf("Failed to write uploaded manifest for %s: %v", upload.Name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	s.logger.Infof("Received uploaded model %s", upload.Name)
+	// Rediscovery queues the torrent, which is seeded once it's created
+	if err := s.discoverModels(); err != nil {
+		s.logger.Errorf("Failed to rediscover models: %v", err)
+	}
+	model, _ := s.modelByName(upload.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(model)
+}
+
+// uploadOptions are the flags of the upload subcommand.
+type uploadOptions struct {
+	server    string
+	token     string
+	modelsDir string
+}
+
+// uploadCommand uploads a model from the local Ollama models directory.
+func uploadCommand() *cobra.Command {
+	var opts uploadOptions
+	cmd := &cobra.Command{
+		Use:   "upload MODEL",
+		Short: "Upload a local Ollama model to a server",
+		Long: `Uploads a model from the local Ollama models directory to a server's cache,
+skipping blobs the server already has and resuming interrupted blobs. The
+server needs admin.token set.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runUpload(opts, args[0])
+		},
+	}
+	home, _ := os.UserHomeDir()
+	modelsDir := os.Getenv("OLLAMA_MODELS")
+	if modelsDir == "" {
+		modelsDir = filepath.Join(home, ".ollama", "models")
+	}
+	cmd.Flags().StringVar(&opts.server, "server", "http://localhost:8080", "URL of the server to upload to")
+	cmd.Flags().StringVar(&opts.token, "token", os.Getenv("OLLAMA_BT_ADMIN_TOKEN"), "the server's admin token (default $OLLAMA_BT_ADMIN_TOKEN)")
+	cmd.Flags().StringVar(&opts.modelsDir, "models-dir", modelsDir, "local Ollama models directory (default $OLLAMA_MODELS or ~/.ollama/models)")
+	return cmd
+}
+
+func runUpload(opts uploadOptions, name string) error {
+	if !strings.Contains(name, ":") {
+		name += ":latest"
+	}
+	local := &Server{modelsDir: opts.modelsDir}
+	manifestPath, err := local.manifestPath(name)
+	if err != nil {
+		return err
+	}
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return err
+	}
+	digests, err := manifestDigests(manifest)
+	if err != nil {
+		return err
+	}
+
+	server := strings.TrimSuffix(opts.server, "/")
+	for _, digest := range digests {
+		if err := uploadBlob(server, opts.token, local.blobPath(digest), digest); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", digest, err)
+		}
+	}
+
+	body, err := json.Marshal(ModelPush{Name: name, Manifest: manifest})
+	if err != nil {
+		return err
+	}
+	resp, err := uploadRequest("POST", server+"/api/uploads/models", opts.token, bytes.NewReader(body), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server answered %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	fmt.Printf("Uploaded %s; the server is creating its torrent\n", name)
+	return nil
+}
+
+// uploadBlob sends a blob the server doesn't have yet, starting where an
+// earlier attempt stopped.
+func uploadBlob(server, token, path, digest string) error {
+	resp, err := uploadRequest("HEAD", server+"/api/uploads/blobs/"+digest, token, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		fmt.Printf("%s: already on the server\n", digest)
+		return nil
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("server answered %s", resp.Status)
+	}
+	offset, _ := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if offset >= info.Size() {
+		offset = 0 // a stale partial upload; start over
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	if offset > 0 {
+		fmt.Printf("%s: resuming at %s of %s\n", digest, formatSize(offset), formatSize(info.Size()))
+	} else {
+		fmt.Printf("%s: uploading %s\n", digest, formatSize(info.Size()))
+	}
+	header := http.Header{}
+	if info.Size() > 0 {
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, info.Size()-1, info.Size()))
+	}
+	req := io.LimitReader(f, info.Size()-offset)
+	resp, err = uploadRequest("PUT", server+"/api/uploads/blobs/"+digest, token, req, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server answered %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func uploadRequest(method, url, token string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultClient.Do(req)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/gorilla/mux"
+)
+
+// VerifyReport is the result of checking one model's blobs against their
+// digests and its data against the piece hashes of its .torrent.
+type VerifyReport struct {
+	Model   string        `json:"model"`
+	OK      bool          `json:"ok"`
+	Blobs   []BlobResult  `json:"blobs"`
+	Torrent TorrentResult `json:"torrent"`
+}
+
+type BlobResult struct {
+	Digest string `json:"digest"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	OK     bool   `json:"ok"`
+	Actual string `json:"actual,omitempty"` // digest of the contents when it doesn't match
+	Error  string `json:"error,omitempty"`
+}
+
+type TorrentResult struct {
+	File      string   `json:"file"`
+	OK        bool     `json:"ok"`
+	Pieces    int      `json:"pieces"`
+	BadPieces []int    `json:"bad_pieces,omitempty"`
+	Errors    []string `json:"errors,omitempty"` // missing or resized files, unreadable torrent
+}
+
+// verifyModel checks a model right away, for troubleshooting a download that
+// Ollama won't load. Unlike the background job it reads at full speed.
+func (s *Server) verifyModel(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	for _, model := range s.catalog() {
+		if model.Name == name {
+			report := s.checkModel(model)
+			if !report.OK {
+				s.logger.Warnf("Verification of %s failed", model.Name)
+				s.notify(eventVerificationFailed, fmt.Sprintf("Verification of %s failed", model.Name))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(report)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (s *Server) checkModel(model Model) VerifyReport {
+	report := VerifyReport{Model: model.Name, Blobs: []BlobResult{}}
+
+	if manifestPath, err := s.manifestPath(model.Name); err != nil {
+		report.Blobs = append(report.Blobs, BlobResult{Error: err.Error()})
+	} else if data, err := os.ReadFile(manifestPath); err != nil {
+		report.Blobs = append(report.Blobs, BlobResult{Path: manifestPath, Error: err.Error()})
+	} else if digests, err := manifestDigests(data); err != nil {
+		report.Blobs = append(report.Blobs, BlobResult{Path: manifestPath, Error: err.Error()})
+	} else {
+		for _, digest := range digests {
+			result := BlobResult{Digest: digest, Path: s.blobPath(digest)}
+			actual, size, err := hashBlob(result.Path, nil)
+			result.Size = size
+			switch {
+			case err != nil:
+				result.Error = err.Error()
+			case actual != digest:
+				result.Actual = actual
+			default:
+				result.OK = true
+			}
+			report.Blobs = append(report.Blobs, result)
+		}
+	}
+
+	report.Torrent = s.checkTorrent(model.TorrentFile)
+
+	report.OK = report.Torrent.OK
+	for _, blob := range report.Blobs {
+		report.OK = report.OK && blob.OK
+	}
+	return report
+}
+
+// checkTorrent re-hashes the data a .torrent describes, laid out under the
+// models directory, and lists the pieces that don't match.
+func (s *Server) checkTorrent(torrentPath string) TorrentResult {
+	result := TorrentResult{File: torrentPath}
+	if torrentPath == "" {
+		result.Errors = append(result.Errors, "model has no torrent file")
+		return result
+	}
+	mi, err := metainfo.LoadFromFile(torrentPath)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to load torrent: %v", err))
+		return result
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to decode info: %v", err))
+		return result
+	}
+	result.Pieces = info.NumPieces()
+
+	// Pieces span files, so a missing or resized file shifts every later
+	// piece; report the files instead of thousands of bad pieces
+	var readers []io.Reader
+	for _, file := range info.UpvertedFiles() {
+		filePath := filepath.Join(s.modelsDir, filepath.Join(file.Path...))
+		stat, err := os.Stat(filePath)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", strings.Join(file.Path, "/"), err))
+			continue
+		}
+		if stat.Size() != file.Length {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: size %d, torrent expects %d", strings.Join(file.Path, "/"), stat.Size(), file.Length))
+			continue
+		}
+		f, err := os.Open(filePath)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", strings.Join(file.Path, "/"), err))
+			continue
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	if len(result.Errors) > 0 {
+		return result
+	}
+
+	data := io.MultiReader(readers...)
+	buf := make([]byte, info.PieceLength)
+	for i := 0; i < result.Pieces; i++ {
+		piece := buf[:info.Piece(i).Length()]
+		if _, err := io.ReadFull(data, piece); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("piece %d: %v", i, err))
+			return result
+		}
+		hash := sha1.Sum(piece)
+		if !bytes.Equal(hash[:], info.Pieces[i*20:(i+1)*20]) {
+			result.BadPieces = append(result.BadPieces, i)
+		}
+	}
+
+	result.OK = len(result.BadPieces) == 0
+	return result
+}
+
+// publishTorrent writes a newly created .torrent under a temporary name and
+// only moves it into place once it validates, so a broken torrent is never
+// listed in the catalog.
+func (s *Server) publishTorrent(torrentPath string, data []byte) error {
+	tmp, err := writeTemp(torrentPath, data)
+	if err != nil {
+		return fmt.Errorf("failed to write torrent file: %w", err)
+	}
+	if err := validateTorrent(tmp, s.modelsDir); err != nil {
+		os.Remove(tmp)
+		s.logger.Errorf("Generated torrent %s failed validation: %v", torrentPath, err)
+		return fmt.Errorf("generated torrent failed validation: %w", err)
+	}
+	if err := os.Rename(tmp, torrentPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write torrent file: %w", err)
+	}
+	return nil
+}
+
+// validateTorrent loads a freshly written .torrent back with the metainfo
+// parser and re-hashes a few pieces from disk: the first, the last, one in
+// the middle, and two at random. It catches encoding and hashing bugs before
+// the torrent is published and clients spend hours on a download that can't
+// complete.
+func validateTorrent(torrentPath, basePath string) error {
+	mi, err := metainfo.LoadFromFile(torrentPath)
+	if err != nil {
+		return fmt.Errorf("failed to load torrent: %w", err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return fmt.Errorf("failed to decode info: %w", err)
+	}
+	if info.PieceLength <= 0 {
+		return fmt.Errorf("invalid piece length %d", info.PieceLength)
+	}
+	if len(info.Pieces)%20 != 0 {
+		return fmt.Errorf("pieces field is %d bytes, not a multiple of 20", len(info.Pieces))
+	}
+	numPieces := int((info.TotalLength() + info.PieceLength - 1) / info.PieceLength)
+	if info.NumPieces() != numPieces {
+		return fmt.Errorf("torrent has %d piece hashes for %d pieces of data", info.NumPieces(), numPieces)
+	}
+	if numPieces == 0 {
+		return nil
+	}
+
+	check := []int{0, numPieces / 2, numPieces - 1, rand.Intn(numPieces), rand.Intn(numPieces)}
+	for _, i := range check {
+		piece, err := readPiece(&info, basePath, i)
+		if err != nil {
+			return fmt.Errorf("piece %d: %w", i, err)
+		}
+		hash := sha1.Sum(piece)
+		if !bytes.Equal(hash[:], info.Pieces[i*20:(i+1)*20]) {
+			return fmt.Errorf("piece %d does not match the data on disk", i)
+		}
+	}
+	return nil
+}
+
+// readPiece reads one piece of a multi-file torrent from the files under
+// basePath.
+func readPiece(info *metainfo.Info, basePath string, index int) ([]byte, error) {
+	piece := make([]byte, info.Piece(index).Length())
+	start := int64(index) * info.PieceLength
+
+	var offset int64 // start of the current file within the torrent
+	filled := 0
+	for _, file := range info.UpvertedFiles() {
+		end := offset + file.Length
+		if end > start && filled < len(piece) {
+			f, err := os.Open(filepath.Join(basePath, filepath.Join(file.Path...)))
+			if err != nil {
+				return nil, err
+			}
+			want := piece[filled:]
+			if remaining := end - (start + int64(filled)); int64(len(want)) > remaining {
+				want = want[:remaining]
+			}
+			n, err := f.ReadAt(want, start+int64(filled)-offset)
+			f.Close()
+			if err != nil && !(err == io.EOF && n == len(want)) {
+				return nil, err
+			}
+			filled += n
+		}
+		offset = end
+	}
+	if filled != len(piece) {
+		return nil, fmt.Errorf("read %d of %d bytes", filled, len(piece))
+	}
+	return piece, nil
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/gorilla/mux"
+)
+
+// Versions keep a model's earlier manifests and torrents after its tag moves
+// upstream, such as a re-pulled llama3:latest, so clients can still fetch the
+// exact build they tested with. A version is named by the digest of its
+// manifest, as in the registry, and requested as name@digest. The copies live
+// in <state_dir>/versions/<model>/<hex>.manifest and <hex>.torrent.
+//
+// Only the manifest is kept: a version downloads as long as its blobs are
+// still on disk, which Ollama only leaves behind with OLLAMA_NOPRUNE set.
+
+// ModelVersion is one build of a model, current or earlier.
+type ModelVersion struct {
+	Digest     string    `json:"digest"` // sha256 of the manifest
+	InfoHash   string    `json:"info_hash"`
+	Size       int64     `json:"size"`
+	SizeHuman  string    `json:"size_human"`
+	SeenAt     time.Time `json:"seen_at"` // when the version was first published here
+	Current    bool      `json:"current"`
+	Available  bool      `json:"available"` // every blob is still on disk
+	TorrentURL string    `json:"torrent_url"`
+}
+
+// versionHex matches the hex part of a manifest digest.
+var versionHex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// manifestDigest names a version of a manifest.
+func manifestDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// versionsDir is where the earlier versions of a model are kept.
+func (s *Server) versionsDir(name string) string {
+	return filepath.Join(s.stateDir, "versions", versionDirName(name))
+}
+
+// versionDirName escapes a model name into a single path segment. Unlike
+// mapping ":" and "/" to "_", it's reversible, so no two models share one.
+func versionDirName(name string) string {
+	return strings.ReplaceAll(url.PathEscape(name), ":", "%3A")
+}
+
+// legacyVersionDirName is how versionDirName used to name the directories,
+// which could give two models the same one.
+func legacyVersionDirName(name string) string {
+	return strings.NewReplacer(":", "_", "/", "_").Replace(name)
+}
+
+// migrateVersionDirs renames the version directories named the old way. A
+// directory two catalog models map to is left alone, since its versions
+// can't be told apart; it only keeps its blobs from being deleted.
+func (s *Server) migrateVersionDirs(models []Model) {
+	if s.stateDir == "" {
+		return
+	}
+	claims := make(map[string]int)
+	for _, model := range models {
+		claims[legacyVersionDirName(model.Name)]++
+	}
+	for _, model := range models {
+		legacy := legacyVersionDirName(model.Name)
+		if legacy == versionDirName(model.Name) {
+			continue
+		}
+		legacyDir := filepath.Join(s.stateDir, "versions", legacy)
+		if _, err := os.Stat(legacyDir); err != nil {
+			continue
+		}
+		if claims[legacy] > 1 {
+			s.logger.Warnf("Not migrating %s: its versions could belong to any of %d models", legacyDir, claims[legacy])
+			continue
+		}
+		dir := s.versionsDir(model.Name)
+		if _, err := os.Stat(dir); err == nil {
+			continue
+		}
+		if err := os.Rename(legacyDir, dir); err != nil {
+			s.logger.Warnf("Failed to migrate versions of %s: %v", model.Name, err)
+			continue
+		}
+		s.logger.Infof("Moved versions of %s to %s", model.Name, dir)
+	}
+}
+
+// recordVersion keeps a copy of a model's current manifest and torrent, so
+// they outlive the tag moving to another build. A version already kept is
+// left as it is.
+func (s *Server) recordVersion(model Model) {
+	if s.modelVersions == 0 || s.stateDir == "" || model.Digest == "" || model.TorrentFile == "" {
+		return
+	}
+	dir := s.versionsDir(model.Name)
+	id := strings.TrimPrefix(model.Digest, "sha256:")
+	torrentPath := filepath.Join(dir, id+".torrent")
+	if _, err := os.Stat(torrentPath); err == nil {
+		return
+	}
+
+	manifest, err := s.readManifest(model.Name)
+	if err != nil || manifestDigest(manifest) != model.Digest {
+		// Pulled again since discovery; the next rescan records it
+		return
+	}
+	unlock := s.lockTorrent(model.TorrentFile)
+	torrent, err := os.ReadFile(model.TorrentFile)
+	unlock()
+	if err != nil {
+		s.logger.Warnf("Failed to keep version %s of %s: %v", model.Digest, model.Name, err)
+		return
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		s.logger.Warnf("Failed to keep version %s of %s: %v", model.Digest, model.Name, err)
+		return
+	}
+	// The manifest goes first: a torrent without its manifest isn't a version
+	for _, file := range []struct {
+		path string
+		data []byte
+	}{
+		{filepath.Join(dir, id+".manifest"), manifest},
+		{torrentPath, torrent},
+	} {
+		tmp, err := writeTemp(file.path, file.data)
+		if err == nil {
+			if err = os.Rename(tmp, file.path); err != nil {
+				os.Remove(tmp)
+			}
+		}
+		if err != nil {
+			s.logger.Warnf("Failed to keep version %s of %s: %v", model.Digest, model.Name, err)
+			return
+		}
+	}
+	s.logger.Infof("Kept version %s of %s", model.Digest, model.Name)
+	s.pruneVersions(model)
+}
+
+// pruneVersions removes the oldest earlier versions of a model beyond
+// model_versions. The current version doesn't count towards the limit.
+func (s *Server) pruneVersions(model Model) {
+	dir := s.versionsDir(model.Name)
+	torrents, _ := filepath.Glob(filepath.Join(dir, "*.torrent"))
+	type kept struct {
+		id      string
+		modTime time.Time
+	}
+	var earlier []kept
+	for _, path := range torrents {
+		id := strings.TrimSuffix(filepath.Base(path), ".torrent")
+		info, err := os.Stat(path)
+		if err != nil || "sha256:"+id == model.Digest {
+			continue
+		}
+		earlier = append(earlier, kept{id, info.ModTime()})
+	}
+	sort.Slice(earlier, func(i, j int) bool { return earlier[i].modTime.After(earlier[j].modTime) })
+	for i := s.modelVersions; i < len(earlier); i++ {
+		os.Remove(filepath.Join(dir, earlier[i].id+".torrent"))
+		os.Remove(filepath.Join(dir, earlier[i].id+".manifest"))
+		s.logger.Infof("Removed version sha256:%s of %s, beyond model_versions", earlier[i].id, model.Name)
+	}
+}
+
+// modelVersionList lists a model's current version followed by the kept ones,
+// newest first.
+func (s *Server) modelVersionList(model Model) []ModelVersion {
+	torrentURL := func(digest string) string {
+		return fmt.Sprintf("%s/api/models/%s/torrent", s.baseURL(), url.PathEscape(model.Name+"@"+digest))
+	}
+
+	versions := []ModelVersion{}
+	if model.Digest != "" {
+		versions = append(versions, ModelVersion{
+			Digest:     model.Digest,
+			InfoHash:   model.InfoHash,
+			Size:       model.Size,
+			SizeHuman:  formatSize(model.Size),
+			SeenAt:     model.CreatedAt,
+			Current:    true,
+			Available:  !model.Incomplete,
+			TorrentURL: torrentURL(model.Digest),
+		})
+	}
+
+	dir := s.versionsDir(model.Name)
+	torrents, _ := filepath.Glob(filepath.Join(dir, "*.torrent"))
+	var earlier []ModelVersion
+	for _, path := range torrents {
+		id := strings.TrimSuffix(filepath.Base(path), ".torrent")
+		digest := "sha256:" + id
+		if digest == model.Digest {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		manifest, err := os.ReadFile(filepath.Join(dir, id+".manifest"))
+		if err != nil {
+			continue
+		}
+		version := ModelVersion{Digest: digest, SeenAt: info.ModTime(), TorrentURL: torrentURL(digest)}
+		version.InfoHash, _ = torrentInfoHash(path)
+		version.Size, _ = manifestSize(manifest)
+		version.SizeHuman = formatSize(version.Size)
+		if digests, err := manifestDigests(manifest); err == nil {
+			version.Available = len(s.missingBlobs(digests)) == 0
+		}
+		earlier = append(earlier, version)
+	}
+	sort.Slice(earlier, func(i, j int) bool { return earlier[i].SeenAt.After(earlier[j].SeenAt) })
+	return append(versions, earlier...)
+}
+
+// getModelVersions serves GET /api/models/{name}/versions.
+func (s *Server) getModelVersions(w http.ResponseWriter, r *http.Request) {
+	model, ok := s.modelByName(mux.Vars(r)["name"])
+	if !ok {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.modelVersionList(model))
+}
+
+// getVersionTorrent serves the torrent of an earlier version of a model,
+// requested as /api/models/{name}@{digest}/torrent. Its only web seed is
+// this server's version of the files, since the model's manifest has moved on.
+func (s *Server) getVersionTorrent(w http.ResponseWriter, r *http.Request, model Model, digest string) {
+	id := strings.TrimPrefix(digest, "sha256:")
+	if !versionHex.MatchString(id) {
+		http.Error(w, "Invalid digest: expected sha256:<64 hex digits>", http.StatusBadRequest)
+		return
+	}
+	torrentPath := filepath.Join(s.versionsDir(model.Name), id+".torrent")
+	if _, err := os.Stat(torrentPath); err != nil {
+		http.Error(w, fmt.Sprintf("No version %s of %s is kept", digest, model.Name), http.StatusNotFound)
+		return
+	}
+	webseed := fmt.Sprintf("%s/webseed/versions/%s/%s/", s.baseURL(), url.PathEscape(versionDirName(model.Name)), id)
+	s.serveTorrent(w, r, torrentPath, model.Name+"@sha256:"+id, webseed)
+}
+
+// withWebseeds replaces the web seeds (BEP 19) of a .torrent.
+func withWebseeds(data []byte, webseeds []string) ([]byte, error) {
+	var torrent map[string]bencode.Bytes
+	if err := bencode.Unmarshal(data, &torrent); err != nil {
+		return nil, fmt.Errorf("failed to decode torrent: %w", err)
+	}
+	torrent["url-list"] = bencode.MustMarshal(webseeds)
+	return bencode.Marshal(torrent)
+}
+
+// versionWebseedHandler serves the files of earlier versions under
+// /webseed/versions/<model>/<hex>/: the kept manifest, and the blobs from
+// the models directory like /webseed/.
+func (s *Server) versionWebseedHandler() http.Handler {
+	blobs := s.webseedHandler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/webseed/versions/"), "/", 3)
+		if len(parts) < 3 || parts[0] == "" || parts[0] == "." || parts[0] == ".." || !versionHex.MatchString(parts[1]) {
+			http.NotFound(w, r)
+			return
+		}
+		dirName, id, rel := parts[0], parts[1], parts[2]
+
+		if !strings.HasPrefix(rel, "models/manifests/") {
+			blobsReq := r.Clone(r.Context())
+			blobsReq.URL.Path = "/webseed/" + rel
+			blobs.ServeHTTP(w, blobsReq)
+			return
+		}
+		manifestPath := filepath.Join(s.stateDir, "versions", dirName, id+".manifest")
+		f, err := os.Open(manifestPath)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("ETag", `"sha256-`+id+`"`)
+		http.ServeContent(w, r, "", info.ModTime(), f)
+	})
+}
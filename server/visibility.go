@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// ModelVisibility is set per model from the admin API and web UI, and wins
+// over model_overrides. A hidden model stays on the server, seeded and served
+// by name, but is only listed for the registered clients in VisibleTo.
+type ModelVisibility struct {
+	Hidden    bool     `json:"hidden"`
+	VisibleTo []string `json:"visible_to,omitempty"` // client names from tracker.passkeys
+}
+
+// HiddenModel is a hidden model as the admin API lists it.
+type HiddenModel struct {
+	Model
+	VisibleTo []string `json:"visible_to"`
+}
+
+func (s *Server) visibilityPath() string {
+	return filepath.Join(s.stateDir, "visibility.json")
+}
+
+// loadVisibility restores the visibility set by a previous run.
+func (s *Server) loadVisibility() error {
+	s.visibility = make(map[string]ModelVisibility)
+	data, err := os.ReadFile(s.visibilityPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &s.visibility); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", s.visibilityPath(), err)
+	}
+	return nil
+}
+
+// setVisibility records a model's visibility and applies it to the catalog
+// straight away. The caller holds visibilityMu.
+func (s *Server) setVisibility(name string, v ModelVisibility) error {
+	s.visibility[name] = v
+	data, err := json.MarshalIndent(s.visibility, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.stateDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := writeTemp(s.visibilityPath(), data)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.visibilityPath()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	s.updateModel(name, func(m *Model) { m.Hidden = v.Hidden })
+	return nil
+}
+
+// modelVisibility returns the visibility set for a model, if any.
+func (s *Server) modelVisibility(name string) (ModelVisibility, bool) {
+	s.visibilityMu.Lock()
+	defer s.visibilityMu.Unlock()
+	v, ok := s.visibility[name]
+	return v, ok
+}
+
+// catalogFor is the catalog listed to a request: the visible models, plus
+// the hidden ones shown to the client whose passkey is in ?key=.
+func (s *Server) catalogFor(r *http.Request) []Model {
+	key := r.URL.Query().Get("key")
+	if key == "" || s.tracker == nil {
+		return s.visibleCatalog()
+	}
+	client, ok := s.tracker.config.Passkeys[key]
+	if !ok {
+		return s.visibleCatalog()
+	}
+	var models []Model
+	for _, model := range s.catalog() {
+		if !model.Hidden || containsString(s.modelSettings(model.Name).VisibleTo, client) {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// hiddenNames returns the names of hidden catalog models.
+func (s *Server) hiddenNames() map[string]bool {
+	hidden := make(map[string]bool)
+	for _, model := range s.catalog() {
+		if model.Hidden {
+			hidden[model.Name] = true
+		}
+	}
+	return hidden
+}
+
+// redactHidden drops hidden models from a list of model names, for public
+// reports that name the models behind a blob.
+func redactHidden(names []string, hidden map[string]bool) []string {
+	visible := []string{}
+	for _, name := range names {
+		if !hidden[name] {
+			visible = append(visible, name)
+		}
+	}
+	return visible
+}
+
+// getHiddenModels lists hidden models for the admin UI, which can't see
+// them in /api/models.
+func (s *Server) getHiddenModels(w http.ResponseWriter, r *http.Request) {
+	hidden := []HiddenModel{}
+	for _, model := range s.catalog() {
+		if model.Hidden {
+			entry := HiddenModel{Model: model, VisibleTo: s.modelSettings(model.Name).VisibleTo}
+			if entry.VisibleTo == nil {
+				entry.VisibleTo = []string{}
+			}
+			hidden = append(hidden, entry)
+		}
+	}
+	sort.Slice(hidden, func(i, j int) bool { return hidden[i].Name < hidden[j].Name })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hidden)
+}
+
+// putModelVisibility serves PUT /api/models/{name}/visibility, behind the
+// admin token, with a ModelVisibility body.
+func (s *Server) putModelVisibility(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, ok := s.modelByName(name); !ok {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+	var v ModelVisibility
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		http.Error(w, "Invalid visibility", http.StatusBadRequest)
+		return
+	}
+	for _, client := range v.VisibleTo {
+		if !s.registeredClient(client) {
+			http.Error(w, fmt.Sprintf("visible_to: %q is not a client in tracker.passkeys", client), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.visibilityMu.Lock()
+	err := s.setVisibility(name, v)
+	s.visibilityMu.Unlock()
+	if err != nil {
+		s.logger.Errorf("Failed to save the visibility of %s: %v", name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if v.Hidden {
+		s.logger.Infof("Hid model %s", name)
+	} else {
+		s.logger.Infof("Unhid model %s", name)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// registeredClient reports whether a client has a passkey on the embedded
+// tracker.
+func (s *Server) registeredClient(name string) bool {
+	if s.tracker == nil {
+		return false
+	}
+	for _, client := range s.tracker.config.Passkeys {
+		if client == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/gorilla/mux"
+)
+
+// ExternalTorrent is a .torrent an admin dropped into the watch directory,
+// listed alongside the models as one of the "other torrents".
+type ExternalTorrent struct {
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	SizeHuman   string    `json:"size_human"`
+	TorrentFile string    `json:"torrent_file"`
+	AddedAt     time.Time `json:"added_at"`
+	InfoHash    string    `json:"info_hash"`
+}
+
+// watchLoop rescans the watch directory so torrents can be added and removed
+// while the server runs.
+func (s *Server) watchLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.scanWatchDir(); err != nil {
+			s.logger.Warnf("Failed to scan watch directory: %v", err)
+		}
+	}
+}
+
+// scanWatchDir loads every .torrent in the watch directory. Their data lives
+// next to them, laid out as a regular client would save it: a single-file
+// torrent as <dir>/<name>, a multi-file torrent under <dir>/<name>/.
+func (s *Server) scanWatchDir() error {
+	entries, err := os.ReadDir(s.watchDir)
+	if err != nil {
+		return err
+	}
+
+	s.watchMu.Lock()
+	known := make(map[string]ExternalTorrent, len(s.external))
+	for _, ext := range s.external {
+		known[ext.TorrentFile] = ext
+	}
+	s.watchMu.Unlock()
+
+	found := []ExternalTorrent{}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".torrent") {
+			continue
+		}
+		torrentPath := filepath.Join(s.watchDir, entry.Name())
+
+		// A .torrent replaced in place is reloaded
+		ext, ok := known[torrentPath]
+		if info, err := entry.Info(); ok && err == nil && !info.ModTime().Equal(ext.AddedAt) {
+			ok = false
+		}
+		if !ok {
+			ext, err = loadExternalTorrent(torrentPath)
+			if err != nil {
+				s.logger.Warnf("Skipping %s: %v", torrentPath, err)
+				continue
+			}
+		}
+		// The same torrent dropped in twice is only listed once
+		if seen[ext.InfoHash] {
+			continue
+		}
+		seen[ext.InfoHash] = true
+		found = append(found, ext)
+
+		if !ok {
+			s.logger.Infof("Found external torrent %s (%s)", ext.Name, ext.InfoHash)
+			if s.seeder != nil {
+				if err := s.seeder.seedExternal(ext, s.watchDir); err != nil {
+					s.logger.Warnf("Failed to seed %s: %v", ext.Name, err)
+				}
+			}
+		}
+	}
+
+	for _, ext := range known {
+		if seen[ext.InfoHash] {
+			continue
+		}
+		s.logger.Infof("External torrent %s removed", ext.Name)
+		if s.seeder != nil {
+			s.seeder.drop(ext.InfoHash)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Name < found[j].Name
+	})
+	s.watchMu.Lock()
+	s.external = found
+	s.watchMu.Unlock()
+	return nil
+}
+
+func loadExternalTorrent(torrentPath string) (ExternalTorrent, error) {
+	mi, err := metainfo.LoadFromFile(torrentPath)
+	if err != nil {
+		return ExternalTorrent{}, fmt.Errorf("failed to load torrent: %w", err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return ExternalTorrent{}, fmt.Errorf("failed to decode info: %w", err)
+	}
+
+	var addedAt time.Time
+	if stat, err := os.Stat(torrentPath); err == nil {
+		addedAt = stat.ModTime()
+	}
+
+	return ExternalTorrent{
+		Name:        info.BestName(),
+		Size:        info.TotalLength(),
+		SizeHuman:   formatSize(info.TotalLength()),
+		TorrentFile: torrentPath,
+		AddedAt:     addedAt,
+		InfoHash:    mi.HashInfoBytes().HexString(),
+	}, nil
+}
+
+// externalTorrents returns a snapshot of the watch directory's torrents.
+func (s *Server) externalTorrents() []ExternalTorrent {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	return append([]ExternalTorrent{}, s.external...)
+}
+
+func (s *Server) getExternalTorrents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.externalTorrents())
+}
+
+// getExternalTorrentFile serves a watched .torrent unchanged; its trackers
+// are whatever the admin's torrent names.
+func (s *Server) getExternalTorrentFile(w http.ResponseWriter, r *http.Request) {
+	infoHash := mux.Vars(r)["infohash"]
+
+	for _, ext := range s.externalTorrents() {
+		if ext.InfoHash == infoHash {
+			w.Header().Set("Content-Type", "application/x-bittorrent")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(ext.TorrentFile)))
+			http.ServeFile(w, r, ext.TorrentFile)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
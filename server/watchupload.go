@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Admins can add any torrent to "Other Torrents" over the API instead of
+// copying files into the watch directory: POST /api/torrents takes the
+// .torrent and either its data or the path of the data on the server, and
+// lays them out in the watch directory as a drop-in would be.
+
+// maxTorrentFileSize bounds the .torrent part of an upload.
+const maxTorrentFileSize = 16 << 20
+
+// torrentUpload is an upload being received into a staging directory next
+// to its place in the watch directory.
+type torrentUpload struct {
+	mi      *metainfo.MetaInfo
+	info    metainfo.Info
+	name    string           // torrent name, the data's name in the watch directory
+	files   map[string]int64 // expected length by path, "/" separated; the name for single-file torrents
+	staging string           // holds <name> until the upload is complete
+	link    string           // data already on the server, instead of uploaded files
+}
+
+// dataRoot is where the upload's data is: a file for single-file torrents,
+// otherwise the directory its files are under.
+func (u *torrentUpload) dataRoot() string {
+	if u.link != "" {
+		return u.link
+	}
+	return filepath.Join(u.staging, u.name)
+}
+
+// filePath is where a file of the torrent, "/" separated, is written.
+func (u *torrentUpload) filePath(rel string) string {
+	if len(u.info.Files) == 0 {
+		return u.dataRoot()
+	}
+	return filepath.Join(u.dataRoot(), filepath.FromSlash(rel))
+}
+
+// newTorrentUpload parses the .torrent of an upload and checks it can go
+// into the watch directory.
+func (s *Server) newTorrentUpload(data []byte) (*torrentUpload, error) {
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load torrent: %w", err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode info: %w", err)
+	}
+	name := info.BestName()
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("torrent name %q can't be used as a file name", name)
+	}
+
+	u := &torrentUpload{mi: mi, info: info, name: name, files: make(map[string]int64)}
+	if len(info.Files) == 0 {
+		u.files[name] = info.Length
+	}
+	for _, file := range info.Files {
+		rel := strings.Join(file.BestPath(), "/")
+		if !safeRelPath(rel) {
+			return nil, fmt.Errorf("torrent file path %q is outside the torrent", rel)
+		}
+		u.files[rel] = file.Length
+	}
+	return u, nil
+}
+
+// safeRelPath reports whether a "/" separated path stays inside its parent.
+func safeRelPath(rel string) bool {
+	return rel != "" && !strings.Contains(rel, `\`) && !path.IsAbs(rel) && path.Clean(rel) == rel &&
+		rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// receiveTorrentData writes one uploaded file of the torrent. Its path in the
+// torrent is the part's filename; a single-file torrent's file can have any.
+func (u *torrentUpload) receiveTorrentData(part io.Reader, filename string) error {
+	rel := filename
+	if len(u.info.Files) == 0 {
+		rel = u.name
+	}
+	length, ok := u.files[rel]
+	if !ok {
+		return fmt.Errorf("%q is not a file of the torrent", filename)
+	}
+	dest := u.filePath(rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	// One byte over is enough to tell the file is too long
+	n, err := io.Copy(f, io.LimitReader(part, length+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to receive %s: %w", filename, err)
+	}
+	if n != length {
+		return fmt.Errorf("%s is %d bytes, the torrent expects %d", filename, n, length)
+	}
+	return nil
+}
+
+// checkTorrentData checks every file of the torrent is there with the right
+// length, then re-hashes a few pieces like a newly created torrent.
+func (u *torrentUpload) checkTorrentData(torrentPath string) error {
+	for rel, length := range u.files {
+		stat, err := os.Stat(u.filePath(rel))
+		if err != nil {
+			return fmt.Errorf("%s: missing", rel)
+		}
+		if stat.Size() != length {
+			return fmt.Errorf("%s: size %d, torrent expects %d", rel, stat.Size(), length)
+		}
+	}
+	return validateTorrent(torrentPath, u.dataRoot())
+}
+
+// receiveTorrent serves POST /api/torrents, behind the admin token. The body
+// is multipart/form-data: a "torrent" file part first, then a "path" field
+// naming the data on the server, or a "data" file part for each file of the
+// torrent with its path in the torrent as the filename.
+func (s *Server) receiveTorrent(w http.ResponseWriter, r *http.Request) {
+	if s.watchDir == "" {
+		http.Error(w, "Set watch.dir to add torrents", http.StatusConflict)
+		return
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected multipart/form-data", http.StatusBadRequest)
+		return
+	}
+
+	var upload *torrentUpload
+	var torrentData []byte
+	fail := func(status int, format string, args ...interface{}) {
+		if upload != nil && upload.staging != "" {
+			os.RemoveAll(upload.staging)
+		}
+		http.Error(w, fmt.Sprintf(format, args...), status)
+	}
+	received := false
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fail(http.StatusBadRequest, "Failed to read upload: %v", err)
+			return
+		}
+
+		switch part.FormName() {
+		case "torrent":
+			if upload != nil {
+				fail(http.StatusBadRequest, "Only one torrent can be uploaded at a time")
+				return
+			}
+			torrentData, err = io.ReadAll(io.LimitReader(part, maxTorrentFileSize+1))
+			if err == nil && len(torrentData) > maxTorrentFileSize {
+				err = fmt.Errorf("the .torrent is over %d bytes", maxTorrentFileSize)
+			}
+			if err == nil {
+				upload, err = s.newTorrentUpload(torrentData)
+			}
+			if err != nil {
+				fail(http.StatusBadRequest, "Invalid torrent: %v", err)
+				return
+			}
+			if s.hasInfoHash(upload.mi.HashInfoBytes().HexString()) {
+				fail(http.StatusConflict, "This torrent is already listed")
+				return
+			}
+			for _, existing := range []string{upload.name, upload.name + ".torrent"} {
+				if _, err := os.Lstat(filepath.Join(s.watchDir, existing)); err == nil {
+					fail(http.StatusConflict, "%s already exists in the watch directory", existing)
+					return
+				}
+			}
+			upload.staging, err = os.MkdirTemp(s.watchDir, ".upload-*")
+			if err != nil {
+				s.logger.Errorf("Failed to stage torrent upload: %v", err)
+				fail(http.StatusInternalServerError, "Internal Server Error")
+				return
+			}
+
+		case "path":
+			if upload == nil {
+				fail(http.StatusBadRequest, "Send the torrent part first")
+				return
+			}
+			if received {
+				fail(http.StatusBadRequest, "Send either path or data, not both")
+				return
+			}
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil || !filepath.IsAbs(string(value)) {
+				fail(http.StatusBadRequest, "path must be an absolute path on the server")
+				return
+			}
+			upload.link = filepath.Clean(string(value))
+			received = true
+
+		case "data":
+			if upload == nil {
+				fail(http.StatusBadRequest, "Send the torrent part first")
+				return
+			}
+			if upload.link != "" {
+				fail(http.StatusBadRequest, "Send either path or data, not both")
+				return
+			}
+			// Part.FileName drops directories, which multi-file torrents need
+			_, params, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+			filename := params["filename"]
+			if len(upload.info.Files) > 0 && !safeRelPath(filename) {
+				fail(http.StatusBadRequest, "Invalid file path %q", filename)
+				return
+			}
+			if err := upload.receiveTorrentData(part, filename); err != nil {
+				fail(http.StatusBadRequest, "%v", err)
+				return
+			}
+			received = true
+		}
+	}
+	if upload == nil {
+		fail(http.StatusBadRequest, "No torrent part in the upload")
+		return
+	}
+	if !received {
+		fail(http.StatusBadRequest, "Send the torrent's data, or its path on the server")
+		return
+	}
+
+	torrentPath := filepath.Join(upload.staging, upload.name+".torrent")
+	if err := os.WriteFile(torrentPath, torrentData, 0644); err != nil {
+		s.logger.Errorf("Failed to stage torrent upload: %v", err)
+		fail(http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	if err := upload.checkTorrentData(torrentPath); err != nil {
+		fail(http.StatusBadRequest, "The data doesn't match the torrent: %v", err)
+		return
+	}
+
+	// The data goes in before the .torrent, so a rescan never finds one
+	// without the other
+	dataPath := filepath.Join(s.watchDir, upload.name)
+	if upload.link != "" {
+		err = os.Symlink(upload.link, dataPath)
+	} else {
+		err = os.Rename(upload.dataRoot(), dataPath)
+	}
+	if err == nil {
+		err = os.Rename(torrentPath, dataPath+".torrent")
+	}
+	if err != nil {
+		s.logger.Errorf("Failed to add uploaded torrent %s: %v", upload.name, err)
+		fail(http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	os.RemoveAll(upload.staging)
+
+	if err := s.scanWatchDir(); err != nil {
+		s.logger.Warnf("Failed to scan watch directory: %v", err)
+	}
+	infoHash := upload.mi.HashInfoBytes().HexString()
+	for _, ext := range s.externalTorrents() {
+		if ext.InfoHash == infoHash {
+			s.logger.Infof("Added uploaded torrent %s (%s)", ext.Name, ext.InfoHash)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(ext)
+			return
+		}
+	}
+	http.Error(w, "The torrent was added but couldn't be loaded; see the server log", http.StatusInternalServerError)
+}